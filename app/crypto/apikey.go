@@ -0,0 +1,162 @@
+package crypto
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// APIKeyPrefix - every api key starts with this, so they are easy to recognize, eg. by secret scanners
+const APIKeyPrefix = "hqs_sa_"
+
+// APIKey - a long lived key a service account authenticates with. Only a hash of the key
+// is stored. The prefix is stored in clear text, so keys can be found and told apart.
+type APIKey struct {
+	ID               string    `bson:"id" json:"id"`
+	Prefix           string    `bson:"prefix" json:"prefix"`
+	Hash             string    `bson:"hash" json:"hash"`
+	Name             string    `bson:"name" json:"name"`
+	ServiceAccountID string    `bson:"service_account_id" json:"service_account_id"`
+	LastUsedAt       time.Time `bson:"last_used_at" json:"last_used_at"`
+	CreatedAt        time.Time `bson:"created_at" json:"created_at"`
+}
+
+// generateSecret - returns a random url safe string of n bytes
+func generateSecret(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashSecret - hashes a secret. The secrets are random and long, so a fast hash is enough.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// splitKey - splits a key of the form <kind><prefix>_<secret> into its prefix
+func splitKey(kind string, key string) (string, error) {
+	if !strings.HasPrefix(key, kind) {
+		return "", errors.New("Invalid key")
+	}
+	parts := strings.SplitN(strings.TrimPrefix(key, kind), "_", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", errors.New("Invalid key")
+	}
+	return parts[0], nil
+}
+
+// CreateAPIKey - creates a new api key for a service account. The key is returned once
+// and cannot be recovered afterwards.
+func (srv *TokenService) CreateAPIKey(ctx context.Context, serviceAccountID string, name string) (string, *APIKey, error) {
+	if serviceAccountID == "" {
+		return "", nil, errors.New("Service account id is not valid")
+	}
+	if strings.TrimSpace(name) == "" {
+		return "", nil, errors.New("Required name")
+	}
+
+	prefix := hex.EncodeToString(uuid.NewV4().Bytes()[:4])
+	secret, err := generateSecret(32)
+	if err != nil {
+		return "", nil, err
+	}
+	key := fmt.Sprintf("%s%s_%s", APIKeyPrefix, prefix, secret)
+
+	apiKey := &APIKey{
+		ID:               uuid.NewV4().String(),
+		Prefix:           prefix,
+		Hash:             hashSecret(key),
+		Name:             strings.TrimSpace(name),
+		ServiceAccountID: serviceAccountID,
+		CreatedAt:        time.Now(),
+	}
+
+	if _, err := srv.apiKeyCollection.InsertOne(ctx, apiKey); err != nil {
+		return "", nil, err
+	}
+
+	return key, apiKey, nil
+}
+
+// DecodeAPIKey - finds the api key matching key, and marks it as used
+func (srv *TokenService) DecodeAPIKey(ctx context.Context, key string) (*APIKey, error) {
+	prefix, err := splitKey(APIKeyPrefix, key)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey := APIKey{}
+	if err := srv.apiKeyCollection.FindOne(ctx, bson.M{"prefix": prefix}).Decode(&apiKey); err != nil {
+		return nil, errors.New("Invalid key")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(apiKey.Hash), []byte(hashSecret(key))) != 1 {
+		return nil, errors.New("Invalid key")
+	}
+
+	// update last used
+	updateKey := bson.M{
+		"$set": bson.M{
+			"last_used_at": time.Now(),
+		},
+	}
+	go srv.apiKeyCollection.UpdateOne(
+		context.Background(),
+		bson.M{"id": apiKey.ID},
+		updateKey,
+	)
+
+	return &apiKey, nil
+}
+
+// GetAPIKeys - returns the api keys of a service account
+func (srv *TokenService) GetAPIKeys(ctx context.Context, serviceAccountID string) ([]*APIKey, error) {
+	apiKeys := []*APIKey{}
+
+	cursor, err := srv.apiKeyCollection.Find(ctx, bson.M{"service_account_id": serviceAccountID})
+	if err != nil {
+		return []*APIKey{}, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var tempKey APIKey
+		if err := cursor.Decode(&tempKey); err != nil {
+			return []*APIKey{}, err
+		}
+		apiKeys = append(apiKeys, &tempKey)
+	}
+
+	return apiKeys, cursor.Err()
+}
+
+// RevokeAPIKey - deletes an api key of a service account, so it cannot be used anymore
+func (srv *TokenService) RevokeAPIKey(ctx context.Context, serviceAccountID string, keyID string) error {
+	result, err := srv.apiKeyCollection.DeleteOne(ctx, bson.M{"id": keyID, "service_account_id": serviceAccountID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return errors.New("Api key does not exist")
+	}
+	return nil
+}
+
+// DeleteServiceAccountAPIKeys - deletes every api key of a service account
+func (srv *TokenService) DeleteServiceAccountAPIKeys(ctx context.Context, serviceAccountID string) error {
+	_, err := srv.apiKeyCollection.DeleteMany(ctx, bson.M{"service_account_id": serviceAccountID})
+	return err
+}
@@ -2,10 +2,12 @@ package crypto
 
 import (
 	"context"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -13,6 +15,7 @@ import (
 	"google.golang.org/grpc/metadata"
 
 	uuid "github.com/satori/go.uuid"
+	tenant "github.com/softcorp-io/hqs-user-service/tenant"
 	userProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -59,16 +62,68 @@ func (srv *TokenService) GetSignupTokenTTL() time.Duration {
 
 var resetPasswordTokenTTL time.Duration
 
+var personalAccessTokenMaxTTL time.Duration
+
+// GetPersonalAccessTokenMaxTTL - returns the longest ttl a personal access token can have
+func (srv *TokenService) GetPersonalAccessTokenMaxTTL() time.Duration {
+	return personalAccessTokenMaxTTL
+}
+
 // GetResetPasswordTokenTTL - returns ttl of token
 func (srv *TokenService) GetResetPasswordTokenTTL() time.Duration {
 	return resetPasswordTokenTTL
 }
 
+var impersonationTokenTTL time.Duration
+
+// GetImpersonationTokenTTL - returns ttl of an impersonation token
+func (srv *TokenService) GetImpersonationTokenTTL() time.Duration {
+	return impersonationTokenTTL
+}
+
+var tokenExchangeTTL time.Duration
+
+// GetTokenExchangeTTL - returns the longest ttl of a token created by a token exchange
+func (srv *TokenService) GetTokenExchangeTTL() time.Duration {
+	return tokenExchangeTTL
+}
+
+var groupClaims bool
+
+// GetGroupClaims - returns whether tokens of a user carry the ids of the groups the user is member of
+func (srv *TokenService) GetGroupClaims() bool {
+	return groupClaims
+}
+
+// groupsKey - the context key of the groups put in the claims of a token
+type groupsKey struct{}
+
+// WithGroups - returns a context, which makes the tokens encoded with it carry the group ids.
+func WithGroups(ctx context.Context, groupIDs []string) context.Context {
+	return context.WithValue(ctx, groupsKey{}, groupIDs)
+}
+
+// Issuer - the issuer and first party client id of every token created by the service
+const Issuer = "hqs.user.service"
+
+// serviceClients - client ids and secrets of the hqs services allowed to call service endpoints
+var serviceClients map[string]string
+
 // CustomClaims is our custom metadata, which will be hashed
-// and sent as the second segment in our JWT
+// and sent as the second segment in our JWT. Scopes restricts the token
+// to a subset of the users privileges, no scopes means every privilege.
+// ImpersonatorID is set when the token was issued to another user impersonating User,
+// and Act is set when a service got the token by a token exchange. OrgID is the organization
+// of User, and empty for the root user and users without an organization. Groups are the ids of
+// the groups User is member of, and only set when TOKEN_GROUP_CLAIMS is enabled.
 type CustomClaims struct {
-	User *userProto.User
-	ID   string
+	User           *userProto.User
+	ID             string
+	Scopes         []string `json:"Scopes,omitempty"`
+	ImpersonatorID string   `json:"ImpersonatorID,omitempty"`
+	Act            *Actor   `json:"act,omitempty"`
+	OrgID          string   `json:"org_id,omitempty"`
+	Groups         []string `json:"groups,omitempty"`
 	jwt.StandardClaims
 }
 
@@ -83,22 +138,28 @@ type UserTokenIdentifier struct {
 
 // AuthIdentifier - used to keep track of auth logins
 type AuthIdentifier struct {
-	TokenID    string    `bson:"token_id" json:"token_id"`
-	UserID     string    `bson:"user_id" json:"user_id"`
-	Longitude  float64   `bson:"longitude" json:"longitude"`
-	Latitude   float64   `bson:"latitude" json:"latitude"`
-	Device     string    `bson:"device" json:"device"`
-	TypeOf     string    `bson:"type_of" json:"type_of"`
-	LastUsedAt time.Time `bson:"last_used_at" json:"last_used_at"`
-	ExpiresAt  time.Time `bson:"expires_at" json:"expires_at"`
-	CreatedAt  time.Time `bson:"created_at" json:"created_at"`
+	TokenID        string    `bson:"token_id" json:"token_id"`
+	UserID         string    `bson:"user_id" json:"user_id"`
+	ImpersonatorID string    `bson:"impersonator_id,omitempty" json:"impersonator_id,omitempty"`
+	Longitude      float64   `bson:"longitude" json:"longitude"`
+	Latitude       float64   `bson:"latitude" json:"latitude"`
+	Device         string    `bson:"device" json:"device"`
+	TypeOf         string    `bson:"type_of" json:"type_of"`
+	LastUsedAt     time.Time `bson:"last_used_at" json:"last_used_at"`
+	ExpiresAt      time.Time `bson:"expires_at" json:"expires_at"`
+	CreatedAt      time.Time `bson:"created_at" json:"created_at"`
+	// the location encrypted by the envelope, while the longitude and latitude are left out
+	Encrypted map[string]string `bson:"encrypted,omitempty" json:"-"`
 }
 
 // TokenService - struct used to create tokens
 type TokenService struct {
-	authCollection  *mongo.Collection
-	tokenCollection *mongo.Collection
-	zapLog          *zap.Logger
+	authCollection          *mongo.Collection
+	tokenCollection         *mongo.Collection
+	apiKeyCollection        *mongo.Collection
+	personalTokenCollection *mongo.Collection
+	envelope                *Envelope
+	zapLog                  *zap.Logger
 }
 
 func initCrypto() error {
@@ -160,11 +221,68 @@ func initCrypto() error {
 	}
 	resetPasswordTokenTTL = tempResetPasswordTTLKey
 
+	// get the max ttl of personal access tokens, a year if not set
+	personalAccessTokenMaxTTL = 8760 * time.Hour
+	personalAccessTokenMaxTTLKey, check := os.LookupEnv("PERSONAL_ACCESS_TOKEN_MAX_TTL")
+	if check {
+		tempPersonalAccessTokenMaxTTL, err := time.ParseDuration(personalAccessTokenMaxTTLKey)
+		if err != nil {
+			return err
+		}
+		personalAccessTokenMaxTTL = tempPersonalAccessTokenMaxTTL
+	}
+
+	// get the impersonation token ttl duration, 15 minutes if not set
+	impersonationTokenTTL = 15 * time.Minute
+	impersonationTokenTTLKey, check := os.LookupEnv("IMPERSONATION_TOKEN_TTL")
+	if check {
+		tempImpersonationTokenTTL, err := time.ParseDuration(impersonationTokenTTLKey)
+		if err != nil {
+			return err
+		}
+		impersonationTokenTTL = tempImpersonationTokenTTL
+	}
+
+	// get the ttl of exchanged tokens, 5 minutes if not set
+	tokenExchangeTTL = 5 * time.Minute
+	tokenExchangeTTLKey, check := os.LookupEnv("TOKEN_EXCHANGE_TTL")
+	if check {
+		tempTokenExchangeTTL, err := time.ParseDuration(tokenExchangeTTLKey)
+		if err != nil {
+			return err
+		}
+		tokenExchangeTTL = tempTokenExchangeTTL
+	}
+
+	// get whether tokens carry the groups of the user, disabled if not set
+	groupClaims = false
+	groupClaimsKey, check := os.LookupEnv("TOKEN_GROUP_CLAIMS")
+	if check && groupClaimsKey != "" {
+		tempGroupClaims, err := strconv.ParseBool(groupClaimsKey)
+		if err != nil {
+			return err
+		}
+		groupClaims = tempGroupClaims
+	}
+
+	// get the services allowed to call service endpoints, eg. introspection
+	serviceClients = map[string]string{}
+	serviceClientsKey, check := os.LookupEnv("SERVICE_CLIENTS")
+	if check {
+		for _, client := range strings.Split(serviceClientsKey, ",") {
+			credentials := strings.SplitN(strings.TrimSpace(client), ":", 2)
+			if len(credentials) != 2 || credentials[0] == "" || credentials[1] == "" {
+				return errors.New("Invalid SERVICE_CLIENTS, expected comma separated id:secret pairs")
+			}
+			serviceClients[credentials[0]] = credentials[1]
+		}
+	}
+
 	return nil
 }
 
 // NewTokenService - returns a token service
-func NewTokenService(authCollection *mongo.Collection, tokenCollection *mongo.Collection, zapLog *zap.Logger) (*TokenService, error) {
+func NewTokenService(authCollection *mongo.Collection, tokenCollection *mongo.Collection, apiKeyCollection *mongo.Collection, personalTokenCollection *mongo.Collection, envelope *Envelope, zapLog *zap.Logger) (*TokenService, error) {
 	if err := initCrypto(); err != nil {
 		return nil, err
 	}
@@ -192,7 +310,35 @@ func NewTokenService(authCollection *mongo.Collection, tokenCollection *mongo.Co
 		return nil, err
 	}
 
-	return &TokenService{authCollection, tokenCollection, zapLog}, nil
+	// api keys are looked up by their prefix, which has to be unique
+	apiKeyModel := mongo.IndexModel{
+		Keys:    bson.M{"prefix": 1},
+		Options: options.Index().SetUnique(true),
+	}
+	_, err = apiKeyCollection.Indexes().CreateOne(context.Background(), apiKeyModel)
+	if err != nil {
+		zapLog.Error(fmt.Sprintf("Could not create index with err %v", err))
+		return nil, err
+	}
+
+	// personal access tokens expire like the other tokens and are looked up by their prefix
+	personalTokenModels := []mongo.IndexModel{
+		{
+			Keys:    bson.M{"expires_at": 1},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+		{
+			Keys:    bson.M{"prefix": 1},
+			Options: options.Index().SetUnique(true),
+		},
+	}
+	_, err = personalTokenCollection.Indexes().CreateMany(context.Background(), personalTokenModels)
+	if err != nil {
+		zapLog.Error(fmt.Sprintf("Could not create index with err %v", err))
+		return nil, err
+	}
+
+	return &TokenService{authCollection, tokenCollection, apiKeyCollection, personalTokenCollection, envelope, zapLog}, nil
 }
 
 // MarshalAuthIdentifier - converts userProto.Auth to AuthIdentifier
@@ -240,8 +386,12 @@ func (srv *TokenService) BlockToken(ctx context.Context, tokenID string) error {
 	}
 	// also delete from auth history
 	_, err = srv.authCollection.DeleteOne(ctx, bson.M{"token_id": tokenID})
-
-	return nil
+	if err != nil {
+		return err
+	}
+	// the id might belong to a personal access token
+	_, err = srv.personalTokenCollection.DeleteOne(ctx, bson.M{"id": tokenID})
+	return err
 }
 
 // BlockAllUserToken - block all users tokens.
@@ -253,12 +403,17 @@ func (srv *TokenService) BlockAllUserToken(ctx context.Context, userID string) e
 	}
 	// also delete all users auth history
 	_, err = srv.authCollection.DeleteOne(ctx, bson.M{"user_id": userID})
-
-	return nil
+	if err != nil {
+		return err
+	}
+	// and every personal access token
+	_, err = srv.personalTokenCollection.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
 }
 
-// Decode - decodes a token string into a token object
-func (srv *TokenService) Decode(ctx context.Context, token string, key []byte) (*CustomClaims, error) {
+// parseToken - parses a token string and validates its signature and claims.
+// It does not check if the token is blocked.
+func parseToken(token string, key []byte) (*CustomClaims, error) {
 	// Parse the token
 	tokenType, err := jwt.ParseWithClaims(token, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
 		return key, nil
@@ -273,9 +428,18 @@ func (srv *TokenService) Decode(ctx context.Context, token string, key []byte) (
 	if tokenType.Claims.(*CustomClaims).ID == "" {
 		return nil, errors.New("token does not contain a valid id")
 	}
+	return tokenType.Claims.(*CustomClaims), nil
+}
+
+// Decode - decodes a token string into a token object
+func (srv *TokenService) Decode(ctx context.Context, token string, key []byte) (*CustomClaims, error) {
+	claims, err := parseToken(token, key)
+	if err != nil {
+		return nil, err
+	}
 	// check if token is blocked
 	tokenIdentifier := UserTokenIdentifier{}
-	if err := srv.tokenCollection.FindOne(ctx, bson.M{"token_id": tokenType.Claims.(*CustomClaims).ID}).Decode(&tokenIdentifier); err != nil {
+	if err := srv.tokenCollection.FindOne(ctx, bson.M{"token_id": claims.ID}).Decode(&tokenIdentifier); err != nil {
 		return nil, err
 	}
 	// check if the token is expired and delete if it is
@@ -294,24 +458,132 @@ func (srv *TokenService) Decode(ctx context.Context, token string, key []byte) (
 	}
 	go srv.authCollection.UpdateOne(
 		ctx,
-		bson.M{"token_id": tokenType.Claims.(*CustomClaims).ID},
+		bson.M{"token_id": claims.ID},
 		updateToken,
 	)
 
-	return tokenType.Claims.(*CustomClaims), nil
+	return claims, nil
 }
 
-// Encode - encodes a claim into a JWT
+// DecodeMany - decodes many token strings, looking every token up in a single query.
+// The claims and errors are returned in the same order as the tokens, where each
+// token either has claims or an error.
+func (srv *TokenService) DecodeMany(ctx context.Context, tokens []string, key []byte) ([]*CustomClaims, []error, error) {
+	claims := make([]*CustomClaims, len(tokens))
+	errs := make([]error, len(tokens))
+
+	tokenIDs := []string{}
+	for i, token := range tokens {
+		tokenClaims, err := parseToken(token, key)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		claims[i] = tokenClaims
+		tokenIDs = append(tokenIDs, tokenClaims.ID)
+	}
+
+	if len(tokenIDs) == 0 {
+		return claims, errs, nil
+	}
+
+	// find every token that is not blocked
+	cursor, err := srv.tokenCollection.Find(ctx, bson.M{"token_id": bson.M{"$in": tokenIDs}})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(ctx)
+
+	tokenIdentifiers := map[string]UserTokenIdentifier{}
+	for cursor.Next(ctx) {
+		var tokenIdentifier UserTokenIdentifier
+		if err := cursor.Decode(&tokenIdentifier); err != nil {
+			return nil, nil, err
+		}
+		tokenIdentifiers[tokenIdentifier.TokenID] = tokenIdentifier
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	usedTokenIDs := []string{}
+	for i, tokenClaims := range claims {
+		if tokenClaims == nil {
+			continue
+		}
+		tokenIdentifier, ok := tokenIdentifiers[tokenClaims.ID]
+		if !ok {
+			claims[i] = nil
+			errs[i] = errors.New("token is blocked and cannot be used")
+			continue
+		}
+		if tokenIdentifier.ExpiresAt.Sub(time.Now()).Seconds() <= 0 {
+			claims[i] = nil
+			errs[i] = errors.New("token is expired - please login again")
+			continue
+		}
+		usedTokenIDs = append(usedTokenIDs, tokenClaims.ID)
+	}
+
+	// update auth history
+	if len(usedTokenIDs) > 0 {
+		updateToken := bson.M{
+			"$set": bson.M{
+				"last_used_at": time.Now(),
+			},
+		}
+		go srv.authCollection.UpdateMany(
+			ctx,
+			bson.M{"token_id": bson.M{"$in": usedTokenIDs}},
+			updateToken,
+		)
+	}
+
+	return claims, errs, nil
+}
+
+// Encode - encodes a claim into a JWT. The token belongs to the organization of ctx, see tenant.WithOrganization.
 func (srv *TokenService) Encode(ctx context.Context, user *userProto.User, key []byte, expiresAt time.Duration) (string, string, error) {
+	return srv.EncodeScoped(ctx, user, key, expiresAt, nil, "")
+}
+
+// EncodeScoped - encodes a claim into a JWT, which is restricted to the given scopes and meant for
+// the given audience. An empty audience makes the token meant for the user service itself.
+func (srv *TokenService) EncodeScoped(ctx context.Context, user *userProto.User, key []byte, expiresAt time.Duration, scopes []string, audience string) (string, string, error) {
+	return srv.encode(ctx, &CustomClaims{
+		User:   user,
+		Scopes: scopes,
+		StandardClaims: jwt.StandardClaims{
+			Audience: audience,
+		},
+	}, key, expiresAt)
+}
+
+// EncodeImpersonation - encodes a claim into a JWT, which lets the impersonator act as the user
+func (srv *TokenService) EncodeImpersonation(ctx context.Context, user *userProto.User, impersonatorID string, key []byte, expiresAt time.Duration) (string, string, error) {
+	if impersonatorID == "" {
+		return "", "", errors.New("Missing impersonator")
+	}
+	return srv.encode(ctx, &CustomClaims{
+		User:           user,
+		ImpersonatorID: impersonatorID,
+	}, key, expiresAt)
+}
+
+// encode - gives the claims an id and an expiry, stores the id s.t. the token can be blocked and signs the token
+func (srv *TokenService) encode(ctx context.Context, claims *CustomClaims, key []byte, expiresAt time.Duration) (string, string, error) {
 	// Create the Claims
 	id := uuid.NewV4().String()
-	claims := CustomClaims{
-		user,
-		id,
-		jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(expiresAt).Unix(),
-			Issuer:    "hqs.user.service",
-		},
+	user := claims.User
+	claims.ID = id
+	claims.StandardClaims.ExpiresAt = time.Now().Add(expiresAt).Unix()
+	claims.StandardClaims.IssuedAt = time.Now().Unix()
+	claims.StandardClaims.Issuer = Issuer
+	if claims.OrgID == "" {
+		claims.OrgID, _, _ = tenant.Organization(ctx)
+	}
+	if groupIDs, ok := ctx.Value(groupsKey{}).([]string); ok && claims.Groups == nil {
+		claims.Groups = groupIDs
 	}
 	// add token to redis
 	tokenIdentifier := UserTokenIdentifier{
@@ -335,6 +607,18 @@ func (srv *TokenService) Encode(ctx context.Context, user *userProto.User, key [
 	return returnToken, id, nil
 }
 
+// AuthenticateClient - validates the credentials of a calling hqs service
+func (srv *TokenService) AuthenticateClient(clientID string, clientSecret string) error {
+	secret, ok := serviceClients[clientID]
+	if !ok || clientID == "" {
+		return errors.New("Unknown client")
+	}
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(clientSecret)) != 1 {
+		return errors.New("Invalid client secret")
+	}
+	return nil
+}
+
 // GetAuthHistory - returns a users auth history
 func (srv *TokenService) GetAuthHistory(ctx context.Context, user *userProto.User) ([]*userProto.Auth, error) {
 	authHistory := []*userProto.Auth{}
@@ -343,7 +627,7 @@ func (srv *TokenService) GetAuthHistory(ctx context.Context, user *userProto.Use
 	}
 
 	// Find all documents that includes the user_id
-	cursor, err := srv.authCollection.Find(ctx, bson.M{"user_id": user.Id, "type_of": "login"})
+	cursor, err := srv.authCollection.Find(ctx, bson.M{"user_id": user.Id, "type_of": bson.M{"$in": []string{"login", "personalaccesstoken", "impersonation"}}})
 	if err != nil {
 		return []*userProto.Auth{}, err
 	}
@@ -351,6 +635,9 @@ func (srv *TokenService) GetAuthHistory(ctx context.Context, user *userProto.Use
 	for cursor.Next(context.Background()) {
 		var tempAuth AuthIdentifier
 		cursor.Decode(&tempAuth)
+		if err := srv.decryptAuthHelper(ctx, &tempAuth); err != nil {
+			return []*userProto.Auth{}, err
+		}
 		// check if the auth is still valid - delete it if not
 		expirationTime := tempAuth.ExpiresAt.Sub(time.Now()).Seconds()
 		if expirationTime <= 0 {
@@ -371,15 +658,48 @@ func (srv *TokenService) AddAuthToHistory(ctx context.Context, user *userProto.U
 		break
 	case "resetpassword":
 		break
+	case "impersonation":
+		break
+	case "personalaccesstoken":
+		break
 	default:
 		return errors.New("Not a valid type")
 	}
+	// personal access tokens are not jwt tokens, and have a single auth history point kept alive while used
+	if typeOf == "personalaccesstoken" {
+		personalToken, err := srv.DecodePersonalAccessToken(ctx, token)
+		if err != nil {
+			return err
+		}
+		if personalToken.UserID != user.Id {
+			return errors.New("Token does not belong to the user")
+		}
+		return srv.recordPersonalAccessTokenUse(ctx, personalToken)
+	}
 	// decode the token
 	claims, err := srv.Decode(ctx, token, key)
 	if err != nil {
 		return err
 	}
 
+	// create new token history point
+	auth := srv.newAuthIdentifier(ctx, user.Id, claims.ID, typeOf)
+	auth.ImpersonatorID = claims.ImpersonatorID
+	if err := srv.encryptAuthHelper(ctx, auth); err != nil {
+		return err
+	}
+
+	// send the auth attempt to the database
+	_, err = srv.authCollection.InsertOne(ctx, auth)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// newAuthIdentifier - creates an auth history point, with location and device taken from the context
+func (srv *TokenService) newAuthIdentifier(ctx context.Context, userID string, tokenID string, typeOf string) *AuthIdentifier {
 	// get longitude & latitude from context
 	latitude := 0.0
 	longitude := 0.0
@@ -416,24 +736,66 @@ func (srv *TokenService) AddAuthToHistory(ctx context.Context, user *userProto.U
 	}
 
 	// create new token history point
-	auth := &AuthIdentifier{
+	return &AuthIdentifier{
 		Longitude:  longitude,
 		Latitude:   latitude,
-		TokenID:    claims.ID,
+		TokenID:    tokenID,
 		Device:     deviceInformation,
 		TypeOf:     typeOf,
 		CreatedAt:  time.Now(),
 		ExpiresAt:  time.Now().Add(authHistoryTTL),
 		LastUsedAt: time.Now(),
-		UserID:     user.Id,
+		UserID:     userID,
 	}
+}
 
-	// send the auth attempt to the database
-	_, err = srv.authCollection.InsertOne(ctx, auth)
+// EncryptsField - reports whether the field is stored encrypted
+func (srv *TokenService) EncryptsField(field string) bool {
+	return srv.envelope.Encrypts(field)
+}
+
+// encryptAuthHelper - moves the location of an auth history point to Encrypted, if geo is encrypted
+func (srv *TokenService) encryptAuthHelper(ctx context.Context, auth *AuthIdentifier) error {
+	if !srv.envelope.Encrypts("geo") {
+		return nil
+	}
+	location := strconv.FormatFloat(auth.Latitude, 'g', -1, 64) + "," + strconv.FormatFloat(auth.Longitude, 'g', -1, 64)
+	ciphertext, err := srv.envelope.Encrypt(ctx, auth.UserID, "geo", location)
 	if err != nil {
 		return err
 	}
+	auth.Encrypted = map[string]string{"geo": ciphertext}
+	auth.Latitude = 0
+	auth.Longitude = 0
+	return nil
+}
 
+// decryptAuthHelper - restores the location of an auth history point, which is encrypted. The location
+// stays empty if its data key was destroyed.
+func (srv *TokenService) decryptAuthHelper(ctx context.Context, auth *AuthIdentifier) error {
+	ciphertext, ok := auth.Encrypted["geo"]
+	if !ok {
+		return nil
+	}
+	location, err := srv.envelope.Decrypt(ctx, auth.UserID, "geo", ciphertext)
+	if err == ErrDataKeyDestroyed {
+		auth.Encrypted = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	coordinates := strings.SplitN(location, ",", 2)
+	if len(coordinates) != 2 {
+		return errors.New("Invalid location of auth history")
+	}
+	if auth.Latitude, err = strconv.ParseFloat(coordinates[0], 64); err != nil {
+		return err
+	}
+	if auth.Longitude, err = strconv.ParseFloat(coordinates[1], 64); err != nil {
+		return err
+	}
+	auth.Encrypted = nil
 	return nil
 }
 
@@ -446,6 +808,30 @@ func (srv *TokenService) DeleteUserAuthHistory(ctx context.Context, user *userPr
 	return nil
 }
 
+// GetUserTokenHistory - returns the tokens of a user, which are still stored, ie. the sessions of the user
+func (srv *TokenService) GetUserTokenHistory(ctx context.Context, user *userProto.User) ([]*UserTokenIdentifier, error) {
+	tokens := []*UserTokenIdentifier{}
+	if user.Id == "" {
+		return []*UserTokenIdentifier{}, errors.New("User id is not valid")
+	}
+
+	cursor, err := srv.tokenCollection.Find(ctx, bson.M{"user_id": user.Id})
+	if err != nil {
+		return []*UserTokenIdentifier{}, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var tempToken UserTokenIdentifier
+		if err := cursor.Decode(&tempToken); err != nil {
+			return []*UserTokenIdentifier{}, err
+		}
+		tokens = append(tokens, &tempToken)
+	}
+
+	return tokens, cursor.Err()
+}
+
 // DeleteUserTokenHistory - deletes all the auth history of a user
 func (srv *TokenService) DeleteUserTokenHistory(ctx context.Context, user *userProto.User) error {
 	_, err := srv.tokenCollection.DeleteMany(ctx, bson.M{"user_id": user.Id})
@@ -0,0 +1,463 @@
+package crypto
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// EncryptableFields - the fields ENCRYPTED_FIELDS can name. geo is the location of an auth history point.
+var EncryptableFields = []string{"name", "email", "phone", "birthday", "description", "geo"}
+
+// defaultEncryptedFields - the fields encrypted when ENCRYPTED_FIELDS is not set. Names and emails are
+// opt-in, as encrypted names and emails cannot be sorted by or searched by a prefix.
+var defaultEncryptedFields = []string{"phone", "birthday", "description", "geo"}
+
+// blindIndexContext - derives the key of the blind indexes from the master key, s.t. the master key itself
+// never hashes values, which are stored
+const blindIndexContext = "hqs-user-service blind index"
+
+// dataKeyCacheTTL - how long the data key of a user is cached. Other instances of the service can use a
+// destroyed key this long.
+const dataKeyCacheTTL = time.Minute
+
+// duplicateKeyCode - the code of the write error mongo returns when a unique index is violated
+const duplicateKeyCode = 11000
+
+// ErrDataKeyDestroyed - returned when a value is decrypted, whose data key was destroyed, ie. whose user
+// was erased.
+var ErrDataKeyDestroyed = errors.New("The data key was destroyed")
+
+// DataKey - a key fields are encrypted with. Only the key wrapped by the master key is stored. Every user
+// has a data key of his/her own, s.t. destroying it makes the data of the user unreadable everywhere, eg.
+// in backups. Keys without a user were shared by every user, and are only used to decrypt old values.
+type DataKey struct {
+	ID         string    `bson:"id" json:"id"`
+	UserID     string    `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	WrappedKey []byte    `bson:"wrapped_key" json:"wrapped_key"`
+	CreatedAt  time.Time `bson:"created_at" json:"created_at"`
+}
+
+// cachedKey - an unwrapped data key, and when it was read
+type cachedKey struct {
+	aead     cipher.AEAD
+	userID   string
+	cachedAt time.Time
+}
+
+// Envelope - encrypts the configured fields of a user with the data key of the user, which is wrapped by a
+// master key read from a local file. Every value names the key it was encrypted with. A nil envelope
+// encrypts nothing.
+type Envelope struct {
+	master        cipher.AEAD
+	indexKey      []byte
+	fields        map[string]bool
+	keyCollection *mongo.Collection
+	mu            sync.RWMutex
+	keys          map[string]*cachedKey
+	userKeys      map[string]string
+}
+
+// NewEnvelope - returns an envelope with the master key in ENCRYPTION_MASTER_KEY_FILE, which encrypts the
+// fields in ENCRYPTED_FIELDS with the data keys in keyCollection. Without ENCRYPTION_MASTER_KEY_FILE every
+// field is stored in clear text, and nil is returned.
+func NewEnvelope(keyCollection *mongo.Collection, zapLog *zap.Logger) (*Envelope, error) {
+	masterKeyFile, ok := os.LookupEnv("ENCRYPTION_MASTER_KEY_FILE")
+	if !ok || masterKeyFile == "" {
+		zapLog.Warn("No ENCRYPTION_MASTER_KEY_FILE - fields are stored in clear text")
+		return nil, nil
+	}
+	masterKey, err := readMasterKey(masterKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	master, err := newAEAD(masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// get the encrypted fields, the default fields if not set
+	fields := map[string]bool{}
+	names := defaultEncryptedFields
+	if fieldsKey, ok := os.LookupEnv("ENCRYPTED_FIELDS"); ok {
+		names = strings.Split(fieldsKey, ",")
+	}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !containsString(EncryptableFields, name) {
+			return nil, fmt.Errorf("Invalid ENCRYPTED_FIELDS, cannot encrypt %s", name)
+		}
+		fields[name] = true
+	}
+
+	mac := hmac.New(sha256.New, masterKey)
+	mac.Write([]byte(blindIndexContext))
+
+	envelope := &Envelope{
+		master:        master,
+		indexKey:      mac.Sum(nil),
+		fields:        fields,
+		keyCollection: keyCollection,
+		keys:          map[string]*cachedKey{},
+		userKeys:      map[string]string{},
+	}
+
+	// keys are found by their id, and every user has a single key
+	keyModels := []mongo.IndexModel{
+		{
+			Keys:    bson.M{"id": 1},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.M{"user_id": 1},
+			Options: options.Index().SetUnique(true).SetSparse(true),
+		},
+	}
+	if _, err := keyCollection.Indexes().CreateMany(context.Background(), keyModels); err != nil {
+		zapLog.Error(fmt.Sprintf("Could not create index with err %v", err))
+		return nil, err
+	}
+
+	// check that the keys were wrapped by the master key, s.t. a wrong master key fails right away
+	dataKey := DataKey{}
+	err = keyCollection.FindOne(context.Background(), bson.M{}).Decode(&dataKey)
+	if err == mongo.ErrNoDocuments {
+		return envelope, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := envelope.unwrapHelper(&dataKey); err != nil {
+		return nil, err
+	}
+
+	return envelope, nil
+}
+
+// readMasterKey - reads a base64 encoded 32 byte key from a file
+func readMasterKey(path string) ([]byte, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("Invalid master key, expected 32 base64 encoded bytes")
+	}
+	return key, nil
+}
+
+// newAEAD - returns AES-256-GCM with key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal - encrypts plaintext with a random nonce, which is put in front of the ciphertext
+func seal(aead cipher.AEAD, plaintext []byte, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open - decrypts a ciphertext made by seal
+func open(aead cipher.AEAD, ciphertext []byte, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("Invalid ciphertext")
+	}
+	return aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], additionalData)
+}
+
+// containsString - reports whether value is one of values
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// duplicateKeyHelper - reports whether err is a violation of a unique index
+func duplicateKeyHelper(err error) bool {
+	var writeErr mongo.WriteException
+	if !errors.As(err, &writeErr) {
+		return false
+	}
+	for _, e := range writeErr.WriteErrors {
+		if e.Code == duplicateKeyCode {
+			return true
+		}
+	}
+	return false
+}
+
+// createDataKey - creates the data key of a user and wraps it with the master key. When another instance
+// created the key meanwhile, that key is returned.
+func (e *Envelope) createDataKey(ctx context.Context, userID string) (string, cipher.AEAD, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", nil, err
+	}
+
+	dataKey := &DataKey{
+		ID:        uuid.NewV4().String(),
+		UserID:    userID,
+		CreatedAt: time.Now(),
+	}
+	// the id is authenticated with the key, s.t. wrapped keys cannot be swapped
+	if dataKey.WrappedKey, err = seal(e.master, key, []byte(dataKey.ID)); err != nil {
+		return "", nil, err
+	}
+	if _, err := e.keyCollection.InsertOne(ctx, dataKey); err != nil {
+		if duplicateKeyHelper(err) {
+			return e.findUserKeyHelper(ctx, userID)
+		}
+		return "", nil, err
+	}
+
+	e.cacheHelper(dataKey, aead)
+	return dataKey.ID, aead, nil
+}
+
+// cacheHelper - caches an unwrapped data key
+func (e *Envelope) cacheHelper(dataKey *DataKey, aead cipher.AEAD) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.keys[dataKey.ID] = &cachedKey{aead, dataKey.UserID, time.Now()}
+	if dataKey.UserID != "" {
+		e.userKeys[dataKey.UserID] = dataKey.ID
+	}
+}
+
+// evictHelper - removes a data key from the cache
+func (e *Envelope) evictHelper(id string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if cached, ok := e.keys[id]; ok && e.userKeys[cached.userID] == id {
+		delete(e.userKeys, cached.userID)
+	}
+	delete(e.keys, id)
+}
+
+// unwrapHelper - unwraps a data key with the master key and caches it
+func (e *Envelope) unwrapHelper(dataKey *DataKey) (cipher.AEAD, error) {
+	key, err := open(e.master, dataKey.WrappedKey, []byte(dataKey.ID))
+	if err != nil {
+		return nil, fmt.Errorf("Could not unwrap data key %s, was it wrapped by another master key?", dataKey.ID)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	e.cacheHelper(dataKey, aead)
+	return aead, nil
+}
+
+// dataKeyHelper - returns the data key with id and the user it belongs to, from the cache or the key
+// collection. The keys of users are read again when they have been cached for dataKeyCacheTTL, s.t.
+// destroyed keys stop working.
+func (e *Envelope) dataKeyHelper(ctx context.Context, id string) (cipher.AEAD, string, error) {
+	e.mu.RLock()
+	cached, ok := e.keys[id]
+	e.mu.RUnlock()
+	if ok && (cached.userID == "" || time.Since(cached.cachedAt) < dataKeyCacheTTL) {
+		return cached.aead, cached.userID, nil
+	}
+
+	dataKey := DataKey{}
+	err := e.keyCollection.FindOne(ctx, bson.M{"id": id}).Decode(&dataKey)
+	if err == mongo.ErrNoDocuments {
+		e.evictHelper(id)
+		return nil, "", ErrDataKeyDestroyed
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("Could not find data key %s with err %v", id, err)
+	}
+	aead, err := e.unwrapHelper(&dataKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return aead, dataKey.UserID, nil
+}
+
+// findUserKeyHelper - returns the data key of a user from the key collection, or a new key if the user has none
+func (e *Envelope) findUserKeyHelper(ctx context.Context, userID string) (string, cipher.AEAD, error) {
+	dataKey := DataKey{}
+	err := e.keyCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&dataKey)
+	if err == mongo.ErrNoDocuments {
+		return e.createDataKey(ctx, userID)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	aead, err := e.unwrapHelper(&dataKey)
+	if err != nil {
+		return "", nil, err
+	}
+	return dataKey.ID, aead, nil
+}
+
+// userKeyHelper - returns the id and the data key of a user, which is created the first time it is needed
+func (e *Envelope) userKeyHelper(ctx context.Context, userID string) (string, cipher.AEAD, error) {
+	e.mu.RLock()
+	id, ok := e.userKeys[userID]
+	e.mu.RUnlock()
+	if ok {
+		aead, _, err := e.dataKeyHelper(ctx, id)
+		if err == nil {
+			return id, aead, nil
+		}
+		if err != ErrDataKeyDestroyed {
+			return "", nil, err
+		}
+	}
+	return e.findUserKeyHelper(ctx, userID)
+}
+
+// DestroyUserKey - destroys the data key of a user, which makes every value encrypted with it unreadable.
+// Returns the id of the destroyed key, or an empty id if the user had no key.
+func (e *Envelope) DestroyUserKey(ctx context.Context, userID string) (string, error) {
+	if e == nil || userID == "" {
+		return "", nil
+	}
+
+	dataKey := DataKey{}
+	err := e.keyCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&dataKey)
+	if err == mongo.ErrNoDocuments {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, err := e.keyCollection.DeleteOne(ctx, bson.M{"id": dataKey.ID}); err != nil {
+		return "", err
+	}
+
+	e.evictHelper(dataKey.ID)
+	return dataKey.ID, nil
+}
+
+// Encrypts - reports whether the field is encrypted
+func (e *Envelope) Encrypts(field string) bool {
+	return e != nil && e.fields[field]
+}
+
+// additionalDataHelper - returns the data authenticated with the value of a field of a user
+func additionalDataHelper(userID string, field string) []byte {
+	return []byte(userID + ":" + field)
+}
+
+// Encrypt - encrypts the value of a field of a user with the data key of the user. The user and the field
+// are authenticated with the value, s.t. the value cannot be moved to another user or field.
+func (e *Envelope) Encrypt(ctx context.Context, userID string, field string, value string) (string, error) {
+	if e == nil {
+		return "", errors.New("Encryption is not configured")
+	}
+	if userID == "" {
+		return "", fmt.Errorf("Cannot encrypt %s without a user", field)
+	}
+
+	id, aead, err := e.userKeyHelper(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(aead, []byte(value), additionalDataHelper(userID, field))
+	if err != nil {
+		return "", err
+	}
+	return id + ":" + base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt - decrypts the value of a field of the user with userID encrypted by Encrypt, with the data key
+// it was encrypted with. ErrDataKeyDestroyed is returned when the key was destroyed. Values encrypted with
+// a shared key before users had keys of their own only authenticate the field.
+func (e *Envelope) Decrypt(ctx context.Context, userID string, field string, value string) (string, error) {
+	if e == nil {
+		return "", fmt.Errorf("Cannot decrypt %s without ENCRYPTION_MASTER_KEY_FILE", field)
+	}
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("Invalid ciphertext of %s", field)
+	}
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("Invalid ciphertext of %s", field)
+	}
+
+	aead, owner, err := e.dataKeyHelper(ctx, parts[0])
+	if err != nil {
+		return "", err
+	}
+	additionalData := []byte(field)
+	if owner != "" {
+		if owner != userID {
+			return "", fmt.Errorf("Could not decrypt %s, which was encrypted for another user", field)
+		}
+		additionalData = additionalDataHelper(userID, field)
+	}
+	plaintext, err := open(aead, ciphertext, additionalData)
+	if err != nil {
+		return "", fmt.Errorf("Could not decrypt %s", field)
+	}
+	return string(plaintext), nil
+}
+
+// Shared - reports whether value was encrypted with a key shared by every user, before users had keys of
+// their own. Such values are not shredded by DestroyUserKey, until they are encrypted again.
+func (e *Envelope) Shared(ctx context.Context, value string) (bool, error) {
+	if e == nil {
+		return false, nil
+	}
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return false, errors.New("Invalid ciphertext")
+	}
+	_, owner, err := e.dataKeyHelper(ctx, parts[0])
+	if err != nil {
+		return false, err
+	}
+	return owner == "", nil
+}
+
+// BlindIndex - returns a keyed hash of value, which finds equal values without storing them in clear
+// text. A nil envelope returns an empty index.
+func (e *Envelope) BlindIndex(value string) string {
+	if e == nil {
+		return ""
+	}
+	mac := hmac.New(sha256.New, e.indexKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,85 @@
+package crypto
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// TokenTypeJWT - the RFC 8693 token type of every token the service issues
+const TokenTypeJWT = "urn:ietf:params:oauth:token-type:jwt"
+
+// Actor - the act claim of RFC 8693 section 4.1. Subject is the client id of the service acting
+// on behalf of the user, and Act is the previous actor when an exchanged token is exchanged again.
+type Actor struct {
+	Subject string `json:"sub"`
+	Act     *Actor `json:"act,omitempty"`
+}
+
+// ExchangeToken - exchanges the decoded subject token of a user for a token the authenticated client
+// can use on behalf of the user, following RFC 8693. The new token is meant for audience, can only
+// narrow the scopes of the subject token and never lives longer than the subject token or the token
+// exchange ttl. No scopes keeps the scopes of the subject token.
+func (srv *TokenService) ExchangeToken(ctx context.Context, subject *CustomClaims, clientID string, audience string, scopes []string, key []byte) (string, *CustomClaims, error) {
+	if audience == "" {
+		return "", nil, errors.New("Missing audience")
+	}
+
+	if subject.User == nil || subject.User.Id == "" {
+		return "", nil, errors.New("Invalid user")
+	}
+	// a token meant for another service cannot be re-targeted by the client
+	if subject.Audience != "" && subject.Audience != clientID {
+		return "", nil, errors.New("Subject token is not meant for the client")
+	}
+	// an impersonator cannot get a token which hides the impersonation
+	if subject.ImpersonatorID != "" {
+		return "", nil, errors.New("Impersonation tokens cannot be exchanged")
+	}
+
+	if len(scopes) == 0 {
+		scopes = subject.Scopes
+	} else if len(subject.Scopes) > 0 {
+		for _, scope := range scopes {
+			if !containsScope(subject.Scopes, scope) {
+				return "", nil, errors.New("Requested scopes are not part of the subject token")
+			}
+		}
+	}
+
+	expiresAt := tokenExchangeTTL
+	if remaining := time.Until(time.Unix(subject.ExpiresAt, 0)); remaining < expiresAt {
+		expiresAt = remaining
+	}
+	if expiresAt <= 0 {
+		return "", nil, errors.New("token is expired - please login again")
+	}
+
+	claims := &CustomClaims{
+		User:   subject.User,
+		Scopes: scopes,
+		Act:    &Actor{Subject: clientID, Act: subject.Act},
+		OrgID:  subject.OrgID,
+		Groups: subject.Groups,
+		StandardClaims: jwt.StandardClaims{
+			Audience: audience,
+		},
+	}
+	token, _, err := srv.encode(ctx, claims, key, expiresAt)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, claims, nil
+}
+
+// containsScope - reports whether scope is one of scopes
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
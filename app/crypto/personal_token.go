@@ -0,0 +1,188 @@
+package crypto
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PersonalAccessTokenPrefix - every personal access token starts with this, which tells them apart from JWT tokens
+const PersonalAccessTokenPrefix = "hqs_pat_"
+
+// PersonalAccessToken - a named token a user can script with. Like api keys only a hash
+// is stored, and the token can only use the privileges named in Scopes.
+type PersonalAccessToken struct {
+	ID         string    `bson:"id" json:"id"`
+	Prefix     string    `bson:"prefix" json:"prefix"`
+	Hash       string    `bson:"hash" json:"hash"`
+	Name       string    `bson:"name" json:"name"`
+	UserID     string    `bson:"user_id" json:"user_id"`
+	Scopes     []string  `bson:"scopes" json:"scopes"`
+	LastUsedAt time.Time `bson:"last_used_at" json:"last_used_at"`
+	ExpiresAt  time.Time `bson:"expires_at" json:"expires_at"`
+	CreatedAt  time.Time `bson:"created_at" json:"created_at"`
+}
+
+// IsPersonalAccessToken - reports whether token looks like a personal access token
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// CreatePersonalAccessToken - creates a personal access token for a user. The token is returned
+// once and cannot be recovered afterwards.
+func (srv *TokenService) CreatePersonalAccessToken(ctx context.Context, userID string, name string, scopes []string, expiresAt time.Duration) (string, *PersonalAccessToken, error) {
+	if userID == "" {
+		return "", nil, errors.New("User id is not valid")
+	}
+	if strings.TrimSpace(name) == "" {
+		return "", nil, errors.New("Required name")
+	}
+	if len(scopes) == 0 {
+		return "", nil, errors.New("A personal access token requires at least one scope")
+	}
+	if expiresAt <= 0 || expiresAt > personalAccessTokenMaxTTL {
+		return "", nil, fmt.Errorf("A personal access token has to expire within %s", personalAccessTokenMaxTTL)
+	}
+
+	prefix := hex.EncodeToString(uuid.NewV4().Bytes()[:4])
+	secret, err := generateSecret(32)
+	if err != nil {
+		return "", nil, err
+	}
+	token := fmt.Sprintf("%s%s_%s", PersonalAccessTokenPrefix, prefix, secret)
+
+	personalToken := &PersonalAccessToken{
+		ID:        uuid.NewV4().String(),
+		Prefix:    prefix,
+		Hash:      hashSecret(token),
+		Name:      strings.TrimSpace(name),
+		UserID:    userID,
+		Scopes:    scopes,
+		ExpiresAt: time.Now().Add(expiresAt),
+		CreatedAt: time.Now(),
+	}
+
+	if _, err := srv.personalTokenCollection.InsertOne(ctx, personalToken); err != nil {
+		return "", nil, err
+	}
+
+	return token, personalToken, nil
+}
+
+// DecodePersonalAccessToken - finds the personal access token matching token. Its usage is recorded
+// with AddAuthToHistory.
+func (srv *TokenService) DecodePersonalAccessToken(ctx context.Context, token string) (*PersonalAccessToken, error) {
+	prefix, err := splitKey(PersonalAccessTokenPrefix, token)
+	if err != nil {
+		return nil, err
+	}
+
+	personalToken := PersonalAccessToken{}
+	if err := srv.personalTokenCollection.FindOne(ctx, bson.M{"prefix": prefix}).Decode(&personalToken); err != nil {
+		return nil, errors.New("Invalid token")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(personalToken.Hash), []byte(hashSecret(token))) != 1 {
+		return nil, errors.New("Invalid token")
+	}
+
+	// mongo removes expired tokens eventually, until then we check ourselves
+	if personalToken.ExpiresAt.Sub(time.Now()).Seconds() <= 0 {
+		return nil, errors.New("token is expired - please create a new one")
+	}
+
+	return &personalToken, nil
+}
+
+// recordPersonalAccessTokenUse - updates when the token was last used, and adds the use to the auth history.
+// The token has a single auth history point, which is kept alive as long as the token is used.
+func (srv *TokenService) recordPersonalAccessTokenUse(ctx context.Context, personalToken *PersonalAccessToken) error {
+	_, err := srv.personalTokenCollection.UpdateOne(
+		ctx,
+		bson.M{"id": personalToken.ID},
+		bson.M{"$set": bson.M{"last_used_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+
+	auth := srv.newAuthIdentifier(ctx, personalToken.UserID, personalToken.ID, "personalaccesstoken")
+	if err := srv.encryptAuthHelper(ctx, auth); err != nil {
+		return err
+	}
+	updateAuth := bson.M{
+		"$set": bson.M{
+			"longitude":    auth.Longitude,
+			"latitude":     auth.Latitude,
+			"device":       auth.Device,
+			"last_used_at": auth.LastUsedAt,
+			"expires_at":   auth.ExpiresAt,
+		},
+		"$setOnInsert": bson.M{
+			"token_id":   auth.TokenID,
+			"user_id":    auth.UserID,
+			"type_of":    auth.TypeOf,
+			"created_at": auth.CreatedAt,
+		},
+	}
+	if auth.Encrypted != nil {
+		updateAuth["$set"].(bson.M)["encrypted"] = auth.Encrypted
+	} else {
+		updateAuth["$unset"] = bson.M{"encrypted": ""}
+	}
+	_, err = srv.authCollection.UpdateOne(
+		ctx,
+		bson.M{"token_id": personalToken.ID},
+		updateAuth,
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// GetPersonalAccessTokens - returns the personal access tokens of a user
+func (srv *TokenService) GetPersonalAccessTokens(ctx context.Context, userID string) ([]*PersonalAccessToken, error) {
+	personalTokens := []*PersonalAccessToken{}
+
+	cursor, err := srv.personalTokenCollection.Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return []*PersonalAccessToken{}, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var tempToken PersonalAccessToken
+		if err := cursor.Decode(&tempToken); err != nil {
+			return []*PersonalAccessToken{}, err
+		}
+		personalTokens = append(personalTokens, &tempToken)
+	}
+
+	return personalTokens, cursor.Err()
+}
+
+// RevokePersonalAccessToken - deletes a personal access token of a user and its auth history
+func (srv *TokenService) RevokePersonalAccessToken(ctx context.Context, userID string, tokenID string) error {
+	result, err := srv.personalTokenCollection.DeleteOne(ctx, bson.M{"id": tokenID, "user_id": userID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return errors.New("Personal access token does not exist")
+	}
+	_, err = srv.authCollection.DeleteOne(ctx, bson.M{"token_id": tokenID})
+	return err
+}
+
+// DeleteUserPersonalAccessTokens - deletes every personal access token of a user
+func (srv *TokenService) DeleteUserPersonalAccessTokens(ctx context.Context, userID string) error {
+	_, err := srv.personalTokenCollection.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
@@ -0,0 +1,355 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	uuid "github.com/satori/go.uuid"
+	repository "github.com/softcorp-io/hqs-user-service/repository"
+	tenant "github.com/softcorp-io/hqs-user-service/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// defaultAuditPageSize - the page size of GetAuditLog when the request has no limit
+const defaultAuditPageSize = 50
+
+// maxAuditPageSize - the largest page GetAuditLog returns
+const maxAuditPageSize = 500
+
+// auditAppendAttempts - how many times an entry is tried appended to the audit log
+const auditAppendAttempts = 3
+
+// auditAppendBackoff - how long to wait after the first failed append, which grows with every attempt
+const auditAppendBackoff = 100 * time.Millisecond
+
+// redactedAuditValue - the value written to the audit log for a personal field of a user
+const redactedAuditValue = "[redacted]"
+
+// auditUserPersonalFields - the personal fields of a user, which are only logged by their name, s.t.
+// erasing the user leaves no personal data in the audit log
+var auditUserPersonalFields = map[string]bool{
+	"name":         true,
+	"email":        true,
+	"phone":        true,
+	"country_code": true,
+	"dial_code":    true,
+	"gender":       true,
+	"image":        true,
+	"description":  true,
+	"title":        true,
+	"birthday":     true,
+	"password":     true,
+	"encrypted":    true,
+	"email_index":  true,
+	"phone_index":  true,
+	"name_index":   true,
+}
+
+// actorKey - the context key of the user making a request
+type actorKey struct{}
+
+// auditActor - the user making a request, and the user impersonating him/her if any
+type auditActor struct {
+	id             string
+	impersonatorID string
+}
+
+// withActor - returns a context, which makes the audit log record the user with id as the actor
+func withActor(ctx context.Context, id string, impersonatorID string) context.Context {
+	return context.WithValue(ctx, actorKey{}, auditActor{id, impersonatorID})
+}
+
+// auditHelper - appends a mutating operation on the target with id targetID to the audit log. before
+// and after are the target before and after the operation, and either is nil when the target is
+// created or deleted. The actor is the caller found when the context was made; operations without a
+// caller, eg. made by the background jobs, have no actor. Appending is tried auditAppendAttempts times,
+// and the error is returned, s.t. an operation missing in the audit log is not reported as done.
+func (s *Handler) auditHelper(ctx context.Context, action string, targetID string, before interface{}, after interface{}) error {
+	entry := &repository.AuditEntry{
+		Action:   action,
+		TargetID: targetID,
+	}
+
+	if actor, ok := ctx.Value(actorKey{}).(auditActor); ok {
+		entry.ActorID = actor.id
+		entry.ImpersonatorID = actor.impersonatorID
+	}
+
+	// the entry belongs to the organization of the target, so its admins can see it
+	entry.OrgID = auditOrganizationHelper(ctx, before, after)
+
+	changedBefore, changedAfter, err := repository.AuditDiff(before, after)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not diff %s of %s for the audit log with err %v", action, targetID, err))
+	}
+	// the audit log tells which personal fields of a user changed, but not their values
+	_, beforeUser := before.(*repository.User)
+	_, afterUser := after.(*repository.User)
+	if beforeUser || afterUser {
+		redactAuditHelper(changedBefore)
+		redactAuditHelper(changedAfter)
+	}
+	entry.Before = changedBefore
+	entry.After = changedAfter
+
+	if meta, ok := metadata.FromIncomingContext(ctx); ok {
+		if requestID := meta["x-request-id"]; len(requestID) > 0 {
+			entry.RequestID = requestID[0]
+		}
+	}
+	if entry.RequestID == "" {
+		entry.RequestID = uuid.NewV4().String()
+	}
+	entry.IP = s.auditIPHelper(ctx)
+
+	for attempt := 1; ; attempt++ {
+		err = s.audit.Append(ctx, entry)
+		if err == nil {
+			return nil
+		}
+		s.zapLog.Error(fmt.Sprintf("Could not append %s of %s to the audit log in attempt %d with err %v", action, targetID, attempt, err))
+		if attempt == auditAppendAttempts {
+			return fmt.Errorf("Could not write %s to the audit log", action)
+		}
+		time.Sleep(time.Duration(attempt) * auditAppendBackoff)
+	}
+}
+
+// auditIPHelper - returns the ip of the client of a request. Any client can send x-forwarded-for, so
+// it is only used when the request comes from one of AUDIT_TRUSTED_PROXIES. The client is then the
+// last forwarded address, which is not a trusted proxy.
+func (s *Handler) auditIPHelper(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	proxies, err := trustedProxiesHelper()
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get trusted proxies with err %v", err))
+		return p.Addr.String()
+	}
+	peerIP := p.Addr.String()
+	if host, _, err := net.SplitHostPort(peerIP); err == nil {
+		peerIP = host
+	}
+	meta, ok := metadata.FromIncomingContext(ctx)
+	if !ok || !trustedProxyHelper(proxies, peerIP) {
+		return p.Addr.String()
+	}
+
+	forwarded := []string{}
+	for _, header := range meta["x-forwarded-for"] {
+		for _, address := range strings.Split(header, ",") {
+			forwarded = append(forwarded, strings.TrimSpace(address))
+		}
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		if !trustedProxyHelper(proxies, forwarded[i]) {
+			return forwarded[i]
+		}
+	}
+	if len(forwarded) > 0 {
+		return forwarded[0]
+	}
+	return p.Addr.String()
+}
+
+// trustedProxiesHelper - returns the networks of the proxies in AUDIT_TRUSTED_PROXIES, whose
+// x-forwarded-for is trusted, eg. "10.0.0.0/8,192.168.1.10"
+func trustedProxiesHelper() ([]*net.IPNet, error) {
+	proxies := []*net.IPNet{}
+	trustedProxies, ok := os.LookupEnv("AUDIT_TRUSTED_PROXIES")
+	if !ok {
+		return proxies, nil
+	}
+	for _, proxy := range strings.Split(trustedProxies, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("Invalid AUDIT_TRUSTED_PROXIES, %s is not an ip", proxy)
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid AUDIT_TRUSTED_PROXIES with err %v", err)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// trustedProxyHelper - reports whether address is the ip of one of proxies
+func trustedProxyHelper(proxies []*net.IPNet, address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range proxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactAuditHelper - replaces the values of the personal fields of a user with redactedAuditValue
+func redactAuditHelper(fields bson.M) {
+	for field := range fields {
+		if auditUserPersonalFields[field] {
+			fields[field] = redactedAuditValue
+		}
+	}
+}
+
+// auditOrganizationHelper - returns the organization of the target of an operation, or the organization
+// of the context if the target has none
+func auditOrganizationHelper(ctx context.Context, targets ...interface{}) string {
+	for _, target := range targets {
+		switch t := target.(type) {
+		case *repository.User:
+			if t != nil {
+				return t.OrgID
+			}
+		case *repository.Group:
+			if t != nil {
+				return t.OrgID
+			}
+		case *repository.Organization:
+			if t != nil {
+				return t.ID
+			}
+		case *erasureCertificate:
+			if t != nil {
+				return t.OrgID
+			}
+		case *dataExport:
+			if t != nil {
+				return t.OrgID
+			}
+		}
+	}
+	organizationID, _, _ := tenant.Organization(ctx)
+	return organizationID
+}
+
+// GetAuditLog - returns a page of the audit log of the organization of the caller, newest first.
+// Requires view_audit_log.
+func (s *Handler) GetAuditLog(ctx context.Context, req *AuditLogRequest) (*AuditLogResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, _, err := s.validateTokenHelper(ctx, "GetAuditLog")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &AuditLogResponse{}, err
+	}
+
+	query := &repository.AuditQuery{
+		ActorID:  req.ActorId,
+		TargetID: req.TargetId,
+		Action:   req.Action,
+		Offset:   req.Offset,
+		Limit:    req.Limit,
+	}
+	if query.Offset < 0 {
+		query.Offset = 0
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultAuditPageSize
+	}
+	if query.Limit > maxAuditPageSize {
+		query.Limit = maxAuditPageSize
+	}
+	if req.From != nil {
+		if query.From, err = ptypes.Timestamp(req.From); err != nil {
+			s.zapLog.Error(fmt.Sprintf("Could not parse from with err %v", err))
+			return &AuditLogResponse{}, err
+		}
+	}
+	if req.To != nil {
+		if query.To, err = ptypes.Timestamp(req.To); err != nil {
+			s.zapLog.Error(fmt.Sprintf("Could not parse to with err %v", err))
+			return &AuditLogResponse{}, err
+		}
+	}
+
+	entries, total, err := s.audit.List(ctx, query)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get audit log with err %v", err))
+		return &AuditLogResponse{}, err
+	}
+
+	res := &AuditLogResponse{Entries: []*AuditEntry{}, Total: total}
+	for _, entry := range entries {
+		res.Entries = append(res.Entries, marshalAuditEntry(entry))
+	}
+	return res, nil
+}
+
+// marshalAuditEntry - converts an entry of the audit log to an AuditEntry, with the changed fields as json
+func marshalAuditEntry(entry *repository.AuditEntry) *AuditEntry {
+	createdAt, _ := ptypes.TimestampProto(entry.CreatedAt)
+	return &AuditEntry{
+		Id:             entry.ID,
+		Sequence:       entry.Sequence,
+		PrevHash:       entry.PrevHash,
+		Hash:           entry.Hash,
+		ActorId:        entry.ActorID,
+		ImpersonatorId: entry.ImpersonatorID,
+		TargetId:       entry.TargetID,
+		Action:         entry.Action,
+		Before:         auditJSONHelper(entry.Before),
+		After:          auditJSONHelper(entry.After),
+		RequestId:      entry.RequestID,
+		Ip:             entry.IP,
+		CreatedAt:      createdAt,
+	}
+}
+
+// auditJSONHelper - returns the fields as relaxed extended json, or an empty string if there are none
+func auditJSONHelper(fields bson.M) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	raw, err := bson.MarshalExtJSON(fields, false, false)
+	if err != nil {
+		return ""
+	}
+	return string(raw)
+}
+
+// auditUserHelper - appends a change of the user with id userID to the audit log. before is the user
+// read before the change, and the user after the change is read back, s.t. the entry also holds the
+// fields the repository set, eg. updated_at.
+func (s *Handler) auditUserHelper(ctx context.Context, action string, userID string, before *repository.User) error {
+	after, err := s.repository.Get(ctx, &repository.User{ID: userID})
+	if err != nil {
+		// a deleted user is only found with GetDeleted
+		if after, err = s.repository.GetDeleted(ctx, &repository.User{ID: userID}); err != nil {
+			after = nil
+		}
+	}
+	return s.auditHelper(ctx, action, userID, before, after)
+}
+
+// copyUserHelper - returns a copy of user, s.t. the user can be changed after it was read as before
+func copyUserHelper(user *repository.User) *repository.User {
+	if user == nil {
+		return nil
+	}
+	copied := *user
+	return &copied
+}
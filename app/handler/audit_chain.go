@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+
+	repository "github.com/softcorp-io/hqs-user-service/repository"
+	tenant "github.com/softcorp-io/hqs-user-service/tenant"
+	userProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+)
+
+// errChainBroken - stops the walk of the audit log at the first broken link
+var errChainBroken = errors.New("The audit log is broken")
+
+// auditCheckpointKeyHelper - returns the ed25519 private key checkpoints of the audit log are signed with,
+// made from the base64 encoded seed in AUDIT_CHECKPOINT_SIGNING_KEY
+func auditCheckpointKeyHelper() (ed25519.PrivateKey, error) {
+	key, ok := os.LookupEnv("AUDIT_CHECKPOINT_SIGNING_KEY")
+	if !ok || key == "" {
+		return nil, errors.New("Required AUDIT_CHECKPOINT_SIGNING_KEY")
+	}
+	seed, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("Invalid AUDIT_CHECKPOINT_SIGNING_KEY, expected a base64 encoded %d byte seed", ed25519.SeedSize)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// auditCheckpointPublicKeyHelper - returns the ed25519 public key checkpoints of the audit log are verified
+// with. It is the base64 encoded AUDIT_CHECKPOINT_PUBLIC_KEY, or the public key of the signing key if not set,
+// s.t. the audit log can be verified without the signing key.
+func auditCheckpointPublicKeyHelper() (ed25519.PublicKey, error) {
+	key, ok := os.LookupEnv("AUDIT_CHECKPOINT_PUBLIC_KEY")
+	if !ok || key == "" {
+		privateKey, err := auditCheckpointKeyHelper()
+		if err != nil {
+			return nil, err
+		}
+		return privateKey.Public().(ed25519.PublicKey), nil
+	}
+	publicKey, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("Invalid AUDIT_CHECKPOINT_PUBLIC_KEY, expected a base64 encoded %d byte key", ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(publicKey), nil
+}
+
+// checkpointMessageHelper - returns what is signed for the checkpoint at the entry with sequence and hash
+func checkpointMessageHelper(sequence int64, hash string) []byte {
+	return []byte(fmt.Sprintf("%d:%s", sequence, hash))
+}
+
+// signCheckpointHelper - returns the hex ed25519 signature of the hash of the entry with sequence
+func signCheckpointHelper(key ed25519.PrivateKey, sequence int64, hash string) string {
+	return hex.EncodeToString(ed25519.Sign(key, checkpointMessageHelper(sequence, hash)))
+}
+
+// verifyCheckpointHelper - reports whether the checkpoint is signed by the private key of key
+func verifyCheckpointHelper(key ed25519.PublicKey, checkpoint *repository.AuditCheckpoint) bool {
+	signature, err := hex.DecodeString(checkpoint.Signature)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(key, checkpointMessageHelper(checkpoint.Sequence, checkpoint.Hash), signature)
+}
+
+// VerifyAuditLog - walks the whole chain of the audit log and reports the first broken link, ie. an
+// entry, which was changed, removed or inserted, or a checkpoint, which no longer matches. Only the root
+// user can verify the audit log, as it holds the entries of every organization.
+func (s *Handler) VerifyAuditLog(ctx context.Context, req *userProto.Request) (*VerifyAuditLogResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, _, err := s.validateTokenHelper(ctx, "VerifyAuditLog")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &VerifyAuditLogResponse{}, err
+	}
+
+	res, _, err := s.verifyAuditHelper(ctx, 1)
+	if err != nil {
+		return &VerifyAuditLogResponse{}, err
+	}
+
+	if !res.Valid {
+		s.zapLog.Warn(fmt.Sprintf("The audit log is broken at entry %d: %s", res.BrokenSequence, res.Reason))
+	}
+	return res, nil
+}
+
+// CheckpointAuditLog - signs a checkpoint at the last entry of the audit log, once the entries since the
+// last checkpoint are verified. Returns nil if there are no entries since the last checkpoint. Run by the
+// checkpoint job of the server.
+func (s *Handler) CheckpointAuditLog(ctx context.Context) (*repository.AuditCheckpoint, error) {
+	key, err := auditCheckpointKeyHelper()
+	if err != nil {
+		s.zapLog.Error(err.Error())
+		return nil, err
+	}
+
+	// the chain holds the entries of every organization
+	ctx = tenant.WithAllOrganizations(ctx)
+
+	checkpoints, err := s.audit.GetCheckpoints(ctx)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get audit checkpoints with err %v", err))
+		return nil, err
+	}
+
+	// only the entries since the last checkpoint need to be verified
+	from := int64(1)
+	if len(checkpoints) > 0 {
+		from = checkpoints[len(checkpoints)-1].Sequence
+	}
+
+	res, last, err := s.verifyAuditHelper(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	if !res.Valid {
+		s.zapLog.Error(fmt.Sprintf("Refused to checkpoint the audit log, which is broken at entry %d: %s", res.BrokenSequence, res.Reason))
+		return nil, errChainBroken
+	}
+	if last == nil || last.Sequence == from && len(checkpoints) > 0 {
+		return nil, nil
+	}
+
+	checkpoint := &repository.AuditCheckpoint{
+		Sequence:  last.Sequence,
+		Hash:      last.Hash,
+		Signature: signCheckpointHelper(key, last.Sequence, last.Hash),
+	}
+	if err := s.audit.AddCheckpoint(ctx, checkpoint); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not add audit checkpoint with err %v", err))
+		return nil, err
+	}
+
+	return checkpoint, nil
+}
+
+// verifyAuditHelper - walks the chain of the audit log from the entry with sequence from, which is the
+// first entry or the entry of a checkpoint, and returns the first broken link and the last entry walked.
+// ctx must see every organization.
+func (s *Handler) verifyAuditHelper(ctx context.Context, from int64) (*VerifyAuditLogResponse, *repository.AuditEntry, error) {
+	key, err := auditCheckpointPublicKeyHelper()
+	if err != nil {
+		s.zapLog.Error(err.Error())
+		return nil, nil, err
+	}
+
+	checkpoints, err := s.audit.GetCheckpoints(ctx)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get audit checkpoints with err %v", err))
+		return nil, nil, err
+	}
+
+	res := &VerifyAuditLogResponse{Valid: true}
+	broken := func(sequence int64, entryID string, reason string) {
+		res.Valid = false
+		res.BrokenSequence = sequence
+		res.BrokenEntryId = entryID
+		res.Reason = reason
+	}
+
+	// a checkpoint must be signed with the signing key, before it can vouch for an entry
+	signed := map[int64]*repository.AuditCheckpoint{}
+	for _, checkpoint := range checkpoints {
+		if !verifyCheckpointHelper(key, checkpoint) {
+			broken(checkpoint.Sequence, "", fmt.Sprintf("The signature of the checkpoint at entry %d is invalid", checkpoint.Sequence))
+			return res, nil, nil
+		}
+		signed[checkpoint.Sequence] = checkpoint
+	}
+
+	var last *repository.AuditEntry
+	expected := from
+	err = s.audit.Walk(ctx, from, func(entry *repository.AuditEntry) error {
+		if entry.Sequence != expected {
+			broken(expected, "", fmt.Sprintf("Entry %d is missing", expected))
+			return errChainBroken
+		}
+		// the entry before the first entry walked is vouched for by the checkpoint of the first entry
+		if last != nil || from == 1 {
+			prevHash := ""
+			if last != nil {
+				prevHash = last.Hash
+			}
+			if entry.PrevHash != prevHash {
+				broken(entry.Sequence, entry.ID, fmt.Sprintf("Entry %d does not hold the hash of the entry before it", entry.Sequence))
+				return errChainBroken
+			}
+		}
+		hash, err := entry.ComputeHash()
+		if err != nil {
+			return err
+		}
+		if hash != entry.Hash {
+			broken(entry.Sequence, entry.ID, fmt.Sprintf("Entry %d was changed", entry.Sequence))
+			return errChainBroken
+		}
+		if checkpoint, ok := signed[entry.Sequence]; ok {
+			if checkpoint.Hash != entry.Hash {
+				broken(entry.Sequence, entry.ID, fmt.Sprintf("Entry %d does not match its checkpoint", entry.Sequence))
+				return errChainBroken
+			}
+			res.Checkpoints++
+		}
+
+		res.Entries++
+		last = entry
+		expected++
+		return nil
+	})
+	if err != nil && err != errChainBroken {
+		s.zapLog.Error(fmt.Sprintf("Could not walk the audit log with err %v", err))
+		return nil, nil, err
+	}
+	if !res.Valid {
+		return res, last, nil
+	}
+
+	// entries cut off the end of the chain are found by the checkpoints after the last entry
+	for _, checkpoint := range checkpoints {
+		if checkpoint.Sequence >= expected {
+			broken(expected, "", fmt.Sprintf("Entries from %d to the checkpoint at entry %d were removed", expected, checkpoint.Sequence))
+			break
+		}
+	}
+
+	return res, last, nil
+}
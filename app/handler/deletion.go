@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	repository "github.com/softcorp-io/hqs-user-service/repository"
+	tenant "github.com/softcorp-io/hqs-user-service/tenant"
+	userProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+)
+
+// defaultDeletionGracePeriod - how long deleted users can be restored, if USER_DELETION_GRACE_PERIOD is not set
+const defaultDeletionGracePeriod = 30 * 24 * time.Hour
+
+// deletionGracePeriodHelper - returns how long deleted users can be restored before they are purged
+func deletionGracePeriodHelper() (time.Duration, error) {
+	gracePeriod, ok := os.LookupEnv("USER_DELETION_GRACE_PERIOD")
+	if !ok {
+		return defaultDeletionGracePeriod, nil
+	}
+	duration, err := time.ParseDuration(gracePeriod)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid USER_DELETION_GRACE_PERIOD with err %v", err)
+	}
+	return duration, nil
+}
+
+// RestoreUser - restores a deleted user together with the service accounts deleted with the user.
+// Users can only be restored until the grace period is over.
+func (s *Handler) RestoreUser(ctx context.Context, req *userProto.User) (*userProto.Response, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, caller, err := s.sensitiveActionHelper(ctx, "RestoreUser")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &userProto.Response{}, err
+	}
+
+	deletedUser, err := s.repository.GetDeleted(ctx, &repository.User{ID: req.Id})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get deletedUser with err  %v", err))
+		return &userProto.Response{}, errors.New("No deleted user with that id")
+	}
+
+	gracePeriod, err := deletionGracePeriodHelper()
+	if err != nil {
+		s.zapLog.Error(err.Error())
+		return &userProto.Response{}, err
+	}
+	if time.Since(*deletedUser.DeletedAt) > gracePeriod {
+		s.zapLog.Error(fmt.Sprintf("Tried to restore user %s after the grace period", deletedUser.ID))
+		return &userProto.Response{}, errors.New("The grace period of the user is over")
+	}
+
+	// check that the policy lets the user restore the other user
+	if err := s.policyHelper(ctx, caller, "RestoreUser", deletedUser, nil); err != nil {
+		return &userProto.Response{}, err
+	}
+
+	before := copyUserHelper(deletedUser)
+	if err := s.repository.Restore(ctx, deletedUser, caller.user.Id); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not restore user with err %v", err))
+		return &userProto.Response{}, err
+	}
+	if err := s.auditUserHelper(ctx, "RestoreUser", deletedUser.ID, before); err != nil {
+		return &userProto.Response{}, err
+	}
+	deletedUser.DeletedAt = nil
+	deletedUser.DeletedBy = ""
+
+	// the reports of an active user have a manager again
+	if deletedUser.Active() {
+		if err := s.repository.FlagReports(ctx, deletedUser, false); err != nil {
+			s.zapLog.Error(fmt.Sprintf("Could not unflag orphaned reports with err %v", err))
+		}
+	}
+
+	// return result
+	res := &userProto.Response{}
+	deletedUser.Password = ""
+	res.User = repository.UnmarshalUser(deletedUser)
+	return res, nil
+}
+
+// PurgeDeletedUsers - deletes the users whose grace period is over for good, with their history, tokens,
+// api keys, groups and images. Returns how many users were purged. Run by the purge job of the server.
+func (s *Handler) PurgeDeletedUsers(ctx context.Context) (int, error) {
+	gracePeriod, err := deletionGracePeriodHelper()
+	if err != nil {
+		s.zapLog.Error(err.Error())
+		return 0, err
+	}
+
+	// the job purges users of every organization
+	ctx = tenant.WithAllOrganizations(ctx)
+
+	users, err := s.repository.GetPurgeable(ctx, time.Now().Add(-gracePeriod))
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get purgeable users with err %v", err))
+		return 0, err
+	}
+
+	// a purge missing in the audit log is returned after the other users are purged
+	purged := 0
+	var auditErr error
+	for _, user := range users {
+		if _, err := s.purgeHelper(ctx, user); err != nil {
+			s.zapLog.Error(fmt.Sprintf("Could not purge user %s with err %v", user.ID, err))
+			continue
+		}
+		if err := s.auditHelper(ctx, "PurgeDeletedUsers", user.ID, user, nil); err != nil {
+			auditErr = err
+		}
+		purged++
+	}
+
+	return purged, auditErr
+}
+
+// purgeHelper - deletes a user and everything belonging to the user for good. The data key of the user is
+// destroyed first, s.t. the encrypted fields of the user cannot be read from backups either. Returns the
+// id of the destroyed key, which is empty if the user had no key.
+func (s *Handler) purgeHelper(ctx context.Context, user *repository.User) (string, error) {
+	keyID, err := s.repository.DestroyDataKey(ctx, user)
+	if err != nil {
+		return "", err
+	}
+
+	// delete the exports of the user
+	exports, err := s.storage.List(exportUserPrefixHelper(user.ID))
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not list users exports with err %v", err))
+	}
+	for exportPath := range exports {
+		_ = s.deleteExportHelper(exportPath)
+	}
+
+	if user.ServiceAccount {
+		// api keys of a service account are deleted with it
+		if err := s.crypto.DeleteServiceAccountAPIKeys(ctx, user.ID); err != nil {
+			s.zapLog.Error(fmt.Sprintf("Could not delete service account api keys with err %v", err))
+		}
+		return keyID, s.repository.Delete(ctx, user)
+	}
+
+	// also delete users auth history
+	if err := s.crypto.DeleteUserAuthHistory(ctx, repository.UnmarshalUser(user)); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not delete users auth history from crypto with err %v", err))
+	}
+
+	// same with token history
+	if err := s.crypto.DeleteUserTokenHistory(ctx, repository.UnmarshalUser(user)); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not delete users auth history from crypto with err %v", err))
+	}
+
+	// same with personal access tokens
+	if err := s.crypto.DeleteUserPersonalAccessTokens(ctx, user.ID); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not delete users personal access tokens with err %v", err))
+	}
+
+	// the user leaves every group
+	if err := s.groups.RemoveMemberFromAll(ctx, user.ID); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not remove user from groups with err %v", err))
+	}
+
+	// delete users profile image, unless the user has the shared default image. A failing storage does
+	// not keep the user from being deleted.
+	if !strings.Contains(user.Image, "shared") {
+		for _, imagePath := range []string{user.Image, "hqs/users/" + user.ID + "/profileImage", "hqs/users/" + user.ID} {
+			if err := s.storage.Delete(imagePath); err != nil {
+				s.zapLog.Error(fmt.Sprintf("Could not delete %s from storage with err %v", imagePath, err))
+			}
+		}
+	}
+
+	return keyID, s.repository.Delete(ctx, user)
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	crypto "github.com/softcorp-io/hqs-user-service/crypto"
+	repository "github.com/softcorp-io/hqs-user-service/repository"
+	tenant "github.com/softcorp-io/hqs-user-service/tenant"
+)
+
+// erasureCertificate - written to the audit log when a user is erased. It proves which data key was
+// destroyed, and so which encrypted fields of the user cannot be read anymore, also not from backups.
+type erasureCertificate struct {
+	UserID   string    `bson:"user_id"`
+	OrgID    string    `bson:"org_id"`
+	KeyID    string    `bson:"key_id,omitempty"`
+	Fields   []string  `bson:"fields"`
+	Reason   string    `bson:"reason,omitempty"`
+	ErasedBy string    `bson:"erased_by"`
+	ErasedAt time.Time `bson:"erased_at"`
+}
+
+// EraseUser - erases a user right away, active or deleted, eg. on a request under the right to erasure.
+// The data key of the user is destroyed before the user and everything belonging to the user is deleted,
+// s.t. the encrypted fields of the user cannot be read from backups either. An erasure certificate is
+// written to the audit log. Requires erase_user.
+func (s *Handler) EraseUser(ctx context.Context, req *EraseUserRequest) (*EraseUserResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, caller, err := s.sensitiveActionHelper(ctx, "EraseUser")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &EraseUserResponse{}, err
+	}
+
+	// deleted users can be erased before their grace period is over
+	eraseUser, err := s.repository.Get(ctx, &repository.User{ID: req.Id})
+	if err != nil {
+		eraseUser, err = s.repository.GetDeleted(ctx, &repository.User{ID: req.Id})
+	}
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get eraseUser with err  %v", err))
+		return &EraseUserResponse{}, errors.New("No user with that id")
+	}
+
+	// the root user cannot be erased
+	if eraseUser.Admin {
+		s.zapLog.Error("Tried to erase root user")
+		return &EraseUserResponse{}, errors.New("Root user is not erasable")
+	}
+
+	// check that the policy lets the user erase the other user
+	if err := s.policyHelper(ctx, caller, "EraseUser", eraseUser, nil); err != nil {
+		return &EraseUserResponse{}, err
+	}
+
+	keyID, err := s.purgeHelper(ctx, eraseUser)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not erase user %s with err %v", eraseUser.ID, err))
+		return &EraseUserResponse{}, err
+	}
+
+	// the fields, which were encrypted with the destroyed key
+	fields := []string{}
+	if keyID != "" {
+		for _, field := range crypto.EncryptableFields {
+			if s.crypto.EncryptsField(field) {
+				fields = append(fields, field)
+			}
+		}
+	}
+
+	certificate := &erasureCertificate{
+		UserID:   eraseUser.ID,
+		OrgID:    eraseUser.OrgID,
+		KeyID:    keyID,
+		Fields:   fields,
+		Reason:   req.Reason,
+		ErasedBy: caller.user.Id,
+		ErasedAt: time.Now(),
+	}
+	auditErr := s.auditHelper(ctx, "EraseUser", eraseUser.ID, nil, certificate)
+
+	// the tokens of the user stop working right away
+	if err := s.crypto.BlockAllUserToken(ctx, eraseUser.ID); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not block users tokens with err %v", err))
+	}
+
+	// the reports of the user have no manager anymore
+	if eraseUser.DeletedAt == nil {
+		if err := s.repository.FlagReports(ctx, eraseUser, true); err != nil {
+			s.zapLog.Error(fmt.Sprintf("Could not flag orphaned reports with err %v", err))
+		}
+	}
+
+	// the user is erased, so the certificate is logged, s.t. it can be written to the audit log by hand
+	if auditErr != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not write the erasure certificate %+v to the audit log", *certificate))
+		return &EraseUserResponse{}, auditErr
+	}
+
+	// return result
+	res := &EraseUserResponse{
+		UserId: eraseUser.ID,
+		KeyId:  keyID,
+		Fields: fields,
+		Reason: req.Reason,
+	}
+	res.ErasedAt, _ = ptypes.TimestampProto(certificate.ErasedAt)
+	return res, nil
+}
+
+// MigrateEncryption - encrypts the fields of users, which were encrypted with a shared key or stored in
+// clear text, again with the data keys of the users, s.t. erasing a user shreds every field of the user.
+// Returns how many users were migrated. Run by the server when it starts.
+func (s *Handler) MigrateEncryption(ctx context.Context) (int, error) {
+	// the migration covers users of every organization
+	ctx = tenant.WithAllOrganizations(ctx)
+
+	migrated, err := s.repository.MigrateEncryption(ctx)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not migrate the encryption of users with err %v", err))
+		return migrated, err
+	}
+	return migrated, nil
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	crypto "github.com/softcorp-io/hqs-user-service/crypto"
+	repository "github.com/softcorp-io/hqs-user-service/repository"
+	tenant "github.com/softcorp-io/hqs-user-service/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// grantTypeTokenExchange - the grant type of RFC 8693 token exchange requests
+const grantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// ExchangeToken - lets an hqs service exchange the token of a user for a token it can use to call
+// another service on behalf of the user, following RFC 8693. The calling service authenticates with its
+// client_id and client_secret in the context metadata, and becomes the act claim of the new token.
+func (s *Handler) ExchangeToken(ctx context.Context, req *TokenExchangeRequest) (*TokenExchangeResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	if req.GrantType != grantTypeTokenExchange {
+		s.zapLog.Error(fmt.Sprintf("Unsupported grant type %s", req.GrantType))
+		return &TokenExchangeResponse{}, errors.New("Unsupported grant type")
+	}
+
+	if req.SubjectTokenType != crypto.TokenTypeJWT {
+		s.zapLog.Error(fmt.Sprintf("Unsupported subject token type %s", req.SubjectTokenType))
+		return &TokenExchangeResponse{}, errors.New("Unsupported subject token type")
+	}
+
+	scopes := strings.Fields(req.Scope)
+	for _, scope := range scopes {
+		if !validScope(scope) {
+			s.zapLog.Error(fmt.Sprintf("Invalid scope %s", scope))
+			return &TokenExchangeResponse{}, fmt.Errorf("Invalid scope %s", scope)
+		}
+	}
+
+	// the client is authenticated before the subject token is looked at
+	clientID, err := s.authenticatedClientHelper(ctx)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate client with err %v", err))
+		return &TokenExchangeResponse{}, err
+	}
+
+	// a blocked or deleted user cannot be acted for, so the user is checked before a token is issued
+	subject, err := s.crypto.Decode(ctx, req.SubjectToken, s.crypto.GetUserCryptoKey())
+	if err != nil || subject.User == nil {
+		s.zapLog.Error(fmt.Sprintf("Could not decode subject token with err %v", err))
+		return &TokenExchangeResponse{}, errors.New("Invalid subject token")
+	}
+	ctx = tenant.WithOrganization(ctx, subject.OrgID)
+	user, err := s.repository.Get(ctx, repository.MarshalUser(subject.User))
+	if err != nil || user.Blocked || activeHelper(user) != nil {
+		s.zapLog.Error("Tried to exchange token of a blocked or deleted user")
+		return &TokenExchangeResponse{}, errors.New("User cannot be acted for")
+	}
+
+	token, claims, err := s.crypto.ExchangeToken(ctx, subject, clientID, req.Audience, scopes, s.crypto.GetUserCryptoKey())
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not exchange token with err %v", err))
+		return &TokenExchangeResponse{}, err
+	}
+
+	s.zapLog.Info(fmt.Sprintf("Service %s exchanged a token of user %s for audience %s", clientID, user.ID, req.Audience))
+	if err := s.auditHelper(ctx, "ExchangeToken", user.ID, nil, bson.M{"token_id": claims.ID, "client_id": clientID, "audience": req.Audience, "scopes": claims.Scopes}); err != nil {
+		return &TokenExchangeResponse{}, err
+	}
+
+	// return result
+	res := &TokenExchangeResponse{}
+	res.AccessToken = token
+	res.IssuedTokenType = crypto.TokenTypeJWT
+	res.TokenType = "Bearer"
+	res.ExpiresIn = claims.ExpiresAt - time.Now().Unix()
+	res.Scope = strings.Join(claims.Scopes, " ")
+	return res, nil
+}
@@ -0,0 +1,360 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	uuid "github.com/satori/go.uuid"
+	crypto "github.com/softcorp-io/hqs-user-service/crypto"
+	repository "github.com/softcorp-io/hqs-user-service/repository"
+	userProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+)
+
+// defaultExportURLTTL - how long the url of an export works, if DATA_EXPORT_URL_TTL is not set
+const defaultExportURLTTL = time.Hour
+
+// exportChunkSize - the size of the chunks a streamed export is sent in
+const exportChunkSize = 64 << 10
+
+// exportFormats - the formats of an export, and the content type each is stored with
+var exportFormats = map[string]string{
+	"zip":  "application/zip",
+	"json": "application/json",
+}
+
+// exportPrefix - where the exports of every user are stored
+const exportPrefix = "hqs/exports/"
+
+// exportImage - a stored image of a user. Data is base64 encoded in the json format.
+type exportImage struct {
+	Path string `json:"path"`
+	Data []byte `json:"data"`
+}
+
+// exportBundle - everything stored about a user. The user is the record of the user without the password.
+type exportBundle struct {
+	User                 map[string]interface{}        `json:"user"`
+	AuthHistory          []*userProto.Auth             `json:"auth_history"`
+	Sessions             []*crypto.UserTokenIdentifier `json:"sessions"`
+	PersonalAccessTokens []*crypto.PersonalAccessToken `json:"personal_access_tokens"`
+	AuditLog             []*AuditEntry                 `json:"audit_log"`
+	Images               []*exportImage                `json:"images"`
+}
+
+// dataExport - written to the audit log when the data of a user is exported
+type dataExport struct {
+	UserID   string `bson:"user_id"`
+	OrgID    string `bson:"org_id"`
+	Format   string `bson:"format"`
+	Delivery string `bson:"delivery"`
+}
+
+// exportURLTTLHelper - returns how long the url of an export works
+func exportURLTTLHelper() (time.Duration, error) {
+	ttl, ok := os.LookupEnv("DATA_EXPORT_URL_TTL")
+	if !ok {
+		return defaultExportURLTTL, nil
+	}
+	duration, err := time.ParseDuration(ttl)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid DATA_EXPORT_URL_TTL with err %v", err)
+	}
+	return duration, nil
+}
+
+// exportUserPrefixHelper - returns where the exports of a user are stored
+func exportUserPrefixHelper(userID string) string {
+	return exportPrefix + userID + "/"
+}
+
+// exportPathHelper - returns where an export of a user in format is stored. Every export has a path of its
+// own, s.t. deleting an expired export never deletes a newer one.
+func exportPathHelper(userID string, exportID string, format string) string {
+	return exportUserPrefixHelper(userID) + exportID + "." + format
+}
+
+// deleteExportHelper - deletes an export from the storage, and logs if it could not
+func (s *Handler) deleteExportHelper(exportPath string) error {
+	if err := s.storage.Delete(exportPath); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not delete export %s with err %v", exportPath, err))
+		return err
+	}
+	return nil
+}
+
+// DeleteExpiredExports - deletes the exports, whose url has expired, from the storage. Exports are deleted
+// when their url expires, so this only finds exports, whose instance of the service stopped meanwhile.
+// Returns how many exports were deleted. Run by the purge job of the server.
+func (s *Handler) DeleteExpiredExports(ctx context.Context) (int, error) {
+	ttl, err := exportURLTTLHelper()
+	if err != nil {
+		s.zapLog.Error(err.Error())
+		return 0, err
+	}
+
+	exports, err := s.storage.List(exportPrefix)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not list exports with err %v", err))
+		return 0, err
+	}
+
+	deleted := 0
+	for exportPath, uploadedAt := range exports {
+		if time.Since(uploadedAt) < ttl {
+			continue
+		}
+		if err := s.deleteExportHelper(exportPath); err != nil {
+			continue
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// ExportMyData - exports everything stored about the caller, eg. to answer a subject access request.
+// The bundle holds the user without the password, the auth history, the sessions, the personal access
+// tokens without their hashes, the audit entries about the user and the profile image.
+func (s *Handler) ExportMyData(req *ExportDataRequest, stream ExportDataServer) error {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, caller, err := s.sensitiveActionHelper(stream.Context(), "ExportMyData")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return err
+	}
+
+	user, err := s.repository.Get(ctx, &repository.User{ID: caller.user.Id})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get user with err %v", err))
+		return err
+	}
+
+	return s.exportHelper(ctx, "ExportMyData", user, req, stream)
+}
+
+// ExportUserData - like ExportMyData, but exports the user with the id of the request. Requires
+// export_user_data.
+func (s *Handler) ExportUserData(req *ExportDataRequest, stream ExportDataServer) error {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, caller, err := s.sensitiveActionHelper(stream.Context(), "ExportUserData")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return err
+	}
+
+	user, err := s.repository.Get(ctx, &repository.User{ID: req.Id})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get user with err %v", err))
+		return err
+	}
+
+	// the root user cannot be exported
+	if user.Admin {
+		s.zapLog.Error("Tried to export root user")
+		return errors.New("Root user is not exportable")
+	}
+
+	// check that the policy lets the user export the other user
+	if err := s.policyHelper(ctx, caller, "ExportUserData", user, nil); err != nil {
+		return err
+	}
+
+	return s.exportHelper(ctx, "ExportUserData", user, req, stream)
+}
+
+// exportHelper - builds the bundle of a user in the requested format, and sends it over the stream or
+// uploads it and sends its url.
+func (s *Handler) exportHelper(ctx context.Context, action string, user *repository.User, req *ExportDataRequest, stream ExportDataServer) error {
+	format := strings.ToLower(req.Format)
+	if format == "" {
+		format = "zip"
+	}
+	contentType, ok := exportFormats[format]
+	if !ok {
+		s.zapLog.Error(fmt.Sprintf("Tried to export data as %s", req.Format))
+		return errors.New("Invalid format, expected zip or json")
+	}
+	delivery := strings.ToLower(req.Delivery)
+	if delivery == "" {
+		delivery = "stream"
+	}
+	if delivery != "stream" && delivery != "url" {
+		s.zapLog.Error(fmt.Sprintf("Tried to deliver export by %s", req.Delivery))
+		return errors.New("Invalid delivery, expected stream or url")
+	}
+
+	bundle, err := s.exportBundleHelper(ctx, user)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not collect data of user %s with err %v", user.ID, err))
+		return err
+	}
+
+	var data []byte
+	if format == "zip" {
+		data, err = exportZipHelper(bundle)
+	} else {
+		data, err = json.MarshalIndent(bundle, "", "  ")
+	}
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not encode export with err %v", err))
+		return err
+	}
+
+	if delivery == "url" {
+		ttl, err := exportURLTTLHelper()
+		if err != nil {
+			s.zapLog.Error(err.Error())
+			return err
+		}
+		exportPath := exportPathHelper(user.ID, uuid.NewV4().String(), format)
+		if err := s.storage.Upload(*bytes.NewBuffer(data), exportPath, contentType); err != nil {
+			s.zapLog.Error(fmt.Sprintf("Could not upload export to storage with err %v", err))
+			return err
+		}
+		// the export is deleted when its url expires
+		time.AfterFunc(ttl, func() {
+			_ = s.deleteExportHelper(exportPath)
+		})
+		url, err := s.storage.Get(exportPath, ttl)
+		if err != nil {
+			s.zapLog.Error(fmt.Sprintf("Could not get url of export with err %v", err))
+			return err
+		}
+		res := &ExportDataResponse{Format: format, Url: url}
+		res.ExpiresAt, _ = ptypes.TimestampProto(time.Now().Add(ttl))
+		if err := stream.Send(res); err != nil {
+			s.zapLog.Error(fmt.Sprintf("Could not send export url with err %v", err))
+			return err
+		}
+	} else {
+		for offset := 0; offset < len(data); offset += exportChunkSize {
+			end := offset + exportChunkSize
+			if end > len(data) {
+				end = len(data)
+			}
+			res := &ExportDataResponse{ChunkData: data[offset:end]}
+			if offset == 0 {
+				res.Format = format
+			}
+			if err := stream.Send(res); err != nil {
+				s.zapLog.Error(fmt.Sprintf("Could not send export chunk with err %v", err))
+				return err
+			}
+		}
+	}
+
+	return s.auditHelper(ctx, action, user.ID, nil, &dataExport{UserID: user.ID, OrgID: user.OrgID, Format: format, Delivery: delivery})
+}
+
+// exportBundleHelper - collects everything stored about a user
+func (s *Handler) exportBundleHelper(ctx context.Context, user *repository.User) (*exportBundle, error) {
+	bundle := &exportBundle{
+		AuditLog: []*AuditEntry{},
+		Images:   []*exportImage{},
+	}
+
+	// the user is exported with the fields of its json, except the password
+	raw, err := json.Marshal(user)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &bundle.User); err != nil {
+		return nil, err
+	}
+	delete(bundle.User, "password")
+
+	protoUser := repository.UnmarshalUser(user)
+	if bundle.AuthHistory, err = s.crypto.GetAuthHistory(ctx, protoUser); err != nil {
+		return nil, err
+	}
+	if bundle.Sessions, err = s.crypto.GetUserTokenHistory(ctx, protoUser); err != nil {
+		return nil, err
+	}
+	if bundle.PersonalAccessTokens, err = s.crypto.GetPersonalAccessTokens(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	for _, personalToken := range bundle.PersonalAccessTokens {
+		personalToken.Hash = ""
+	}
+
+	// every page of the audit entries about the user
+	query := &repository.AuditQuery{TargetID: user.ID, Limit: maxAuditPageSize}
+	for {
+		entries, total, err := s.audit.List(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			bundle.AuditLog = append(bundle.AuditLog, marshalAuditEntry(entry))
+		}
+		query.Offset += query.Limit
+		if len(entries) == 0 || query.Offset >= total {
+			break
+		}
+	}
+
+	// the profile image, unless the user has the shared default image
+	if user.Image != "" && !strings.Contains(user.Image, "shared") {
+		image, err := s.storage.Download(user.Image)
+		if err != nil {
+			return nil, err
+		}
+		bundle.Images = append(bundle.Images, &exportImage{Path: user.Image, Data: image.Bytes()})
+	}
+
+	return bundle, nil
+}
+
+// exportZipHelper - writes a bundle as a zip with a json file for each part, and the images as they are stored
+func exportZipHelper(bundle *exportBundle) ([]byte, error) {
+	archive := bytes.Buffer{}
+	writer := zip.NewWriter(&archive)
+
+	parts := []struct {
+		name  string
+		value interface{}
+	}{
+		{"user.json", bundle.User},
+		{"auth_history.json", bundle.AuthHistory},
+		{"sessions.json", bundle.Sessions},
+		{"personal_access_tokens.json", bundle.PersonalAccessTokens},
+		{"audit_log.json", bundle.AuditLog},
+	}
+	for _, part := range parts {
+		data, err := json.MarshalIndent(part.value, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		file, err := writer.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := file.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	for _, image := range bundle.Images {
+		file, err := writer.Create("images/" + path.Base(image.Path))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := file.Write(image.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return archive.Bytes(), nil
+}
@@ -0,0 +1,319 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/golang/protobuf/ptypes"
+	crypto "github.com/softcorp-io/hqs-user-service/crypto"
+	repository "github.com/softcorp-io/hqs-user-service/repository"
+	userProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+)
+
+// defaultGroupPageSize - the page size used when a request has no limit
+const defaultGroupPageSize = 50
+
+// maxGroupPageSize - the largest page of groups or members a request can get
+const maxGroupPageSize = 500
+
+// marshalGroup - converts a repository.Group to a Group.
+func marshalGroup(group *repository.Group) *Group {
+	createdAt, _ := ptypes.TimestampProto(group.CreatedAt)
+	return &Group{
+		Id:        group.ID,
+		Name:      group.Name,
+		CreatedAt: createdAt,
+	}
+}
+
+// CreateGroup - creates a group in the organization of the caller.
+func (s *Handler) CreateGroup(ctx context.Context, req *GroupRequest) (*GroupResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, _, err := s.validateTokenHelper(ctx, "CreateGroup")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &GroupResponse{}, err
+	}
+
+	group := &repository.Group{Name: req.Name}
+	if err := s.groups.Create(ctx, group); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not create group with err %v", err))
+		return &GroupResponse{}, err
+	}
+	if err := s.auditHelper(ctx, "CreateGroup", group.ID, nil, group); err != nil {
+		return &GroupResponse{}, err
+	}
+
+	// return result
+	res := &GroupResponse{}
+	res.Group = marshalGroup(group)
+	return res, nil
+}
+
+// RenameGroup - gives a group a new name.
+func (s *Handler) RenameGroup(ctx context.Context, req *GroupRequest) (*GroupResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, _, err := s.validateTokenHelper(ctx, "RenameGroup")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &GroupResponse{}, err
+	}
+
+	before, err := s.groups.Get(ctx, &repository.Group{ID: req.Id})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get group with err %v", err))
+		return &GroupResponse{}, err
+	}
+
+	if err := s.groups.Rename(ctx, &repository.Group{ID: req.Id, Name: req.Name}); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not rename group with err %v", err))
+		return &GroupResponse{}, err
+	}
+
+	group, err := s.groups.Get(ctx, &repository.Group{ID: req.Id})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get group with err %v", err))
+		return &GroupResponse{}, err
+	}
+	if err := s.auditHelper(ctx, "RenameGroup", group.ID, before, group); err != nil {
+		return &GroupResponse{}, err
+	}
+
+	// return result
+	res := &GroupResponse{}
+	res.Group = marshalGroup(group)
+	return res, nil
+}
+
+// DeleteGroup - deletes a group. Tokens created before keep the group in their claims until they expire.
+func (s *Handler) DeleteGroup(ctx context.Context, req *GroupRequest) (*GroupResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, _, err := s.validateTokenHelper(ctx, "DeleteGroup")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &GroupResponse{}, err
+	}
+
+	before, err := s.groups.Get(ctx, &repository.Group{ID: req.Id})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get group with err %v", err))
+		return &GroupResponse{}, err
+	}
+
+	if err := s.groups.Delete(ctx, &repository.Group{ID: req.Id}); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not delete group with err %v", err))
+		return &GroupResponse{}, err
+	}
+	if err := s.auditHelper(ctx, "DeleteGroup", before.ID, before, nil); err != nil {
+		return &GroupResponse{}, err
+	}
+
+	return &GroupResponse{}, nil
+}
+
+// AddGroupMember - adds the user with UserId to a group. The user must be in the organization of the group,
+// and the policy must let the caller manage the user. Only the root user can add him/herself to a group.
+func (s *Handler) AddGroupMember(ctx context.Context, req *GroupRequest) (*GroupResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	caller, err := s.authenticateHelper(ctx)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &GroupResponse{}, err
+	}
+	ctx = caller.tenantContext(ctx)
+
+	if err := s.authorizeHelper(caller, "AddGroupMember"); err != nil {
+		return &GroupResponse{}, err
+	}
+
+	// the repository only finds users of the organization of the caller
+	member, err := s.repository.Get(ctx, &repository.User{ID: req.UserId})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get member with err %v", err))
+		return &GroupResponse{}, errors.New("User does not exist")
+	}
+
+	// a user cannot give him/herself the claims of a group
+	if member.ID == caller.user.Id && !caller.root() {
+		s.zapLog.Error(fmt.Sprintf("User %s tried to add him/herself to group %s", caller.user.Id, req.Id))
+		return &GroupResponse{}, errors.New("Cannot add yourself to a group")
+	}
+
+	// check that the policy lets the user manage the member
+	if err := s.policyHelper(ctx, caller, "AddGroupMember", member, nil); err != nil {
+		return &GroupResponse{}, err
+	}
+
+	before, err := s.groups.Get(ctx, &repository.Group{ID: req.Id})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get group with err %v", err))
+		return &GroupResponse{}, err
+	}
+
+	if err := s.groups.AddMember(ctx, &repository.Group{ID: req.Id}, member.ID); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not add member with err %v", err))
+		return &GroupResponse{}, err
+	}
+	if err := s.auditGroupHelper(ctx, "AddGroupMember", before); err != nil {
+		return &GroupResponse{}, err
+	}
+
+	return &GroupResponse{}, nil
+}
+
+// RemoveGroupMember - removes the user with UserId from a group.
+func (s *Handler) RemoveGroupMember(ctx context.Context, req *GroupRequest) (*GroupResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, _, err := s.validateTokenHelper(ctx, "RemoveGroupMember")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &GroupResponse{}, err
+	}
+
+	before, err := s.groups.Get(ctx, &repository.Group{ID: req.Id})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get group with err %v", err))
+		return &GroupResponse{}, err
+	}
+
+	if err := s.groups.RemoveMember(ctx, &repository.Group{ID: req.Id}, req.UserId); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not remove member with err %v", err))
+		return &GroupResponse{}, err
+	}
+	if err := s.auditGroupHelper(ctx, "RemoveGroupMember", before); err != nil {
+		return &GroupResponse{}, err
+	}
+
+	return &GroupResponse{}, nil
+}
+
+// GetUserGroups - returns a page of the groups of the user with UserId sorted by name. Every user can
+// get his/her own groups, the groups of other users requires the view_all_users permission.
+func (s *Handler) GetUserGroups(ctx context.Context, req *GroupRequest) (*GroupResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	caller, err := s.authenticateHelper(ctx)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &GroupResponse{}, err
+	}
+	ctx = caller.tenantContext(ctx)
+
+	userID := req.UserId
+	if userID == "" {
+		userID = caller.user.Id
+	}
+	if err := s.viewUserHelper(caller, "GetUserGroups", userID); err != nil {
+		return &GroupResponse{}, err
+	}
+
+	offset, limit := pageHelper(req)
+	groups, total, err := s.groups.GetByMember(ctx, userID, offset, limit)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get groups with err %v", err))
+		return &GroupResponse{}, err
+	}
+
+	// return result
+	res := &GroupResponse{}
+	res.Groups = []*Group{}
+	for _, group := range groups {
+		res.Groups = append(res.Groups, marshalGroup(group))
+	}
+	res.Total = total
+	return res, nil
+}
+
+// GetGroupMembers - returns a page of the members of a group in the order they were added.
+func (s *Handler) GetGroupMembers(ctx context.Context, req *GroupRequest) (*GroupResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, _, err := s.validateTokenHelper(ctx, "GetGroupMembers")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &GroupResponse{}, err
+	}
+
+	offset, limit := pageHelper(req)
+	memberIDs, total, err := s.groups.GetMemberIDs(ctx, &repository.Group{ID: req.Id}, offset, limit)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get group members with err %v", err))
+		return &GroupResponse{}, err
+	}
+
+	members, err := s.repository.GetMany(ctx, memberIDs)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get members with err %v", err))
+		return &GroupResponse{}, err
+	}
+
+	// keep the order of the group
+	membersByID := map[string]*repository.User{}
+	for _, member := range members {
+		member.Password = ""
+		membersByID[member.ID] = member
+	}
+
+	// return result
+	res := &GroupResponse{}
+	res.Members = []*userProto.User{}
+	for _, memberID := range memberIDs {
+		if member, ok := membersByID[memberID]; ok {
+			res.Members = append(res.Members, repository.UnmarshalUser(member))
+		}
+	}
+	res.Total = total
+	return res, nil
+}
+
+// pageHelper - returns the offset and limit of a request, with the limit between 1 and maxGroupPageSize
+func pageHelper(req *GroupRequest) (int64, int64) {
+	offset := req.Offset
+	if offset < 0 {
+		offset = 0
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultGroupPageSize
+	}
+	if limit > maxGroupPageSize {
+		limit = maxGroupPageSize
+	}
+	return offset, limit
+}
+
+// groupClaimsHelper - returns a context, which puts the ids of the groups of the user in the claims of
+// the tokens encoded with it. The context is returned as is, when tokens do not carry groups.
+func (s *Handler) groupClaimsHelper(ctx context.Context, userID string) (context.Context, error) {
+	if !s.crypto.GetGroupClaims() {
+		return ctx, nil
+	}
+
+	// a limit of 0 gets every group
+	groups, _, err := s.groups.GetByMember(ctx, userID, 0, 0)
+	if err != nil {
+		return ctx, err
+	}
+
+	groupIDs := []string{}
+	for _, group := range groups {
+		groupIDs = append(groupIDs, group.ID)
+	}
+	return crypto.WithGroups(ctx, groupIDs), nil
+}
+
+// auditGroupHelper - appends a change of a group to the audit log. before is the group read before the
+// change, and the group after the change is read back.
+func (s *Handler) auditGroupHelper(ctx context.Context, action string, before *repository.Group) error {
+	after, err := s.groups.Get(ctx, &repository.Group{ID: before.ID})
+	if err != nil {
+		after = nil
+	}
+	return s.auditHelper(ctx, action, before.ID, before, after)
+}
@@ -7,14 +7,22 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/golang/protobuf/ptypes"
 	uuid "github.com/satori/go.uuid"
 	crypto "github.com/softcorp-io/hqs-user-service/crypto"
+	permission "github.com/softcorp-io/hqs-user-service/permission"
+	policy "github.com/softcorp-io/hqs-user-service/policy"
+	tenant "github.com/softcorp-io/hqs-user-service/tenant"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	repository "github.com/softcorp-io/hqs-user-service/repository"
 	storage "github.com/softcorp-io/hqs-user-service/storage"
@@ -26,34 +34,58 @@ import (
 // authable - interface used to decode/encode tokens.
 type authable interface {
 	Decode(ctx context.Context, token string, key []byte) (*crypto.CustomClaims, error)
+	DecodeMany(ctx context.Context, tokens []string, key []byte) ([]*crypto.CustomClaims, []error, error)
 	Encode(ctx context.Context, user *userProto.User, key []byte, expiresAt time.Duration) (string, string, error)
+	EncodeScoped(ctx context.Context, user *userProto.User, key []byte, expiresAt time.Duration, scopes []string, audience string) (string, string, error)
 	BlockToken(ctx context.Context, tokenID string) error
 	BlockAllUserToken(ctx context.Context, userID string) error
 	GetAuthHistory(ctx context.Context, user *userProto.User) ([]*userProto.Auth, error)
 	AddAuthToHistory(ctx context.Context, user *userProto.User, token string, typeOf string, key []byte) error
 	DeleteUserAuthHistory(ctx context.Context, user *userProto.User) error
 	DeleteUserTokenHistory(ctx context.Context, user *userProto.User) error
+	GetUserTokenHistory(ctx context.Context, user *userProto.User) ([]*crypto.UserTokenIdentifier, error)
 	GetResetPasswordCryptoKey() []byte
 	GetUserCryptoKey() []byte
 	GetUserTokenTTL() time.Duration
 	GetSignupTokenTTL() time.Duration
 	GetResetPasswordTokenTTL() time.Duration
 	GetAuthHistoryTTL() time.Duration
+	EncryptsField(field string) bool
+	AuthenticateClient(clientID string, clientSecret string) error
+	CreateAPIKey(ctx context.Context, serviceAccountID string, name string) (string, *crypto.APIKey, error)
+	DecodeAPIKey(ctx context.Context, key string) (*crypto.APIKey, error)
+	GetAPIKeys(ctx context.Context, serviceAccountID string) ([]*crypto.APIKey, error)
+	RevokeAPIKey(ctx context.Context, serviceAccountID string, keyID string) error
+	DeleteServiceAccountAPIKeys(ctx context.Context, serviceAccountID string) error
+	CreatePersonalAccessToken(ctx context.Context, userID string, name string, scopes []string, expiresAt time.Duration) (string, *crypto.PersonalAccessToken, error)
+	DecodePersonalAccessToken(ctx context.Context, token string) (*crypto.PersonalAccessToken, error)
+	GetPersonalAccessTokens(ctx context.Context, userID string) ([]*crypto.PersonalAccessToken, error)
+	RevokePersonalAccessToken(ctx context.Context, userID string, tokenID string) error
+	DeleteUserPersonalAccessTokens(ctx context.Context, userID string) error
+	EncodeImpersonation(ctx context.Context, user *userProto.User, impersonatorID string, key []byte, expiresAt time.Duration) (string, string, error)
+	GetImpersonationTokenTTL() time.Duration
+	GetGroupClaims() bool
+	ExchangeToken(ctx context.Context, subject *crypto.CustomClaims, clientID string, audience string, scopes []string, key []byte) (string, *crypto.CustomClaims, error)
 }
 
 // Handler - struct used through program and passed to go-micro.
 type Handler struct {
 	repository      repository.Repository
+	organizations   repository.OrganizationRepository
+	groups          repository.GroupRepository
+	audit           repository.AuditRepository
 	storage         storage.Storage
 	crypto          authable
 	emailClient     emailProto.EmailServiceClient
 	privilegeClient privilegeProto.PrivilegeServiceClient
+	permissions     *permission.Registry
+	policy          *policy.Policy
 	zapLog          *zap.Logger
 }
 
 // NewHandler returns a Handler object
-func NewHandler(repo repository.Repository, stor storage.Storage, crypto authable, emailClient emailProto.EmailServiceClient, privilegeClient privilegeProto.PrivilegeServiceClient, zapLog *zap.Logger) *Handler {
-	return &Handler{repo, stor, crypto, emailClient, privilegeClient, zapLog}
+func NewHandler(repo repository.Repository, organizations repository.OrganizationRepository, groups repository.GroupRepository, audit repository.AuditRepository, stor storage.Storage, crypto authable, emailClient emailProto.EmailServiceClient, privilegeClient privilegeProto.PrivilegeServiceClient, permissions *permission.Registry, policy *policy.Policy, zapLog *zap.Logger) *Handler {
+	return &Handler{repo, organizations, groups, audit, stor, crypto, emailClient, privilegeClient, permissions, policy, zapLog}
 }
 
 // Ping - used for other service to check if live
@@ -68,9 +100,7 @@ func (s *Handler) Create(ctx context.Context, req *userProto.User) (*userProto.R
 	s.zapLog.Info("Recieved new request")
 
 	// check that user is allowed to create
-	_, err := s.validateTokenHelper(ctx, &privilegeProto.Privilege{
-		CreateUser: true,
-	})
+	ctx, _, err := s.validateTokenHelper(ctx, "Create")
 	if err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
 		return &userProto.Response{}, err
@@ -79,15 +109,14 @@ func (s *Handler) Create(ctx context.Context, req *userProto.User) (*userProto.R
 	// create user
 	resultUser := repository.MarshalUser(req)
 
-	// give user default privilege
-	privilegeResponse, err := s.privilegeClient.GetDefault(ctx, &privilegeProto.Request{})
+	// give user default privilege of the organization
+	defaultPrivilegeID, err := s.defaultPrivilegeHelper(ctx)
 	if err != nil {
-		s.zapLog.Error("Could not get default privilege")
 		return &userProto.Response{}, err
 	}
 
 	// update user with privilege id
-	resultUser.PrivilegeID = privilegeResponse.Privilege.Id
+	resultUser.PrivilegeID = defaultPrivilegeID
 
 	if err := resultUser.Validate("password"); err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not validate user with err %v", err))
@@ -106,6 +135,9 @@ func (s *Handler) Create(ctx context.Context, req *userProto.User) (*userProto.R
 		s.zapLog.Error(fmt.Sprintf("Could not create with err %v", err))
 		return &userProto.Response{}, err
 	}
+	if err := s.auditHelper(ctx, "Create", resultUser.ID, nil, resultUser); err != nil {
+		return &userProto.Response{}, err
+	}
 
 	// Strip the password back out, so's we're not returning it
 	res := &userProto.Response{}
@@ -122,9 +154,7 @@ func (s *Handler) GenerateSignupToken(ctx context.Context, req *userProto.Reques
 	s.zapLog.Info("Recieved new request")
 
 	// check that user is allowed to create
-	_, err := s.validateTokenHelper(ctx, &privilegeProto.Privilege{
-		CreateUser: true,
-	})
+	ctx, _, err := s.validateTokenHelper(ctx, "GenerateSignupToken")
 	if err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
 		return &userProto.Token{}, err
@@ -133,7 +163,7 @@ func (s *Handler) GenerateSignupToken(ctx context.Context, req *userProto.Reques
 	// encode user
 	encUser := &userProto.User{}
 	encUser.Id = uuid.NewV4().String()
-	token, _, err := s.crypto.Encode(context.Background(), encUser, s.crypto.GetUserCryptoKey(), s.crypto.GetSignupTokenTTL())
+	token, id, err := s.crypto.Encode(ctx, encUser, s.crypto.GetUserCryptoKey(), s.crypto.GetSignupTokenTTL())
 	if err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not encode signup with err %v", err))
 		return &userProto.Token{}, err
@@ -146,6 +176,10 @@ func (s *Handler) GenerateSignupToken(ctx context.Context, req *userProto.Reques
 		return &userProto.Token{}, err
 	}
 
+	if err := s.auditHelper(ctx, "GenerateSignupToken", encUser.Id, nil, bson.M{"token_id": id}); err != nil {
+		return &userProto.Token{}, err
+	}
+
 	// return result and add url to link
 	res := &userProto.Token{}
 	res.Url = linkBase
@@ -162,11 +196,15 @@ func (s *Handler) Signup(ctx context.Context, req *userProto.User) (*userProto.R
 	s.zapLog.Info("Recieved new request")
 
 	// check that the user is allowed to signup
-	userToken, err := s.validateSignupToken(ctx)
+	signupClaims, err := s.validateSignupToken(ctx)
 	if err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
 		return &userProto.Response{}, err
 	}
+	userToken := signupClaims.User
+
+	// the user signs up to the organization of the user who generated the token
+	ctx = tenant.WithOrganization(ctx, signupClaims.OrgID)
 
 	_, err = s.repository.Get(ctx, repository.MarshalUser(userToken))
 	if err == nil {
@@ -183,22 +221,27 @@ func (s *Handler) Signup(ctx context.Context, req *userProto.User) (*userProto.R
 		return &userProto.Response{}, err
 	}
 
-	// give user default privilege
-	privilegeResponse, err := s.privilegeClient.GetDefault(ctx, &privilegeProto.Request{})
+	// give user default privilege of the organization
+	defaultPrivilegeID, err := s.defaultPrivilegeHelper(ctx)
 	if err != nil {
-		s.zapLog.Error("Could not get default privilege")
 		return &userProto.Response{}, err
 	}
 
 	createUser.Password = string(hashedPass)
 	createUser.Id = userToken.Id
-	createUser.PrivilegeID = privilegeResponse.Privilege.Id
+	createUser.PrivilegeID = defaultPrivilegeID
 
-	if err := s.repository.Signup(ctx, repository.MarshalUser(createUser)); err != nil {
+	signupUser := repository.MarshalUser(createUser)
+	if err := s.repository.Signup(ctx, signupUser); err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not signup with err %v", err))
 		return &userProto.Response{}, err
 	}
 
+	// the new user signed up him/herself
+	if err := s.auditHelper(withActor(ctx, signupUser.ID, ""), "Signup", signupUser.ID, nil, signupUser); err != nil {
+		return &userProto.Response{}, err
+	}
+
 	// Strip the password back out, so's we're not returning it
 	res := &userProto.Response{}
 	createUser.Password = ""
@@ -213,9 +256,7 @@ func (s *Handler) Get(ctx context.Context, req *userProto.User) (*userProto.Resp
 	s.zapLog.Info("Recieved new request")
 
 	// check that user is allowed to create
-	_, err := s.validateTokenHelper(ctx, &privilegeProto.Privilege{
-		ViewAllUsers: true,
-	})
+	ctx, _, err := s.validateTokenHelper(ctx, "Get")
 	if err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
 		return &userProto.Response{}, err
@@ -242,6 +283,7 @@ func (s *Handler) Get(ctx context.Context, req *userProto.User) (*userProto.Resp
 	}
 
 	resultUser := repository.UnmarshalUser(user)
+	versionHeaderHelper(ctx, user)
 
 	// return result
 	res := &userProto.Response{}
@@ -256,7 +298,7 @@ func (s *Handler) GetByToken(ctx context.Context, req *userProto.Request) (*user
 	s.zapLog.Info("Recieved new request")
 
 	// check that user is allowed to create
-	actualUser, err := s.validateTokenHelper(ctx, &privilegeProto.Privilege{})
+	ctx, actualUser, err := s.validateTokenHelper(ctx, "GetByToken")
 	if err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
 		return &userProto.Response{}, err
@@ -270,6 +312,11 @@ func (s *Handler) GetByToken(ctx context.Context, req *userProto.Request) (*user
 		actualUser.Image = imageURL
 	}
 
+	// the version is needed to update the user with an expected version
+	if user, err := s.repository.Get(ctx, &repository.User{ID: actualUser.Id}); err == nil {
+		versionHeaderHelper(ctx, user)
+	}
+
 	res := &userProto.Response{}
 	actualUser.Password = ""
 	res.User = actualUser
@@ -283,9 +330,7 @@ func (s *Handler) GetByEmail(ctx context.Context, req *userProto.User) (*userPro
 	s.zapLog.Info("Recieved new request")
 
 	// check that user is allowed to create
-	_, err := s.validateTokenHelper(ctx, &privilegeProto.Privilege{
-		ViewAllUsers: true,
-	})
+	ctx, _, err := s.validateTokenHelper(ctx, "GetByEmail")
 	if err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
 		return &userProto.Response{}, err
@@ -321,9 +366,7 @@ func (s *Handler) GetAll(ctx context.Context, req *userProto.Request) (*userProt
 	s.zapLog.Info("Recieved new request")
 
 	// check that user is allowed to create
-	_, err := s.validateTokenHelper(ctx, &privilegeProto.Privilege{
-		ViewAllUsers: true,
-	})
+	ctx, _, err := s.validateTokenHelper(ctx, "GetAll")
 	if err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
 		return &userProto.Response{}, err
@@ -340,12 +383,7 @@ func (s *Handler) GetAll(ctx context.Context, req *userProto.Request) (*userProt
 		user.Password = ""
 
 		// add user image
-		imageURL, err := s.storage.Get(user.Image, time.Hour*1)
-		if err != nil {
-			s.zapLog.Error(fmt.Sprintf("Could not get user image from storage with err %v", err))
-		} else {
-			user.Image = imageURL
-		}
+		s.imageHelper(user)
 	}
 
 	resultUsers := repository.UnmarshalUserCollection(results)
@@ -358,25 +396,147 @@ func (s *Handler) GetAll(ctx context.Context, req *userProto.Request) (*userProt
 	return res, nil
 }
 
+// ListUsers - returns a page of the users matching the filters of the request. Like GetAll, the root
+// user and service accounts are never listed.
+func (s *Handler) ListUsers(ctx context.Context, req *ListUsersRequest) (*ListUsersResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, _, err := s.validateTokenHelper(ctx, "ListUsers")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &ListUsersResponse{}, err
+	}
+
+	query := &repository.ListQuery{
+		PrivilegeID: req.PrivilegeID,
+		CountryCode: req.CountryCode,
+		SortBy:      req.SortBy,
+		Descending:  req.Descending,
+		Fields:      req.Fields,
+		Cursor:      req.Cursor,
+		Limit:       req.Limit,
+	}
+	if req.Blocked != nil {
+		query.Blocked = &req.Blocked.Value
+	}
+	if req.CreatedAfter != nil {
+		if query.CreatedAfter, err = ptypes.Timestamp(req.CreatedAfter); err != nil {
+			s.zapLog.Error(fmt.Sprintf("Could not parse CreatedAfter with err %v", err))
+			return &ListUsersResponse{}, err
+		}
+	}
+	if req.CreatedBefore != nil {
+		if query.CreatedBefore, err = ptypes.Timestamp(req.CreatedBefore); err != nil {
+			s.zapLog.Error(fmt.Sprintf("Could not parse CreatedBefore with err %v", err))
+			return &ListUsersResponse{}, err
+		}
+	}
+
+	page, err := s.repository.List(ctx, query)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not list users with err %v", err))
+		return &ListUsersResponse{}, err
+	}
+
+	for _, user := range page.Users {
+		// add user image, if it was asked for
+		if user.Image != "" {
+			s.imageHelper(user)
+		}
+	}
+
+	// return result
+	res := &ListUsersResponse{}
+	res.Users = repository.UnmarshalUserCollection(page.Users)
+	res.NextCursor = page.NextCursor
+	res.Total = page.Total
+	return res, nil
+}
+
+// SearchUsers - finds users by a part of their name, email or phone, best match first. Finding blocked
+// users also requires the block_user permission.
+func (s *Handler) SearchUsers(ctx context.Context, req *SearchUsersRequest) (*SearchUsersResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	caller, err := s.authenticateHelper(ctx)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &SearchUsersResponse{}, err
+	}
+	ctx = caller.tenantContext(ctx)
+
+	if err := s.authorizeHelper(caller, "SearchUsers"); err != nil {
+		return &SearchUsersResponse{}, err
+	}
+	if req.IncludeBlocked {
+		if err := s.authorizeHelper(caller, permission.WithOption("SearchUsers", "include_blocked")); err != nil {
+			return &SearchUsersResponse{}, err
+		}
+	}
+
+	results, more, err := s.repository.Search(ctx, &repository.SearchQuery{
+		Term:           req.Term,
+		IncludeBlocked: req.IncludeBlocked,
+		Offset:         req.Offset,
+		Limit:          req.Limit,
+	})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not search users with err %v", err))
+		return &SearchUsersResponse{}, err
+	}
+
+	// return result
+	res := &SearchUsersResponse{}
+	res.Users = []*userProto.User{}
+	for _, result := range results {
+		s.imageHelper(&result.User)
+		res.Users = append(res.Users, repository.UnmarshalUser(&result.User))
+	}
+	res.More = more
+	return res, nil
+}
+
 // UpdateProfile - updates profile information given a token. Token is used to validate and find the user
 // A user can only update his/her own profile
 func (s *Handler) UpdateProfile(ctx context.Context, req *userProto.User) (*userProto.Response, error) {
 	s.zapLog.Info("Recieved new request")
 
 	// check that user is allowed to create
-	actualUser, err := s.validateTokenHelper(ctx, &privilegeProto.Privilege{})
+	ctx, actualUser, err := s.validateTokenHelper(ctx, "UpdateProfile")
 	if err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
 		return &userProto.Response{}, err
 	}
 
+	expected, err := expectedVersionHelper(ctx)
+	if err != nil {
+		return &userProto.Response{}, err
+	}
+
+	before, err := s.repository.Get(ctx, &repository.User{ID: actualUser.Id})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get actualUser with err  %v", err))
+		return &userProto.Response{}, err
+	}
+	if err := versionHelper(before, expected); err != nil {
+		return &userProto.Response{}, err
+	}
+
 	resultUser := repository.MarshalUser(req)
 
 	// give user the id from the token
 	resultUser.ID = actualUser.Id
+	resultUser.UpdatedBy = actualUser.Id
+	resultUser.ExpectedVersion = expected
 
 	if err := s.repository.UpdateProfile(ctx, resultUser); err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not update profile with err  %v", err))
+		return &userProto.Response{}, conflictHelper(err, expected)
+	}
+	if expected != nil {
+		versionHeaderHelper(ctx, resultUser)
+	}
+	if err := s.auditUserHelper(ctx, "UpdateProfile", resultUser.ID, before); err != nil {
 		return &userProto.Response{}, err
 	}
 
@@ -393,15 +553,18 @@ func (s *Handler) UpdatePrivileges(ctx context.Context, req *userProto.User) (*u
 	s.zapLog.Info("Recieved new request")
 
 	// check that user is allowed to create
-	_, err := s.validateTokenHelper(ctx, &privilegeProto.Privilege{
-		ManagePrivileges: true,
-	})
+	ctx, caller, err := s.sensitiveActionHelper(ctx, "UpdatePrivileges")
 
 	if err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
 		return &userProto.Response{}, err
 	}
 
+	expected, err := expectedVersionHelper(ctx)
+	if err != nil {
+		return &userProto.Response{}, err
+	}
+
 	resultUser := repository.MarshalUser(req)
 
 	// validate that user actually exists & that reqUser is no admin
@@ -410,6 +573,9 @@ func (s *Handler) UpdatePrivileges(ctx context.Context, req *userProto.User) (*u
 		s.zapLog.Error(fmt.Sprintf("Could not get reqUser with err  %v", err))
 		return &userProto.Response{}, err
 	}
+	if err := versionHelper(reqUser, expected); err != nil {
+		return &userProto.Response{}, err
+	}
 
 	// the root user cannot be updated
 	if reqUser.Admin {
@@ -417,6 +583,13 @@ func (s *Handler) UpdatePrivileges(ctx context.Context, req *userProto.User) (*u
 		return &userProto.Response{}, errors.New("Root user is not updateable")
 	}
 
+	// only privileges of the organization can be given to its users
+	if reqUser.OrgID != "" {
+		if err := s.organizationPrivilegeHelper(ctx, reqUser.OrgID, req.PrivilegeID); err != nil {
+			return &userProto.Response{}, err
+		}
+	}
+
 	// check that the requested prvilege actully exists
 	privilege, err := s.privilegeClient.Get(ctx, &privilegeProto.Privilege{
 		Id: req.PrivilegeID,
@@ -426,11 +599,23 @@ func (s *Handler) UpdatePrivileges(ctx context.Context, req *userProto.User) (*u
 		return &userProto.Response{}, err
 	}
 
+	// check that the policy lets the user change the privilege
+	if err := s.policyHelper(ctx, caller, "UpdatePrivileges", reqUser, privilege.Privilege); err != nil {
+		return &userProto.Response{}, err
+	}
+
 	// update user with privilege id
 	resultUser.PrivilegeID = privilege.Privilege.Id
+	resultUser.ExpectedVersion = expected
 
 	if err := s.repository.UpdatePrivileges(ctx, resultUser); err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not update with err  %v", err))
+		return &userProto.Response{}, conflictHelper(err, expected)
+	}
+	if expected != nil {
+		versionHeaderHelper(ctx, resultUser)
+	}
+	if err := s.auditUserHelper(ctx, "UpdatePrivileges", reqUser.ID, reqUser); err != nil {
 		return &userProto.Response{}, err
 	}
 
@@ -449,11 +634,12 @@ func (s *Handler) UpdatePassword(ctx context.Context, req *userProto.UpdatePassw
 	s.zapLog.Info("Recieved new request")
 
 	// check that user is allowed to create
-	actualUser, err := s.validateTokenHelper(ctx, &privilegeProto.Privilege{})
+	ctx, caller, err := s.sensitiveActionHelper(ctx, "UpdatePassword")
 	if err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
 		return &userProto.Response{}, err
 	}
+	actualUser := caller.user
 
 	// validate that the user remembers his/her old password
 	if err := bcrypt.CompareHashAndPassword([]byte(actualUser.Password), []byte(req.OldPassword)); err != nil {
@@ -483,10 +669,19 @@ func (s *Handler) UpdatePassword(ctx context.Context, req *userProto.UpdatePassw
 	// give user the id from the toke
 	resultUser.ID = actualUser.Id
 
+	before, err := s.repository.Get(ctx, &repository.User{ID: actualUser.Id})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get actualUser with err  %v", err))
+		return &userProto.Response{}, err
+	}
+
 	if err := s.repository.UpdatePassword(ctx, resultUser); err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not update password with err %v", err))
 		return &userProto.Response{}, err
 	}
+	if err := s.auditUserHelper(ctx, "UpdatePassword", resultUser.ID, before); err != nil {
+		return &userProto.Response{}, err
+	}
 
 	// return result
 	res := &userProto.Response{}
@@ -497,25 +692,31 @@ func (s *Handler) UpdatePassword(ctx context.Context, req *userProto.UpdatePassw
 }
 
 // UpdateBlockUser - can either block a user or unblock a user
-// block = true, not blocked = false.
+// block = true, not blocked = false. Blocking deactivates the user, see UpdateUserStatus.
 func (s *Handler) UpdateBlockUser(ctx context.Context, req *userProto.User) (*userProto.Response, error) {
 	s.zapLog.Info("Recieved new request")
 
 	// check that user is allowed to create
-	_, err := s.validateTokenHelper(ctx, &privilegeProto.Privilege{
-		BlockUser: true,
-	})
+	ctx, caller, err := s.sensitiveActionHelper(ctx, "UpdateBlockUser")
 	if err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
 		return &userProto.Response{}, err
 	}
 
+	expected, err := expectedVersionHelper(ctx)
+	if err != nil {
+		return &userProto.Response{}, err
+	}
+
 	// validate that user actually exists & that reqUser is no admin
 	reqUser, err := s.repository.Get(ctx, repository.MarshalUser(req))
 	if err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not get reqUser with err  %v", err))
 		return &userProto.Response{}, err
 	}
+	if err := versionHelper(reqUser, expected); err != nil {
+		return &userProto.Response{}, err
+	}
 
 	// the root user cannot be updated
 	if reqUser.Admin {
@@ -523,11 +724,31 @@ func (s *Handler) UpdateBlockUser(ctx context.Context, req *userProto.User) (*us
 		return &userProto.Response{}, errors.New("Root user is not updateable")
 	}
 
-	if err := s.repository.UpdateBlockUser(ctx, repository.MarshalUser(req)); err != nil {
-		s.zapLog.Error(fmt.Sprintf("Unable to block user with err %v", err))
+	// check that the policy lets the user block the other user
+	if err := s.policyHelper(ctx, caller, "UpdateBlockUser", reqUser, nil); err != nil {
 		return &userProto.Response{}, err
 	}
 
+	// blocking deactivates the user, and unblocking activates the user again
+	to := repository.StatusActive
+	if req.Blocked {
+		to = repository.StatusDeactivated
+	}
+	if reqUser.CurrentStatus() != to {
+		before := copyUserHelper(reqUser)
+		reqUser.ExpectedVersion = expected
+		if err := s.updateStatusHelper(ctx, reqUser, &repository.StatusChange{To: to, By: caller.user.Id}, nil); err != nil {
+			s.zapLog.Error(fmt.Sprintf("Unable to block user with err %v", err))
+			return &userProto.Response{}, conflictHelper(err, expected)
+		}
+		if err := s.auditUserHelper(ctx, "UpdateBlockUser", reqUser.ID, before); err != nil {
+			return &userProto.Response{}, err
+		}
+	}
+	if expected != nil {
+		versionHeaderHelper(ctx, reqUser)
+	}
+
 	res := &userProto.Response{}
 	res.User = req
 
@@ -553,18 +774,27 @@ func (s *Handler) UploadImage(stream userProto.UserService_UploadImageServer) er
 	md := metadata.New(map[string]string{"token": token})
 	ctx = metadata.NewIncomingContext(ctx, md)
 
-	authUser, err := s.validateTokenHelper(ctx, &privilegeProto.Privilege{})
+	ctx, authUser, err := s.validateTokenHelper(ctx, "UploadImage")
 	if err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
 		return err
 	}
 
+	// the expected version is sent in the metadata of the stream
+	expected, err := expectedVersionHelper(stream.Context())
+	if err != nil {
+		return err
+	}
+
 	// validate that user actually exists
 	actualUser, err := s.repository.Get(ctx, repository.MarshalUser(authUser))
 	if err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not get authUser with err  %v", err))
 		return err
 	}
+	if err := versionHelper(actualUser, expected); err != nil {
+		return err
+	}
 
 	maxSize := 1 << 40
 
@@ -600,17 +830,38 @@ func (s *Handler) UploadImage(stream userProto.UserService_UploadImageServer) er
 		}
 	}
 
-	// upload first so we don't send success on failure
-	imagePath := "hqs/users/" + actualUser.ID + "profileImage/profileImage.png"
+	// upload first so we don't send success on failure. Every upload has a path of its own, s.t. an
+	// upload, which loses against a newer version of the user, does not replace the stored image.
+	imagePath := "hqs/users/" + actualUser.ID + "/profileImage/" + uuid.NewV4().String() + ".png"
 	if err := s.storage.Upload(imageData, imagePath, "image/jpeg", "image/png", "image/jpg"); err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not upload image to storage with err %v", err))
 		return err
 	}
 
 	// update user image in repo
+	before := copyUserHelper(actualUser)
 	actualUser.Image = imagePath
-	if err := s.repository.UpdateImage(context.Background(), actualUser); err != nil {
+	actualUser.ExpectedVersion = expected
+	if err := s.repository.UpdateImage(tenant.WithOrganization(context.Background(), actualUser.OrgID), actualUser); err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not update repository with image path %v", err))
+		if err := s.storage.Delete(imagePath); err != nil {
+			s.zapLog.Error(fmt.Sprintf("Could not delete unused image %s from storage with err %v", imagePath, err))
+		}
+		return conflictHelper(err, expected)
+	}
+
+	// the image replaced is not used anymore, unless it is a shared default image
+	if before.Image != "" && !strings.Contains(before.Image, "shared") {
+		if err := s.storage.Delete(before.Image); err != nil {
+			s.zapLog.Error(fmt.Sprintf("Could not delete replaced image %s from storage with err %v", before.Image, err))
+		}
+	}
+	if expected != nil {
+		if err := stream.SetHeader(metadata.Pairs(versionKey, strconv.FormatInt(actualUser.Version, 10))); err != nil {
+			s.zapLog.Error(fmt.Sprintf("Could not send version header with err %v", err))
+		}
+	}
+	if err := s.auditUserHelper(ctx, "UploadImage", actualUser.ID, before); err != nil {
 		return err
 	}
 
@@ -629,14 +880,12 @@ func (s *Handler) UploadImage(stream userProto.UserService_UploadImageServer) er
 	return nil
 }
 
-// Delete - deletes all users. At the moment, you can only delete your own user
+// Delete - deletes a user. The user can be restored with RestoreUser until the grace period is over.
 func (s *Handler) Delete(ctx context.Context, req *userProto.User) (*userProto.Response, error) {
 	s.zapLog.Info("Recieved new request")
 
 	// check that user is allowed to create
-	_, err := s.validateTokenHelper(ctx, &privilegeProto.Privilege{
-		DeleteUser: true,
-	})
+	ctx, caller, err := s.sensitiveActionHelper(ctx, "Delete")
 	if err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
 		return &userProto.Response{}, err
@@ -654,41 +903,29 @@ func (s *Handler) Delete(ctx context.Context, req *userProto.User) (*userProto.R
 		return &userProto.Response{}, errors.New("Root user is not deletable")
 	}
 
-	// Delete the user
-	if err := s.repository.Delete(ctx, deleteUser); err != nil {
-		s.zapLog.Error(fmt.Sprintf("Could not delete user from repository with err %v", err))
+	// check that the policy lets the user delete the other user
+	if err := s.policyHelper(ctx, caller, "Delete", deleteUser, nil); err != nil {
 		return &userProto.Response{}, err
 	}
 
-	// also delete users auth history
-	if err := s.crypto.DeleteUserAuthHistory(ctx, req); err != nil {
-		s.zapLog.Error(fmt.Sprintf("Could not delete users auth history from crypto with err %v", err))
-	}
-
-	// same with token history
-	if err := s.crypto.DeleteUserTokenHistory(ctx, req); err != nil {
-		s.zapLog.Error(fmt.Sprintf("Could not delete users auth history from crypto with err %v", err))
-	}
-
-	// delete users profile image todo: add this to storage insted... should not be part of handler
-	// if the user didn't update profile image
-	if strings.Contains(deleteUser.Image, "shared") {
-		return &userProto.Response{}, nil
+	// the user is only marked as deleted, PurgeDeletedUsers deletes the user for good after the grace period
+	before := copyUserHelper(deleteUser)
+	if err := s.repository.SoftDelete(ctx, deleteUser, caller.user.Id); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not delete user from repository with err %v", err))
+		return &userProto.Response{}, err
 	}
-
-	if err := s.storage.Delete(deleteUser.Image); err != nil {
-		s.zapLog.Error(fmt.Sprintf("Could not delete user image from storage with err %v", err))
+	if err := s.auditUserHelper(ctx, "Delete", deleteUser.ID, before); err != nil {
 		return &userProto.Response{}, err
 	}
 
-	if err := s.storage.Delete("hqs/users/" + deleteUser.ID + "/profileImage"); err != nil {
-		s.zapLog.Error(fmt.Sprintf("Could not delete image folder from storage with err %v", err))
-		return &userProto.Response{}, err
+	// the tokens of the user stop working right away
+	if err := s.crypto.BlockAllUserToken(ctx, deleteUser.ID); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not block users tokens with err %v", err))
 	}
 
-	if err := s.storage.Delete("hqs/users/" + deleteUser.ID); err != nil {
-		s.zapLog.Error(fmt.Sprintf("Could not delete user folder from storage with err %v", err))
-		return &userProto.Response{}, err
+	// the reports of the user have no manager anymore
+	if err := s.repository.FlagReports(ctx, deleteUser, true); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not flag orphaned reports with err %v", err))
 	}
 
 	return &userProto.Response{}, nil
@@ -698,24 +935,38 @@ func (s *Handler) Delete(ctx context.Context, req *userProto.User) (*userProto.R
 func (s *Handler) Auth(ctx context.Context, req *userProto.User) (*userProto.Token, error) {
 	s.zapLog.Info("Recieved new request")
 
-	user, err := s.repository.GetByEmail(ctx, repository.MarshalUser(req))
+	// emails are unique across organizations, so the user is found in every organization
+	user, err := s.repository.GetByEmail(tenant.WithAllOrganizations(ctx), repository.MarshalUser(req))
 	if err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not get authUser with err  %v", err))
 		return &userProto.Token{}, err
 	}
 
-	// check if the user is blocked
-	if user.Blocked {
-		s.zapLog.Error("The user is blocked")
-		return &userProto.Token{}, errors.New("The user is blocked")
-	}
-
+	// the password is checked first, s.t. the status of a user is only told to the user
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not compare hash with err  %v", err))
 		return &userProto.Token{}, err
 	}
 
-	token, id, err := s.crypto.Encode(context.Background(), repository.UnmarshalUser(user), s.crypto.GetUserCryptoKey(), s.crypto.GetUserTokenTTL())
+	// only active users can log in
+	if err := activeHelper(user); err != nil {
+		s.zapLog.Error(fmt.Sprintf("User %s is not active with err %v", user.ID, err))
+		return &userProto.Token{}, err
+	}
+
+	// service accounts can only authenticate with api keys
+	if user.ServiceAccount {
+		s.zapLog.Error("Tried to authenticate service account with password")
+		return &userProto.Token{}, errors.New("Service accounts authenticate with api keys")
+	}
+
+	groupsCtx, err := s.groupClaimsHelper(tenant.WithOrganization(ctx, user.OrgID), user.ID)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get users groups with err  %v", err))
+		return &userProto.Token{}, err
+	}
+
+	token, id, err := s.crypto.Encode(groupsCtx, repository.UnmarshalUser(user), s.crypto.GetUserCryptoKey(), s.crypto.GetUserTokenTTL())
 	if err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not encode user with err  %v", err))
 		return &userProto.Token{}, err
@@ -734,12 +985,94 @@ func (s *Handler) Auth(ctx context.Context, req *userProto.User) (*userProto.Tok
 	return res, nil
 }
 
+// CreateScopedToken - creates a token for the authenticated user, which is restricted to a subset of
+// the users privileges and optionally meant for another hqs service. A user can only grant scopes
+// he/she already has.
+func (s *Handler) CreateScopedToken(ctx context.Context, req *ScopedTokenRequest) (*userProto.Token, error) {
+	s.zapLog.Info("Recieved new request")
+
+	caller, err := s.authenticateHelper(ctx)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &userProto.Token{}, err
+	}
+	ctx = caller.tenantContext(ctx)
+
+	if err := s.authorizeHelper(caller, "CreateScopedToken"); err != nil {
+		return &userProto.Token{}, err
+	}
+
+	// an impersonator or a service cannot get a token which hides that it is not the user
+	if caller.impersonated() || caller.delegated() {
+		s.zapLog.Error("Tried to create scoped token while impersonating or with an exchanged token")
+		return &userProto.Token{}, errors.New("Not allowed while impersonating or acting for the user")
+	}
+
+	// a service account cannot turn its api key into a token, which outlives revoking the key
+	if caller.apiKey != nil {
+		s.zapLog.Error(fmt.Sprintf("Service account %s tried to create scoped token with an api key", caller.user.Id))
+		return &userProto.Token{}, errors.New("Service accounts cannot create scoped tokens")
+	}
+	// a personal access token cannot be turned into a token, which outlives revoking it
+	if caller.personalToken != nil {
+		s.zapLog.Error(fmt.Sprintf("User %s tried to create scoped token with a personal access token", caller.user.Id))
+		return &userProto.Token{}, errors.New("Personal access tokens cannot create scoped tokens")
+	}
+	storedUser, err := s.repository.Get(ctx, &repository.User{ID: caller.user.Id})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get caller with err %v", err))
+		return &userProto.Token{}, err
+	}
+	if storedUser.ServiceAccount {
+		s.zapLog.Error(fmt.Sprintf("Service account %s tried to create scoped token", storedUser.ID))
+		return &userProto.Token{}, errors.New("Service accounts cannot create scoped tokens")
+	}
+
+	if len(req.Scopes) == 0 {
+		s.zapLog.Error("No scopes in request")
+		return &userProto.Token{}, errors.New("A scoped token requires at least one scope")
+	}
+
+	if err := scopesGranted(s.grantedHelper(caller), req.Scopes); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not grant scopes with err %v", err))
+		return &userProto.Token{}, err
+	}
+
+	// scoped tokens can live shorter than a login, but never longer
+	ttl := s.crypto.GetUserTokenTTL()
+	if req.ExpiresIn > 0 && time.Duration(req.ExpiresIn)*time.Second < ttl {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+
+	ctx, err = s.groupClaimsHelper(ctx, caller.user.Id)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get users groups with err %v", err))
+		return &userProto.Token{}, err
+	}
+
+	token, id, err := s.crypto.EncodeScoped(ctx, caller.user, s.crypto.GetUserCryptoKey(), ttl, req.Scopes, req.Audience)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not encode scoped token with err %v", err))
+		return &userProto.Token{}, err
+	}
+	if err := s.auditHelper(ctx, "CreateScopedToken", caller.user.Id, nil, bson.M{"token_id": id, "scopes": req.Scopes, "audience": req.Audience}); err != nil {
+		return &userProto.Token{}, err
+	}
+
+	// return result
+	res := &userProto.Token{}
+	res.Token = token
+	res.Id = id
+
+	return res, nil
+}
+
 // BlockToken - block token so it cannot be used anymore. Can be undone the next hour
 func (s *Handler) BlockToken(ctx context.Context, req *userProto.Token) (*userProto.Token, error) {
 	s.zapLog.Info("Recieved new request")
 
-	// check that user is allowed to create
-	actualUser, err := s.validateTokenHelper(ctx, &privilegeProto.Privilege{})
+	// an impersonator cannot block the tokens of the user
+	ctx, caller, err := s.sensitiveActionHelper(ctx, "BlockToken")
 	if err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
 		return &userProto.Token{}, err
@@ -751,7 +1084,7 @@ func (s *Handler) BlockToken(ctx context.Context, req *userProto.Token) (*userPr
 		return &userProto.Token{}, err
 	}
 
-	if claims.User.Id != actualUser.Id {
+	if claims.User.Id != caller.user.Id {
 		s.zapLog.Error("Token user does not match auth user")
 		return &userProto.Token{}, errors.New("Token user does not match auth user")
 	}
@@ -760,6 +1093,9 @@ func (s *Handler) BlockToken(ctx context.Context, req *userProto.Token) (*userPr
 		s.zapLog.Error(fmt.Sprintf("Could not block token with err  %v", err))
 		return &userProto.Token{}, err
 	}
+	if err := s.auditHelper(ctx, "BlockToken", claims.ID, nil, nil); err != nil {
+		return &userProto.Token{}, err
+	}
 
 	// return result
 	res := &userProto.Token{}
@@ -771,10 +1107,8 @@ func (s *Handler) BlockToken(ctx context.Context, req *userProto.Token) (*userPr
 func (s *Handler) EmailResetPasswordToken(ctx context.Context, req *userProto.User) (*userProto.Response, error) {
 	s.zapLog.Info("Recieved new request")
 
-	// check that user is allowed to create
-	_, err := s.validateTokenHelper(ctx, &privilegeProto.Privilege{
-		SendResetPasswordEmail: true,
-	})
+	// an impersonator cannot send reset password emails
+	ctx, _, err := s.sensitiveActionHelper(ctx, "EmailResetPasswordToken")
 	if err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
 		return &userProto.Response{}, err
@@ -788,7 +1122,7 @@ func (s *Handler) EmailResetPasswordToken(ctx context.Context, req *userProto.Us
 	}
 
 	// generate token
-	resetToken, _, err := s.crypto.Encode(context.Background(), req, s.crypto.GetResetPasswordCryptoKey(), s.crypto.GetResetPasswordTokenTTL())
+	resetToken, _, err := s.crypto.Encode(tenant.WithOrganization(ctx, resultUser.OrgID), req, s.crypto.GetResetPasswordCryptoKey(), s.crypto.GetResetPasswordTokenTTL())
 	if err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not encode reset password with err %v", err))
 		return &userProto.Response{}, err
@@ -832,11 +1166,33 @@ func (s *Handler) ResetPassword(ctx context.Context, req *userProto.ResetPasswor
 		return &userProto.Response{}, errors.New("Invalid user")
 	}
 
+	// validate and hash the new password
+	updateUser := &repository.User{ID: claims.User.Id, Password: req.NewPassword}
+	if err := updateUser.Validate("password"); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate user password with err %v", err))
+		return &userProto.Response{}, err
+	}
+	hashedPass, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not generate hash with err %v", err))
+		return &userProto.Response{}, err
+	}
+	updateUser.Password = string(hashedPass)
+
+	// the user resets his/her own password
+	ctx = withActor(tenant.WithOrganization(ctx, claims.OrgID), claims.User.Id, "")
+	before, err := s.repository.Get(ctx, &repository.User{ID: claims.User.Id})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get user with err  %v", err))
+		return &userProto.Response{}, err
+	}
+
 	// update the password of the claimed user
-	updateUser := repository.MarshalUser(claims.User)
-	updateUser.Password = req.NewPassword
-	if err := s.repository.UpdatePassword(ctx, updateUser); err == nil {
-		s.zapLog.Error("Could not update the user with that password")
+	if err := s.repository.UpdatePassword(ctx, updateUser); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not update password with err %v", err))
+		return &userProto.Response{}, err
+	}
+	if err := s.auditUserHelper(ctx, "ResetPassword", updateUser.ID, before); err != nil {
 		return &userProto.Response{}, err
 	}
 
@@ -854,7 +1210,7 @@ func (s *Handler) BlockTokenByID(ctx context.Context, req *userProto.BlockTokenR
 	s.zapLog.Info("Recieved new request")
 
 	// check that user is allowed to create
-	actualUser, err := s.validateTokenHelper(ctx, &privilegeProto.Privilege{})
+	ctx, actualUser, err := s.validateTokenHelper(ctx, "BlockTokenByID")
 	if err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
 		return &userProto.Token{}, err
@@ -885,6 +1241,9 @@ func (s *Handler) BlockTokenByID(ctx context.Context, req *userProto.BlockTokenR
 		s.zapLog.Error(fmt.Sprintf("Could not block token with err  %v", err))
 		return &userProto.Token{}, err
 	}
+	if err := s.auditHelper(ctx, "BlockTokenByID", req.TokenID, nil, nil); err != nil {
+		return &userProto.Token{}, err
+	}
 
 	// return result
 	res := &userProto.Token{}
@@ -896,17 +1255,20 @@ func (s *Handler) BlockTokenByID(ctx context.Context, req *userProto.BlockTokenR
 func (s *Handler) BlockUsersTokens(ctx context.Context, req *userProto.Request) (*userProto.Response, error) {
 	s.zapLog.Info("Recieved new request")
 
-	// check that user is allowed to create
-	actualUser, err := s.validateTokenHelper(ctx, &privilegeProto.Privilege{})
+	// an impersonator cannot block the tokens of the user
+	ctx, caller, err := s.sensitiveActionHelper(ctx, "BlockUsersTokens")
 	if err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
 		return &userProto.Response{}, err
 	}
 
-	if err := s.crypto.BlockAllUserToken(context.Background(), actualUser.Id); err != nil {
+	if err := s.crypto.BlockAllUserToken(context.Background(), caller.user.Id); err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not block all users tokens with err  %v", err))
 		return &userProto.Response{}, err
 	}
+	if err := s.auditHelper(ctx, "BlockUsersTokens", caller.user.Id, nil, nil); err != nil {
+		return &userProto.Response{}, err
+	}
 
 	// return result
 	res := &userProto.Response{}
@@ -919,7 +1281,7 @@ func (s *Handler) GetAuthHistory(ctx context.Context, req *userProto.Request) (*
 	s.zapLog.Info("Recieved new request")
 
 	// check that user is allowed to create
-	actualUser, err := s.validateTokenHelper(ctx, &privilegeProto.Privilege{})
+	ctx, actualUser, err := s.validateTokenHelper(ctx, "GetAuthHistory")
 	if err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
 		return &userProto.AuthHistory{}, err
@@ -953,34 +1315,165 @@ func (s *Handler) ValidateToken(ctx context.Context, req *userProto.Token) (*use
 		return &userProto.Token{}, errors.New("Invalid user")
 	}
 
-	// validate that user actually exists
-	actualUser, err := s.repository.Get(ctx, repository.MarshalUser(claims.User))
+	// a token meant for a service is only valid to that service, which authenticates with its client credentials
+	if claims.Audience != "" {
+		clientID, err := s.authenticatedClientHelper(ctx)
+		if err != nil {
+			s.zapLog.Error(fmt.Sprintf("Could not validate client of token meant for %s with err %v", claims.Audience, err))
+			return &userProto.Token{}, errors.New("Token is not meant for the audience")
+		}
+		if claims.Audience != clientID {
+			s.zapLog.Error(fmt.Sprintf("Token meant for %s was validated by %s", claims.Audience, clientID))
+			return &userProto.Token{}, errors.New("Token is not meant for the audience")
+		}
+	}
+
+	// validate that user actually exists in the organization of the token
+	actualUser, err := s.repository.Get(tenant.WithOrganization(ctx, claims.OrgID), repository.MarshalUser(claims.User))
 	if err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not get authUser with err  %v", err))
 		return &userProto.Token{}, err
 	}
 
-	if actualUser.Blocked {
-		s.zapLog.Error("User is blocked")
-		return &userProto.Token{}, errors.New("User is blocked")
+	if err := s.tokenUserHelper(ctx, claims, actualUser); err != nil {
+		return &userProto.Token{}, err
 	}
 
 	// get users privileges
-	privilegeResponse, err := s.privilegeClient.Get(ctx, &privilegeProto.Privilege{Id: actualUser.PrivilegeID})
+	privilege, err := s.privilegeHelper(ctx, actualUser)
 	if err != nil {
-		s.zapLog.Error(fmt.Sprintf("Could not get users privileges with err %v", err))
 		return &userProto.Token{}, err
 	}
 
 	// return result
 	res := &userProto.Token{}
-	res.ManagePrivileges = privilegeResponse.Privilege.ManagePrivileges
+	res.ManagePrivileges = restrictPrivilege(privilege, claims.Scopes).ManagePrivileges
 	res.Valid = true
 	return res, nil
 }
 
-// validateSignupToken - used for validating the crypto token by sigup function
-func (s *Handler) validateSignupToken(ctx context.Context) (*userProto.User, error) {
+// maxValidateTokens - the maximum amount of tokens ValidateTokens accepts in one request
+const maxValidateTokens = 500
+
+// ValidateTokens - validates many tokens at once. The token collection and the users are queried
+// once for all tokens, and the privilege service is called once per distinct privilege. Like Introspect
+// it is only answered for clients with valid credentials, since it describes tokens of every organization.
+func (s *Handler) ValidateTokens(ctx context.Context, req *ValidateTokensRequest) (*ValidateTokensResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	clientID, err := s.authenticatedClientHelper(ctx)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate client with err %v", err))
+		return &ValidateTokensResponse{}, err
+	}
+
+	// the audience of a service is its client id, s.t. a service cannot validate tokens meant for another
+	if req.Audience != "" && req.Audience != clientID {
+		s.zapLog.Error(fmt.Sprintf("Client %s validated tokens for %s", clientID, req.Audience))
+		return &ValidateTokensResponse{}, errors.New("Audience must be the client id")
+	}
+
+	if len(req.Tokens) > maxValidateTokens {
+		s.zapLog.Error(fmt.Sprintf("Too many tokens in request: %d", len(req.Tokens)))
+		return &ValidateTokensResponse{}, fmt.Errorf("Cannot validate more than %d tokens at once", maxValidateTokens)
+	}
+
+	results := make([]*TokenValidation, len(req.Tokens))
+	for i := range req.Tokens {
+		results[i] = &TokenValidation{}
+	}
+
+	claims, decodeErrs, err := s.crypto.DecodeMany(ctx, req.Tokens, s.crypto.GetUserCryptoKey())
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not decode tokens with err %v", err))
+		return &ValidateTokensResponse{}, err
+	}
+
+	// find the users of every decoded token
+	userIDs := []string{}
+	for i, tokenClaims := range claims {
+		if decodeErrs[i] != nil {
+			results[i].Error = decodeErrs[i].Error()
+			continue
+		}
+		if tokenClaims.User == nil || tokenClaims.User.Id == "" {
+			results[i].Error = "Invalid user"
+			continue
+		}
+		results[i].Audience = tokenClaims.Audience
+		if (tokenClaims.Audience != "" && tokenClaims.Audience != clientID) || (req.Audience != "" && tokenClaims.Audience == "") {
+			results[i].Error = "Token is not meant for the audience"
+			continue
+		}
+		userIDs = append(userIDs, tokenClaims.User.Id)
+	}
+
+	users := map[string]*repository.User{}
+	if len(userIDs) > 0 {
+		// tokens of every organization can be validated, the organization of each token is checked below
+		foundUsers, err := s.repository.GetMany(tenant.WithAllOrganizations(ctx), userIDs)
+		if err != nil {
+			s.zapLog.Error(fmt.Sprintf("Could not get users with err %v", err))
+			return &ValidateTokensResponse{}, err
+		}
+		for _, user := range foundUsers {
+			users[user.ID] = user
+		}
+	}
+
+	// get the privileges of the users, each privilege is only fetched once
+	privileges := map[string]*privilegeProto.Privilege{}
+	organizationPrivileges := map[string]error{}
+	for i, result := range results {
+		if result.Error != "" {
+			continue
+		}
+		user, ok := users[claims[i].User.Id]
+		if !ok {
+			result.Error = "User does not exist"
+			continue
+		}
+		if err := s.tokenUserHelper(ctx, claims[i], user); err != nil {
+			result.Error = status.Convert(err).Message()
+			continue
+		}
+		if user.OrgID != "" {
+			key := user.OrgID + "/" + user.PrivilegeID
+			if _, ok := organizationPrivileges[key]; !ok {
+				organizationPrivileges[key] = s.organizationPrivilegeHelper(ctx, user.OrgID, user.PrivilegeID)
+			}
+			if err := organizationPrivileges[key]; err != nil {
+				result.Error = err.Error()
+				continue
+			}
+		}
+		privilege, ok := privileges[user.PrivilegeID]
+		if !ok {
+			privilegeResponse, err := s.privilegeClient.Get(ctx, &privilegeProto.Privilege{Id: user.PrivilegeID})
+			if err != nil {
+				s.zapLog.Error(fmt.Sprintf("Could not get users privileges with err %v", err))
+				return &ValidateTokensResponse{}, err
+			}
+			privilege = privilegeResponse.Privilege
+			privileges[user.PrivilegeID] = privilege
+		}
+		tokenPrivilege := restrictPrivilege(privilege, claims[i].Scopes)
+		result.Valid = true
+		result.UserID = user.ID
+		result.ManagePrivileges = tokenPrivilege.ManagePrivileges
+		result.Privilege = tokenPrivilege
+		result.Groups = claims[i].Groups
+	}
+
+	// return result
+	res := &ValidateTokensResponse{}
+	res.Results = results
+	return res, nil
+}
+
+// validateSignupToken - used for validating the crypto token by sigup function. The claims
+// also hold the organization the new user signs up to.
+func (s *Handler) validateSignupToken(ctx context.Context) (*crypto.CustomClaims, error) {
 	meta, ok := metadata.FromIncomingContext(ctx)
 
 	if !ok {
@@ -1009,11 +1502,94 @@ func (s *Handler) validateSignupToken(ctx context.Context) (*userProto.User, err
 		s.zapLog.Error("Invalid user")
 		return nil, errors.New("Invalid user")
 	}
-	return claims.User, nil
+	return claims, nil
+}
+
+// principal - the authenticated caller of a request. privilege is already restricted
+// to the scopes of the token. Only callers authenticated by a JWT token have claims.
+type principal struct {
+	user           *userProto.User
+	organizationID string
+	claims         *crypto.CustomClaims
+	apiKey         *crypto.APIKey
+	personalToken  *crypto.PersonalAccessToken
+	privilege      *privilegeProto.Privilege
+}
+
+// root - returns whether the caller is the root user, the only user who sees every organization.
+// An admin flag on a user of an organization does not let the user leave the organization.
+func (p *principal) root() bool {
+	return p.user.Admin && p.organizationID == ""
+}
+
+// tenantContext - returns a context, which only lets the repository see the organization of the caller,
+// and makes the audit log record the caller as the actor
+func (p *principal) tenantContext(ctx context.Context) context.Context {
+	impersonatorID := ""
+	if p.impersonated() {
+		impersonatorID = p.claims.ImpersonatorID
+	}
+	ctx = withActor(ctx, p.user.Id, impersonatorID)
+
+	if p.root() {
+		return tenant.WithAllOrganizations(ctx)
+	}
+	return tenant.WithOrganization(ctx, p.organizationID)
+}
+
+// impersonated - returns whether the caller is another user impersonating the user
+func (p *principal) impersonated() bool {
+	return p.claims != nil && p.claims.ImpersonatorID != ""
+}
+
+// delegated - returns whether the caller is a service using a token it got by a token exchange
+func (p *principal) delegated() bool {
+	return p.claims != nil && p.claims.Act != nil
+}
+
+// scoped - returns whether the caller is restricted to the scopes of its token
+func (p *principal) scoped() bool {
+	return (p.claims != nil && len(p.claims.Scopes) > 0) || p.personalToken != nil
+}
+
+// validateTokenHelper - helper function to validate tokens inside functions in Handler. The caller
+// needs the permissions rpc requires in the permission registry. The returned context only lets
+// the repository see the organization of the caller.
+func (s *Handler) validateTokenHelper(ctx context.Context, rpc string) (context.Context, *userProto.User, error) {
+	caller, err := s.authenticateHelper(ctx)
+	if err != nil {
+		return ctx, nil, err
+	}
+
+	if err := s.authorizeHelper(caller, rpc); err != nil {
+		return ctx, nil, err
+	}
+
+	return caller.tenantContext(ctx), caller.user, nil
 }
 
-// validateTokenHelper - helper function to validate tokens inside functions in Handler
-func (s *Handler) validateTokenHelper(ctx context.Context, privilege *privilegeProto.Privilege) (*userProto.User, error) {
+// sensitiveActionHelper - like validateTokenHelper, but refuses impersonation tokens. Used for
+// actions only the user him/herself should be able to do, eg. changing password or privileges.
+func (s *Handler) sensitiveActionHelper(ctx context.Context, rpc string) (context.Context, *principal, error) {
+	caller, err := s.authenticateHelper(ctx)
+	if err != nil {
+		return ctx, nil, err
+	}
+
+	if caller.impersonated() {
+		s.zapLog.Error(fmt.Sprintf("User %s tried a sensitive action while impersonating user %s", caller.claims.ImpersonatorID, caller.user.Id))
+		return ctx, nil, errors.New("Not allowed while impersonating")
+	}
+
+	if err := s.authorizeHelper(caller, rpc); err != nil {
+		return ctx, nil, err
+	}
+
+	return caller.tenantContext(ctx), caller, nil
+}
+
+// authenticateHelper - finds the caller of a request from the token or api key in the context
+func (s *Handler) authenticateHelper(ctx context.Context) (*principal, error) {
 	meta, ok := metadata.FromIncomingContext(ctx)
 
 	if !ok {
@@ -1021,6 +1597,10 @@ func (s *Handler) validateTokenHelper(ctx context.Context, privilege *privilegeP
 		return nil, errors.New("Could not validate token")
 	}
 
+	if apiKey := meta["api-key"]; len(apiKey) > 0 && strings.TrimSpace(apiKey[0]) != "" {
+		return s.authenticateAPIKeyHelper(ctx, apiKey[0])
+	}
+
 	token := meta["token"]
 
 	if len(token) == 0 {
@@ -1033,6 +1613,10 @@ func (s *Handler) validateTokenHelper(ctx context.Context, privilege *privilegeP
 		return nil, errors.New("Token is empty")
 	}
 
+	if crypto.IsPersonalAccessToken(token[0]) {
+		return s.authenticatePersonalAccessTokenHelper(ctx, token[0])
+	}
+
 	claims, err := s.crypto.Decode(context.Background(), token[0], s.crypto.GetUserCryptoKey())
 	if err != nil {
 		return nil, err
@@ -1043,51 +1627,126 @@ func (s *Handler) validateTokenHelper(ctx context.Context, privilege *privilegeP
 		return nil, errors.New("Invalid user")
 	}
 
-	// validate that user actually exists
-	actualUser, err := s.repository.Get(ctx, repository.MarshalUser(claims.User))
+	// tokens meant for other services cannot be used here
+	if claims.Audience != "" && claims.Audience != crypto.Issuer {
+		s.zapLog.Error(fmt.Sprintf("Token is meant for %s", claims.Audience))
+		return nil, errors.New("Token is not meant for the user service")
+	}
+
+	// validate that user actually exists, the organization of the caller is not known yet
+	actualUser, err := s.repository.Get(tenant.WithAllOrganizations(ctx), repository.MarshalUser(claims.User))
 	if err != nil {
 		s.zapLog.Error(fmt.Sprintf("Could not get authUser with err  %v", err))
 		return nil, err
 	}
 
-	if actualUser.Blocked {
-		s.zapLog.Error("User is blocked")
-		return nil, errors.New("User is blocked")
+	if err := s.tokenUserHelper(ctx, claims, actualUser); err != nil {
+		return nil, err
+	}
+
+	// every impersonated request is logged
+	if claims.ImpersonatorID != "" {
+		method, _ := grpc.Method(ctx)
+		s.zapLog.Info(fmt.Sprintf("User %s called %s impersonating user %s", claims.ImpersonatorID, method, actualUser.ID))
 	}
 
 	// get users privileges
-	privilegeResponse, err := s.privilegeClient.Get(ctx, &privilegeProto.Privilege{Id: actualUser.PrivilegeID})
+	privilege, err := s.privilegeHelper(ctx, actualUser)
 	if err != nil {
-		s.zapLog.Error(fmt.Sprintf("Could not get users privileges with err %v", err))
 		return nil, err
 	}
 
-	// check if we desire the privilege, we also have it
-	resultPrivilege := privilegeResponse.Privilege
-	if privilege.ViewAllUsers && !resultPrivilege.ViewAllUsers {
-		s.zapLog.Error("User do not have view privileges")
-		return nil, errors.New("User do not have view privileges")
+	return &principal{
+		user:           repository.UnmarshalUser(actualUser),
+		organizationID: actualUser.OrgID,
+		claims:         claims,
+		privilege:      restrictPrivilege(privilege, claims.Scopes),
+	}, nil
+}
+
+// tokenUserHelper - checks a decoded token against its user. Every path accepting user tokens runs
+// these checks, s.t. a token refused by one path is not valid to another.
+func (s *Handler) tokenUserHelper(ctx context.Context, claims *crypto.CustomClaims, user *repository.User) error {
+	if err := activeHelper(user); err != nil {
+		s.zapLog.Error(fmt.Sprintf("User %s is not active with err %v", user.ID, err))
+		return err
 	}
-	if privilege.CreateUser && !resultPrivilege.CreateUser {
-		s.zapLog.Error("User do not have create privileges")
-		return nil, errors.New("User do not have create privileges")
+
+	// service accounts only authenticate with api keys, s.t. the checks of the key and its owner apply
+	if user.ServiceAccount {
+		s.zapLog.Error(fmt.Sprintf("Service account %s tried to authenticate with a token", user.ID))
+		return errors.New("Service accounts authenticate with api keys")
 	}
-	if privilege.ManagePrivileges && !resultPrivilege.ManagePrivileges {
-		s.zapLog.Error("User do not have manage privileges")
-		return nil, errors.New("User do not have manage privileges")
+
+	// tokens issued before the user moved to another organization cannot be used
+	if claims.OrgID != user.OrgID {
+		s.zapLog.Error(fmt.Sprintf("Token of user %s belongs to organization %s", user.ID, claims.OrgID))
+		return errors.New("Token belongs to another organization")
 	}
-	if privilege.DeleteUser && !resultPrivilege.DeleteUser {
-		s.zapLog.Error("User do not have delete privileges")
-		return nil, errors.New("User do not have delete privileges")
+
+	// the impersonator must still be allowed to impersonate
+	if claims.ImpersonatorID != "" {
+		if err := s.impersonatorHelper(ctx, claims.ImpersonatorID, user); err != nil {
+			return err
+		}
 	}
-	if privilege.BlockUser && !resultPrivilege.BlockUser {
-		s.zapLog.Error("User do not have block privileges")
-		return nil, errors.New("User do not have block privileges")
+
+	return nil
+}
+
+// privilegeHelper - returns the privileges of a user. The privilege of a user in an organization must be
+// one of the privileges of the organization, s.t. a misconfigured user gets no privileges at all.
+func (s *Handler) privilegeHelper(ctx context.Context, user *repository.User) (*privilegeProto.Privilege, error) {
+	if user.OrgID != "" {
+		if err := s.organizationPrivilegeHelper(ctx, user.OrgID, user.PrivilegeID); err != nil {
+			return nil, err
+		}
 	}
-	if privilege.SendResetPasswordEmail && !resultPrivilege.SendResetPasswordEmail {
-		s.zapLog.Error("User do not have send reset email privileges")
-		return nil, errors.New("User do not have send reset email privileges")
+
+	privilegeResponse, err := s.privilegeClient.Get(ctx, &privilegeProto.Privilege{Id: user.PrivilegeID})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get users privileges with err %v", err))
+		return nil, err
+	}
+
+	return privilegeResponse.Privilege, nil
+}
+
+// authorizeHelper - checks that the caller has every permission rpc requires
+func (s *Handler) authorizeHelper(caller *principal, rpc string) error {
+	if err := s.permissions.Authorize(rpc, s.grantedHelper(caller)); err != nil {
+		s.zapLog.Error(fmt.Sprintf("User %s was denied %s with err %v", caller.user.Id, rpc, err))
+		return err
+	}
+	return nil
+}
+
+// imageHelper - replaces the image path of the user with a url of the image, which expires in an hour
+func (s *Handler) imageHelper(user *repository.User) {
+	imageURL, err := s.storage.Get(user.Image, time.Hour*1)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get user image from storage with err %v", err))
+		return
 	}
+	user.Image = imageURL
+}
 
-	return repository.UnmarshalUser(actualUser), nil
+// grantedHelper - returns the permissions of the caller. Only the root user acting as him/herself
+// has the root permission.
+func (s *Handler) grantedHelper(caller *principal) permission.Set {
+	granted := s.permissions.Granted(caller.privilege, caller.scoped())
+	granted[permission.Root] = caller.root() && !caller.scoped() && !caller.impersonated() && !caller.delegated()
+	return granted
+}
+
+// viewUserHelper - checks that the caller can call rpc for the user with userID. Every user can see
+// his/her own data, the data of other users requires the permissions registered for permission.OtherUser(rpc).
+func (s *Handler) viewUserHelper(caller *principal, rpc string, userID string) error {
+	if err := s.authorizeHelper(caller, rpc); err != nil {
+		return err
+	}
+	if userID == caller.user.Id {
+		return nil
+	}
+	return s.authorizeHelper(caller, permission.OtherUser(rpc))
 }
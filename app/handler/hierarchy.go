@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	repository "github.com/softcorp-io/hqs-user-service/repository"
+	userProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+)
+
+// marshalChartUser - converts a user of the repository to an OrgChartUser
+func marshalChartUser(user *repository.User, depth int64) *OrgChartUser {
+	user.Password = ""
+	return &OrgChartUser{
+		User:            repository.UnmarshalUser(user),
+		ManagerId:       user.ManagerID,
+		ManagerOrphaned: user.ManagerOrphaned,
+		Depth:           depth,
+	}
+}
+
+// UpdateManager - sets the manager the user reports to. The manager must be an active user of the same
+// organization, who does not report to the user.
+func (s *Handler) UpdateManager(ctx context.Context, req *ManagerRequest) (*userProto.Response, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, caller, err := s.sensitiveActionHelper(ctx, "UpdateManager")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &userProto.Response{}, err
+	}
+
+	reqUser, err := s.repository.Get(ctx, &repository.User{ID: req.Id})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get reqUser with err  %v", err))
+		return &userProto.Response{}, err
+	}
+
+	// the root user cannot be updated, and service accounts report to their owner
+	if reqUser.Admin || reqUser.ServiceAccount {
+		s.zapLog.Error("Tried to set the manager of root user or service account")
+		return &userProto.Response{}, errors.New("User cannot have a manager")
+	}
+
+	if req.ManagerId != "" {
+		manager, err := s.repository.Get(ctx, &repository.User{ID: req.ManagerId})
+		if err != nil {
+			s.zapLog.Error(fmt.Sprintf("Could not get manager with err  %v", err))
+			return &userProto.Response{}, errors.New("Manager does not exist")
+		}
+		if !manager.Active() || manager.ServiceAccount {
+			s.zapLog.Error(fmt.Sprintf("Tried to set inactive user or service account %s as manager", manager.ID))
+			return &userProto.Response{}, errors.New("User cannot be a manager")
+		}
+	}
+
+	// check that the policy lets the user manage the other user
+	if err := s.policyHelper(ctx, caller, "UpdateManager", reqUser, nil); err != nil {
+		return &userProto.Response{}, err
+	}
+
+	before := copyUserHelper(reqUser)
+	reqUser.ManagerID = req.ManagerId
+	if err := s.repository.UpdateManager(ctx, reqUser); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not update manager with err %v", err))
+		return &userProto.Response{}, err
+	}
+	if err := s.auditUserHelper(ctx, "UpdateManager", reqUser.ID, before); err != nil {
+		return &userProto.Response{}, err
+	}
+
+	// return result
+	res := &userProto.Response{}
+	reqUser.Password = ""
+	res.User = repository.UnmarshalUser(reqUser)
+	return res, nil
+}
+
+// GetDirectReports - returns the users the user with Id manages directly.
+func (s *Handler) GetDirectReports(ctx context.Context, req *ManagerRequest) (*OrgChartResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, user, err := s.orgChartHelper(ctx, "GetDirectReports", req.Id)
+	if err != nil {
+		return &OrgChartResponse{}, err
+	}
+
+	reports, err := s.repository.GetDirectReports(ctx, user)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get direct reports with err %v", err))
+		return &OrgChartResponse{}, err
+	}
+
+	// return result
+	res := &OrgChartResponse{}
+	res.Users = []*OrgChartUser{}
+	for _, report := range reports {
+		res.Users = append(res.Users, marshalChartUser(report, 0))
+	}
+	return res, nil
+}
+
+// GetReports - returns every user below the user with Id in the org chart.
+func (s *Handler) GetReports(ctx context.Context, req *ManagerRequest) (*OrgChartResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, user, err := s.orgChartHelper(ctx, "GetReports", req.Id)
+	if err != nil {
+		return &OrgChartResponse{}, err
+	}
+
+	reports, err := s.repository.GetReports(ctx, user)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get reports with err %v", err))
+		return &OrgChartResponse{}, err
+	}
+
+	// return result
+	res := &OrgChartResponse{}
+	res.Users = []*OrgChartUser{}
+	for _, report := range reports {
+		res.Users = append(res.Users, marshalChartUser(&report.User, report.Depth))
+	}
+	return res, nil
+}
+
+// GetManagementChain - returns the managers above the user with Id, starting with the direct manager.
+func (s *Handler) GetManagementChain(ctx context.Context, req *ManagerRequest) (*OrgChartResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, user, err := s.orgChartHelper(ctx, "GetManagementChain", req.Id)
+	if err != nil {
+		return &OrgChartResponse{}, err
+	}
+
+	chain, err := s.repository.GetManagementChain(ctx, user)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get management chain with err %v", err))
+		return &OrgChartResponse{}, err
+	}
+
+	// return result
+	res := &OrgChartResponse{}
+	res.Users = []*OrgChartUser{}
+	for _, manager := range chain {
+		res.Users = append(res.Users, marshalChartUser(&manager.User, manager.Depth))
+	}
+	return res, nil
+}
+
+// orgChartHelper - authenticates the caller and finds the user the org chart is made for. An empty
+// userID is the caller. The returned context is scoped to the organization of the caller.
+func (s *Handler) orgChartHelper(ctx context.Context, rpc string, userID string) (context.Context, *repository.User, error) {
+	caller, err := s.authenticateHelper(ctx)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return ctx, nil, err
+	}
+	ctx = caller.tenantContext(ctx)
+
+	if userID == "" {
+		userID = caller.user.Id
+	}
+	if err := s.viewUserHelper(caller, rpc, userID); err != nil {
+		return ctx, nil, err
+	}
+
+	user, err := s.repository.Get(ctx, &repository.User{ID: userID})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get user with err  %v", err))
+		return ctx, nil, err
+	}
+
+	return ctx, user, nil
+}
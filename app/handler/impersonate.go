@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	repository "github.com/softcorp-io/hqs-user-service/repository"
+	tenant "github.com/softcorp-io/hqs-user-service/tenant"
+	privilegeProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_privilege_service"
+	userProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Impersonate - lets a user with the impersonate permission act as another user. The returned token is
+// short lived, cannot be used for sensitive actions and every request made with it is logged. The
+// impersonation is added to the auth history of the impersonated user.
+func (s *Handler) Impersonate(ctx context.Context, req *userProto.User) (*userProto.Token, error) {
+	s.zapLog.Info("Recieved new request")
+
+	caller, err := s.authenticateHelper(ctx)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &userProto.Token{}, err
+	}
+	ctx = caller.tenantContext(ctx)
+
+	// only a login can be used to impersonate, not scoped or exchanged tokens, api keys or another impersonation
+	if caller.claims == nil || len(caller.claims.Scopes) > 0 || caller.impersonated() || caller.delegated() {
+		s.zapLog.Error("Tried to impersonate without a login")
+		return &userProto.Token{}, errors.New("Impersonation requires a login")
+	}
+
+	if err := s.authorizeHelper(caller, "Impersonate"); err != nil {
+		return &userProto.Token{}, err
+	}
+
+	subject, err := s.repository.Get(ctx, &repository.User{ID: req.Id})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get user to impersonate with err %v", err))
+		return &userProto.Token{}, err
+	}
+
+	if subject.ID == caller.user.Id {
+		s.zapLog.Error("Tried to impersonate self")
+		return &userProto.Token{}, errors.New("Cannot impersonate yourself")
+	}
+
+	// the root user and service accounts cannot be impersonated
+	if subject.Admin || subject.ServiceAccount {
+		s.zapLog.Error("Tried to impersonate root user or service account")
+		return &userProto.Token{}, errors.New("User cannot be impersonated")
+	}
+
+	if !subject.Active() {
+		s.zapLog.Error("Tried to impersonate user, who is not active")
+		return &userProto.Token{}, errors.New("User is not active")
+	}
+
+	// check that the policy lets the user impersonate the other user, eg. not one with a higher privilege
+	if err := s.policyHelper(ctx, caller, "Impersonate", subject, nil); err != nil {
+		return &userProto.Token{}, err
+	}
+
+	// the token belongs to the organization of the impersonated user
+	token, id, err := s.crypto.EncodeImpersonation(tenant.WithOrganization(ctx, subject.OrgID), repository.UnmarshalUser(subject), caller.user.Id, s.crypto.GetUserCryptoKey(), s.crypto.GetImpersonationTokenTTL())
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not encode impersonation token with err %v", err))
+		return &userProto.Token{}, err
+	}
+
+	// the impersonated user can see the impersonation in his/her auth history
+	if err = s.crypto.AddAuthToHistory(ctx, repository.UnmarshalUser(subject), token, "impersonation", s.crypto.GetUserCryptoKey()); err != nil {
+		s.zapLog.Warn(fmt.Sprintf("Could not add to auth history with err : %v", err))
+	}
+
+	s.zapLog.Info(fmt.Sprintf("User %s started impersonating user %s with token %s", caller.user.Id, subject.ID, id))
+	if err := s.auditHelper(ctx, "Impersonate", subject.ID, nil, bson.M{"token_id": id}); err != nil {
+		return &userProto.Token{}, err
+	}
+
+	// return result
+	res := &userProto.Token{}
+	res.Token = token
+	res.Id = id
+
+	return res, nil
+}
+
+// impersonatorHelper - checks that the impersonator of a token still exists, is allowed to impersonate
+// and is in the organization of the impersonated user, unless the impersonator is root.
+func (s *Handler) impersonatorHelper(ctx context.Context, impersonatorID string, subject *repository.User) error {
+	impersonator, err := s.repository.Get(tenant.WithAllOrganizations(ctx), &repository.User{ID: impersonatorID})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get impersonator with err %v", err))
+		return errors.New("Invalid impersonator")
+	}
+
+	if impersonator.OrgID != subject.OrgID && !(impersonator.Admin && impersonator.OrgID == "") {
+		s.zapLog.Error(fmt.Sprintf("User %s impersonated user %s of another organization", impersonatorID, subject.ID))
+		return errors.New("Invalid impersonator")
+	}
+
+	// impersonate is a named permission, so only the privilege id is needed
+	granted := s.permissions.Granted(&privilegeProto.Privilege{Id: impersonator.PrivilegeID}, false)
+	if !impersonator.Active() || s.permissions.Authorize("Impersonate", granted) != nil {
+		s.zapLog.Error(fmt.Sprintf("User %s is no longer allowed to impersonate", impersonatorID))
+		return errors.New("Invalid impersonator")
+	}
+
+	return nil
+}
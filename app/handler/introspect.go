@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	crypto "github.com/softcorp-io/hqs-user-service/crypto"
+	repository "github.com/softcorp-io/hqs-user-service/repository"
+	tenant "github.com/softcorp-io/hqs-user-service/tenant"
+	privilegeProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_privilege_service"
+	"google.golang.org/grpc/metadata"
+)
+
+// Introspect - describes a token to another hqs service, following RFC 7662. The calling service
+// authenticates with its client_id and client_secret in the context metadata. Tokens that cannot
+// be used return a response where only Active is set to false.
+func (s *Handler) Introspect(ctx context.Context, req *IntrospectRequest) (*IntrospectResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	if err := s.validateClientHelper(ctx); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate client with err %v", err))
+		return &IntrospectResponse{}, err
+	}
+
+	return s.introspect(ctx, req.Token)
+}
+
+// IntrospectHTTP - http variant of Introspect. Expects a POST with a form encoded token and the
+// calling service's credentials as basic auth.
+func (s *Handler) IntrospectHTTP(w http.ResponseWriter, r *http.Request) {
+	s.zapLog.Info("Recieved new request")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostFormValue("client_id")
+		clientSecret = r.PostFormValue("client_secret")
+	}
+	if err := s.crypto.AuthenticateClient(clientID, clientSecret); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate client with err %v", err))
+		w.Header().Set("WWW-Authenticate", `Basic realm="hqs"`)
+		http.Error(w, "invalid client", http.StatusUnauthorized)
+		return
+	}
+
+	res, err := s.introspect(r.Context(), r.PostFormValue("token"))
+	if err != nil {
+		http.Error(w, "could not introspect token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not write introspection response with err %v", err))
+	}
+}
+
+// introspect - builds the introspection response of a token. Only failures of the
+// privilege service are returned as errors, everything else makes the token inactive.
+func (s *Handler) introspect(ctx context.Context, token string) (*IntrospectResponse, error) {
+	inactive := &IntrospectResponse{Active: false}
+
+	if strings.TrimSpace(token) == "" {
+		return inactive, nil
+	}
+
+	claims, err := s.crypto.Decode(ctx, token, s.crypto.GetUserCryptoKey())
+	if err != nil {
+		s.zapLog.Info(fmt.Sprintf("Introspected token is not active with err %v", err))
+		return inactive, nil
+	}
+
+	if claims.User.Id == "" {
+		return inactive, nil
+	}
+
+	// the user must still be in the organization of the token
+	user, err := s.repository.Get(tenant.WithOrganization(ctx, claims.OrgID), repository.MarshalUser(claims.User))
+	if err != nil {
+		s.zapLog.Info(fmt.Sprintf("Introspected token has no user with err %v", err))
+		return inactive, nil
+	}
+
+	if !user.Active() {
+		return inactive, nil
+	}
+
+	if user.OrgID != "" && s.organizationPrivilegeHelper(ctx, user.OrgID, user.PrivilegeID) != nil {
+		return inactive, nil
+	}
+
+	privilegeResponse, err := s.privilegeClient.Get(ctx, &privilegeProto.Privilege{Id: user.PrivilegeID})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get users privileges with err %v", err))
+		return &IntrospectResponse{}, err
+	}
+
+	privilege := restrictPrivilege(privilegeResponse.Privilege, claims.Scopes)
+
+	res := &IntrospectResponse{}
+	res.Active = true
+	res.Scope = strings.Join(privilegeScopes(privilege), " ")
+	res.ClientID = crypto.Issuer
+	if claims.Act != nil {
+		res.ClientID = claims.Act.Subject
+	}
+	res.Username = user.Email
+	res.TokenType = "Bearer"
+	res.Exp = claims.ExpiresAt
+	res.Iat = claims.IssuedAt
+	res.Sub = user.ID
+	res.Aud = claims.Audience
+	res.Iss = claims.Issuer
+	res.Jti = claims.ID
+	res.Act = actorHelper(claims.Act)
+	res.OrgID = user.OrgID
+	res.Groups = claims.Groups
+	res.Privilege = privilege
+	return res, nil
+}
+
+// validateClientHelper - validates the client credentials a calling service put in the context
+func (s *Handler) validateClientHelper(ctx context.Context) error {
+	_, err := s.authenticatedClientHelper(ctx)
+	return err
+}
+
+// authenticatedClientHelper - authenticates the calling service by its client credentials and returns its
+// client id, which is the audience of the tokens meant for the service
+func (s *Handler) authenticatedClientHelper(ctx context.Context) (string, error) {
+	clientID, clientSecret, err := s.clientCredentialsHelper(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.crypto.AuthenticateClient(clientID, clientSecret); err != nil {
+		return "", err
+	}
+	return clientID, nil
+}
+
+// actorHelper - converts the act claim of a token to its message
+func actorHelper(act *crypto.Actor) *Actor {
+	if act == nil {
+		return nil
+	}
+	return &Actor{Subject: act.Subject, Act: actorHelper(act.Act)}
+}
+
+// clientCredentialsHelper - returns the client credentials a calling service put in the context
+func (s *Handler) clientCredentialsHelper(ctx context.Context) (string, string, error) {
+	meta, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", "", errors.New("Could not validate client")
+	}
+
+	clientID := meta["client_id"]
+	clientSecret := meta["client_secret"]
+	if len(clientID) == 0 || len(clientSecret) == 0 {
+		return "", "", errors.New("Missing client_id or client_secret header in context")
+	}
+
+	return clientID[0], clientSecret[0], nil
+}
@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	repository "github.com/softcorp-io/hqs-user-service/repository"
+	tenant "github.com/softcorp-io/hqs-user-service/tenant"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// statusErrorDomain - the domain of the error info sent when a user is not active
+const statusErrorDomain = "hqs.user.service"
+
+// activeHelper - returns an error if the user is not active. The error is a FailedPrecondition status,
+// whose ErrorInfo reason names the status of the user, eg. USER_SUSPENDED.
+func activeHelper(user *repository.User) error {
+	current := user.StatusAt(time.Now())
+	if current == repository.StatusActive {
+		return nil
+	}
+
+	metadata := map[string]string{"status": string(current)}
+	message := fmt.Sprintf("The user is %s", strings.Replace(string(current), "_", " ", -1))
+	if current == repository.StatusSuspended && user.Suspension != nil {
+		// suspended users are told when they get access again
+		metadata["suspended_until"] = user.Suspension.End.Format(time.RFC3339)
+		message = fmt.Sprintf("The user is suspended until %s", user.Suspension.End.Format(time.RFC3339))
+	}
+
+	st := status.New(codes.FailedPrecondition, message)
+	detailed, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason:   "USER_" + strings.ToUpper(string(current)),
+		Domain:   statusErrorDomain,
+		Metadata: metadata,
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// marshalUserStatus - converts the status of a user of the repository to a UserStatusResponse
+func marshalUserStatus(user *repository.User) *UserStatusResponse {
+	res := &UserStatusResponse{
+		Id:      user.ID,
+		Status:  string(user.StatusAt(time.Now())),
+		Changes: []*StatusChange{},
+	}
+	if user.Suspension != nil {
+		res.SuspendedReason = user.Suspension.Reason
+		res.SuspendedFrom, _ = ptypes.TimestampProto(user.Suspension.Start)
+		res.SuspendedUntil, _ = ptypes.TimestampProto(user.Suspension.End)
+	}
+	if !user.StatusUpdatedAt.IsZero() {
+		res.StatusUpdatedAt, _ = ptypes.TimestampProto(user.StatusUpdatedAt)
+	}
+	for _, change := range user.StatusChanges {
+		at, _ := ptypes.TimestampProto(change.At)
+		res.Changes = append(res.Changes, &StatusChange{
+			From:   string(change.From),
+			To:     string(change.To),
+			Reason: change.Reason,
+			By:     change.By,
+			At:     at,
+		})
+	}
+	return res
+}
+
+// UpdateUserStatus - changes the status of a user, eg. suspends the user until a given time. Only
+// transitions allowed by the lifecycle of a user are made, and every change is recorded on the user.
+func (s *Handler) UpdateUserStatus(ctx context.Context, req *UserStatusRequest) (*UserStatusResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, caller, err := s.sensitiveActionHelper(ctx, "UpdateUserStatus")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &UserStatusResponse{}, err
+	}
+
+	to, err := repository.ParseStatus(req.Status)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not parse status with err %v", err))
+		return &UserStatusResponse{}, err
+	}
+	if to == repository.StatusDeleted {
+		s.zapLog.Error("Tried to delete user by its status")
+		return &UserStatusResponse{}, errors.New("Users are deleted with Delete")
+	}
+
+	// a suspension starts now, unless it is scheduled to start later
+	var suspension *repository.Suspension
+	if to == repository.StatusSuspended {
+		suspension = &repository.Suspension{Reason: req.Reason, Start: time.Now(), By: caller.user.Id}
+		if req.SuspendedFrom != nil {
+			if suspension.Start, err = ptypes.Timestamp(req.SuspendedFrom); err != nil {
+				s.zapLog.Error(fmt.Sprintf("Could not parse suspended from with err %v", err))
+				return &UserStatusResponse{}, err
+			}
+		}
+		if req.SuspendedUntil == nil {
+			s.zapLog.Error("Tried to suspend user without an end")
+			return &UserStatusResponse{}, errors.New("Required end of the suspension")
+		}
+		if suspension.End, err = ptypes.Timestamp(req.SuspendedUntil); err != nil {
+			s.zapLog.Error(fmt.Sprintf("Could not parse suspended until with err %v", err))
+			return &UserStatusResponse{}, err
+		}
+	}
+
+	reqUser, err := s.repository.Get(ctx, &repository.User{ID: req.Id})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get reqUser with err  %v", err))
+		return &UserStatusResponse{}, err
+	}
+
+	// the root user cannot be updated
+	if reqUser.Admin {
+		s.zapLog.Error("Tried to update root user")
+		return &UserStatusResponse{}, errors.New("Root user is not updateable")
+	}
+
+	// check that the policy lets the user change the status of the other user
+	if err := s.policyHelper(ctx, caller, "UpdateUserStatus", reqUser, nil); err != nil {
+		return &UserStatusResponse{}, err
+	}
+
+	before := copyUserHelper(reqUser)
+	if err := s.updateStatusHelper(ctx, reqUser, &repository.StatusChange{To: to, Reason: req.Reason, By: caller.user.Id}, suspension); err != nil {
+		return &UserStatusResponse{}, err
+	}
+	if err := s.auditUserHelper(ctx, "UpdateUserStatus", reqUser.ID, before); err != nil {
+		return &UserStatusResponse{}, err
+	}
+
+	return marshalUserStatus(reqUser), nil
+}
+
+// GetUserStatus - returns the status of a user and the history of it. Every user can see his/her own
+// status, other users require view_all_users.
+func (s *Handler) GetUserStatus(ctx context.Context, req *UserStatusRequest) (*UserStatusResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	caller, err := s.authenticateHelper(ctx)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &UserStatusResponse{}, err
+	}
+	ctx = caller.tenantContext(ctx)
+
+	if req.Id == "" {
+		req.Id = caller.user.Id
+	}
+	if err := s.viewUserHelper(caller, "GetUserStatus", req.Id); err != nil {
+		return &UserStatusResponse{}, err
+	}
+
+	user, err := s.repository.Get(ctx, &repository.User{ID: req.Id})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get user with err  %v", err))
+		return &UserStatusResponse{}, err
+	}
+
+	return marshalUserStatus(user), nil
+}
+
+// ApplySuspensions - starts the suspensions, which are due, and lifts the suspensions, which have ended,
+// in every organization. Returns how many users changed status. Run by the suspension scheduler of the server.
+func (s *Handler) ApplySuspensions(ctx context.Context) (int, error) {
+	// the scheduler changes users of every organization
+	ctx = tenant.WithAllOrganizations(ctx)
+
+	users, err := s.repository.GetSuspensionChanges(ctx, time.Now())
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get suspension changes with err %v", err))
+		return 0, err
+	}
+
+	// a change missing in the audit log is returned after the other users are changed
+	changed := 0
+	var auditErr error
+	for _, user := range users {
+		change := &repository.StatusChange{To: repository.StatusActive, Reason: "The suspension ended"}
+		suspension := user.Suspension
+		if user.CurrentStatus() == repository.StatusActive {
+			change = &repository.StatusChange{To: repository.StatusSuspended, By: suspension.By}
+		}
+		before := copyUserHelper(user)
+		if err := s.updateStatusHelper(ctx, user, change, suspension); err != nil {
+			continue
+		}
+		if err := s.auditUserHelper(ctx, "ApplySuspensions", user.ID, before); err != nil {
+			auditErr = err
+		}
+		changed++
+	}
+
+	return changed, auditErr
+}
+
+// updateStatusHelper - changes the status of user and updates what depends on it. The reports of a user,
+// who is no longer active, are orphaned until the user is active again.
+func (s *Handler) updateStatusHelper(ctx context.Context, user *repository.User, change *repository.StatusChange, suspension *repository.Suspension) error {
+	wasActive := user.CurrentStatus() == repository.StatusActive
+
+	if err := s.repository.UpdateStatus(ctx, user, change, suspension); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not update status of user %s with err %v", user.ID, err))
+		return err
+	}
+
+	if isActive := user.CurrentStatus() == repository.StatusActive; wasActive != isActive {
+		if err := s.repository.FlagReports(ctx, user, !isActive); err != nil {
+			s.zapLog.Error(fmt.Sprintf("Could not flag orphaned reports with err %v", err))
+		}
+	}
+
+	return nil
+}
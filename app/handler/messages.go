@@ -0,0 +1,598 @@
+package handler
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	privilegeProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_privilege_service"
+	userProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+	"google.golang.org/grpc"
+)
+
+// The types below are request and response messages for RPCs that hqs_proto does not
+// define yet. They are protobuf messages like the generated ones, with the same field
+// numbers hqs_proto should give them, and are served by the ExtensionServiceDesc in
+// service.go until they are moved to hqs_proto.
+
+// IntrospectRequest - token introspection request, see RFC 7662 section 2.1.
+type IntrospectRequest struct {
+	Token         string `protobuf:"bytes,1,opt,name=token,proto3" json:"token"`
+	TokenTypeHint string `protobuf:"bytes,2,opt,name=token_type_hint,proto3" json:"token_type_hint,omitempty"`
+}
+
+func (m *IntrospectRequest) Reset()         { *m = IntrospectRequest{} }
+func (m *IntrospectRequest) String() string { return proto.CompactTextString(m) }
+func (*IntrospectRequest) ProtoMessage()    {}
+
+// IntrospectResponse - token introspection response, see RFC 7662 section 2.2.
+// Privilege holds the full privilege set of the token owner, and Act the services acting
+// on behalf of the user when the token was exchanged. OrgID is the organization of the user,
+// and Groups the groups the user was member of when the token was created.
+type IntrospectResponse struct {
+	Active    bool                      `protobuf:"varint,1,opt,name=active,proto3" json:"active"`
+	Scope     string                    `protobuf:"bytes,2,opt,name=scope,proto3" json:"scope,omitempty"`
+	ClientID  string                    `protobuf:"bytes,3,opt,name=client_id,proto3" json:"client_id,omitempty"`
+	Username  string                    `protobuf:"bytes,4,opt,name=username,proto3" json:"username,omitempty"`
+	TokenType string                    `protobuf:"bytes,5,opt,name=token_type,proto3" json:"token_type,omitempty"`
+	Exp       int64                     `protobuf:"varint,6,opt,name=exp,proto3" json:"exp,omitempty"`
+	Iat       int64                     `protobuf:"varint,7,opt,name=iat,proto3" json:"iat,omitempty"`
+	Sub       string                    `protobuf:"bytes,8,opt,name=sub,proto3" json:"sub,omitempty"`
+	Aud       string                    `protobuf:"bytes,12,opt,name=aud,proto3" json:"aud,omitempty"`
+	Iss       string                    `protobuf:"bytes,9,opt,name=iss,proto3" json:"iss,omitempty"`
+	Jti       string                    `protobuf:"bytes,10,opt,name=jti,proto3" json:"jti,omitempty"`
+	Act       *Actor                    `protobuf:"bytes,13,opt,name=act,proto3" json:"act,omitempty"`
+	OrgID     string                    `protobuf:"bytes,14,opt,name=org_id,proto3" json:"org_id,omitempty"`
+	Groups    []string                  `protobuf:"bytes,15,rep,name=groups,proto3" json:"groups,omitempty"`
+	Privilege *privilegeProto.Privilege `protobuf:"bytes,11,opt,name=privilege,proto3" json:"privilege,omitempty"`
+}
+
+func (m *IntrospectResponse) Reset()         { *m = IntrospectResponse{} }
+func (m *IntrospectResponse) String() string { return proto.CompactTextString(m) }
+func (*IntrospectResponse) ProtoMessage()    {}
+
+// Actor - the service acting on behalf of the user, and the actor it acts for in turn, see RFC 8693
+// section 4.1.
+type Actor struct {
+	Subject string `protobuf:"bytes,1,opt,name=sub,proto3" json:"sub"`
+	Act     *Actor `protobuf:"bytes,2,opt,name=act,proto3" json:"act,omitempty"`
+}
+
+func (m *Actor) Reset()         { *m = Actor{} }
+func (m *Actor) String() string { return proto.CompactTextString(m) }
+func (*Actor) ProtoMessage()    {}
+
+// ValidateTokensRequest - tokens to validate in a single call. Tokens meant for an audience are
+// only valid to the client with that id. Audience can only be the client id, and when it is set,
+// tokens without an audience are not valid.
+type ValidateTokensRequest struct {
+	Tokens   []string `protobuf:"bytes,1,rep,name=tokens,proto3" json:"tokens"`
+	Audience string   `protobuf:"bytes,2,opt,name=audience,proto3" json:"audience,omitempty"`
+}
+
+func (m *ValidateTokensRequest) Reset()         { *m = ValidateTokensRequest{} }
+func (m *ValidateTokensRequest) String() string { return proto.CompactTextString(m) }
+func (*ValidateTokensRequest) ProtoMessage()    {}
+
+// TokenValidation - the result of validating a single token. Error is set when Valid is false.
+type TokenValidation struct {
+	Valid            bool                      `protobuf:"varint,1,opt,name=valid,proto3" json:"valid"`
+	UserID           string                    `protobuf:"bytes,2,opt,name=user_id,proto3" json:"user_id,omitempty"`
+	Audience         string                    `protobuf:"bytes,6,opt,name=audience,proto3" json:"audience,omitempty"`
+	ManagePrivileges bool                      `protobuf:"varint,3,opt,name=manage_privileges,proto3" json:"manage_privileges,omitempty"`
+	Privilege        *privilegeProto.Privilege `protobuf:"bytes,4,opt,name=privilege,proto3" json:"privilege,omitempty"`
+	Groups           []string                  `protobuf:"bytes,7,rep,name=groups,proto3" json:"groups,omitempty"`
+	Error            string                    `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`
+}
+
+func (m *TokenValidation) Reset()         { *m = TokenValidation{} }
+func (m *TokenValidation) String() string { return proto.CompactTextString(m) }
+func (*TokenValidation) ProtoMessage()    {}
+
+// ValidateTokensResponse - one result per requested token, in the order of the request.
+type ValidateTokensResponse struct {
+	Results []*TokenValidation `protobuf:"bytes,1,rep,name=results,proto3" json:"results"`
+}
+
+func (m *ValidateTokensResponse) Reset()         { *m = ValidateTokensResponse{} }
+func (m *ValidateTokensResponse) String() string { return proto.CompactTextString(m) }
+func (*ValidateTokensResponse) ProtoMessage()    {}
+
+// ScopedTokenRequest - the scopes and audience of a new token. ExpiresIn is in seconds
+// and cannot exceed the ttl of a login token.
+type ScopedTokenRequest struct {
+	Scopes    []string `protobuf:"bytes,1,rep,name=scopes,proto3" json:"scopes"`
+	Audience  string   `protobuf:"bytes,2,opt,name=audience,proto3" json:"audience,omitempty"`
+	ExpiresIn int64    `protobuf:"varint,3,opt,name=expires_in,proto3" json:"expires_in,omitempty"`
+}
+
+func (m *ScopedTokenRequest) Reset()         { *m = ScopedTokenRequest{} }
+func (m *ScopedTokenRequest) String() string { return proto.CompactTextString(m) }
+func (*ScopedTokenRequest) ProtoMessage()    {}
+
+// ServiceAccountRequest - identifies or describes a service account.
+type ServiceAccountRequest struct {
+	Id          string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name        string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Description string `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
+	PrivilegeID string `protobuf:"bytes,4,opt,name=privilege_id,proto3" json:"privilege_id,omitempty"`
+}
+
+func (m *ServiceAccountRequest) Reset()         { *m = ServiceAccountRequest{} }
+func (m *ServiceAccountRequest) String() string { return proto.CompactTextString(m) }
+func (*ServiceAccountRequest) ProtoMessage()    {}
+
+// ServiceAccount - a non-human user owned by a user.
+type ServiceAccount struct {
+	Id          string               `protobuf:"bytes,1,opt,name=id,proto3" json:"id"`
+	Name        string               `protobuf:"bytes,2,opt,name=name,proto3" json:"name"`
+	Description string               `protobuf:"bytes,3,opt,name=description,proto3" json:"description"`
+	OwnerID     string               `protobuf:"bytes,4,opt,name=owner_id,proto3" json:"owner_id"`
+	PrivilegeID string               `protobuf:"bytes,5,opt,name=privilege_id,proto3" json:"privilege_id"`
+	Blocked     bool                 `protobuf:"varint,6,opt,name=blocked,proto3" json:"blocked"`
+	CreatedAt   *timestamp.Timestamp `protobuf:"bytes,7,opt,name=created_at,proto3" json:"created_at"`
+}
+
+func (m *ServiceAccount) Reset()         { *m = ServiceAccount{} }
+func (m *ServiceAccount) String() string { return proto.CompactTextString(m) }
+func (*ServiceAccount) ProtoMessage()    {}
+
+// ServiceAccountResponse - a single service account or a list of them.
+type ServiceAccountResponse struct {
+	ServiceAccount  *ServiceAccount   `protobuf:"bytes,1,opt,name=service_account,proto3" json:"service_account,omitempty"`
+	ServiceAccounts []*ServiceAccount `protobuf:"bytes,2,rep,name=service_accounts,proto3" json:"service_accounts,omitempty"`
+}
+
+func (m *ServiceAccountResponse) Reset()         { *m = ServiceAccountResponse{} }
+func (m *ServiceAccountResponse) String() string { return proto.CompactTextString(m) }
+func (*ServiceAccountResponse) ProtoMessage()    {}
+
+// APIKeyRequest - identifies an api key of a service account, or names a new one.
+type APIKeyRequest struct {
+	Id               string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	ServiceAccountID string `protobuf:"bytes,2,opt,name=service_account_id,proto3" json:"service_account_id"`
+	Name             string `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+}
+
+func (m *APIKeyRequest) Reset()         { *m = APIKeyRequest{} }
+func (m *APIKeyRequest) String() string { return proto.CompactTextString(m) }
+func (*APIKeyRequest) ProtoMessage()    {}
+
+// APIKey - describes an api key. The key itself is never part of it.
+type APIKey struct {
+	Id               string               `protobuf:"bytes,1,opt,name=id,proto3" json:"id"`
+	Prefix           string               `protobuf:"bytes,2,opt,name=prefix,proto3" json:"prefix"`
+	Name             string               `protobuf:"bytes,3,opt,name=name,proto3" json:"name"`
+	ServiceAccountID string               `protobuf:"bytes,4,opt,name=service_account_id,proto3" json:"service_account_id"`
+	LastUsedAt       *timestamp.Timestamp `protobuf:"bytes,5,opt,name=last_used_at,proto3" json:"last_used_at"`
+	CreatedAt        *timestamp.Timestamp `protobuf:"bytes,6,opt,name=created_at,proto3" json:"created_at"`
+}
+
+func (m *APIKey) Reset()         { *m = APIKey{} }
+func (m *APIKey) String() string { return proto.CompactTextString(m) }
+func (*APIKey) ProtoMessage()    {}
+
+// APIKeyResponse - Key is only set when the key was just created.
+type APIKeyResponse struct {
+	Key     string    `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	APIKey  *APIKey   `protobuf:"bytes,2,opt,name=api_key,proto3" json:"api_key,omitempty"`
+	APIKeys []*APIKey `protobuf:"bytes,3,rep,name=api_keys,proto3" json:"api_keys,omitempty"`
+}
+
+func (m *APIKeyResponse) Reset()         { *m = APIKeyResponse{} }
+func (m *APIKeyResponse) String() string { return proto.CompactTextString(m) }
+func (*APIKeyResponse) ProtoMessage()    {}
+
+// PersonalAccessTokenRequest - identifies a personal access token, or describes a new one.
+// ExpiresIn is in seconds.
+type PersonalAccessTokenRequest struct {
+	Id        string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name      string   `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Scopes    []string `protobuf:"bytes,3,rep,name=scopes,proto3" json:"scopes,omitempty"`
+	ExpiresIn int64    `protobuf:"varint,4,opt,name=expires_in,proto3" json:"expires_in,omitempty"`
+}
+
+func (m *PersonalAccessTokenRequest) Reset()         { *m = PersonalAccessTokenRequest{} }
+func (m *PersonalAccessTokenRequest) String() string { return proto.CompactTextString(m) }
+func (*PersonalAccessTokenRequest) ProtoMessage()    {}
+
+// PersonalAccessToken - describes a personal access token. The token itself is never part of it.
+type PersonalAccessToken struct {
+	Id         string               `protobuf:"bytes,1,opt,name=id,proto3" json:"id"`
+	Prefix     string               `protobuf:"bytes,2,opt,name=prefix,proto3" json:"prefix"`
+	Name       string               `protobuf:"bytes,3,opt,name=name,proto3" json:"name"`
+	Scopes     []string             `protobuf:"bytes,4,rep,name=scopes,proto3" json:"scopes"`
+	LastUsedAt *timestamp.Timestamp `protobuf:"bytes,5,opt,name=last_used_at,proto3" json:"last_used_at"`
+	ExpiresAt  *timestamp.Timestamp `protobuf:"bytes,6,opt,name=expires_at,proto3" json:"expires_at"`
+	CreatedAt  *timestamp.Timestamp `protobuf:"bytes,7,opt,name=created_at,proto3" json:"created_at"`
+}
+
+func (m *PersonalAccessToken) Reset()         { *m = PersonalAccessToken{} }
+func (m *PersonalAccessToken) String() string { return proto.CompactTextString(m) }
+func (*PersonalAccessToken) ProtoMessage()    {}
+
+// PersonalAccessTokenResponse - Token is only set when the token was just created.
+type PersonalAccessTokenResponse struct {
+	Token                string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	PersonalAccessToken  *PersonalAccessToken   `protobuf:"bytes,2,opt,name=personal_access_token,proto3" json:"personal_access_token,omitempty"`
+	PersonalAccessTokens []*PersonalAccessToken `protobuf:"bytes,3,rep,name=personal_access_tokens,proto3" json:"personal_access_tokens,omitempty"`
+}
+
+func (m *PersonalAccessTokenResponse) Reset()         { *m = PersonalAccessTokenResponse{} }
+func (m *PersonalAccessTokenResponse) String() string { return proto.CompactTextString(m) }
+func (*PersonalAccessTokenResponse) ProtoMessage()    {}
+
+// TokenExchangeRequest - token exchange request, see RFC 8693 section 2.1. Scope is space
+// separated, and left empty the scopes of the subject token are kept.
+type TokenExchangeRequest struct {
+	GrantType        string `protobuf:"bytes,1,opt,name=grant_type,proto3" json:"grant_type"`
+	SubjectToken     string `protobuf:"bytes,2,opt,name=subject_token,proto3" json:"subject_token"`
+	SubjectTokenType string `protobuf:"bytes,3,opt,name=subject_token_type,proto3" json:"subject_token_type"`
+	Audience         string `protobuf:"bytes,4,opt,name=audience,proto3" json:"audience"`
+	Scope            string `protobuf:"bytes,5,opt,name=scope,proto3" json:"scope,omitempty"`
+}
+
+func (m *TokenExchangeRequest) Reset()         { *m = TokenExchangeRequest{} }
+func (m *TokenExchangeRequest) String() string { return proto.CompactTextString(m) }
+func (*TokenExchangeRequest) ProtoMessage()    {}
+
+// TokenExchangeResponse - token exchange response, see RFC 8693 section 2.2.
+type TokenExchangeResponse struct {
+	AccessToken     string `protobuf:"bytes,1,opt,name=access_token,proto3" json:"access_token"`
+	IssuedTokenType string `protobuf:"bytes,2,opt,name=issued_token_type,proto3" json:"issued_token_type"`
+	TokenType       string `protobuf:"bytes,3,opt,name=token_type,proto3" json:"token_type"`
+	ExpiresIn       int64  `protobuf:"varint,4,opt,name=expires_in,proto3" json:"expires_in"`
+	Scope           string `protobuf:"bytes,5,opt,name=scope,proto3" json:"scope,omitempty"`
+}
+
+func (m *TokenExchangeResponse) Reset()         { *m = TokenExchangeResponse{} }
+func (m *TokenExchangeResponse) String() string { return proto.CompactTextString(m) }
+func (*TokenExchangeResponse) ProtoMessage()    {}
+
+// UserProfileRequest - updates the Fields of the profile of User. Fields are named like the
+// stored fields, eg. title or country_code.
+type UserProfileRequest struct {
+	User   *userProto.User `protobuf:"bytes,1,opt,name=user,proto3" json:"user"`
+	Fields []string        `protobuf:"bytes,2,rep,name=fields,proto3" json:"fields"`
+}
+
+func (m *UserProfileRequest) Reset()         { *m = UserProfileRequest{} }
+func (m *UserProfileRequest) String() string { return proto.CompactTextString(m) }
+func (*UserProfileRequest) ProtoMessage()    {}
+
+// TeamRequest - moves the user with Id to Team
+type TeamRequest struct {
+	Id   string `protobuf:"bytes,1,opt,name=id,proto3" json:"id"`
+	Team string `protobuf:"bytes,2,opt,name=team,proto3" json:"team"`
+}
+
+func (m *TeamRequest) Reset()         { *m = TeamRequest{} }
+func (m *TeamRequest) String() string { return proto.CompactTextString(m) }
+func (*TeamRequest) ProtoMessage()    {}
+
+// Organization - a customer company. Its users can only be given the privileges in PrivilegeIds,
+// and new users get DefaultPrivilegeId.
+type Organization struct {
+	Id                 string               `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name               string               `protobuf:"bytes,2,opt,name=name,proto3" json:"name"`
+	PrivilegeIds       []string             `protobuf:"bytes,3,rep,name=privilege_ids,proto3" json:"privilege_ids"`
+	DefaultPrivilegeId string               `protobuf:"bytes,4,opt,name=default_privilege_id,proto3" json:"default_privilege_id"`
+	CreatedAt          *timestamp.Timestamp `protobuf:"bytes,5,opt,name=created_at,proto3" json:"created_at,omitempty"`
+}
+
+func (m *Organization) Reset()         { *m = Organization{} }
+func (m *Organization) String() string { return proto.CompactTextString(m) }
+func (*Organization) ProtoMessage()    {}
+
+// OrganizationResponse - a single organization or a list of them.
+type OrganizationResponse struct {
+	Organization  *Organization   `protobuf:"bytes,1,opt,name=organization,proto3" json:"organization,omitempty"`
+	Organizations []*Organization `protobuf:"bytes,2,rep,name=organizations,proto3" json:"organizations,omitempty"`
+}
+
+func (m *OrganizationResponse) Reset()         { *m = OrganizationResponse{} }
+func (m *OrganizationResponse) String() string { return proto.CompactTextString(m) }
+func (*OrganizationResponse) ProtoMessage()    {}
+
+// UserOrganizationRequest - moves the user with Id to the organization with OrganizationId.
+// An empty OrganizationId moves the user out of every organization.
+type UserOrganizationRequest struct {
+	Id             string `protobuf:"bytes,1,opt,name=id,proto3" json:"id"`
+	OrganizationId string `protobuf:"bytes,2,opt,name=organization_id,proto3" json:"organization_id"`
+}
+
+func (m *UserOrganizationRequest) Reset()         { *m = UserOrganizationRequest{} }
+func (m *UserOrganizationRequest) String() string { return proto.CompactTextString(m) }
+func (*UserOrganizationRequest) ProtoMessage()    {}
+
+// GroupRequest - identifies a group, names a new one or gives the member UserId. Offset and
+// Limit page the groups of a user and the members of a group.
+type GroupRequest struct {
+	Id     string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name   string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	UserId string `protobuf:"bytes,3,opt,name=user_id,proto3" json:"user_id,omitempty"`
+	Offset int64  `protobuf:"varint,4,opt,name=offset,proto3" json:"offset,omitempty"`
+	Limit  int64  `protobuf:"varint,5,opt,name=limit,proto3" json:"limit,omitempty"`
+}
+
+func (m *GroupRequest) Reset()         { *m = GroupRequest{} }
+func (m *GroupRequest) String() string { return proto.CompactTextString(m) }
+func (*GroupRequest) ProtoMessage()    {}
+
+// Group - a named group of users in an organization.
+type Group struct {
+	Id        string               `protobuf:"bytes,1,opt,name=id,proto3" json:"id"`
+	Name      string               `protobuf:"bytes,2,opt,name=name,proto3" json:"name"`
+	CreatedAt *timestamp.Timestamp `protobuf:"bytes,3,opt,name=created_at,proto3" json:"created_at"`
+}
+
+func (m *Group) Reset()         { *m = Group{} }
+func (m *Group) String() string { return proto.CompactTextString(m) }
+func (*Group) ProtoMessage()    {}
+
+// GroupResponse - a single group, a page of groups or a page of members. Total is the amount of
+// groups or members in every page.
+type GroupResponse struct {
+	Group   *Group            `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Groups  []*Group          `protobuf:"bytes,2,rep,name=groups,proto3" json:"groups,omitempty"`
+	Members []*userProto.User `protobuf:"bytes,3,rep,name=members,proto3" json:"members,omitempty"`
+	Total   int64             `protobuf:"varint,4,opt,name=total,proto3" json:"total,omitempty"`
+}
+
+func (m *GroupResponse) Reset()         { *m = GroupResponse{} }
+func (m *GroupResponse) String() string { return proto.CompactTextString(m) }
+func (*GroupResponse) ProtoMessage()    {}
+
+// ManagerRequest - identifies the user with Id, whose manager is set to ManagerId. An empty
+// ManagerId removes the manager.
+type ManagerRequest struct {
+	Id        string `protobuf:"bytes,1,opt,name=id,proto3" json:"id"`
+	ManagerId string `protobuf:"bytes,2,opt,name=manager_id,proto3" json:"manager_id,omitempty"`
+}
+
+func (m *ManagerRequest) Reset()         { *m = ManagerRequest{} }
+func (m *ManagerRequest) String() string { return proto.CompactTextString(m) }
+func (*ManagerRequest) ProtoMessage()    {}
+
+// OrgChartUser - a user of an org chart. Depth is how many levels the user is below or above the
+// requested user, starting at 0. ManagerOrphaned is set while the manager is blocked or deleted.
+type OrgChartUser struct {
+	User            *userProto.User `protobuf:"bytes,1,opt,name=user,proto3" json:"user"`
+	ManagerId       string          `protobuf:"bytes,2,opt,name=manager_id,proto3" json:"manager_id,omitempty"`
+	ManagerOrphaned bool            `protobuf:"varint,3,opt,name=manager_orphaned,proto3" json:"manager_orphaned,omitempty"`
+	Depth           int64           `protobuf:"varint,4,opt,name=depth,proto3" json:"depth"`
+}
+
+func (m *OrgChartUser) Reset()         { *m = OrgChartUser{} }
+func (m *OrgChartUser) String() string { return proto.CompactTextString(m) }
+func (*OrgChartUser) ProtoMessage()    {}
+
+// OrgChartResponse - the users of an org chart, closest to the requested user first.
+type OrgChartResponse struct {
+	Users []*OrgChartUser `protobuf:"bytes,1,rep,name=users,proto3" json:"users"`
+}
+
+func (m *OrgChartResponse) Reset()         { *m = OrgChartResponse{} }
+func (m *OrgChartResponse) String() string { return proto.CompactTextString(m) }
+func (*OrgChartResponse) ProtoMessage()    {}
+
+// ListUsersRequest - filters, sorts and pages users. Blocked filters on the blocked status when set,
+// and CreatedAfter and CreatedBefore on when users were created. SortBy is one of name, email,
+// country_code, created_at and updated_at. Fields limits the returned fields, eg. name and email.
+// Cursor is the NextCursor of the previous page.
+type ListUsersRequest struct {
+	Blocked       *wrappers.BoolValue  `protobuf:"bytes,1,opt,name=blocked,proto3" json:"blocked,omitempty"`
+	PrivilegeID   string               `protobuf:"bytes,2,opt,name=privilege_id,proto3" json:"privilege_id,omitempty"`
+	CountryCode   string               `protobuf:"bytes,3,opt,name=country_code,proto3" json:"country_code,omitempty"`
+	CreatedAfter  *timestamp.Timestamp `protobuf:"bytes,4,opt,name=created_after,proto3" json:"created_after,omitempty"`
+	CreatedBefore *timestamp.Timestamp `protobuf:"bytes,5,opt,name=created_before,proto3" json:"created_before,omitempty"`
+	SortBy        string               `protobuf:"bytes,6,opt,name=sort_by,proto3" json:"sort_by,omitempty"`
+	Descending    bool                 `protobuf:"varint,7,opt,name=descending,proto3" json:"descending,omitempty"`
+	Fields        []string             `protobuf:"bytes,8,rep,name=fields,proto3" json:"fields,omitempty"`
+	Cursor        string               `protobuf:"bytes,9,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	Limit         int64                `protobuf:"varint,10,opt,name=limit,proto3" json:"limit,omitempty"`
+}
+
+func (m *ListUsersRequest) Reset()         { *m = ListUsersRequest{} }
+func (m *ListUsersRequest) String() string { return proto.CompactTextString(m) }
+func (*ListUsersRequest) ProtoMessage()    {}
+
+// ListUsersResponse - a page of users. NextCursor is empty on the last page, and Total is the
+// amount of users matching the filters.
+type ListUsersResponse struct {
+	Users      []*userProto.User `protobuf:"bytes,1,rep,name=users,proto3" json:"users"`
+	NextCursor string            `protobuf:"bytes,2,opt,name=next_cursor,proto3" json:"next_cursor,omitempty"`
+	Total      int64             `protobuf:"varint,3,opt,name=total,proto3" json:"total"`
+}
+
+func (m *ListUsersResponse) Reset()         { *m = ListUsersResponse{} }
+func (m *ListUsersResponse) String() string { return proto.CompactTextString(m) }
+func (*ListUsersResponse) ProtoMessage()    {}
+
+// SearchUsersRequest - searches users by a part of their name, email or phone. Blocked users are
+// only found with IncludeBlocked.
+type SearchUsersRequest struct {
+	Term           string `protobuf:"bytes,1,opt,name=term,proto3" json:"term"`
+	IncludeBlocked bool   `protobuf:"varint,2,opt,name=include_blocked,proto3" json:"include_blocked,omitempty"`
+	Offset         int64  `protobuf:"varint,3,opt,name=offset,proto3" json:"offset,omitempty"`
+	Limit          int64  `protobuf:"varint,4,opt,name=limit,proto3" json:"limit,omitempty"`
+}
+
+func (m *SearchUsersRequest) Reset()         { *m = SearchUsersRequest{} }
+func (m *SearchUsersRequest) String() string { return proto.CompactTextString(m) }
+func (*SearchUsersRequest) ProtoMessage()    {}
+
+// SearchUsersResponse - a page of the users found, best match first. More is true if there are more
+// results after the page.
+type SearchUsersResponse struct {
+	Users []*userProto.User `protobuf:"bytes,1,rep,name=users,proto3" json:"users"`
+	More  bool              `protobuf:"varint,2,opt,name=more,proto3" json:"more"`
+}
+
+func (m *SearchUsersResponse) Reset()         { *m = SearchUsersResponse{} }
+func (m *SearchUsersResponse) String() string { return proto.CompactTextString(m) }
+func (*SearchUsersResponse) ProtoMessage()    {}
+
+// UserStatusRequest - identifies the user with Id, whose status is changed to Status, eg. suspended
+// with a Reason from SuspendedFrom until SuspendedUntil. Suspensions start right away without SuspendedFrom.
+type UserStatusRequest struct {
+	Id             string               `protobuf:"bytes,1,opt,name=id,proto3" json:"id"`
+	Status         string               `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	Reason         string               `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	SuspendedFrom  *timestamp.Timestamp `protobuf:"bytes,5,opt,name=suspended_from,proto3" json:"suspended_from,omitempty"`
+	SuspendedUntil *timestamp.Timestamp `protobuf:"bytes,4,opt,name=suspended_until,proto3" json:"suspended_until,omitempty"`
+}
+
+func (m *UserStatusRequest) Reset()         { *m = UserStatusRequest{} }
+func (m *UserStatusRequest) String() string { return proto.CompactTextString(m) }
+func (*UserStatusRequest) ProtoMessage()    {}
+
+// StatusChange - a change of the status of a user, made by the user with id By.
+type StatusChange struct {
+	From   string               `protobuf:"bytes,1,opt,name=from,proto3" json:"from"`
+	To     string               `protobuf:"bytes,2,opt,name=to,proto3" json:"to"`
+	Reason string               `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	By     string               `protobuf:"bytes,4,opt,name=by,proto3" json:"by,omitempty"`
+	At     *timestamp.Timestamp `protobuf:"bytes,5,opt,name=at,proto3" json:"at"`
+}
+
+func (m *StatusChange) Reset()         { *m = StatusChange{} }
+func (m *StatusChange) String() string { return proto.CompactTextString(m) }
+func (*StatusChange) ProtoMessage()    {}
+
+// UserStatusResponse - the status of a user, one of invited, pending_verification, active, suspended,
+// deactivated and deleted, and every change of it, oldest first. A suspension, which has not started
+// yet, is returned with the status of the user until it starts.
+type UserStatusResponse struct {
+	Id              string               `protobuf:"bytes,1,opt,name=id,proto3" json:"id"`
+	Status          string               `protobuf:"bytes,2,opt,name=status,proto3" json:"status"`
+	SuspendedReason string               `protobuf:"bytes,3,opt,name=suspended_reason,proto3" json:"suspended_reason,omitempty"`
+	SuspendedFrom   *timestamp.Timestamp `protobuf:"bytes,7,opt,name=suspended_from,proto3" json:"suspended_from,omitempty"`
+	SuspendedUntil  *timestamp.Timestamp `protobuf:"bytes,4,opt,name=suspended_until,proto3" json:"suspended_until,omitempty"`
+	StatusUpdatedAt *timestamp.Timestamp `protobuf:"bytes,5,opt,name=status_updated_at,proto3" json:"status_updated_at,omitempty"`
+	Changes         []*StatusChange      `protobuf:"bytes,6,rep,name=changes,proto3" json:"changes"`
+}
+
+func (m *UserStatusResponse) Reset()         { *m = UserStatusResponse{} }
+func (m *UserStatusResponse) String() string { return proto.CompactTextString(m) }
+func (*UserStatusResponse) ProtoMessage()    {}
+
+// AuditLogRequest - filters the audit log by the actor, the target and the action, and by when the
+// operations were made, from From until To.
+type AuditLogRequest struct {
+	ActorId  string               `protobuf:"bytes,1,opt,name=actor_id,proto3" json:"actor_id,omitempty"`
+	TargetId string               `protobuf:"bytes,2,opt,name=target_id,proto3" json:"target_id,omitempty"`
+	Action   string               `protobuf:"bytes,3,opt,name=action,proto3" json:"action,omitempty"`
+	From     *timestamp.Timestamp `protobuf:"bytes,4,opt,name=from,proto3" json:"from,omitempty"`
+	To       *timestamp.Timestamp `protobuf:"bytes,5,opt,name=to,proto3" json:"to,omitempty"`
+	Offset   int64                `protobuf:"varint,6,opt,name=offset,proto3" json:"offset,omitempty"`
+	Limit    int64                `protobuf:"varint,7,opt,name=limit,proto3" json:"limit,omitempty"`
+}
+
+func (m *AuditLogRequest) Reset()         { *m = AuditLogRequest{} }
+func (m *AuditLogRequest) String() string { return proto.CompactTextString(m) }
+func (*AuditLogRequest) ProtoMessage()    {}
+
+// AuditEntry - a mutating operation of the user with ActorId on the target with TargetId. Before and
+// After are json objects of the fields the operation changed. Hash chains the entry to the entry before
+// it with PrevHash.
+type AuditEntry struct {
+	Id             string               `protobuf:"bytes,1,opt,name=id,proto3" json:"id"`
+	Sequence       int64                `protobuf:"varint,11,opt,name=sequence,proto3" json:"sequence"`
+	PrevHash       string               `protobuf:"bytes,12,opt,name=prev_hash,proto3" json:"prev_hash,omitempty"`
+	Hash           string               `protobuf:"bytes,13,opt,name=hash,proto3" json:"hash"`
+	ActorId        string               `protobuf:"bytes,2,opt,name=actor_id,proto3" json:"actor_id,omitempty"`
+	ImpersonatorId string               `protobuf:"bytes,3,opt,name=impersonator_id,proto3" json:"impersonator_id,omitempty"`
+	TargetId       string               `protobuf:"bytes,4,opt,name=target_id,proto3" json:"target_id,omitempty"`
+	Action         string               `protobuf:"bytes,5,opt,name=action,proto3" json:"action"`
+	Before         string               `protobuf:"bytes,6,opt,name=before,proto3" json:"before,omitempty"`
+	After          string               `protobuf:"bytes,7,opt,name=after,proto3" json:"after,omitempty"`
+	RequestId      string               `protobuf:"bytes,8,opt,name=request_id,proto3" json:"request_id,omitempty"`
+	Ip             string               `protobuf:"bytes,9,opt,name=ip,proto3" json:"ip,omitempty"`
+	CreatedAt      *timestamp.Timestamp `protobuf:"bytes,10,opt,name=created_at,proto3" json:"created_at"`
+}
+
+func (m *AuditEntry) Reset()         { *m = AuditEntry{} }
+func (m *AuditEntry) String() string { return proto.CompactTextString(m) }
+func (*AuditEntry) ProtoMessage()    {}
+
+// AuditLogResponse - a page of the audit log, newest first, and the amount of entries matching the filters.
+type AuditLogResponse struct {
+	Entries []*AuditEntry `protobuf:"bytes,1,rep,name=entries,proto3" json:"entries"`
+	Total   int64         `protobuf:"varint,2,opt,name=total,proto3" json:"total"`
+}
+
+func (m *AuditLogResponse) Reset()         { *m = AuditLogResponse{} }
+func (m *AuditLogResponse) String() string { return proto.CompactTextString(m) }
+func (*AuditLogResponse) ProtoMessage()    {}
+
+// VerifyAuditLogResponse - the result of walking the chain of the audit log. Entries and Checkpoints are
+// how many entries and checkpoints were verified. If the chain is not Valid, BrokenSequence is the place
+// of the first broken link, BrokenEntryId the entry there if any, and Reason tells what is broken.
+type VerifyAuditLogResponse struct {
+	Valid          bool   `protobuf:"varint,1,opt,name=valid,proto3" json:"valid"`
+	Entries        int64  `protobuf:"varint,2,opt,name=entries,proto3" json:"entries"`
+	Checkpoints    int64  `protobuf:"varint,3,opt,name=checkpoints,proto3" json:"checkpoints"`
+	BrokenSequence int64  `protobuf:"varint,4,opt,name=broken_sequence,proto3" json:"broken_sequence,omitempty"`
+	BrokenEntryId  string `protobuf:"bytes,5,opt,name=broken_entry_id,proto3" json:"broken_entry_id,omitempty"`
+	Reason         string `protobuf:"bytes,6,opt,name=reason,proto3" json:"reason,omitempty"`
+}
+
+func (m *VerifyAuditLogResponse) Reset()         { *m = VerifyAuditLogResponse{} }
+func (m *VerifyAuditLogResponse) String() string { return proto.CompactTextString(m) }
+func (*VerifyAuditLogResponse) ProtoMessage()    {}
+
+// EraseUserRequest - identifies the user with Id, who is erased, and why.
+type EraseUserRequest struct {
+	Id     string `protobuf:"bytes,1,opt,name=id,proto3" json:"id"`
+	Reason string `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+}
+
+func (m *EraseUserRequest) Reset()         { *m = EraseUserRequest{} }
+func (m *EraseUserRequest) String() string { return proto.CompactTextString(m) }
+func (*EraseUserRequest) ProtoMessage()    {}
+
+// EraseUserResponse - the erasure certificate of a user. KeyId is the destroyed data key, which the
+// Fields of the user were encrypted with. KeyId is empty if the user had no data key.
+type EraseUserResponse struct {
+	UserId   string               `protobuf:"bytes,1,opt,name=user_id,proto3" json:"user_id"`
+	KeyId    string               `protobuf:"bytes,2,opt,name=key_id,proto3" json:"key_id,omitempty"`
+	Fields   []string             `protobuf:"bytes,3,rep,name=fields,proto3" json:"fields"`
+	Reason   string               `protobuf:"bytes,4,opt,name=reason,proto3" json:"reason,omitempty"`
+	ErasedAt *timestamp.Timestamp `protobuf:"bytes,5,opt,name=erased_at,proto3" json:"erased_at"`
+}
+
+func (m *EraseUserResponse) Reset()         { *m = EraseUserResponse{} }
+func (m *EraseUserResponse) String() string { return proto.CompactTextString(m) }
+func (*EraseUserResponse) ProtoMessage()    {}
+
+// ExportDataRequest - exports the data of the user with Id, or of the caller for ExportMyData. Format is
+// zip, the default, or json, and Delivery stream, the default, or url.
+type ExportDataRequest struct {
+	Id       string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Format   string `protobuf:"bytes,2,opt,name=format,proto3" json:"format,omitempty"`
+	Delivery string `protobuf:"bytes,3,opt,name=delivery,proto3" json:"delivery,omitempty"`
+}
+
+func (m *ExportDataRequest) Reset()         { *m = ExportDataRequest{} }
+func (m *ExportDataRequest) String() string { return proto.CompactTextString(m) }
+func (*ExportDataRequest) ProtoMessage()    {}
+
+// ExportDataResponse - a message of an export stream. A streamed bundle is sent as ChunkData over many
+// messages, the first also telling the Format. A bundle delivered by url is a single message with a Url,
+// which works until ExpiresAt.
+type ExportDataResponse struct {
+	Format    string               `protobuf:"bytes,1,opt,name=format,proto3" json:"format,omitempty"`
+	Url       string               `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	ExpiresAt *timestamp.Timestamp `protobuf:"bytes,3,opt,name=expires_at,proto3" json:"expires_at,omitempty"`
+	ChunkData []byte               `protobuf:"bytes,4,opt,name=chunk_data,proto3" json:"chunk_data,omitempty"`
+}
+
+func (m *ExportDataResponse) Reset()         { *m = ExportDataResponse{} }
+func (m *ExportDataResponse) String() string { return proto.CompactTextString(m) }
+func (*ExportDataResponse) ProtoMessage()    {}
+
+// ExportDataServer - the server side of a stream of ExportDataResponse, like a generated stream.
+type ExportDataServer interface {
+	Send(*ExportDataResponse) error
+	grpc.ServerStream
+}
@@ -0,0 +1,246 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/golang/protobuf/ptypes"
+	repository "github.com/softcorp-io/hqs-user-service/repository"
+	tenant "github.com/softcorp-io/hqs-user-service/tenant"
+	privilegeProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_privilege_service"
+	userProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+)
+
+// marshalOrganization - converts a repository.Organization to an Organization.
+func marshalOrganization(organization *repository.Organization) *Organization {
+	createdAt, _ := ptypes.TimestampProto(organization.CreatedAt)
+	return &Organization{
+		Id:                 organization.ID,
+		Name:               organization.Name,
+		PrivilegeIds:       organization.PrivilegeIDs,
+		DefaultPrivilegeId: organization.DefaultPrivilegeID,
+		CreatedAt:          createdAt,
+	}
+}
+
+// CreateOrganization - creates an organization. Only the root user can create organizations.
+func (s *Handler) CreateOrganization(ctx context.Context, req *Organization) (*OrganizationResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, _, err := s.validateTokenHelper(ctx, "CreateOrganization")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &OrganizationResponse{}, err
+	}
+
+	organization := &repository.Organization{
+		Name:               req.Name,
+		PrivilegeIDs:       req.PrivilegeIds,
+		DefaultPrivilegeID: req.DefaultPrivilegeId,
+	}
+	if err := s.privilegesExistHelper(ctx, organization); err != nil {
+		return &OrganizationResponse{}, err
+	}
+
+	if err := s.organizations.Create(ctx, organization); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not create organization with err %v", err))
+		return &OrganizationResponse{}, err
+	}
+	if err := s.auditHelper(ctx, "CreateOrganization", organization.ID, nil, organization); err != nil {
+		return &OrganizationResponse{}, err
+	}
+
+	// return result
+	res := &OrganizationResponse{}
+	res.Organization = marshalOrganization(organization)
+	return res, nil
+}
+
+// GetOrganizations - returns every organization to the root user, and the organization of the user to everyone else.
+func (s *Handler) GetOrganizations(ctx context.Context, req *userProto.Request) (*OrganizationResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, _, err := s.validateTokenHelper(ctx, "GetOrganizations")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &OrganizationResponse{}, err
+	}
+
+	organizations, err := s.organizations.GetAll(ctx)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get organizations with err %v", err))
+		return &OrganizationResponse{}, err
+	}
+
+	// return result
+	res := &OrganizationResponse{}
+	res.Organizations = []*Organization{}
+	for _, organization := range organizations {
+		res.Organizations = append(res.Organizations, marshalOrganization(organization))
+	}
+	return res, nil
+}
+
+// UpdateOrganization - updates the name and privileges of an organization. Only the root user can update organizations.
+func (s *Handler) UpdateOrganization(ctx context.Context, req *Organization) (*OrganizationResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, _, err := s.validateTokenHelper(ctx, "UpdateOrganization")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &OrganizationResponse{}, err
+	}
+
+	organization := &repository.Organization{
+		ID:                 req.Id,
+		Name:               req.Name,
+		PrivilegeIDs:       req.PrivilegeIds,
+		DefaultPrivilegeID: req.DefaultPrivilegeId,
+	}
+	if err := s.privilegesExistHelper(ctx, organization); err != nil {
+		return &OrganizationResponse{}, err
+	}
+
+	before, err := s.organizations.Get(ctx, &repository.Organization{ID: req.Id})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get organization with err %v", err))
+		return &OrganizationResponse{}, err
+	}
+
+	if err := s.organizations.Update(ctx, organization); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not update organization with err %v", err))
+		return &OrganizationResponse{}, err
+	}
+	if after, err := s.organizations.Get(ctx, &repository.Organization{ID: req.Id}); err == nil {
+		if err := s.auditHelper(ctx, "UpdateOrganization", organization.ID, before, after); err != nil {
+			return &OrganizationResponse{}, err
+		}
+	}
+
+	// return result
+	res := &OrganizationResponse{}
+	res.Organization = marshalOrganization(organization)
+	return res, nil
+}
+
+// UpdateUserOrganization - moves a user and his/her service accounts to another organization, where the
+// user gets the default privilege, is in no groups and has no manager. Tokens of the old organization can no longer be used. Only the root
+// user can move users between organizations.
+func (s *Handler) UpdateUserOrganization(ctx context.Context, req *UserOrganizationRequest) (*userProto.Response, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, _, err := s.validateTokenHelper(ctx, "UpdateUserOrganization")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &userProto.Response{}, err
+	}
+
+	reqUser, err := s.repository.Get(ctx, &repository.User{ID: req.Id})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get reqUser with err  %v", err))
+		return &userProto.Response{}, err
+	}
+
+	// the root user cannot be moved, and service accounts move with their owner
+	if reqUser.Admin || reqUser.ServiceAccount {
+		s.zapLog.Error("Tried to move root user or service account")
+		return &userProto.Response{}, errors.New("User cannot be moved to another organization")
+	}
+
+	defaultPrivilegeID, err := s.defaultPrivilegeHelper(tenant.WithOrganization(ctx, req.OrganizationId))
+	if err != nil {
+		return &userProto.Response{}, err
+	}
+
+	serviceAccounts, err := s.repository.GetServiceAccounts(ctx, reqUser)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get users service accounts with err %v", err))
+		return &userProto.Response{}, err
+	}
+
+	before := copyUserHelper(reqUser)
+	reqUser.OrgID = req.OrganizationId
+	reqUser.PrivilegeID = defaultPrivilegeID
+	reqUser.Team = ""
+	if err := s.repository.UpdateOrganization(ctx, reqUser); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not update organization with err %v", err))
+		return &userProto.Response{}, err
+	}
+	if err := s.auditUserHelper(ctx, "UpdateUserOrganization", reqUser.ID, before); err != nil {
+		return &userProto.Response{}, err
+	}
+
+	// groups and reports belong to the old organization
+	if err := s.groups.RemoveMemberFromAll(ctx, reqUser.ID); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not remove user from groups with err %v", err))
+	}
+	if err := s.repository.FlagReports(ctx, reqUser, true); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not flag orphaned reports with err %v", err))
+	}
+
+	for _, serviceAccount := range serviceAccounts {
+		serviceAccount.OrgID = req.OrganizationId
+		serviceAccount.PrivilegeID = defaultPrivilegeID
+		if err := s.repository.UpdateOrganization(ctx, serviceAccount); err != nil {
+			s.zapLog.Error(fmt.Sprintf("Could not move service account %s with err %v", serviceAccount.ID, err))
+		}
+	}
+
+	s.zapLog.Info(fmt.Sprintf("Moved user %s to organization %s", reqUser.ID, req.OrganizationId))
+
+	// return result
+	res := &userProto.Response{}
+	reqUser.Password = ""
+	res.User = repository.UnmarshalUser(reqUser)
+	return res, nil
+}
+
+// privilegesExistHelper - checks that every privilege of an organization exists in the privilege service
+func (s *Handler) privilegesExistHelper(ctx context.Context, organization *repository.Organization) error {
+	privilegeIDs := append([]string{organization.DefaultPrivilegeID}, organization.PrivilegeIDs...)
+	for _, privilegeID := range privilegeIDs {
+		if _, err := s.privilegeClient.Get(ctx, &privilegeProto.Privilege{Id: privilegeID}); err != nil {
+			s.zapLog.Error(fmt.Sprintf("Could not find privilege %s with err %v", privilegeID, err))
+			return err
+		}
+	}
+	return nil
+}
+
+// organizationPrivilegeHelper - checks that the privilege is one of the privileges of the organization
+func (s *Handler) organizationPrivilegeHelper(ctx context.Context, organizationID string, privilegeID string) error {
+	organization, err := s.organizations.Get(tenant.WithOrganization(ctx, organizationID), &repository.Organization{ID: organizationID})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get organization %s with err %v", organizationID, err))
+		return errors.New("Organization does not exist")
+	}
+
+	if !organization.HasPrivilege(privilegeID) {
+		s.zapLog.Error(fmt.Sprintf("Privilege %s is not a privilege of organization %s", privilegeID, organizationID))
+		return errors.New("Privilege does not belong to the organization")
+	}
+
+	return nil
+}
+
+// defaultPrivilegeHelper - returns the privilege new users of the organization in ctx get. Users without an
+// organization get the default privilege of the privilege service.
+func (s *Handler) defaultPrivilegeHelper(ctx context.Context) (string, error) {
+	organizationID, all, err := tenant.Organization(ctx)
+	if err == nil && !all && organizationID != "" {
+		organization, err := s.organizations.Get(ctx, &repository.Organization{ID: organizationID})
+		if err != nil {
+			s.zapLog.Error(fmt.Sprintf("Could not get organization %s with err %v", organizationID, err))
+			return "", errors.New("Organization does not exist")
+		}
+		return organization.DefaultPrivilegeID, nil
+	}
+
+	privilegeResponse, err := s.privilegeClient.GetDefault(ctx, &privilegeProto.Request{})
+	if err != nil {
+		s.zapLog.Error("Could not get default privilege")
+		return "", err
+	}
+	return privilegeResponse.Privilege.Id, nil
+}
@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	crypto "github.com/softcorp-io/hqs-user-service/crypto"
+	repository "github.com/softcorp-io/hqs-user-service/repository"
+	tenant "github.com/softcorp-io/hqs-user-service/tenant"
+	userProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+)
+
+// marshalPersonalAccessToken - converts a crypto.PersonalAccessToken to a PersonalAccessToken, leaving out the hash.
+func marshalPersonalAccessToken(personalToken *crypto.PersonalAccessToken) *PersonalAccessToken {
+	createdAt, _ := ptypes.TimestampProto(personalToken.CreatedAt)
+	expiresAt, _ := ptypes.TimestampProto(personalToken.ExpiresAt)
+	lastUsedAt, _ := ptypes.TimestampProto(personalToken.LastUsedAt)
+	return &PersonalAccessToken{
+		Id:         personalToken.ID,
+		Prefix:     personalToken.Prefix,
+		Name:       personalToken.Name,
+		Scopes:     personalToken.Scopes,
+		LastUsedAt: lastUsedAt,
+		ExpiresAt:  expiresAt,
+		CreatedAt:  createdAt,
+	}
+}
+
+// CreatePersonalAccessToken - creates a personal access token for the authenticated user. The token is
+// only returned here. It can only be created from a login and with scopes the user has.
+func (s *Handler) CreatePersonalAccessToken(ctx context.Context, req *PersonalAccessTokenRequest) (*PersonalAccessTokenResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	caller, err := s.personalTokenOwnerHelper(ctx, "CreatePersonalAccessToken")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &PersonalAccessTokenResponse{}, err
+	}
+
+	if err := scopesGranted(s.grantedHelper(caller), req.Scopes); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not grant scopes with err %v", err))
+		return &PersonalAccessTokenResponse{}, err
+	}
+
+	token, personalToken, err := s.crypto.CreatePersonalAccessToken(ctx, caller.user.Id, req.Name, req.Scopes, time.Duration(req.ExpiresIn)*time.Second)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not create personal access token with err %v", err))
+		return &PersonalAccessTokenResponse{}, err
+	}
+	if err := s.auditHelper(caller.tenantContext(ctx), "CreatePersonalAccessToken", personalToken.ID, nil, personalToken); err != nil {
+		return &PersonalAccessTokenResponse{}, err
+	}
+
+	// return result
+	res := &PersonalAccessTokenResponse{}
+	res.Token = token
+	res.PersonalAccessToken = marshalPersonalAccessToken(personalToken)
+	return res, nil
+}
+
+// GetPersonalAccessTokens - lists the personal access tokens of the authenticated user.
+func (s *Handler) GetPersonalAccessTokens(ctx context.Context, req *userProto.Request) (*PersonalAccessTokenResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	caller, err := s.personalTokenOwnerHelper(ctx, "GetPersonalAccessTokens")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &PersonalAccessTokenResponse{}, err
+	}
+
+	personalTokens, err := s.crypto.GetPersonalAccessTokens(ctx, caller.user.Id)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get personal access tokens with err %v", err))
+		return &PersonalAccessTokenResponse{}, err
+	}
+
+	// return result
+	res := &PersonalAccessTokenResponse{}
+	res.PersonalAccessTokens = []*PersonalAccessToken{}
+	for _, personalToken := range personalTokens {
+		res.PersonalAccessTokens = append(res.PersonalAccessTokens, marshalPersonalAccessToken(personalToken))
+	}
+	return res, nil
+}
+
+// RevokePersonalAccessToken - revokes a personal access token of the authenticated user.
+func (s *Handler) RevokePersonalAccessToken(ctx context.Context, req *PersonalAccessTokenRequest) (*PersonalAccessTokenResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	caller, err := s.authenticateHelper(ctx)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &PersonalAccessTokenResponse{}, err
+	}
+
+	if err := s.authorizeHelper(caller, "RevokePersonalAccessToken"); err != nil {
+		return &PersonalAccessTokenResponse{}, err
+	}
+
+	if err := s.crypto.RevokePersonalAccessToken(ctx, caller.user.Id, req.Id); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not revoke personal access token with err %v", err))
+		return &PersonalAccessTokenResponse{}, err
+	}
+	if err := s.auditHelper(caller.tenantContext(ctx), "RevokePersonalAccessToken", req.Id, nil, nil); err != nil {
+		return &PersonalAccessTokenResponse{}, err
+	}
+
+	return &PersonalAccessTokenResponse{}, nil
+}
+
+// personalTokenOwnerHelper - authenticates a user logged in with a JWT token. Personal access tokens,
+// api keys, scoped, exchanged and impersonation tokens cannot be used to manage personal access tokens.
+func (s *Handler) personalTokenOwnerHelper(ctx context.Context, rpc string) (*principal, error) {
+	caller, err := s.authenticateHelper(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if caller.claims == nil || len(caller.claims.Scopes) > 0 || caller.impersonated() || caller.delegated() {
+		s.zapLog.Error("Tried to manage personal access tokens without a login")
+		return nil, errors.New("Personal access tokens can only be managed after login")
+	}
+
+	if err := s.authorizeHelper(caller, rpc); err != nil {
+		return nil, err
+	}
+
+	return caller, nil
+}
+
+// authenticatePersonalAccessTokenHelper - finds the user of a personal access token. The privileges
+// of the user are restricted to the scopes of the token.
+func (s *Handler) authenticatePersonalAccessTokenHelper(ctx context.Context, token string) (*principal, error) {
+	personalToken, err := s.crypto.DecodePersonalAccessToken(ctx, token)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not decode personal access token with err %v", err))
+		return nil, err
+	}
+
+	actualUser, err := s.repository.Get(tenant.WithAllOrganizations(ctx), &repository.User{ID: personalToken.UserID})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get authUser with err  %v", err))
+		return nil, err
+	}
+
+	if actualUser.ServiceAccount {
+		s.zapLog.Error("Service account tried to use a personal access token")
+		return nil, errors.New("Service accounts cannot use personal access tokens")
+	}
+
+	if err := activeHelper(actualUser); err != nil {
+		s.zapLog.Error(fmt.Sprintf("User %s is not active with err %v", actualUser.ID, err))
+		return nil, err
+	}
+
+	privilege, err := s.privilegeHelper(ctx, actualUser)
+	if err != nil {
+		return nil, err
+	}
+
+	// the use is recorded like logins, but is no reason to refuse the request
+	if err := s.crypto.AddAuthToHistory(ctx, repository.UnmarshalUser(actualUser), token, "personalaccesstoken", nil); err != nil {
+		s.zapLog.Warn(fmt.Sprintf("Could not record personal access token use with err %v", err))
+	}
+
+	return &principal{
+		user:           repository.UnmarshalUser(actualUser),
+		organizationID: actualUser.OrgID,
+		personalToken:  personalToken,
+		privilege:      restrictPrivilege(privilege, personalToken.Scopes),
+	}, nil
+}
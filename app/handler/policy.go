@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	policy "github.com/softcorp-io/hqs-user-service/policy"
+	repository "github.com/softcorp-io/hqs-user-service/repository"
+	privilegeProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_privilege_service"
+	userProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+)
+
+// UpdateTeam - moves a user to another team. An empty team removes the user from his/her team.
+func (s *Handler) UpdateTeam(ctx context.Context, req *TeamRequest) (*userProto.Response, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, caller, err := s.sensitiveActionHelper(ctx, "UpdateTeam")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &userProto.Response{}, err
+	}
+
+	reqUser, err := s.repository.Get(ctx, &repository.User{ID: req.Id})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get reqUser with err  %v", err))
+		return &userProto.Response{}, err
+	}
+
+	// the root user cannot be updated
+	if reqUser.Admin {
+		s.zapLog.Error("Tried to update root user")
+		return &userProto.Response{}, errors.New("Root user is not updateable")
+	}
+
+	// a user cannot move him/herself into another team, which would change whom he/she can manage
+	if reqUser.ID == caller.user.Id && !caller.root() {
+		s.zapLog.Error(fmt.Sprintf("User %s tried to update his/her own team", caller.user.Id))
+		return &userProto.Response{}, errors.New("Cannot update your own team")
+	}
+
+	// check that the policy lets the user manage the other user
+	if err := s.policyHelper(ctx, caller, "UpdateTeam", reqUser, nil); err != nil {
+		return &userProto.Response{}, err
+	}
+
+	before := copyUserHelper(reqUser)
+	reqUser.Team = req.Team
+	if err := s.repository.UpdateTeam(ctx, reqUser); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not update team with err %v", err))
+		return &userProto.Response{}, err
+	}
+	if err := s.auditUserHelper(ctx, "UpdateTeam", reqUser.ID, before); err != nil {
+		return &userProto.Response{}, err
+	}
+
+	// return result
+	res := &userProto.Response{}
+	reqUser.Password = ""
+	res.User = repository.UnmarshalUser(reqUser)
+	return res, nil
+}
+
+// policyHelper - evaluates the policy for the caller doing action on target. requested is the
+// privilege the action gives target, if any. Users are compared by their full privileges, also
+// when the caller uses a scoped token.
+func (s *Handler) policyHelper(ctx context.Context, caller *principal, action string, target *repository.User, requested *privilegeProto.Privilege) error {
+	actor, err := s.repository.Get(ctx, &repository.User{ID: caller.user.Id})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get actor with err %v", err))
+		return err
+	}
+
+	actorPrivilege, err := s.privilegeHelper(ctx, actor)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get actors privileges with err %v", err))
+		return err
+	}
+
+	targetPrivilege, err := s.privilegeHelper(ctx, target)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get targets privileges with err %v", err))
+		return err
+	}
+
+	req := &policy.Request{
+		Action: action,
+		Actor: policy.Subject{
+			ID:          actor.ID,
+			Team:        actor.Team,
+			Admin:       actor.Admin,
+			Permissions: s.permissions.Granted(actorPrivilege, false).Names(),
+		},
+		Target: policy.Subject{
+			ID:          target.ID,
+			Team:        target.Team,
+			Admin:       target.Admin,
+			Permissions: s.permissions.Granted(targetPrivilege, false).Names(),
+		},
+	}
+	if requested != nil {
+		req.Permissions = s.permissions.Granted(requested, false).Names()
+	}
+
+	if err := s.policy.Evaluate(req); err != nil {
+		s.zapLog.Error(fmt.Sprintf("User %s was denied %s on user %s with err %v", actor.ID, action, target.ID, err))
+		return err
+	}
+
+	return nil
+}
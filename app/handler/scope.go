@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"fmt"
+
+	permission "github.com/softcorp-io/hqs-user-service/permission"
+	privilegeProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_privilege_service"
+)
+
+// scope names of the privilege flags, which are the names of their permissions.
+// Used when tokens are described to other services.
+const (
+	scopeViewAllUsers           = string(permission.ViewAllUsers)
+	scopeCreateUser             = string(permission.CreateUser)
+	scopeManagePrivileges       = string(permission.ManagePrivileges)
+	scopeDeleteUser             = string(permission.DeleteUser)
+	scopeBlockUser              = string(permission.BlockUser)
+	scopeSendResetPasswordEmail = string(permission.SendResetPasswordEmail)
+)
+
+// privilegeScopes - returns the scope names of every flag set in privilege.
+func privilegeScopes(privilege *privilegeProto.Privilege) []string {
+	scopes := []string{}
+	if privilege == nil {
+		return scopes
+	}
+	if privilege.ViewAllUsers {
+		scopes = append(scopes, scopeViewAllUsers)
+	}
+	if privilege.CreateUser {
+		scopes = append(scopes, scopeCreateUser)
+	}
+	if privilege.ManagePrivileges {
+		scopes = append(scopes, scopeManagePrivileges)
+	}
+	if privilege.DeleteUser {
+		scopes = append(scopes, scopeDeleteUser)
+	}
+	if privilege.BlockUser {
+		scopes = append(scopes, scopeBlockUser)
+	}
+	if privilege.SendResetPasswordEmail {
+		scopes = append(scopes, scopeSendResetPasswordEmail)
+	}
+	return scopes
+}
+
+// validScope - reports whether name is the scope name of a privilege flag.
+func validScope(name string) bool {
+	switch name {
+	case scopeViewAllUsers, scopeCreateUser, scopeManagePrivileges, scopeDeleteUser, scopeBlockUser, scopeSendResetPasswordEmail:
+		return true
+	}
+	return false
+}
+
+// restrictPrivilege - returns a copy of privilege where only the flags named in scopes are kept.
+// No scopes means the token is not restricted, and privilege is returned as is.
+func restrictPrivilege(privilege *privilegeProto.Privilege, scopes []string) *privilegeProto.Privilege {
+	if len(scopes) == 0 || privilege == nil {
+		return privilege
+	}
+	granted := map[string]bool{}
+	for _, scope := range scopes {
+		granted[scope] = true
+	}
+	return &privilegeProto.Privilege{
+		Id:                     privilege.Id,
+		Name:                   privilege.Name,
+		ViewAllUsers:           privilege.ViewAllUsers && granted[scopeViewAllUsers],
+		CreateUser:             privilege.CreateUser && granted[scopeCreateUser],
+		ManagePrivileges:       privilege.ManagePrivileges && granted[scopeManagePrivileges],
+		DeleteUser:             privilege.DeleteUser && granted[scopeDeleteUser],
+		BlockUser:              privilege.BlockUser && granted[scopeBlockUser],
+		SendResetPasswordEmail: privilege.SendResetPasswordEmail && granted[scopeSendResetPasswordEmail],
+	}
+}
+
+// scopesGranted - returns an error naming the first scope that is not one of the granted permissions.
+func scopesGranted(granted permission.Set, scopes []string) error {
+	for _, scope := range scopes {
+		if !validScope(scope) {
+			return fmt.Errorf("Unknown scope %s", scope)
+		}
+		if !granted[permission.Permission(scope)] {
+			return fmt.Errorf("User do not have the %s privilege", scope)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"context"
+
+	userProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+	"google.golang.org/grpc"
+)
+
+// ExtensionServiceName - the grpc service of the rpcs, whose messages are defined in messages.go
+const ExtensionServiceName = "hqs_user_service.UserServiceExtension"
+
+// unaryMethodHelper - describes a unary rpc of the extension service, whose request is decoded into the
+// message newRequest returns before call is called with it
+func unaryMethodHelper(name string, newRequest func() interface{}, call func(s *Handler, ctx context.Context, req interface{}) (interface{}, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := newRequest()
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			handle := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return call(srv.(*Handler), ctx, req)
+			}
+			if interceptor == nil {
+				return handle(ctx, req)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ExtensionServiceName + "/" + name}
+			return interceptor(ctx, req, info, handle)
+		},
+	}
+}
+
+// exportDataServer - the server side of an export stream of the extension service
+type exportDataServer struct {
+	grpc.ServerStream
+}
+
+func (x *exportDataServer) Send(m *ExportDataResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// exportStreamHelper - describes a server streaming export rpc of the extension service
+func exportStreamHelper(name string, call func(s *Handler, req *ExportDataRequest, stream ExportDataServer) error) grpc.StreamDesc {
+	return grpc.StreamDesc{
+		StreamName:    name,
+		ServerStreams: true,
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			req := &ExportDataRequest{}
+			if err := stream.RecvMsg(req); err != nil {
+				return err
+			}
+			return call(srv.(*Handler), req, &exportDataServer{stream})
+		},
+	}
+}
+
+// ExtensionServiceDesc - the rpcs of the handler, whose messages are defined in messages.go. Register it
+// next to the user service with grpcServer.RegisterService(&handler.ExtensionServiceDesc, handle).
+var ExtensionServiceDesc = grpc.ServiceDesc{
+	ServiceName: ExtensionServiceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		unaryMethodHelper("Introspect", func() interface{} { return &IntrospectRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.Introspect(ctx, req.(*IntrospectRequest))
+		}),
+		unaryMethodHelper("ValidateTokens", func() interface{} { return &ValidateTokensRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.ValidateTokens(ctx, req.(*ValidateTokensRequest))
+		}),
+		unaryMethodHelper("CreateScopedToken", func() interface{} { return &ScopedTokenRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.CreateScopedToken(ctx, req.(*ScopedTokenRequest))
+		}),
+		unaryMethodHelper("CreateServiceAccount", func() interface{} { return &ServiceAccountRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.CreateServiceAccount(ctx, req.(*ServiceAccountRequest))
+		}),
+		unaryMethodHelper("GetServiceAccounts", func() interface{} { return &userProto.Request{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.GetServiceAccounts(ctx, req.(*userProto.Request))
+		}),
+		unaryMethodHelper("DeleteServiceAccount", func() interface{} { return &ServiceAccountRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.DeleteServiceAccount(ctx, req.(*ServiceAccountRequest))
+		}),
+		unaryMethodHelper("CreateAPIKey", func() interface{} { return &APIKeyRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.CreateAPIKey(ctx, req.(*APIKeyRequest))
+		}),
+		unaryMethodHelper("GetAPIKeys", func() interface{} { return &APIKeyRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.GetAPIKeys(ctx, req.(*APIKeyRequest))
+		}),
+		unaryMethodHelper("RevokeAPIKey", func() interface{} { return &APIKeyRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.RevokeAPIKey(ctx, req.(*APIKeyRequest))
+		}),
+		unaryMethodHelper("CreatePersonalAccessToken", func() interface{} { return &PersonalAccessTokenRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.CreatePersonalAccessToken(ctx, req.(*PersonalAccessTokenRequest))
+		}),
+		unaryMethodHelper("GetPersonalAccessTokens", func() interface{} { return &userProto.Request{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.GetPersonalAccessTokens(ctx, req.(*userProto.Request))
+		}),
+		unaryMethodHelper("RevokePersonalAccessToken", func() interface{} { return &PersonalAccessTokenRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.RevokePersonalAccessToken(ctx, req.(*PersonalAccessTokenRequest))
+		}),
+		unaryMethodHelper("Impersonate", func() interface{} { return &userProto.User{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.Impersonate(ctx, req.(*userProto.User))
+		}),
+		unaryMethodHelper("ExchangeToken", func() interface{} { return &TokenExchangeRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.ExchangeToken(ctx, req.(*TokenExchangeRequest))
+		}),
+		unaryMethodHelper("UpdateTeam", func() interface{} { return &TeamRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.UpdateTeam(ctx, req.(*TeamRequest))
+		}),
+		unaryMethodHelper("UpdateUserProfile", func() interface{} { return &UserProfileRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.UpdateUserProfile(ctx, req.(*UserProfileRequest))
+		}),
+		unaryMethodHelper("CreateOrganization", func() interface{} { return &Organization{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.CreateOrganization(ctx, req.(*Organization))
+		}),
+		unaryMethodHelper("GetOrganizations", func() interface{} { return &userProto.Request{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.GetOrganizations(ctx, req.(*userProto.Request))
+		}),
+		unaryMethodHelper("UpdateOrganization", func() interface{} { return &Organization{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.UpdateOrganization(ctx, req.(*Organization))
+		}),
+		unaryMethodHelper("UpdateUserOrganization", func() interface{} { return &UserOrganizationRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.UpdateUserOrganization(ctx, req.(*UserOrganizationRequest))
+		}),
+		unaryMethodHelper("CreateGroup", func() interface{} { return &GroupRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.CreateGroup(ctx, req.(*GroupRequest))
+		}),
+		unaryMethodHelper("RenameGroup", func() interface{} { return &GroupRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.RenameGroup(ctx, req.(*GroupRequest))
+		}),
+		unaryMethodHelper("DeleteGroup", func() interface{} { return &GroupRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.DeleteGroup(ctx, req.(*GroupRequest))
+		}),
+		unaryMethodHelper("AddGroupMember", func() interface{} { return &GroupRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.AddGroupMember(ctx, req.(*GroupRequest))
+		}),
+		unaryMethodHelper("RemoveGroupMember", func() interface{} { return &GroupRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.RemoveGroupMember(ctx, req.(*GroupRequest))
+		}),
+		unaryMethodHelper("GetUserGroups", func() interface{} { return &GroupRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.GetUserGroups(ctx, req.(*GroupRequest))
+		}),
+		unaryMethodHelper("GetGroupMembers", func() interface{} { return &GroupRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.GetGroupMembers(ctx, req.(*GroupRequest))
+		}),
+		unaryMethodHelper("UpdateManager", func() interface{} { return &ManagerRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.UpdateManager(ctx, req.(*ManagerRequest))
+		}),
+		unaryMethodHelper("GetDirectReports", func() interface{} { return &ManagerRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.GetDirectReports(ctx, req.(*ManagerRequest))
+		}),
+		unaryMethodHelper("GetReports", func() interface{} { return &ManagerRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.GetReports(ctx, req.(*ManagerRequest))
+		}),
+		unaryMethodHelper("GetManagementChain", func() interface{} { return &ManagerRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.GetManagementChain(ctx, req.(*ManagerRequest))
+		}),
+		unaryMethodHelper("ListUsers", func() interface{} { return &ListUsersRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.ListUsers(ctx, req.(*ListUsersRequest))
+		}),
+		unaryMethodHelper("SearchUsers", func() interface{} { return &SearchUsersRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.SearchUsers(ctx, req.(*SearchUsersRequest))
+		}),
+		unaryMethodHelper("RestoreUser", func() interface{} { return &userProto.User{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.RestoreUser(ctx, req.(*userProto.User))
+		}),
+		unaryMethodHelper("GetUserStatus", func() interface{} { return &UserStatusRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.GetUserStatus(ctx, req.(*UserStatusRequest))
+		}),
+		unaryMethodHelper("UpdateUserStatus", func() interface{} { return &UserStatusRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.UpdateUserStatus(ctx, req.(*UserStatusRequest))
+		}),
+		unaryMethodHelper("GetAuditLog", func() interface{} { return &AuditLogRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.GetAuditLog(ctx, req.(*AuditLogRequest))
+		}),
+		unaryMethodHelper("VerifyAuditLog", func() interface{} { return &userProto.Request{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.VerifyAuditLog(ctx, req.(*userProto.Request))
+		}),
+		unaryMethodHelper("EraseUser", func() interface{} { return &EraseUserRequest{} }, func(s *Handler, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.EraseUser(ctx, req.(*EraseUserRequest))
+		}),
+	},
+	Streams: []grpc.StreamDesc{
+		exportStreamHelper("ExportMyData", func(s *Handler, req *ExportDataRequest, stream ExportDataServer) error {
+			return s.ExportMyData(req, stream)
+		}),
+		exportStreamHelper("ExportUserData", func(s *Handler, req *ExportDataRequest, stream ExportDataServer) error {
+			return s.ExportUserData(req, stream)
+		}),
+	},
+	Metadata: "handler/messages.go",
+}
@@ -0,0 +1,314 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/golang/protobuf/ptypes"
+	crypto "github.com/softcorp-io/hqs-user-service/crypto"
+	repository "github.com/softcorp-io/hqs-user-service/repository"
+	tenant "github.com/softcorp-io/hqs-user-service/tenant"
+	privilegeProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_privilege_service"
+	userProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+)
+
+// marshalServiceAccount - converts a service account user to a ServiceAccount.
+func marshalServiceAccount(user *repository.User) *ServiceAccount {
+	createdAt, _ := ptypes.TimestampProto(user.CreatedAt)
+	return &ServiceAccount{
+		Id:          user.ID,
+		Name:        user.Name,
+		Description: user.Description,
+		OwnerID:     user.OwnerID,
+		PrivilegeID: user.PrivilegeID,
+		Blocked:     user.Blocked,
+		CreatedAt:   createdAt,
+	}
+}
+
+// marshalAPIKey - converts a crypto.APIKey to an APIKey, leaving out the hash.
+func marshalAPIKey(apiKey *crypto.APIKey) *APIKey {
+	createdAt, _ := ptypes.TimestampProto(apiKey.CreatedAt)
+	lastUsedAt, _ := ptypes.TimestampProto(apiKey.LastUsedAt)
+	return &APIKey{
+		Id:               apiKey.ID,
+		Prefix:           apiKey.Prefix,
+		Name:             apiKey.Name,
+		ServiceAccountID: apiKey.ServiceAccountID,
+		LastUsedAt:       lastUsedAt,
+		CreatedAt:        createdAt,
+	}
+}
+
+// CreateServiceAccount - creates a service account owned by the authenticated user. The user needs to be
+// allowed to manage privileges, and can only give the service account privileges he/she has.
+func (s *Handler) CreateServiceAccount(ctx context.Context, req *ServiceAccountRequest) (*ServiceAccountResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, caller, err := s.serviceAccountOwnerHelper(ctx, "CreateServiceAccount")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &ServiceAccountResponse{}, err
+	}
+
+	// only privileges of the organization can be given to its service accounts
+	if caller.organizationID != "" {
+		if err := s.organizationPrivilegeHelper(ctx, caller.organizationID, req.PrivilegeID); err != nil {
+			return &ServiceAccountResponse{}, err
+		}
+	}
+
+	// check that the requested privilege exists and is not more than the owners
+	privilegeResponse, err := s.privilegeClient.Get(ctx, &privilegeProto.Privilege{Id: req.PrivilegeID})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not find the specified privilege with err  %v", err))
+		return &ServiceAccountResponse{}, err
+	}
+	if err := scopesGranted(s.grantedHelper(caller), privilegeScopes(privilegeResponse.Privilege)); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not grant privilege to service account with err %v", err))
+		return &ServiceAccountResponse{}, err
+	}
+
+	serviceAccount := &repository.User{
+		Name:        req.Name,
+		Description: req.Description,
+		OwnerID:     caller.user.Id,
+		PrivilegeID: privilegeResponse.Privilege.Id,
+	}
+
+	if err := s.repository.CreateServiceAccount(ctx, serviceAccount); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not create service account with err %v", err))
+		return &ServiceAccountResponse{}, err
+	}
+	if err := s.auditHelper(ctx, "CreateServiceAccount", serviceAccount.ID, nil, serviceAccount); err != nil {
+		return &ServiceAccountResponse{}, err
+	}
+
+	// return result
+	res := &ServiceAccountResponse{}
+	res.ServiceAccount = marshalServiceAccount(serviceAccount)
+	return res, nil
+}
+
+// GetServiceAccounts - returns the service accounts owned by the authenticated user.
+func (s *Handler) GetServiceAccounts(ctx context.Context, req *userProto.Request) (*ServiceAccountResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, caller, err := s.serviceAccountOwnerHelper(ctx, "GetServiceAccounts")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &ServiceAccountResponse{}, err
+	}
+
+	serviceAccounts, err := s.repository.GetServiceAccounts(ctx, repository.MarshalUser(caller.user))
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get service accounts with err %v", err))
+		return &ServiceAccountResponse{}, err
+	}
+
+	// return result
+	res := &ServiceAccountResponse{}
+	res.ServiceAccounts = []*ServiceAccount{}
+	for _, serviceAccount := range serviceAccounts {
+		res.ServiceAccounts = append(res.ServiceAccounts, marshalServiceAccount(serviceAccount))
+	}
+	return res, nil
+}
+
+// DeleteServiceAccount - deletes a service account owned by the authenticated user, along with its api keys.
+func (s *Handler) DeleteServiceAccount(ctx context.Context, req *ServiceAccountRequest) (*ServiceAccountResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, caller, err := s.serviceAccountOwnerHelper(ctx, "DeleteServiceAccount")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &ServiceAccountResponse{}, err
+	}
+
+	serviceAccount, err := s.ownedServiceAccountHelper(ctx, caller, req.Id)
+	if err != nil {
+		return &ServiceAccountResponse{}, err
+	}
+
+	if err := s.crypto.DeleteServiceAccountAPIKeys(ctx, serviceAccount.ID); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not delete service account api keys with err %v", err))
+		return &ServiceAccountResponse{}, err
+	}
+
+	if err := s.repository.Delete(ctx, serviceAccount); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not delete service account with err %v", err))
+		return &ServiceAccountResponse{}, err
+	}
+	if err := s.auditHelper(ctx, "DeleteServiceAccount", serviceAccount.ID, serviceAccount, nil); err != nil {
+		return &ServiceAccountResponse{}, err
+	}
+
+	return &ServiceAccountResponse{}, nil
+}
+
+// CreateAPIKey - creates an api key for a service account owned by the authenticated user.
+// The key is only returned here and cannot be recovered later.
+func (s *Handler) CreateAPIKey(ctx context.Context, req *APIKeyRequest) (*APIKeyResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, caller, err := s.serviceAccountOwnerHelper(ctx, "CreateAPIKey")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &APIKeyResponse{}, err
+	}
+
+	serviceAccount, err := s.ownedServiceAccountHelper(ctx, caller, req.ServiceAccountID)
+	if err != nil {
+		return &APIKeyResponse{}, err
+	}
+
+	key, apiKey, err := s.crypto.CreateAPIKey(ctx, serviceAccount.ID, req.Name)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not create api key with err %v", err))
+		return &APIKeyResponse{}, err
+	}
+	if err := s.auditHelper(ctx, "CreateAPIKey", apiKey.ID, nil, apiKey); err != nil {
+		return &APIKeyResponse{}, err
+	}
+
+	// return result
+	res := &APIKeyResponse{}
+	res.Key = key
+	res.APIKey = marshalAPIKey(apiKey)
+	return res, nil
+}
+
+// GetAPIKeys - lists the api keys of a service account owned by the authenticated user.
+func (s *Handler) GetAPIKeys(ctx context.Context, req *APIKeyRequest) (*APIKeyResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, caller, err := s.serviceAccountOwnerHelper(ctx, "GetAPIKeys")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &APIKeyResponse{}, err
+	}
+
+	serviceAccount, err := s.ownedServiceAccountHelper(ctx, caller, req.ServiceAccountID)
+	if err != nil {
+		return &APIKeyResponse{}, err
+	}
+
+	apiKeys, err := s.crypto.GetAPIKeys(ctx, serviceAccount.ID)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get api keys with err %v", err))
+		return &APIKeyResponse{}, err
+	}
+
+	// return result
+	res := &APIKeyResponse{}
+	res.APIKeys = []*APIKey{}
+	for _, apiKey := range apiKeys {
+		res.APIKeys = append(res.APIKeys, marshalAPIKey(apiKey))
+	}
+	return res, nil
+}
+
+// RevokeAPIKey - revokes an api key of a service account owned by the authenticated user.
+func (s *Handler) RevokeAPIKey(ctx context.Context, req *APIKeyRequest) (*APIKeyResponse, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, caller, err := s.serviceAccountOwnerHelper(ctx, "RevokeAPIKey")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &APIKeyResponse{}, err
+	}
+
+	serviceAccount, err := s.ownedServiceAccountHelper(ctx, caller, req.ServiceAccountID)
+	if err != nil {
+		return &APIKeyResponse{}, err
+	}
+
+	if err := s.crypto.RevokeAPIKey(ctx, serviceAccount.ID, req.Id); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not revoke api key with err %v", err))
+		return &APIKeyResponse{}, err
+	}
+	if err := s.auditHelper(ctx, "RevokeAPIKey", req.Id, nil, nil); err != nil {
+		return &APIKeyResponse{}, err
+	}
+
+	return &APIKeyResponse{}, nil
+}
+
+// serviceAccountOwnerHelper - authenticates a user that can own service accounts and has the permissions
+// of rpc. Service accounts cannot manage other service accounts or api keys, and neither can an impersonator.
+func (s *Handler) serviceAccountOwnerHelper(ctx context.Context, rpc string) (context.Context, *principal, error) {
+	caller, err := s.authenticateHelper(ctx)
+	if err != nil {
+		return ctx, nil, err
+	}
+
+	if caller.apiKey != nil || caller.user.Admin || caller.impersonated() || caller.delegated() {
+		s.zapLog.Error("Tried to manage service accounts as a service account, root or while impersonating")
+		return ctx, nil, errors.New("Service accounts can only be managed by users")
+	}
+
+	if err := s.authorizeHelper(caller, rpc); err != nil {
+		return ctx, nil, err
+	}
+
+	return caller.tenantContext(ctx), caller, nil
+}
+
+// ownedServiceAccountHelper - finds a service account and checks that the caller owns it.
+func (s *Handler) ownedServiceAccountHelper(ctx context.Context, caller *principal, id string) (*repository.User, error) {
+	serviceAccount, err := s.repository.Get(ctx, &repository.User{ID: id})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get service account with err %v", err))
+		return nil, errors.New("Service account does not exist")
+	}
+
+	if !serviceAccount.ServiceAccount || serviceAccount.OwnerID != caller.user.Id {
+		s.zapLog.Error("Service account is not owned by the user")
+		return nil, errors.New("Service account does not exist")
+	}
+
+	return serviceAccount, nil
+}
+
+// authenticateAPIKeyHelper - finds the service account of an api key. A service account can only be
+// used while its owner exists and is not blocked.
+func (s *Handler) authenticateAPIKeyHelper(ctx context.Context, key string) (*principal, error) {
+	apiKey, err := s.crypto.DecodeAPIKey(ctx, key)
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not decode api key with err %v", err))
+		return nil, err
+	}
+
+	serviceAccount, err := s.repository.Get(tenant.WithAllOrganizations(ctx), &repository.User{ID: apiKey.ServiceAccountID})
+	if err != nil || !serviceAccount.ServiceAccount {
+		s.zapLog.Error("Api key has no service account")
+		return nil, errors.New("Invalid key")
+	}
+
+	if err := activeHelper(serviceAccount); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Service account %s is not active with err %v", serviceAccount.ID, err))
+		return nil, err
+	}
+
+	// the owner must be in the organization of the service account
+	owner, err := s.repository.Get(tenant.WithOrganization(ctx, serviceAccount.OrgID), &repository.User{ID: serviceAccount.OwnerID})
+	if err != nil || !owner.Active() {
+		s.zapLog.Error("Service account owner does not exist or is not active")
+		return nil, errors.New("Service account owner does not exist or is not active")
+	}
+
+	privilege, err := s.privilegeHelper(ctx, serviceAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	s.zapLog.Info(fmt.Sprintf("Authenticated service account %s with api key %s", serviceAccount.ID, apiKey.Prefix))
+
+	return &principal{
+		user:           repository.UnmarshalUser(serviceAccount),
+		organizationID: serviceAccount.OrgID,
+		apiKey:         apiKey,
+		privilege:      privilege,
+	}, nil
+}
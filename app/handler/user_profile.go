@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	permission "github.com/softcorp-io/hqs-user-service/permission"
+	repository "github.com/softcorp-io/hqs-user-service/repository"
+	userProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+)
+
+// UpdateUserProfile - updates the given fields of another users profile. Besides the update_user_profile
+// permission, the caller needs the profile_<field> permission of every field, eg. profile_title.
+func (s *Handler) UpdateUserProfile(ctx context.Context, req *UserProfileRequest) (*userProto.Response, error) {
+	s.zapLog.Info("Recieved new request")
+
+	ctx, caller, err := s.sensitiveActionHelper(ctx, "UpdateUserProfile")
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not validate token with err %v", err))
+		return &userProto.Response{}, err
+	}
+
+	if req.User == nil || len(req.Fields) == 0 {
+		s.zapLog.Error("Tried to update a profile without any fields")
+		return &userProto.Response{}, errors.New("No fields to update")
+	}
+
+	// check that the caller may edit every field
+	if err := s.profileFieldsHelper(caller, req.Fields); err != nil {
+		s.zapLog.Error(fmt.Sprintf("User %s could not update profile fields with err %v", caller.user.Id, err))
+		return &userProto.Response{}, err
+	}
+
+	reqUser, err := s.repository.Get(ctx, &repository.User{ID: req.User.Id})
+	if err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not get reqUser with err  %v", err))
+		return &userProto.Response{}, err
+	}
+
+	// the root user cannot be updated
+	if reqUser.Admin {
+		s.zapLog.Error("Tried to update root user")
+		return &userProto.Response{}, errors.New("Root user is not updateable")
+	}
+
+	// service accounts have no profile
+	if reqUser.ServiceAccount {
+		s.zapLog.Error("Tried to update the profile of a service account")
+		return &userProto.Response{}, errors.New("Service accounts have no profile")
+	}
+
+	// check that the policy lets the user manage the other user
+	if err := s.policyHelper(ctx, caller, "UpdateUserProfile", reqUser, nil); err != nil {
+		return &userProto.Response{}, err
+	}
+
+	before := copyUserHelper(reqUser)
+	if err := reqUser.CopyProfileFields(repository.MarshalUser(req.User), req.Fields); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not copy profile fields with err %v", err))
+		return &userProto.Response{}, err
+	}
+
+	reqUser.UpdatedBy = caller.user.Id
+	if err := s.repository.UpdateProfileFields(ctx, reqUser, req.Fields); err != nil {
+		s.zapLog.Error(fmt.Sprintf("Could not update profile with err  %v", err))
+		return &userProto.Response{}, err
+	}
+
+	s.zapLog.Info(fmt.Sprintf("User %s updated %v of the profile of user %s", caller.user.Id, req.Fields, reqUser.ID))
+	if err := s.auditUserHelper(ctx, "UpdateUserProfile", reqUser.ID, before); err != nil {
+		return &userProto.Response{}, err
+	}
+
+	// return result
+	res := &userProto.Response{}
+	reqUser.Password = ""
+	res.User = repository.UnmarshalUser(reqUser)
+	return res, nil
+}
+
+// profileFieldsHelper - returns a PermissionDenied error if the caller may not edit one of the fields.
+func (s *Handler) profileFieldsHelper(caller *principal, fields []string) error {
+	known := map[string]bool{}
+	for _, field := range repository.ProfileFields {
+		known[field] = true
+	}
+
+	granted := s.grantedHelper(caller)
+	for _, field := range fields {
+		if !known[field] {
+			return fmt.Errorf("Unknown profile field %s", field)
+		}
+		if !granted[permission.ProfileField(field)] {
+			return permission.Denied("UpdateUserProfile", permission.ProfileField(field))
+		}
+	}
+	return nil
+}
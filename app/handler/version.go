@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	repository "github.com/softcorp-io/hqs-user-service/repository"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// expectedVersionKey - the metadata key of the version a client expects a user to have when updating it
+const expectedVersionKey = "expected-version"
+
+// versionKey - the header key of the version of a user
+const versionKey = "version"
+
+// expectedVersionHelper - returns the version sent in the expected-version metadata, or nil if the client
+// sent none, ie. updates the user whatever version it has.
+func expectedVersionHelper(ctx context.Context) (*int64, error) {
+	meta, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(meta[expectedVersionKey]) == 0 {
+		return nil, nil
+	}
+
+	version, err := strconv.ParseInt(strings.TrimSpace(meta[expectedVersionKey][0]), 10, 64)
+	if err != nil || version < 0 {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid %s %s", expectedVersionKey, meta[expectedVersionKey][0]))
+	}
+	return &version, nil
+}
+
+// versionHelper - returns a conflict if the user does not have the expected version, s.t. an update
+// fails before anything is changed. The repository checks the version again when it writes.
+func versionHelper(user *repository.User, expected *int64) error {
+	if expected == nil || user.Version == *expected {
+		return nil
+	}
+	return conflictHelper(repository.ErrVersionConflict, expected)
+}
+
+// conflictHelper - converts a version conflict of the repository to an Aborted status, whose ErrorInfo
+// has the reason VERSION_CONFLICT. Other errors are returned as they are.
+func conflictHelper(err error, expected *int64) error {
+	if err != repository.ErrVersionConflict {
+		return err
+	}
+
+	st := status.New(codes.Aborted, err.Error())
+	metadata := map[string]string{}
+	if expected != nil {
+		metadata["expected_version"] = strconv.FormatInt(*expected, 10)
+	}
+	detailed, detailErr := st.WithDetails(&errdetails.ErrorInfo{
+		Reason:   "VERSION_CONFLICT",
+		Domain:   statusErrorDomain,
+		Metadata: metadata,
+	})
+	if detailErr != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// versionHeaderHelper - sends the version of the user in the version header, s.t. the client can send it
+// as expected-version with the next update. Outside of a grpc call, eg. in tests, nothing is sent.
+func versionHeaderHelper(ctx context.Context, user *repository.User) {
+	_ = grpc.SetHeader(ctx, metadata.Pairs(versionKey, strconv.FormatInt(user.Version, 10)))
+}
@@ -0,0 +1,317 @@
+package permission
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	privilegeProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_privilege_service"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Permission - a named permission, which an rpc can require and a privilege can grant
+type Permission string
+
+// the permissions of the privilege flags, and the named permissions the flags do not cover
+const (
+	ViewAllUsers           Permission = "view_all_users"
+	CreateUser             Permission = "create_user"
+	ManagePrivileges       Permission = "manage_privileges"
+	DeleteUser             Permission = "delete_user"
+	BlockUser              Permission = "block_user"
+	SendResetPasswordEmail Permission = "send_reset_password_email"
+	Impersonate            Permission = "impersonate"
+	UpdateUserProfile      Permission = "update_user_profile"
+	ManageGroups           Permission = "manage_groups"
+	ViewAuditLog           Permission = "view_audit_log"
+	EraseUser              Permission = "erase_user"
+	ExportUserData         Permission = "export_user_data"
+)
+
+// Root - held only by the root user, when not restricted by scopes, impersonation or an exchange.
+// It cannot be granted to a privilege.
+const Root Permission = "root"
+
+// profileFieldPrefix - the prefix of the permissions to update single profile fields of other users
+const profileFieldPrefix = "profile_"
+
+// errorDomain - the domain of the error info sent with a denied permission
+const errorDomain = "hqs.user.service"
+
+// ErrorReason - the reason of the error info sent with a denied permission
+const ErrorReason = "MISSING_PERMISSION"
+
+// knownPermissions - every permission, which can be granted besides the profile field permissions
+var knownPermissions = []Permission{
+	ViewAllUsers, CreateUser, ManagePrivileges, DeleteUser, BlockUser, SendResetPasswordEmail,
+	Impersonate, UpdateUserProfile, ManageGroups, ViewAuditLog, EraseUser, ExportUserData,
+}
+
+// rpcPermissions - the permissions each rpc requires besides an authenticated caller.
+// RPCs, which only require an authenticated caller, are in here without permissions.
+// RPCs not in here are denied. An rpc, which needs more permissions to act on another user
+// or with an option, is also in here under the name returned by OtherUser or WithOption.
+var rpcPermissions = map[string][]Permission{
+	"GetByToken":                {},
+	"GetAuthHistory":            {},
+	"GetOrganizations":          {},
+	"GetUserStatus":             {},
+	"GetDirectReports":          {},
+	"GetReports":                {},
+	"GetManagementChain":        {},
+	"UpdateProfile":             {},
+	"UpdatePassword":            {},
+	"UploadImage":               {},
+	"BlockToken":                {},
+	"BlockTokenByID":            {},
+	"BlockUsersTokens":          {},
+	"ExportMyData":              {},
+	"Create":                    {CreateUser},
+	"GenerateSignupToken":       {CreateUser},
+	"Get":                       {ViewAllUsers},
+	"GetByEmail":                {ViewAllUsers},
+	"GetAll":                    {ViewAllUsers},
+	"ListUsers":                 {ViewAllUsers},
+	"SearchUsers":               {ViewAllUsers},
+	"UpdatePrivileges":          {ManagePrivileges},
+	"UpdateTeam":                {ManagePrivileges},
+	"UpdateManager":             {ManagePrivileges},
+	"UpdateBlockUser":           {BlockUser},
+	"Delete":                    {DeleteUser},
+	"RestoreUser":               {DeleteUser},
+	"EraseUser":                 {EraseUser},
+	"ExportUserData":            {ExportUserData},
+	"UpdateUserStatus":          {BlockUser},
+	"EmailResetPasswordToken":   {SendResetPasswordEmail},
+	"CreateServiceAccount":      {ManagePrivileges},
+	"Impersonate":               {Impersonate},
+	"UpdateUserProfile":         {UpdateUserProfile},
+	"CreateGroup":               {ManageGroups},
+	"RenameGroup":               {ManageGroups},
+	"DeleteGroup":               {ManageGroups},
+	"AddGroupMember":            {ManageGroups},
+	"RemoveGroupMember":         {ManageGroups},
+	"GetGroupMembers":           {ViewAllUsers},
+	"GetAuditLog":               {ViewAuditLog},
+	"VerifyAuditLog":            {Root},
+	"CreateOrganization":        {Root},
+	"UpdateOrganization":        {Root},
+	"UpdateUserOrganization":    {Root},
+	"CreateScopedToken":         {},
+	"GetServiceAccounts":        {},
+	"DeleteServiceAccount":      {},
+	"CreateAPIKey":              {},
+	"GetAPIKeys":                {},
+	"RevokeAPIKey":              {},
+	"CreatePersonalAccessToken": {},
+	"GetPersonalAccessTokens":   {},
+	"RevokePersonalAccessToken": {},
+	"GetUserGroups":             {},
+
+	"GetUserStatus.other_user":      {ViewAllUsers},
+	"GetDirectReports.other_user":   {ViewAllUsers},
+	"GetReports.other_user":         {ViewAllUsers},
+	"GetManagementChain.other_user": {ViewAllUsers},
+	"GetUserGroups.other_user":      {ViewAllUsers},
+	"SearchUsers.include_blocked":   {BlockUser},
+}
+
+// OtherUser - returns the name the extra permissions of rpc are registered under, when the caller
+// acts on another user than him/herself
+func OtherUser(rpc string) string {
+	return rpc + ".other_user"
+}
+
+// WithOption - returns the name the extra permissions of rpc are registered under, when the caller
+// uses option
+func WithOption(rpc string, option string) string {
+	return rpc + "." + option
+}
+
+// ProfileField - returns the permission to update the profile field of other users, eg. profile_title
+func ProfileField(field string) Permission {
+	return Permission(profileFieldPrefix + field)
+}
+
+// Known - returns whether permission is a permission, which can be granted
+func (r *Registry) Known(permission Permission) bool {
+	for _, known := range knownPermissions {
+		if permission == known {
+			return true
+		}
+	}
+	field := strings.TrimPrefix(string(permission), profileFieldPrefix)
+	if field == string(permission) {
+		return false
+	}
+	for _, profileField := range r.profileFields {
+		if field == profileField {
+			return true
+		}
+	}
+	return false
+}
+
+// Set - the permissions granted to a caller
+type Set map[Permission]bool
+
+// Registry - maps rpcs to the permissions they require, and privileges to the named permissions
+// they grant on top of their flags.
+type Registry struct {
+	rpcs          map[string][]Permission
+	privileges    map[string][]Permission
+	profileFields []string
+}
+
+// NewRegistry - returns a registry with the permissions of every rpc. profileFields are the fields,
+// which have a permission to update them. Named permissions are granted to privileges with
+// PRIVILEGE_PERMISSIONS, and the impersonate permission also with IMPERSONATION_PRIVILEGE_IDS.
+func NewRegistry(profileFields []string) (*Registry, error) {
+	registry := &Registry{
+		rpcs:          map[string][]Permission{},
+		privileges:    map[string][]Permission{},
+		profileFields: profileFields,
+	}
+	for rpc, permissions := range rpcPermissions {
+		registry.Register(rpc, permissions...)
+	}
+
+	// get the named permissions of privileges, eg. "privilegeID:perm1|perm2,privilegeID2:perm1"
+	privilegePermissionsKey, check := os.LookupEnv("PRIVILEGE_PERMISSIONS")
+	if check && strings.TrimSpace(privilegePermissionsKey) != "" {
+		for _, grant := range strings.Split(privilegePermissionsKey, ",") {
+			parts := strings.SplitN(strings.TrimSpace(grant), ":", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return nil, errors.New("Invalid PRIVILEGE_PERMISSIONS, expected comma separated privilegeID:permission|permission pairs")
+			}
+			for _, name := range strings.Split(parts[1], "|") {
+				permission := Permission(strings.TrimSpace(name))
+				if !registry.Known(permission) {
+					return nil, fmt.Errorf("Invalid PRIVILEGE_PERMISSIONS, unknown permission %s", permission)
+				}
+				registry.Grant(parts[0], permission)
+			}
+		}
+	}
+
+	// get the privileges allowed to impersonate
+	impersonationPrivilegesKey, check := os.LookupEnv("IMPERSONATION_PRIVILEGE_IDS")
+	if check {
+		for _, privilegeID := range strings.Split(impersonationPrivilegesKey, ",") {
+			if strings.TrimSpace(privilegeID) != "" {
+				registry.Grant(strings.TrimSpace(privilegeID), Impersonate)
+			}
+		}
+	}
+
+	return registry, nil
+}
+
+// Register - sets the permissions an rpc requires
+func (r *Registry) Register(rpc string, permissions ...Permission) {
+	r.rpcs[rpc] = permissions
+}
+
+// Grant - grants a named permission to every user with the privilege
+func (r *Registry) Grant(privilegeID string, permission Permission) {
+	if privilegeID == "" || permission == "" {
+		return
+	}
+	r.privileges[privilegeID] = append(r.privileges[privilegeID], permission)
+}
+
+// Required - returns the permissions an rpc requires
+func (r *Registry) Required(rpc string) []Permission {
+	return r.rpcs[rpc]
+}
+
+// Granted - returns the permissions of a privilege. Scoped callers only get the permissions of the
+// privilege flags, as scopes cannot name the other permissions.
+func (r *Registry) Granted(privilege *privilegeProto.Privilege, scoped bool) Set {
+	granted := FromPrivilege(privilege)
+	if privilege == nil || scoped {
+		return granted
+	}
+	for _, permission := range r.privileges[privilege.Id] {
+		granted[permission] = true
+	}
+	return granted
+}
+
+// Authorize - returns a PermissionDenied error naming the first permission the rpc requires,
+// which is not granted. RPCs, which are not registered, are always denied.
+func (r *Registry) Authorize(rpc string, granted Set) error {
+	permissions, ok := r.rpcs[rpc]
+	if !ok {
+		return status.Error(codes.PermissionDenied, fmt.Sprintf("%s is not a registered rpc", rpc))
+	}
+	for _, permission := range permissions {
+		if !granted[permission] {
+			return Denied(rpc, permission)
+		}
+	}
+	return nil
+}
+
+// Names - returns the sorted names of the granted permissions
+func (s Set) Names() []string {
+	names := []string{}
+	for permission, granted := range s {
+		if granted {
+			names = append(names, string(permission))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FromPrivilege - returns the permissions of the flags set in privilege
+func FromPrivilege(privilege *privilegeProto.Privilege) Set {
+	granted := Set{}
+	if privilege == nil {
+		return granted
+	}
+	granted[ViewAllUsers] = privilege.ViewAllUsers
+	granted[CreateUser] = privilege.CreateUser
+	granted[ManagePrivileges] = privilege.ManagePrivileges
+	granted[DeleteUser] = privilege.DeleteUser
+	granted[BlockUser] = privilege.BlockUser
+	granted[SendResetPasswordEmail] = privilege.SendResetPasswordEmail
+	return granted
+}
+
+// Denied - returns a PermissionDenied status error. The missing permission and the rpc
+// are also sent as error info, s.t. clients do not need to parse the message.
+func Denied(rpc string, missing Permission) error {
+	st := status.New(codes.PermissionDenied, fmt.Sprintf("User do not have the %s permission required by %s", missing, rpc))
+	detailed, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason: ErrorReason,
+		Domain: errorDomain,
+		Metadata: map[string]string{
+			"permission": string(missing),
+			"rpc":        rpc,
+		},
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// Missing - returns the missing permission of an error returned by Authorize
+func Missing(err error) (Permission, bool) {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.PermissionDenied {
+		return "", false
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Reason == ErrorReason {
+			return Permission(info.Metadata["permission"]), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,295 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorReason - the reason of the error info sent when a policy denies an action
+const ErrorReason = "POLICY_DENIED"
+
+// errorDomain - the domain of the error info sent when a policy denies an action
+const errorDomain = "hqs.user.service"
+
+// the operators a condition can compare attributes with
+const (
+	operatorEquals    = "equals"
+	operatorNotEquals = "not_equals"
+	operatorSubset    = "subset"
+)
+
+// Subject - the attributes of a user taking part in an action
+type Subject struct {
+	ID          string
+	Team        string
+	Admin       bool
+	Permissions []string
+}
+
+// Request - an actor wanting to do an action on a target. Permissions are the permissions the
+// action gives the target, eg. the permissions of a new privilege.
+type Request struct {
+	Action      string
+	Actor       Subject
+	Target      Subject
+	Permissions []string
+}
+
+// Condition - compares two values. A value is an attribute, eg. "actor.team", or a literal.
+type Condition struct {
+	Left     string `json:"left"`
+	Operator string `json:"operator"`
+	Right    string `json:"right"`
+}
+
+// Rule - an action is denied when Require does not hold, unless Unless holds
+type Rule struct {
+	Name    string     `json:"name"`
+	Actions []string   `json:"actions"`
+	Require Condition  `json:"require"`
+	Unless  *Condition `json:"unless,omitempty"`
+	Message string     `json:"message"`
+}
+
+// Policy - the rules deciding if a user can act on another user
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// defaultPolicy - used when no POLICY_FILE is configured. The root user is not bound by the rules.
+// Users without a team are in the same team on own_team, like users before teams existed.
+var defaultPolicy = `{
+	"rules": [
+		{
+			"name": "no_higher_privilege",
+			"actions": ["Impersonate", "Delete", "RestoreUser", "EraseUser", "ExportUserData", "UpdateBlockUser", "UpdateUserStatus", "UpdatePrivileges", "UpdateTeam", "UpdateManager", "UpdateUserProfile"],
+			"require": {"left": "target.permissions", "operator": "subset", "right": "actor.permissions"},
+			"unless": {"left": "actor.admin", "operator": "equals", "right": "true"},
+			"message": "Cannot modify users with a higher privilege than your own"
+		},
+		{
+			"name": "no_privilege_escalation",
+			"actions": ["UpdatePrivileges"],
+			"require": {"left": "request.permissions", "operator": "subset", "right": "actor.permissions"},
+			"unless": {"left": "actor.admin", "operator": "equals", "right": "true"},
+			"message": "Cannot give users a higher privilege than your own"
+		},
+		{
+			"name": "own_team",
+			"actions": ["Delete", "RestoreUser", "EraseUser", "ExportUserData", "UpdateBlockUser", "UpdateUserStatus", "UpdatePrivileges", "UpdateTeam", "UpdateManager", "UpdateUserProfile", "AddGroupMember"],
+			"require": {"left": "target.team", "operator": "equals", "right": "actor.team"},
+			"unless": {"left": "actor.admin", "operator": "equals", "right": "true"},
+			"message": "Can only manage users in your own team"
+		},
+		{
+			"name": "not_self",
+			"actions": ["UpdateBlockUser", "UpdateUserStatus", "UpdateTeam"],
+			"require": {"left": "target.id", "operator": "not_equals", "right": "actor.id"},
+			"message": "Cannot block, change the status or the team of yourself"
+		}
+	]
+}`
+
+// NewPolicy - reads the policy from the file in POLICY_FILE, or uses the default policy if not set
+func NewPolicy() (*Policy, error) {
+	path, check := os.LookupEnv("POLICY_FILE")
+	if !check || strings.TrimSpace(path) == "" {
+		return Parse([]byte(defaultPolicy))
+	}
+	return Load(path)
+}
+
+// Load - reads a policy from a json file
+func Load(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse - parses a json policy and validates every rule
+func Parse(data []byte) (*Policy, error) {
+	policy := &Policy{}
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, err
+	}
+	for _, rule := range policy.Rules {
+		if rule.Name == "" {
+			return nil, errors.New("Policy rule is missing a name")
+		}
+		if len(rule.Actions) == 0 {
+			return nil, fmt.Errorf("Policy rule %s has no actions", rule.Name)
+		}
+		if err := rule.Require.validate(); err != nil {
+			return nil, fmt.Errorf("Policy rule %s is invalid: %v", rule.Name, err)
+		}
+		if rule.Unless != nil {
+			if err := rule.Unless.validate(); err != nil {
+				return nil, fmt.Errorf("Policy rule %s is invalid: %v", rule.Name, err)
+			}
+		}
+	}
+	return policy, nil
+}
+
+// Evaluate - returns a PermissionDenied error naming the first rule the request breaks
+func (p *Policy) Evaluate(req *Request) error {
+	for _, rule := range p.Rules {
+		if !rule.appliesTo(req.Action) {
+			continue
+		}
+		if rule.Unless != nil && rule.Unless.holds(req) {
+			continue
+		}
+		if !rule.Require.holds(req) {
+			return denied(rule)
+		}
+	}
+	return nil
+}
+
+// RuleOf - returns the name of the rule behind an error returned by Evaluate
+func RuleOf(err error) (string, bool) {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.PermissionDenied {
+		return "", false
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Reason == ErrorReason {
+			return info.Metadata["rule"], true
+		}
+	}
+	return "", false
+}
+
+// appliesTo - reports whether the rule is about action
+func (r Rule) appliesTo(action string) bool {
+	for _, a := range r.Actions {
+		if a == action || a == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// validate - checks that the operator and attributes of the condition exist
+func (c Condition) validate() error {
+	switch c.Operator {
+	case operatorEquals, operatorNotEquals, operatorSubset:
+	default:
+		return fmt.Errorf("unknown operator %s", c.Operator)
+	}
+	for _, value := range []string{c.Left, c.Right} {
+		if isAttribute(value) {
+			if _, err := attribute(&Request{}, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// holds - evaluates the condition on a request
+func (c Condition) holds(req *Request) bool {
+	left := value(req, c.Left)
+	right := value(req, c.Right)
+	switch c.Operator {
+	case operatorEquals:
+		return equal(left, right)
+	case operatorNotEquals:
+		return !equal(left, right)
+	case operatorSubset:
+		return subset(left, right)
+	}
+	return false
+}
+
+// isAttribute - reports whether a value of a condition names an attribute instead of a literal
+func isAttribute(v string) bool {
+	return strings.HasPrefix(v, "actor.") || strings.HasPrefix(v, "target.") || strings.HasPrefix(v, "request.")
+}
+
+// value - returns the values of an attribute, or the literal itself
+func value(req *Request, v string) []string {
+	if !isAttribute(v) {
+		return []string{v}
+	}
+	values, _ := attribute(req, v)
+	return values
+}
+
+// attribute - looks up an attribute of a request, eg. "target.team"
+func attribute(req *Request, name string) ([]string, error) {
+	if name == "request.permissions" {
+		return req.Permissions, nil
+	}
+	var subject Subject
+	var field string
+	switch {
+	case strings.HasPrefix(name, "actor."):
+		subject, field = req.Actor, strings.TrimPrefix(name, "actor.")
+	case strings.HasPrefix(name, "target."):
+		subject, field = req.Target, strings.TrimPrefix(name, "target.")
+	default:
+		return nil, fmt.Errorf("unknown attribute %s", name)
+	}
+	switch field {
+	case "id":
+		return []string{subject.ID}, nil
+	case "team":
+		return []string{subject.Team}, nil
+	case "admin":
+		return []string{fmt.Sprintf("%t", subject.Admin)}, nil
+	case "permissions":
+		return subject.Permissions, nil
+	}
+	return nil, fmt.Errorf("unknown attribute %s", name)
+}
+
+// equal - reports whether two values hold the same elements
+func equal(left []string, right []string) bool {
+	return subset(left, right) && subset(right, left)
+}
+
+// subset - reports whether every element of left is in right
+func subset(left []string, right []string) bool {
+	elements := map[string]bool{}
+	for _, r := range right {
+		elements[r] = true
+	}
+	for _, l := range left {
+		if !elements[l] {
+			return false
+		}
+	}
+	return true
+}
+
+// denied - returns the PermissionDenied status error of a broken rule
+func denied(rule Rule) error {
+	message := rule.Message
+	if message == "" {
+		message = fmt.Sprintf("Denied by policy rule %s", rule.Name)
+	}
+	st := status.New(codes.PermissionDenied, message)
+	detailed, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason: ErrorReason,
+		Domain: errorDomain,
+		Metadata: map[string]string{
+			"rule": rule.Name,
+		},
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
@@ -0,0 +1,370 @@
+package privilege
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	privilegeProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_privilege_service"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Config - configures the caching, retries and circuit breaker of the privilege client
+type Config struct {
+	// how long a privilege is served from the cache before the privilege service is asked again
+	CacheTTL time.Duration
+	// the deadline of every single call to the privilege service
+	CallTimeout time.Duration
+	// how many times a failed read is retried, and the delay before the first retry, which doubles every retry
+	MaxRetries     int
+	RetryBaseDelay time.Duration
+	// how many failed calls in a row open the breaker, and how long it stays open
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// when the privilege service is unavailable, serve the last known privilege instead of failing,
+	// as long as it expired from the cache less than MaxStale ago
+	ServeStale bool
+	MaxStale   time.Duration
+}
+
+// DefaultConfig - returns the config used for unset env variables
+func DefaultConfig() Config {
+	return Config{
+		CacheTTL:         30 * time.Second,
+		CallTimeout:      2 * time.Second,
+		MaxRetries:       3,
+		RetryBaseDelay:   50 * time.Millisecond,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+		ServeStale:       false,
+		MaxStale:         5 * time.Minute,
+	}
+}
+
+// ConfigFromEnv - returns the config with the PRIVILEGE_ env variables that are set
+func ConfigFromEnv() (Config, error) {
+	config := DefaultConfig()
+
+	durations := map[string]*time.Duration{
+		"PRIVILEGE_CACHE_TTL":        &config.CacheTTL,
+		"PRIVILEGE_CALL_TIMEOUT":     &config.CallTimeout,
+		"PRIVILEGE_RETRY_BASE_DELAY": &config.RetryBaseDelay,
+		"PRIVILEGE_BREAKER_COOLDOWN": &config.BreakerCooldown,
+		"PRIVILEGE_MAX_STALE":        &config.MaxStale,
+	}
+	for key, duration := range durations {
+		if value, check := os.LookupEnv(key); check {
+			tempDuration, err := time.ParseDuration(value)
+			if err != nil {
+				return Config{}, fmt.Errorf("Invalid %s with err %v", key, err)
+			}
+			*duration = tempDuration
+		}
+	}
+
+	ints := map[string]*int{
+		"PRIVILEGE_MAX_RETRIES":       &config.MaxRetries,
+		"PRIVILEGE_BREAKER_THRESHOLD": &config.BreakerThreshold,
+	}
+	for key, number := range ints {
+		if value, check := os.LookupEnv(key); check {
+			tempNumber, err := strconv.Atoi(value)
+			if err != nil || tempNumber < 0 {
+				return Config{}, fmt.Errorf("Invalid %s", key)
+			}
+			*number = tempNumber
+		}
+	}
+
+	if value, check := os.LookupEnv("PRIVILEGE_SERVE_STALE"); check {
+		serveStale, err := strconv.ParseBool(value)
+		if err != nil {
+			return Config{}, fmt.Errorf("Invalid PRIVILEGE_SERVE_STALE with err %v", err)
+		}
+		config.ServeStale = serveStale
+	}
+
+	return config, nil
+}
+
+// ErrUnavailable - returned when the breaker is open and no privilege can be served
+var ErrUnavailable = status.Error(codes.Unavailable, "privilege service is unavailable")
+
+// cacheEntry - a cached privilege and when it has to be fetched again
+type cacheEntry struct {
+	privilege *privilegeProto.Privilege
+	expiresAt time.Time
+}
+
+// Metrics - counters of the client, published with expvar
+type Metrics struct {
+	CacheHits   expvar.Int
+	CacheMisses expvar.Int
+	Calls       expvar.Int
+	Failures    expvar.Int
+	Retries     expvar.Int
+	StaleServed expvar.Int
+	Rejected    expvar.Int
+	BreakerOpen expvar.Int
+}
+
+// Map - returns the metrics as an expvar map, which can be published
+func (m *Metrics) Map() *expvar.Map {
+	metrics := new(expvar.Map).Init()
+	metrics.Set("cache_hits", &m.CacheHits)
+	metrics.Set("cache_misses", &m.CacheMisses)
+	metrics.Set("calls", &m.Calls)
+	metrics.Set("failures", &m.Failures)
+	metrics.Set("retries", &m.Retries)
+	metrics.Set("stale_served", &m.StaleServed)
+	metrics.Set("rejected", &m.Rejected)
+	metrics.Set("breaker_open", &m.BreakerOpen)
+	return metrics
+}
+
+// Client - wraps a privilege service client. Get is served from a ttl cache, every call gets
+// a deadline and reads are retried with exponential backoff. After too many failures in a row a circuit
+// breaker stops calling the privilege service for a while.
+type Client struct {
+	client  privilegeProto.PrivilegeServiceClient
+	config  Config
+	zapLog  *zap.Logger
+	Metrics *Metrics
+
+	mu        sync.Mutex
+	cache     map[string]*cacheEntry
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// NewClient - returns a client wrapping client
+func NewClient(client privilegeProto.PrivilegeServiceClient, config Config, zapLog *zap.Logger) *Client {
+	return &Client{
+		client:  client,
+		config:  config,
+		zapLog:  zapLog,
+		Metrics: &Metrics{},
+		cache:   map[string]*cacheEntry{},
+	}
+}
+
+// Get - returns a privilege from the cache, or from the privilege service if it is not cached or expired.
+// When the privilege service is unavailable the last known privilege is served if ServeStale is set,
+// and it expired less than MaxStale ago.
+func (c *Client) Get(ctx context.Context, in *privilegeProto.Privilege, opts ...grpc.CallOption) (*privilegeProto.Response, error) {
+	c.mu.Lock()
+	entry, cached := c.cache[in.Id]
+	c.mu.Unlock()
+
+	if cached && time.Now().Before(entry.expiresAt) {
+		c.Metrics.CacheHits.Add(1)
+		return &privilegeProto.Response{Privilege: entry.privilege}, nil
+	}
+	c.Metrics.CacheMisses.Add(1)
+
+	res, err := c.call(ctx, true, func(ctx context.Context) (*privilegeProto.Response, error) {
+		return c.client.Get(ctx, in, opts...)
+	})
+	if err != nil {
+		if cached && c.config.ServeStale && transient(err) && time.Since(entry.expiresAt) < c.config.MaxStale {
+			c.Metrics.StaleServed.Add(1)
+			c.zapLog.Warn(fmt.Sprintf("Serving stale privilege %s with err %v", in.Id, err))
+			return &privilegeProto.Response{Privilege: entry.privilege}, nil
+		}
+		return nil, err
+	}
+
+	if res.Privilege != nil && in.Id != "" {
+		c.mu.Lock()
+		c.cache[in.Id] = &cacheEntry{privilege: res.Privilege, expiresAt: time.Now().Add(c.config.CacheTTL)}
+		c.mu.Unlock()
+	}
+	return res, nil
+}
+
+// Invalidate - removes a privilege from the cache
+func (c *Client) Invalidate(id string) {
+	c.mu.Lock()
+	delete(c.cache, id)
+	c.mu.Unlock()
+}
+
+// Ping - pings the privilege service
+func (c *Client) Ping(ctx context.Context, in *privilegeProto.Request, opts ...grpc.CallOption) (*privilegeProto.Response, error) {
+	return c.call(ctx, true, func(ctx context.Context) (*privilegeProto.Response, error) {
+		return c.client.Ping(ctx, in, opts...)
+	})
+}
+
+// Create - creates a privilege
+func (c *Client) Create(ctx context.Context, in *privilegeProto.Privilege, opts ...grpc.CallOption) (*privilegeProto.Response, error) {
+	return c.call(ctx, false, func(ctx context.Context) (*privilegeProto.Response, error) {
+		return c.client.Create(ctx, in, opts...)
+	})
+}
+
+// Update - updates a privilege and removes it from the cache
+func (c *Client) Update(ctx context.Context, in *privilegeProto.Privilege, opts ...grpc.CallOption) (*privilegeProto.Response, error) {
+	defer c.Invalidate(in.Id)
+	return c.call(ctx, false, func(ctx context.Context) (*privilegeProto.Response, error) {
+		return c.client.Update(ctx, in, opts...)
+	})
+}
+
+// GetDefault - returns the default privilege
+func (c *Client) GetDefault(ctx context.Context, in *privilegeProto.Request, opts ...grpc.CallOption) (*privilegeProto.Response, error) {
+	return c.call(ctx, true, func(ctx context.Context) (*privilegeProto.Response, error) {
+		return c.client.GetDefault(ctx, in, opts...)
+	})
+}
+
+// GetRoot - returns the root privilege
+func (c *Client) GetRoot(ctx context.Context, in *privilegeProto.Request, opts ...grpc.CallOption) (*privilegeProto.Response, error) {
+	return c.call(ctx, true, func(ctx context.Context) (*privilegeProto.Response, error) {
+		return c.client.GetRoot(ctx, in, opts...)
+	})
+}
+
+// GetAll - returns every privilege
+func (c *Client) GetAll(ctx context.Context, in *privilegeProto.Request, opts ...grpc.CallOption) (*privilegeProto.Response, error) {
+	return c.call(ctx, true, func(ctx context.Context) (*privilegeProto.Response, error) {
+		return c.client.GetAll(ctx, in, opts...)
+	})
+}
+
+// Delete - deletes a privilege and removes it from the cache
+func (c *Client) Delete(ctx context.Context, in *privilegeProto.Privilege, opts ...grpc.CallOption) (*privilegeProto.Response, error) {
+	defer c.Invalidate(in.Id)
+	return c.call(ctx, false, func(ctx context.Context) (*privilegeProto.Response, error) {
+		return c.client.Delete(ctx, in, opts...)
+	})
+}
+
+// call - calls the privilege service through the breaker. Every attempt gets its own deadline,
+// and transient failures of reads are retried with exponential backoff. Writes are not retried,
+// as a write which timed out might have been done anyway.
+func (c *Client) call(ctx context.Context, retry bool, fn func(ctx context.Context) (*privilegeProto.Response, error)) (*privilegeProto.Response, error) {
+	allowed, probe := c.allow()
+	if !allowed {
+		c.Metrics.Rejected.Add(1)
+		return nil, ErrUnavailable
+	}
+
+	delay := c.config.RetryBaseDelay
+	var err error
+	maxRetries := c.config.MaxRetries
+	if !retry {
+		maxRetries = 0
+	}
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			c.Metrics.Retries.Add(1)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				c.release(probe)
+				return nil, ctx.Err()
+			}
+			delay *= 2
+		}
+
+		c.Metrics.Calls.Add(1)
+		callCtx, cancel := context.WithTimeout(ctx, c.config.CallTimeout)
+		var res *privilegeProto.Response
+		res, err = fn(callCtx)
+		cancel()
+
+		if err == nil {
+			c.succeeded()
+			return res, nil
+		}
+		c.Metrics.Failures.Add(1)
+
+		// only failures of the privilege service itself are retried, and the caller might have given up
+		if !transient(err) || ctx.Err() != nil {
+			break
+		}
+	}
+
+	if transient(err) {
+		c.failed(probe)
+	} else {
+		c.release(probe)
+	}
+	return nil, err
+}
+
+// allow - reports whether the breaker lets a call through, and whether the call is the probe. After
+// the cooldown a single call is let through as the probe, which closes the breaker again if it succeeds.
+// Every other call is rejected until the probe returns.
+func (c *Client) allow() (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.probing {
+		return false, false
+	}
+	if c.openUntil.IsZero() {
+		return true, false
+	}
+	if time.Now().Before(c.openUntil) {
+		return false, false
+	}
+	c.probing = true
+	return true, true
+}
+
+// succeeded - closes the breaker
+func (c *Client) succeeded() {
+	c.mu.Lock()
+	c.failures = 0
+	c.openUntil = time.Time{}
+	c.probing = false
+	c.mu.Unlock()
+}
+
+// release - ends a probe, which told nothing about the privilege service, s.t. the next call becomes the probe
+func (c *Client) release(probe bool) {
+	if !probe {
+		return
+	}
+	c.mu.Lock()
+	c.probing = false
+	c.mu.Unlock()
+}
+
+// failed - counts a failed call, and opens the breaker when there are too many in a row or the probe failed
+func (c *Client) failed(probe bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures++
+	if probe {
+		c.probing = false
+	}
+	if c.config.BreakerThreshold > 0 && (probe || c.failures >= c.config.BreakerThreshold) {
+		c.openUntil = time.Now().Add(c.config.BreakerCooldown)
+		c.Metrics.BreakerOpen.Add(1)
+		c.zapLog.Error(fmt.Sprintf("Privilege service failed %d times in a row, opening breaker for %s", c.failures, c.config.BreakerCooldown))
+	}
+}
+
+// transient - reports whether an error is caused by the privilege service being unavailable,
+// rather than by the request
+func transient(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	}
+	return false
+}
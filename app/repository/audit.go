@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// auditHiddenFields - the fields never written to the audit log
+var auditHiddenFields = []string{"_id", "password", "hash", "status_changes", "encrypted", "email_index", "phone_index", "name_index"}
+
+// AuditEntry - a mutating operation of ActorID on TargetID. Before and After only hold the fields
+// the operation changed. Entries form a chain, where every entry holds the hash of the entry before it.
+type AuditEntry struct {
+	ID             string    `bson:"id" json:"id"`
+	Sequence       int64     `bson:"sequence" json:"sequence"`
+	PrevHash       string    `bson:"prev_hash,omitempty" json:"prev_hash,omitempty"`
+	Hash           string    `bson:"hash" json:"hash"`
+	OrgID          string    `bson:"org_id,omitempty" json:"org_id,omitempty"`
+	ActorID        string    `bson:"actor_id,omitempty" json:"actor_id,omitempty"`
+	ImpersonatorID string    `bson:"impersonator_id,omitempty" json:"impersonator_id,omitempty"`
+	TargetID       string    `bson:"target_id,omitempty" json:"target_id,omitempty"`
+	Action         string    `bson:"action" json:"action"`
+	Before         bson.M    `bson:"before,omitempty" json:"before,omitempty"`
+	After          bson.M    `bson:"after,omitempty" json:"after,omitempty"`
+	RequestID      string    `bson:"request_id,omitempty" json:"request_id,omitempty"`
+	IP             string    `bson:"ip,omitempty" json:"ip,omitempty"`
+	CreatedAt      time.Time `bson:"created_at" json:"created_at"`
+}
+
+// AuditQuery - filters the audit log. Zero values do not filter, and From and To limit when the
+// operations were made.
+type AuditQuery struct {
+	ActorID  string
+	TargetID string
+	Action   string
+	From     time.Time
+	To       time.Time
+	Offset   int64
+	Limit    int64
+}
+
+// AuditRepository - interface. The audit log is append-only, so entries are never updated or deleted.
+type AuditRepository interface {
+	Append(ctx context.Context, entry *AuditEntry) error
+	List(ctx context.Context, query *AuditQuery) ([]*AuditEntry, int64, error)
+	Last(ctx context.Context) (*AuditEntry, error)
+	Walk(ctx context.Context, from int64, visit func(entry *AuditEntry) error) error
+	AddCheckpoint(ctx context.Context, checkpoint *AuditCheckpoint) error
+	GetCheckpoints(ctx context.Context) ([]*AuditCheckpoint, error)
+}
+
+// MongoAuditRepository - struct. mu serializes the appends of the service, s.t. they do not race for
+// the same place in the chain.
+type MongoAuditRepository struct {
+	mongo       *mongo.Collection
+	checkpoints *mongo.Collection
+	mu          sync.Mutex
+}
+
+// NewAuditRepository - returns MongoAuditRepository pointer.
+func NewAuditRepository(mongo *mongo.Collection, checkpoints *mongo.Collection) *MongoAuditRepository {
+	return &MongoAuditRepository{mongo: mongo, checkpoints: checkpoints}
+}
+
+// AuditDiff - returns the fields, which differ between before and after, with their values before and
+// after. A nil before or after, eg. when something is created or deleted, returns every field.
+func AuditDiff(before interface{}, after interface{}) (bson.M, bson.M, error) {
+	beforeFields, err := auditFieldsHelper(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	afterFields, err := auditFieldsHelper(after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changedBefore := bson.M{}
+	changedAfter := bson.M{}
+	for field, value := range beforeFields {
+		if afterValue, ok := afterFields[field]; !ok || !reflect.DeepEqual(value, afterValue) {
+			changedBefore[field] = value
+		}
+	}
+	for field, value := range afterFields {
+		if beforeValue, ok := beforeFields[field]; !ok || !reflect.DeepEqual(value, beforeValue) {
+			changedAfter[field] = value
+		}
+	}
+	return changedBefore, changedAfter, nil
+}
+
+// auditFieldsHelper - returns the fields of v as stored in mongo, without the hidden fields
+func auditFieldsHelper(v interface{}) (bson.M, error) {
+	fields := bson.M{}
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return fields, nil
+	}
+
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := bson.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	for _, field := range auditHiddenFields {
+		delete(fields, field)
+	}
+	return fields, nil
+}
+
+// Append - adds an entry to the end of the chain of the audit log.
+func (r *MongoAuditRepository) Append(ctx context.Context, entry *AuditEntry) error {
+	if entry.Action == "" {
+		return errors.New("Required action")
+	}
+	entry.ID = uuid.NewV4().String()
+	// mongo stores milliseconds, s.t. the hash is made of the time read back
+	entry.CreatedAt = time.Now().Truncate(time.Millisecond)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// other instances of the service append to the same chain, so the entry is appended again
+	// after the last entry, if another entry took its place meanwhile
+	for attempt := 0; attempt < maxAppendAttempts; attempt++ {
+		last, err := r.Last(ctx)
+		if err != nil {
+			return err
+		}
+		entry.Sequence = 1
+		entry.PrevHash = ""
+		if last != nil {
+			entry.Sequence = last.Sequence + 1
+			entry.PrevHash = last.Hash
+		}
+		if entry.Hash, err = entry.ComputeHash(); err != nil {
+			return err
+		}
+
+		_, err = r.mongo.InsertOne(ctx, entry)
+		if duplicateKeyHelper(err) {
+			continue
+		}
+		return err
+	}
+
+	return errors.New("Could not append to the audit log, too many concurrent appends")
+}
+
+// List - returns a page of the audit log matching the query, newest first, and the total amount of
+// matching entries.
+func (r *MongoAuditRepository) List(ctx context.Context, query *AuditQuery) ([]*AuditEntry, int64, error) {
+	entriesReturn := []*AuditEntry{}
+
+	filter := bson.M{}
+	if query.ActorID != "" {
+		filter["actor_id"] = query.ActorID
+	}
+	if query.TargetID != "" {
+		filter["target_id"] = query.TargetID
+	}
+	if query.Action != "" {
+		filter["action"] = query.Action
+	}
+	created := bson.M{}
+	if !query.From.IsZero() {
+		created["$gte"] = query.From
+	}
+	if !query.To.IsZero() {
+		created["$lt"] = query.To
+	}
+	if len(created) > 0 {
+		filter["created_at"] = created
+	}
+	filter, err := scope(ctx, filter)
+	if err != nil {
+		return []*AuditEntry{}, 0, err
+	}
+
+	total, err := r.mongo.CountDocuments(ctx, filter)
+	if err != nil {
+		return []*AuditEntry{}, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "id", Value: -1}}).
+		SetSkip(query.Offset).
+		SetLimit(query.Limit)
+	cursor, err := r.mongo.Find(ctx, filter, opts)
+	if err != nil {
+		return []*AuditEntry{}, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var tempEntry AuditEntry
+		if err := cursor.Decode(&tempEntry); err != nil {
+			return []*AuditEntry{}, 0, err
+		}
+		entriesReturn = append(entriesReturn, &tempEntry)
+	}
+
+	return entriesReturn, total, cursor.Err()
+}
@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxAppendAttempts - how many times an entry is appended, before giving up on concurrent appends
+const maxAppendAttempts = 5
+
+// duplicateKeyCode - the mongo error code of a write breaking a unique index
+const duplicateKeyCode = 11000
+
+// AuditCheckpoint - a signed statement of the hash of the entry with Sequence. Entries up to a checkpoint
+// cannot be changed, removed or cut off the end of the chain, without the checkpoint no longer matching.
+type AuditCheckpoint struct {
+	ID        string    `bson:"id" json:"id"`
+	Sequence  int64     `bson:"sequence" json:"sequence"`
+	Hash      string    `bson:"hash" json:"hash"`
+	Signature string    `bson:"signature" json:"signature"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+// ComputeHash - returns the hex sha256 hash of the entry and the hash of the entry before it. The hash
+// covers every field but Hash, and is the same for an entry before it is stored and after it is read.
+func (e *AuditEntry) ComputeHash() (string, error) {
+	doc := bson.D{
+		{Key: "id", Value: e.ID},
+		{Key: "sequence", Value: e.Sequence},
+		{Key: "prev_hash", Value: e.PrevHash},
+		{Key: "org_id", Value: e.OrgID},
+		{Key: "actor_id", Value: e.ActorID},
+		{Key: "impersonator_id", Value: e.ImpersonatorID},
+		{Key: "target_id", Value: e.TargetID},
+		{Key: "action", Value: e.Action},
+		{Key: "before", Value: canonicalHelper(e.Before)},
+		{Key: "after", Value: canonicalHelper(e.After)},
+		{Key: "request_id", Value: e.RequestID},
+		{Key: "ip", Value: e.IP},
+		{Key: "created_at", Value: e.CreatedAt.UnixNano() / int64(time.Millisecond)},
+	}
+	raw, err := bson.MarshalExtJSON(doc, true, false)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// canonicalHelper - returns v with the fields of every document sorted by name, s.t. a document
+// encodes the same regardless of the order mongo or a map gives its fields in. Empty documents are
+// the same as missing ones.
+func canonicalHelper(v interface{}) interface{} {
+	switch value := v.(type) {
+	case nil:
+		return bson.D{}
+	case bson.M:
+		doc := bson.D{}
+		for key, field := range value {
+			doc = append(doc, bson.E{Key: key, Value: canonicalHelper(field)})
+		}
+		sort.Slice(doc, func(i, j int) bool { return doc[i].Key < doc[j].Key })
+		return doc
+	case bson.D:
+		doc := bson.D{}
+		for _, field := range value {
+			doc = append(doc, bson.E{Key: field.Key, Value: canonicalHelper(field.Value)})
+		}
+		sort.Slice(doc, func(i, j int) bool { return doc[i].Key < doc[j].Key })
+		return doc
+	case bson.A:
+		array := bson.A{}
+		for _, element := range value {
+			array = append(array, canonicalHelper(element))
+		}
+		return array
+	case []interface{}:
+		return canonicalHelper(bson.A(value))
+	case map[string]interface{}:
+		return canonicalHelper(bson.M(value))
+	}
+	return v
+}
+
+// duplicateKeyHelper - reports whether err is a write breaking a unique index
+func duplicateKeyHelper(err error) bool {
+	var writeErr mongo.WriteException
+	if !errors.As(err, &writeErr) {
+		return false
+	}
+	for _, e := range writeErr.WriteErrors {
+		if e.Code == duplicateKeyCode {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateIndexes - creates the unique index on the sequence of the entries, which keeps two entries from
+// taking the same place in the chain, and the unique index on the sequence of the checkpoints.
+func (r *MongoAuditRepository) CreateIndexes(ctx context.Context) error {
+	sequenceModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "sequence", Value: 1}},
+		Options: options.Index().SetName("audit_sequence").SetUnique(true),
+	}
+	if _, err := r.mongo.Indexes().CreateOne(ctx, sequenceModel); err != nil {
+		return err
+	}
+
+	checkpointModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "sequence", Value: 1}},
+		Options: options.Index().SetName("audit_checkpoint_sequence").SetUnique(true),
+	}
+	_, err := r.checkpoints.Indexes().CreateOne(ctx, checkpointModel)
+	return err
+}
+
+// Last - returns the last entry of the chain, or nil if the audit log is empty.
+func (r *MongoAuditRepository) Last(ctx context.Context) (*AuditEntry, error) {
+	entryReturn := AuditEntry{}
+
+	opts := options.FindOne().SetSort(bson.D{{Key: "sequence", Value: -1}})
+	if err := r.mongo.FindOne(ctx, bson.M{}, opts).Decode(&entryReturn); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &entryReturn, nil
+}
+
+// Walk - visits the entries of the chain in order from the entry with sequence from, until visit returns
+// an error. The chain holds the entries of every organization, so only a context seeing every organization
+// can walk it. Entries written before the chain existed have no sequence and are skipped.
+func (r *MongoAuditRepository) Walk(ctx context.Context, from int64, visit func(entry *AuditEntry) error) error {
+	if from < 1 {
+		from = 1
+	}
+	filter, err := scope(ctx, bson.M{"sequence": bson.M{"$gte": from}})
+	if err != nil {
+		return err
+	}
+	if _, ok := filter["org_id"]; ok {
+		return errors.New("Only the whole audit log can be walked")
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "sequence", Value: 1}})
+	cursor, err := r.mongo.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var tempEntry AuditEntry
+		if err := cursor.Decode(&tempEntry); err != nil {
+			return err
+		}
+		if err := visit(&tempEntry); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+// AddCheckpoint - stores a checkpoint of the chain.
+func (r *MongoAuditRepository) AddCheckpoint(ctx context.Context, checkpoint *AuditCheckpoint) error {
+	if checkpoint.Sequence < 1 || checkpoint.Hash == "" || checkpoint.Signature == "" {
+		return errors.New("Required sequence, hash and signature")
+	}
+	checkpoint.ID = uuid.NewV4().String()
+	checkpoint.CreatedAt = time.Now()
+
+	_, err := r.checkpoints.InsertOne(ctx, checkpoint)
+
+	return err
+}
+
+// GetCheckpoints - returns every checkpoint of the chain, oldest first.
+func (r *MongoAuditRepository) GetCheckpoints(ctx context.Context) ([]*AuditCheckpoint, error) {
+	checkpointsReturn := []*AuditCheckpoint{}
+
+	opts := options.Find().SetSort(bson.D{{Key: "sequence", Value: 1}})
+	cursor, err := r.checkpoints.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return []*AuditCheckpoint{}, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var tempCheckpoint AuditCheckpoint
+		if err := cursor.Decode(&tempCheckpoint); err != nil {
+			return []*AuditCheckpoint{}, err
+		}
+		checkpointsReturn = append(checkpointsReturn, &tempCheckpoint)
+	}
+
+	return checkpointsReturn, cursor.Err()
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ownedHelper - matches the user and the service accounts the user owns
+func ownedHelper(user *User) bson.A {
+	return bson.A{
+		bson.M{"id": user.ID},
+		bson.M{"owner_id": user.ID, "service_account": true},
+	}
+}
+
+// SoftDelete - marks a user and the users service accounts as deleted by deletedBy. Deleted users are
+// hidden from every query, but they can be restored until they are purged.
+func (r *MongoRepository) SoftDelete(ctx context.Context, user *User, deletedBy string) error {
+	// mongo stores milliseconds, s.t. Restore can match the time read back
+	deletedAt := time.Now().Truncate(time.Millisecond)
+
+	filter, err := userScope(ctx, bson.M{"$or": ownedHelper(user)})
+	if err != nil {
+		return err
+	}
+
+	owned, err := r.findHelper(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	// the status is kept, s.t. a restored user gets it back
+	for _, ownedUser := range owned {
+		change := StatusChange{From: ownedUser.CurrentStatus(), To: StatusDeleted, By: deletedBy, At: deletedAt}
+		update := bson.M{
+			"$set":  bson.M{"deleted_at": deletedAt, "deleted_by": deletedBy, "status_updated_at": deletedAt},
+			"$push": bson.M{"status_changes": change},
+			"$inc":  bson.M{"version": 1},
+		}
+		if _, err := r.mongo.UpdateOne(ctx, bson.M{"id": ownedUser.ID, "deleted_at": nil}, update); err != nil {
+			return err
+		}
+	}
+
+	user.DeletedAt = &deletedAt
+	user.DeletedBy = deletedBy
+
+	return nil
+}
+
+// GetDeleted - fetches a deleted user.
+func (r *MongoRepository) GetDeleted(ctx context.Context, user *User) (*User, error) {
+	userReturn := User{}
+
+	filter, err := scope(ctx, bson.M{"id": user.ID, "deleted_at": bson.M{"$ne": nil}})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.mongo.FindOne(ctx, filter).Decode(&userReturn); err != nil {
+		return nil, err
+	}
+	if err := r.decryptHelper(ctx, &userReturn); err != nil {
+		return nil, err
+	}
+
+	return &userReturn, nil
+}
+
+// Restore - restores a deleted user, and the service accounts deleted together with the user, with
+// the status they had before.
+func (r *MongoRepository) Restore(ctx context.Context, user *User, restoredBy string) error {
+	filter, err := scope(ctx, bson.M{"$or": ownedHelper(user), "deleted_at": user.DeletedAt})
+	if err != nil {
+		return err
+	}
+
+	owned, err := r.findHelper(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	restoredAt := time.Now()
+	for _, ownedUser := range owned {
+		ownedUser.DeletedAt = nil
+		change := StatusChange{From: StatusDeleted, To: ownedUser.CurrentStatus(), By: restoredBy, At: restoredAt}
+		update := bson.M{
+			"$set":   bson.M{"status_updated_at": restoredAt},
+			"$unset": bson.M{"deleted_at": "", "deleted_by": ""},
+			"$push":  bson.M{"status_changes": change},
+			"$inc":   bson.M{"version": 1},
+		}
+		if _, err := r.mongo.UpdateOne(ctx, bson.M{"id": ownedUser.ID, "deleted_at": user.DeletedAt}, update); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetPurgeable - returns the users deleted before the given time, ie. whose grace period is over.
+func (r *MongoRepository) GetPurgeable(ctx context.Context, before time.Time) ([]*User, error) {
+	filter, err := scope(ctx, bson.M{"deleted_at": bson.M{"$lt": before}})
+	if err != nil {
+		return []*User{}, err
+	}
+
+	return r.findHelper(ctx, filter)
+}
+
+// findHelper - returns the users matching filter
+func (r *MongoRepository) findHelper(ctx context.Context, filter bson.M) ([]*User, error) {
+	usersReturn := []*User{}
+
+	cursor, err := r.mongo.Find(ctx, filter)
+	if err != nil {
+		return []*User{}, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var tempUser User
+		if err := cursor.Decode(&tempUser); err != nil {
+			return []*User{}, err
+		}
+		if err := r.decryptHelper(ctx, &tempUser); err != nil {
+			return []*User{}, err
+		}
+		usersReturn = append(usersReturn, &tempUser)
+	}
+
+	return usersReturn, cursor.Err()
+}
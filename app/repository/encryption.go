@@ -0,0 +1,293 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	crypto "github.com/softcorp-io/hqs-user-service/crypto"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// encryptedUserFields - the fields of a user, which the envelope can encrypt
+var encryptedUserFields = []string{"name", "email", "phone", "birthday", "description"}
+
+// fieldStringHelper - returns the value of a field as the string, which is encrypted
+func fieldStringHelper(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return ""
+}
+
+// setFieldString - sets a field, which can be encrypted, to its decrypted value.
+func (u *User) setFieldString(field string, value string) error {
+	switch field {
+	case "name":
+		u.Name = value
+	case "email":
+		u.Email = value
+	case "phone":
+		u.Phone = value
+	case "description":
+		u.Description = value
+	case "birthday":
+		birthday, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return err
+		}
+		u.Birthday = birthday
+	default:
+		return errors.New("Unknown encrypted field " + field)
+	}
+	return nil
+}
+
+// nameIndexHelper - returns the blind indexes of the words of a name, ignoring case, s.t. a user with an
+// encrypted name is found by a whole word of it
+func (r *MongoRepository) nameIndexHelper(name string) []string {
+	indexes := []string{}
+	for _, word := range strings.Fields(strings.ToLower(name)) {
+		indexes = append(indexes, r.envelope.BlindIndex(word))
+	}
+	return indexes
+}
+
+// emailFilterHelper - matches the user with email by its blind index. Users stored before the email got a
+// blind index are matched by their email.
+func (r *MongoRepository) emailFilterHelper(email string) bson.M {
+	if r.envelope == nil {
+		return bson.M{"email": email}
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{"email_index": r.envelope.BlindIndex(email)},
+		bson.M{"email": email, "email_index": nil},
+	}}
+}
+
+// encryptHelper - returns a copy of user as it is stored, where the fields the envelope encrypts are
+// moved to Encrypted and the email, the phone and the words of the name have blind indexes.
+func (r *MongoRepository) encryptHelper(ctx context.Context, user *User) (*User, error) {
+	stored := *user
+	stored.Encrypted = nil
+	stored.EmailIndex = r.envelope.BlindIndex(user.Email)
+	stored.PhoneIndex = r.envelope.BlindIndex(user.Phone)
+	stored.NameIndex = nil
+	if r.envelope.Encrypts("name") {
+		stored.NameIndex = r.nameIndexHelper(user.Name)
+	}
+
+	cleared := &User{}
+	for _, field := range encryptedUserFields {
+		if !r.envelope.Encrypts(field) {
+			continue
+		}
+		value, err := user.profileField(field)
+		if err != nil {
+			return nil, err
+		}
+		ciphertext, err := r.envelope.Encrypt(ctx, user.ID, field, fieldStringHelper(value))
+		if err != nil {
+			return nil, err
+		}
+		if stored.Encrypted == nil {
+			stored.Encrypted = map[string]string{}
+		}
+		stored.Encrypted[field] = ciphertext
+		if err := stored.CopyProfileFields(cleared, []string{field}); err != nil {
+			return nil, err
+		}
+	}
+
+	return &stored, nil
+}
+
+// encryptUpdateHelper - moves the fields the envelope encrypts from the $set of update to encrypted, with
+// the data key of userID, and sets the blind indexes when the email, phone or name is updated. Fields, which are no longer
+// encrypted, are stored in clear text instead of their old ciphertext.
+func (r *MongoRepository) encryptUpdateHelper(ctx context.Context, userID string, update bson.M) error {
+	set, ok := update["$set"].(bson.M)
+	if !ok {
+		return nil
+	}
+
+	unset := bson.M{}
+	for field, index := range map[string]string{"email": "email_index", "phone": "phone_index"} {
+		value, ok := set[field].(string)
+		if !ok {
+			continue
+		}
+		if r.envelope == nil {
+			unset[index] = ""
+		} else {
+			set[index] = r.envelope.BlindIndex(value)
+		}
+	}
+	if name, ok := set["name"].(string); ok {
+		if r.envelope.Encrypts("name") {
+			set["name_index"] = r.nameIndexHelper(name)
+		} else {
+			unset["name_index"] = ""
+		}
+	}
+
+	cleared := &User{}
+	for _, field := range encryptedUserFields {
+		value, ok := set[field]
+		if !ok {
+			continue
+		}
+		if !r.envelope.Encrypts(field) {
+			unset["encrypted."+field] = ""
+			continue
+		}
+		ciphertext, err := r.envelope.Encrypt(ctx, userID, field, fieldStringHelper(value))
+		if err != nil {
+			return err
+		}
+		set["encrypted."+field] = ciphertext
+		if set[field], err = cleared.profileField(field); err != nil {
+			return err
+		}
+	}
+
+	if len(unset) == 0 {
+		return nil
+	}
+	if existing, ok := update["$unset"].(bson.M); ok {
+		for field, value := range unset {
+			existing[field] = value
+		}
+	} else {
+		update["$unset"] = unset
+	}
+	return nil
+}
+
+// decryptHelper - restores the encrypted fields of a user read from the database. Fields, whose data key
+// was destroyed, stay empty.
+func (r *MongoRepository) decryptHelper(ctx context.Context, user *User) error {
+	for field, ciphertext := range user.Encrypted {
+		value, err := r.envelope.Decrypt(ctx, user.ID, field, ciphertext)
+		if err == crypto.ErrDataKeyDestroyed {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := user.setFieldString(field, value); err != nil {
+			return err
+		}
+	}
+	user.Encrypted = nil
+	return nil
+}
+
+// DestroyDataKey - destroys the data key of a user, s.t. the encrypted fields of the user cannot be read
+// anymore, neither from the database nor from its backups. Returns the id of the destroyed key, or an
+// empty id if the user had no key.
+func (r *MongoRepository) DestroyDataKey(ctx context.Context, user *User) (string, error) {
+	return r.envelope.DestroyUserKey(ctx, user.ID)
+}
+
+// migrationFieldsHelper - returns the fields of a stored user, which are not encrypted with the data key of
+// the user, ie. encrypted with a shared key or stored in clear text. Fields, whose key was destroyed, are
+// left as they are.
+func (r *MongoRepository) migrationFieldsHelper(ctx context.Context, user *User) ([]string, error) {
+	fields := []string{}
+	cleared := &User{}
+	for _, field := range encryptedUserFields {
+		if !r.envelope.Encrypts(field) {
+			continue
+		}
+		if ciphertext, ok := user.Encrypted[field]; ok {
+			shared, err := r.envelope.Shared(ctx, ciphertext)
+			if err == crypto.ErrDataKeyDestroyed {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if shared {
+				fields = append(fields, field)
+			}
+			continue
+		}
+		value, err := user.profileField(field)
+		if err != nil {
+			return nil, err
+		}
+		empty, err := cleared.profileField(field)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(value, empty) {
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
+
+// MigrateEncryption - encrypts the fields of every user again with the data key of the user, which were
+// encrypted with a shared key or stored in clear text, s.t. destroying the key of the user makes them
+// unreadable. Deleted users are migrated too. Users changed meanwhile are migrated the next time. Returns
+// how many users were migrated.
+func (r *MongoRepository) MigrateEncryption(ctx context.Context) (int, error) {
+	if r.envelope == nil {
+		return 0, nil
+	}
+
+	filter, err := scope(ctx, bson.M{})
+	if err != nil {
+		return 0, err
+	}
+	cursor, err := r.mongo.Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	migrated := 0
+	for cursor.Next(ctx) {
+		var tempUser User
+		if err := cursor.Decode(&tempUser); err != nil {
+			return migrated, err
+		}
+		fields, err := r.migrationFieldsHelper(ctx, &tempUser)
+		if err != nil {
+			return migrated, err
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		if err := r.decryptHelper(ctx, &tempUser); err != nil {
+			return migrated, err
+		}
+
+		set := bson.M{}
+		for _, field := range fields {
+			if set[field], err = tempUser.profileField(field); err != nil {
+				return migrated, err
+			}
+		}
+		update := bson.M{"$set": set}
+		if err := r.encryptUpdateHelper(ctx, tempUser.ID, update); err != nil {
+			return migrated, err
+		}
+		// the version is matched, but not incremented, since the user itself does not change
+		res, err := r.mongo.UpdateOne(ctx, bson.M{"id": tempUser.ID, "version": versionFilterHelper(tempUser.Version)}, update)
+		if err != nil {
+			return migrated, err
+		}
+		if res.ModifiedCount > 0 {
+			migrated++
+		}
+	}
+
+	return migrated, cursor.Err()
+}
@@ -0,0 +1,273 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Group - a named group of users in an organization, eg. a team or a project group.
+type Group struct {
+	ID        string    `bson:"id" json:"id"`
+	OrgID     string    `bson:"org_id,omitempty" json:"org_id,omitempty"`
+	Name      string    `bson:"name" json:"name"`
+	MemberIDs []string  `bson:"member_ids" json:"member_ids"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// GroupRepository - interface.
+type GroupRepository interface {
+	Create(ctx context.Context, group *Group) error
+	Get(ctx context.Context, group *Group) (*Group, error)
+	Rename(ctx context.Context, group *Group) error
+	Delete(ctx context.Context, group *Group) error
+	AddMember(ctx context.Context, group *Group, userID string) error
+	RemoveMember(ctx context.Context, group *Group, userID string) error
+	RemoveMemberFromAll(ctx context.Context, userID string) error
+	GetByMember(ctx context.Context, userID string, offset int64, limit int64) ([]*Group, int64, error)
+	GetMemberIDs(ctx context.Context, group *Group, offset int64, limit int64) ([]string, int64, error)
+}
+
+// MongoGroupRepository - struct.
+type MongoGroupRepository struct {
+	mongo *mongo.Collection
+}
+
+// NewGroupRepository - returns MongoGroupRepository pointer.
+func NewGroupRepository(mongo *mongo.Collection) *MongoGroupRepository {
+	return &MongoGroupRepository{mongo}
+}
+
+// Validate - validates input.
+func (g *Group) Validate() error {
+	g.Name = strings.TrimSpace(g.Name)
+	if g.Name == "" {
+		return errors.New("Required name")
+	}
+	return nil
+}
+
+// nameTakenHelper - checks if another group of the organization has the name
+func (r *MongoGroupRepository) nameTakenHelper(ctx context.Context, group *Group) (bool, error) {
+	filter, err := scope(ctx, bson.M{"name": group.Name, "id": bson.M{"$ne": group.ID}})
+	if err != nil {
+		return false, err
+	}
+	count, err := r.mongo.CountDocuments(ctx, filter)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Create - creates a new group in the organization of ctx.
+func (r *MongoGroupRepository) Create(ctx context.Context, group *Group) error {
+	group.ID = uuid.NewV4().String()
+	if err := group.Validate(); err != nil {
+		return err
+	}
+
+	organizationID, err := organizationOf(ctx, group.OrgID)
+	if err != nil {
+		return err
+	}
+	group.OrgID = organizationID
+
+	taken, err := r.nameTakenHelper(ctx, group)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return errors.New("A group with that name already exists")
+	}
+
+	group.MemberIDs = []string{}
+	group.CreatedAt = time.Now()
+	group.UpdatedAt = time.Now()
+
+	_, err = r.mongo.InsertOne(ctx, group)
+
+	return err
+}
+
+// Get - finds a single group using its id. The members are left out, see GetMemberIDs.
+func (r *MongoGroupRepository) Get(ctx context.Context, group *Group) (*Group, error) {
+	groupReturn := Group{}
+
+	filter, err := scope(ctx, bson.M{"id": group.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.FindOne().SetProjection(bson.M{"member_ids": 0})
+	if err := r.mongo.FindOne(ctx, filter, opts).Decode(&groupReturn); err != nil {
+		return nil, err
+	}
+
+	return &groupReturn, nil
+}
+
+// Rename - renames a group.
+func (r *MongoGroupRepository) Rename(ctx context.Context, group *Group) error {
+	if err := group.Validate(); err != nil {
+		return err
+	}
+
+	taken, err := r.nameTakenHelper(ctx, group)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return errors.New("A group with that name already exists")
+	}
+
+	return r.updateHelper(ctx, group, bson.M{"$set": bson.M{"name": group.Name, "updated_at": time.Now()}})
+}
+
+// Delete - deletes a group.
+func (r *MongoGroupRepository) Delete(ctx context.Context, group *Group) error {
+	filter, err := scope(ctx, bson.M{"id": group.ID})
+	if err != nil {
+		return err
+	}
+
+	result, err := r.mongo.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return errors.New("Group does not exist")
+	}
+
+	return nil
+}
+
+// AddMember - adds a user to a group. Adding a member twice does nothing.
+func (r *MongoGroupRepository) AddMember(ctx context.Context, group *Group, userID string) error {
+	return r.updateHelper(ctx, group, bson.M{
+		"$addToSet": bson.M{"member_ids": userID},
+		"$set":      bson.M{"updated_at": time.Now()},
+	})
+}
+
+// RemoveMember - removes a user from a group.
+func (r *MongoGroupRepository) RemoveMember(ctx context.Context, group *Group, userID string) error {
+	return r.updateHelper(ctx, group, bson.M{
+		"$pull": bson.M{"member_ids": userID},
+		"$set":  bson.M{"updated_at": time.Now()},
+	})
+}
+
+// RemoveMemberFromAll - removes a user from every group of the organization, eg. when the user is deleted.
+func (r *MongoGroupRepository) RemoveMemberFromAll(ctx context.Context, userID string) error {
+	filter, err := scope(ctx, bson.M{"member_ids": userID})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.mongo.UpdateMany(ctx, filter, bson.M{"$pull": bson.M{"member_ids": userID}})
+
+	return err
+}
+
+// GetByMember - returns a page of the groups a user is member of sorted by name, and the total amount of them.
+func (r *MongoGroupRepository) GetByMember(ctx context.Context, userID string, offset int64, limit int64) ([]*Group, int64, error) {
+	groupsReturn := []*Group{}
+
+	filter, err := scope(ctx, bson.M{"member_ids": userID})
+	if err != nil {
+		return []*Group{}, 0, err
+	}
+
+	total, err := r.mongo.CountDocuments(ctx, filter)
+	if err != nil {
+		return []*Group{}, 0, err
+	}
+
+	opts := options.Find().
+		SetProjection(bson.M{"member_ids": 0}).
+		SetSort(bson.D{{Key: "name", Value: 1}}).
+		SetSkip(offset).
+		SetLimit(limit)
+	cursor, err := r.mongo.Find(ctx, filter, opts)
+	if err != nil {
+		return []*Group{}, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var tempGroup Group
+		if err := cursor.Decode(&tempGroup); err != nil {
+			return []*Group{}, 0, err
+		}
+		groupsReturn = append(groupsReturn, &tempGroup)
+	}
+
+	return groupsReturn, total, cursor.Err()
+}
+
+// GetMemberIDs - returns a page of the ids of the members of a group, and the total amount of members.
+// Members are in the order they were added.
+func (r *MongoGroupRepository) GetMemberIDs(ctx context.Context, group *Group, offset int64, limit int64) ([]string, int64, error) {
+	filter, err := scope(ctx, bson.M{"id": group.ID})
+	if err != nil {
+		return []string{}, 0, err
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$project", Value: bson.M{
+			"total":      bson.M{"$size": "$member_ids"},
+			"member_ids": bson.M{"$slice": bson.A{"$member_ids", offset, limit}},
+		}}},
+	}
+	cursor, err := r.mongo.Aggregate(ctx, pipeline)
+	if err != nil {
+		return []string{}, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	if !cursor.Next(ctx) {
+		if err := cursor.Err(); err != nil {
+			return []string{}, 0, err
+		}
+		return []string{}, 0, errors.New("Group does not exist")
+	}
+
+	page := struct {
+		Total     int64    `bson:"total"`
+		MemberIDs []string `bson:"member_ids"`
+	}{}
+	if err := cursor.Decode(&page); err != nil {
+		return []string{}, 0, err
+	}
+
+	return page.MemberIDs, page.Total, nil
+}
+
+// updateHelper - applies update to a group of the organization in ctx
+func (r *MongoGroupRepository) updateHelper(ctx context.Context, group *Group, update bson.M) error {
+	filter, err := scope(ctx, bson.M{"id": group.ID})
+	if err != nil {
+		return err
+	}
+
+	result, err := r.mongo.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.New("Group does not exist")
+	}
+
+	return nil
+}
@@ -0,0 +1,219 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ChartUser - a user of an org chart. Depth is how many levels the user is below or above the user
+// the chart was made for, starting at 0 for direct reports and the direct manager.
+type ChartUser struct {
+	User  `bson:",inline"`
+	Depth int64 `bson:"depth"`
+}
+
+// ErrManagerCycle - returned when a user would end up managing him/herself.
+var ErrManagerCycle = errors.New("The manager reports to the user")
+
+// UpdateManager - sets the manager of a user, or removes it if ManagerID is empty. A user cannot get a
+// manager, who reports to the user. As another update of a manager might be written between the check
+// and the write, the chain is checked again after the write, and a write, which closed a cycle, is undone.
+func (r *MongoRepository) UpdateManager(ctx context.Context, user *User) error {
+	filter, err := userScope(ctx, bson.M{"id": user.ID})
+	if err != nil {
+		return err
+	}
+
+	previous := struct {
+		ManagerID string `bson:"manager_id"`
+	}{}
+	if err := r.mongo.FindOne(ctx, filter, options.FindOne().SetProjection(bson.M{"manager_id": 1})).Decode(&previous); err != nil {
+		return err
+	}
+
+	cycle, err := r.managerCycleHelper(ctx, user)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return ErrManagerCycle
+	}
+
+	updateUser := bson.M{
+		"$set": bson.M{
+			"manager_id":       user.ManagerID,
+			"manager_orphaned": false,
+			"updated_at":       time.Now(),
+		},
+	}
+	if err := r.updateHelper(ctx, user, filter, updateUser); err != nil {
+		return err
+	}
+
+	cycle, err = r.managerCycleHelper(ctx, user)
+	if err == nil && !cycle {
+		return nil
+	}
+
+	// undo the write, unless the manager was changed again meanwhile
+	undoFilter, scopeErr := userScope(ctx, bson.M{"id": user.ID, "manager_id": user.ManagerID})
+	if scopeErr != nil {
+		return scopeErr
+	}
+	undo := bson.M{
+		"$set": bson.M{"manager_id": previous.ManagerID, "updated_at": time.Now()},
+		"$inc": bson.M{"version": 1},
+	}
+	if _, undoErr := r.mongo.UpdateOne(ctx, undoFilter, undo); undoErr != nil {
+		return undoErr
+	}
+	if err != nil {
+		return err
+	}
+	return ErrManagerCycle
+}
+
+// managerCycleHelper - reports whether the user is its own manager, or is in the management chain of its manager
+func (r *MongoRepository) managerCycleHelper(ctx context.Context, user *User) (bool, error) {
+	if user.ManagerID == "" {
+		return false, nil
+	}
+	if user.ManagerID == user.ID {
+		return true, nil
+	}
+	chain, err := r.GetManagementChain(ctx, &User{ID: user.ManagerID})
+	if err != nil {
+		return false, err
+	}
+	for _, manager := range chain {
+		if manager.ID == user.ID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// FlagReports - marks the direct reports of a manager as orphaned, eg. when the manager is blocked or
+// deleted, or clears the mark again when the manager is unblocked.
+func (r *MongoRepository) FlagReports(ctx context.Context, manager *User, orphaned bool) error {
+	filter, err := userScope(ctx, bson.M{"manager_id": manager.ID})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.mongo.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"manager_orphaned": orphaned}, "$inc": bson.M{"version": 1}})
+
+	return err
+}
+
+// GetDirectReports - returns the users the manager manages directly, without passwords.
+func (r *MongoRepository) GetDirectReports(ctx context.Context, manager *User) ([]*User, error) {
+	usersReturn := []*User{}
+
+	filter, err := userScope(ctx, bson.M{"manager_id": manager.ID})
+	if err != nil {
+		return []*User{}, err
+	}
+
+	opts := options.Find().SetProjection(bson.M{"password": 0})
+	cursor, err := r.mongo.Find(ctx, filter, opts)
+	if err != nil {
+		return []*User{}, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var tempUser User
+		if err := cursor.Decode(&tempUser); err != nil {
+			return []*User{}, err
+		}
+		if err := r.decryptHelper(ctx, &tempUser); err != nil {
+			return []*User{}, err
+		}
+		usersReturn = append(usersReturn, &tempUser)
+	}
+	if err := cursor.Err(); err != nil {
+		return []*User{}, err
+	}
+
+	// names can be encrypted, so the users are sorted once they are decrypted
+	sort.SliceStable(usersReturn, func(i, j int) bool {
+		return usersReturn[i].Name < usersReturn[j].Name
+	})
+	return usersReturn, nil
+}
+
+// GetReports - returns every user below the manager in the org chart, without passwords.
+func (r *MongoRepository) GetReports(ctx context.Context, manager *User) ([]*ChartUser, error) {
+	return r.graphLookupHelper(ctx, manager, "$id", "id", "manager_id")
+}
+
+// GetManagementChain - returns the managers above the user, starting with the direct manager,
+// without passwords.
+func (r *MongoRepository) GetManagementChain(ctx context.Context, user *User) ([]*ChartUser, error) {
+	return r.graphLookupHelper(ctx, user, "$manager_id", "manager_id", "id")
+}
+
+// graphLookupHelper - walks the org chart from user with $graphLookup and returns the users found
+// sorted by depth. The walk never leaves the organization in ctx.
+func (r *MongoRepository) graphLookupHelper(ctx context.Context, user *User, startWith string, connectFromField string, connectToField string) ([]*ChartUser, error) {
+	filter, err := userScope(ctx, bson.M{"id": user.ID})
+	if err != nil {
+		return []*ChartUser{}, err
+	}
+	restrict, err := userScope(ctx, bson.M{})
+	if err != nil {
+		return []*ChartUser{}, err
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$graphLookup", Value: bson.M{
+			"from":                    r.mongo.Name(),
+			"startWith":               startWith,
+			"connectFromField":        connectFromField,
+			"connectToField":          connectToField,
+			"as":                      "chart",
+			"depthField":              "depth",
+			"restrictSearchWithMatch": restrict,
+		}}},
+		{{Key: "$unwind", Value: "$chart"}},
+		{{Key: "$replaceRoot", Value: bson.M{"newRoot": "$chart"}}},
+		{{Key: "$project", Value: bson.M{"password": 0}}},
+	}
+	cursor, err := r.mongo.Aggregate(ctx, pipeline)
+	if err != nil {
+		return []*ChartUser{}, err
+	}
+	defer cursor.Close(ctx)
+
+	usersReturn := []*ChartUser{}
+	for cursor.Next(ctx) {
+		var tempUser ChartUser
+		if err := cursor.Decode(&tempUser); err != nil {
+			return []*ChartUser{}, err
+		}
+		if err := r.decryptHelper(ctx, &tempUser.User); err != nil {
+			return []*ChartUser{}, err
+		}
+		usersReturn = append(usersReturn, &tempUser)
+	}
+	if err := cursor.Err(); err != nil {
+		return []*ChartUser{}, err
+	}
+
+	// names can be encrypted, so the users are sorted once they are decrypted
+	sort.SliceStable(usersReturn, func(i, j int) bool {
+		if usersReturn[i].Depth != usersReturn[j].Depth {
+			return usersReturn[i].Depth < usersReturn[j].Depth
+		}
+		return usersReturn[i].Name < usersReturn[j].Name
+	})
+	return usersReturn, nil
+}
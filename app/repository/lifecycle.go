@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Status - the lifecycle state of a user. Only active users can authenticate.
+type Status string
+
+// the statuses of a user
+const (
+	StatusInvited             Status = "invited"
+	StatusPendingVerification Status = "pending_verification"
+	StatusActive              Status = "active"
+	StatusSuspended           Status = "suspended"
+	StatusDeactivated         Status = "deactivated"
+	StatusDeleted             Status = "deleted"
+)
+
+// statusTransitions - the statuses a user can change to from each status. Users are only deleted and
+// restored by Delete and RestoreUser, which keep the status the user had before the deletion.
+var statusTransitions = map[Status][]Status{
+	StatusInvited:             {StatusPendingVerification, StatusActive, StatusDeactivated},
+	StatusPendingVerification: {StatusActive, StatusDeactivated},
+	StatusActive:              {StatusSuspended, StatusDeactivated},
+	StatusSuspended:           {StatusActive, StatusSuspended, StatusDeactivated},
+	StatusDeactivated:         {StatusActive},
+}
+
+// StatusChange - a transition of the status of a user, made by the user with id By.
+type StatusChange struct {
+	From   Status    `bson:"from" json:"from"`
+	To     Status    `bson:"to" json:"to"`
+	Reason string    `bson:"reason,omitempty" json:"reason,omitempty"`
+	By     string    `bson:"by,omitempty" json:"by,omitempty"`
+	At     time.Time `bson:"at" json:"at"`
+}
+
+// ParseStatus - returns the status named s
+func ParseStatus(s string) (Status, error) {
+	status := Status(strings.ToLower(strings.TrimSpace(s)))
+	if _, ok := statusTransitions[status]; !ok && status != StatusDeleted {
+		return "", fmt.Errorf("Unknown status %s", s)
+	}
+	return status, nil
+}
+
+// Suspension - suspends a user from Start until End. Reason is shown to admins.
+type Suspension struct {
+	Reason string    `bson:"reason" json:"reason"`
+	Start  time.Time `bson:"start" json:"start"`
+	End    time.Time `bson:"end" json:"end"`
+	By     string    `bson:"by,omitempty" json:"by,omitempty"`
+}
+
+// Validate - validates that the suspension has a reason and ends in the future, after it starts.
+func (s *Suspension) Validate() error {
+	s.Reason = strings.TrimSpace(s.Reason)
+	if s.Reason == "" {
+		return errors.New("Required reason of the suspension")
+	}
+	if !s.End.After(time.Now()) || !s.End.After(s.Start) {
+		return errors.New("Required end of the suspension in the future, after its start")
+	}
+	return nil
+}
+
+// scheduled - reports whether the suspension starts after now
+func (s *Suspension) scheduled(now time.Time) bool {
+	return s.Start.After(now)
+}
+
+// CurrentStatus - returns the stored status of the user. Users created before statuses existed are
+// active, or deactivated if they are blocked.
+func (u *User) CurrentStatus() Status {
+	if u.DeletedAt != nil {
+		return StatusDeleted
+	}
+	if u.Status != "" {
+		return u.Status
+	}
+	if u.Blocked {
+		return StatusDeactivated
+	}
+	return StatusActive
+}
+
+// StatusAt - returns the status of the user at the given time. Suspensions start and end on time, also
+// before the scheduler has changed the stored status.
+func (u *User) StatusAt(now time.Time) Status {
+	current := u.CurrentStatus()
+	if u.Suspension == nil {
+		return current
+	}
+	if current == StatusSuspended && !now.Before(u.Suspension.End) {
+		return StatusActive
+	}
+	if current == StatusActive && !u.Suspension.scheduled(now) && now.Before(u.Suspension.End) {
+		return StatusSuspended
+	}
+	return current
+}
+
+// Active - reports whether the user can authenticate and act right now
+func (u *User) Active() bool {
+	return u.StatusAt(time.Now()) == StatusActive
+}
+
+// initStatus - sets the status of a new user, who is active unless created as blocked
+func (u *User) initStatus() {
+	if u.Status == "" {
+		u.Status = u.CurrentStatus()
+	}
+	u.Blocked = blockedStatus(u.Status)
+	u.StatusUpdatedAt = time.Now()
+}
+
+// blockedStatus - reports whether users with the status are blocked. Blocked is kept for the
+// clients that only know blocked users.
+func blockedStatus(status Status) bool {
+	return status == StatusSuspended || status == StatusDeactivated
+}
+
+// ValidateTransition - validates that a user can change from one status to another.
+func ValidateTransition(from Status, to Status) error {
+	for _, status := range statusTransitions[from] {
+		if status == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("Cannot change the status of a user from %s to %s", from, to)
+}
+
+// UpdateStatus - changes the status of a user to the status of change, and records the change on the
+// user. A suspension requires suspension, and if it starts in the future, the status is changed when it
+// starts. Activating a user with a scheduled suspension cancels the suspension. Fails if the status of
+// the user was changed by someone else since the user was read.
+func (r *MongoRepository) UpdateStatus(ctx context.Context, user *User, change *StatusChange, suspension *Suspension) error {
+	now := time.Now()
+	change.From = user.CurrentStatus()
+	change.Reason = strings.TrimSpace(change.Reason)
+	change.At = now
+
+	cancel := change.From == StatusActive && change.To == StatusActive && user.Suspension != nil
+	if !cancel {
+		if err := ValidateTransition(change.From, change.To); err != nil {
+			return err
+		}
+	}
+
+	update := bson.M{}
+	if change.To == StatusSuspended {
+		if suspension == nil {
+			return errors.New("Required suspension")
+		}
+		if err := suspension.Validate(); err != nil {
+			return err
+		}
+		change.Reason = suspension.Reason
+		update["$set"] = bson.M{"suspension": suspension, "updated_at": now}
+	} else {
+		update["$unset"] = bson.M{"suspension": ""}
+		update["$set"] = bson.M{"updated_at": now}
+	}
+
+	// a scheduled suspension changes the status when it starts
+	scheduled := change.To == StatusSuspended && suspension.scheduled(now)
+	if !scheduled && !cancel {
+		set := update["$set"].(bson.M)
+		set["status"] = change.To
+		set["blocked"] = blockedStatus(change.To)
+		set["status_updated_at"] = now
+		update["$push"] = bson.M{"status_changes": change}
+	}
+
+	current := bson.M{"id": user.ID, "status": user.Status}
+	if user.Status == "" {
+		// users created before statuses existed have no status
+		current["status"] = nil
+	}
+	filter, err := userScope(ctx, current)
+	if err != nil {
+		return err
+	}
+	expectVersionHelper(user, filter, update)
+
+	result, err := r.mongo.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		if user.ExpectedVersion != nil {
+			return ErrVersionConflict
+		}
+		return errors.New("The status of the user was changed meanwhile, try again")
+	}
+	if user.ExpectedVersion != nil {
+		user.Version = *user.ExpectedVersion + 1
+	}
+
+	user.Suspension = nil
+	if change.To == StatusSuspended {
+		user.Suspension = suspension
+	}
+	if !scheduled && !cancel {
+		user.Status = change.To
+		user.Blocked = blockedStatus(change.To)
+		user.StatusUpdatedAt = now
+		user.StatusChanges = append(user.StatusChanges, *change)
+	}
+
+	return nil
+}
+
+// GetSuspensionChanges - returns the users of every organization in ctx, whose suspension has started or
+// ended at the given time, but whose stored status has not changed yet.
+func (r *MongoRepository) GetSuspensionChanges(ctx context.Context, now time.Time) ([]*User, error) {
+	filter, err := userScope(ctx, bson.M{"$or": bson.A{
+		bson.M{"status": StatusActive, "suspension.start": bson.M{"$lte": now}, "suspension.end": bson.M{"$gt": now}},
+		bson.M{"status": StatusSuspended, "suspension.end": bson.M{"$lte": now}},
+	}})
+	if err != nil {
+		return []*User{}, err
+	}
+
+	return r.findHelper(ctx, filter)
+}
@@ -0,0 +1,236 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultListLimit - the page size of List when the query has no limit
+const DefaultListLimit = 50
+
+// MaxListLimit - the largest page List returns
+const MaxListLimit = 500
+
+// ListSortFields - the fields List can sort by. Users are sorted by name if not set.
+var ListSortFields = []string{"name", "email", "country_code", "created_at", "updated_at"}
+
+// ListFields - the fields List can return besides the id. Passwords are never returned.
+var ListFields = []string{"name", "email", "phone", "country_code", "dial_code", "gender", "image", "description", "title", "birthday", "privilege_id", "blocked", "created_at", "updated_at", "team", "org_id", "manager_id"}
+
+// ListQuery - filters, sorts and pages the users of List. Zero values do not filter, and Cursor is
+// the NextCursor of the previous page. A cursor only works with the filters and sorting it was made with.
+type ListQuery struct {
+	Blocked       *bool
+	PrivilegeID   string
+	CountryCode   string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	SortBy        string
+	Descending    bool
+	Fields        []string
+	Cursor        string
+	Limit         int64
+}
+
+// ListPage - a page of users. NextCursor is empty on the last page, and Total counts the users
+// matching the filters in every page.
+type ListPage struct {
+	Users      []*User
+	NextCursor string
+	Total      int64
+}
+
+// listCursor - the position after the last user of a page
+type listCursor struct {
+	Value interface{} `bson:"v"`
+	ID    string      `bson:"id"`
+}
+
+// Validate - validates input and sets the default sorting and page size.
+func (q *ListQuery) Validate() error {
+	if q.SortBy == "" {
+		q.SortBy = "name"
+	}
+	if !containsField(ListSortFields, q.SortBy) {
+		return fmt.Errorf("Cannot sort by %s", q.SortBy)
+	}
+	for _, field := range q.Fields {
+		if !containsField(ListFields, field) {
+			return fmt.Errorf("Unknown field %s", field)
+		}
+	}
+	if !q.CreatedAfter.IsZero() && !q.CreatedBefore.IsZero() && q.CreatedBefore.Before(q.CreatedAfter) {
+		return errors.New("CreatedBefore is before CreatedAfter")
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultListLimit
+	}
+	if q.Limit > MaxListLimit {
+		q.Limit = MaxListLimit
+	}
+	return nil
+}
+
+// containsField - reports whether field is one of fields
+func containsField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// filter - the filter of the query without the cursor. The root user and service accounts are never listed.
+func (q *ListQuery) filter() bson.M {
+	filter := bson.M{
+		"admin":           bson.M{"$ne": true},
+		"service_account": bson.M{"$ne": true},
+	}
+	if q.Blocked != nil {
+		filter["blocked"] = *q.Blocked
+	}
+	if q.PrivilegeID != "" {
+		filter["privilege_id"] = q.PrivilegeID
+	}
+	if q.CountryCode != "" {
+		filter["country_code"] = q.CountryCode
+	}
+	created := bson.M{}
+	if !q.CreatedAfter.IsZero() {
+		created["$gte"] = q.CreatedAfter
+	}
+	if !q.CreatedBefore.IsZero() {
+		created["$lt"] = q.CreatedBefore
+	}
+	if len(created) > 0 {
+		filter["created_at"] = created
+	}
+	return filter
+}
+
+// cursorFilter - restricts filter to the users after the cursor in the sort order. Users with the
+// same sort value are ordered by id, s.t. no user is skipped or listed twice.
+func (q *ListQuery) cursorFilter(filter bson.M) (bson.M, error) {
+	if q.Cursor == "" {
+		return filter, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, errors.New("Invalid cursor")
+	}
+	cursor := listCursor{}
+	if err := bson.Unmarshal(raw, &cursor); err != nil {
+		return nil, errors.New("Invalid cursor")
+	}
+
+	after := "$gt"
+	if q.Descending {
+		after = "$lt"
+	}
+	filter["$or"] = bson.A{
+		bson.M{q.SortBy: bson.M{after: cursor.Value}},
+		bson.M{q.SortBy: cursor.Value, "id": bson.M{after: cursor.ID}},
+	}
+	return filter, nil
+}
+
+// nextCursor - returns the cursor pointing after user
+func (q *ListQuery) nextCursor(user bson.Raw) (string, error) {
+	cursor := listCursor{Value: user.Lookup(q.SortBy), ID: user.Lookup("id").StringValue()}
+	raw, err := bson.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// projection - the fields of the query, always with the id and the sort field needed by the cursor.
+// No fields returns every field except the password.
+func (q *ListQuery) projection() bson.M {
+	if len(q.Fields) == 0 {
+		return bson.M{"password": 0}
+	}
+	projection := bson.M{"id": 1, q.SortBy: 1}
+	for _, field := range q.Fields {
+		projection[field] = 1
+		if containsField(encryptedUserFields, field) {
+			projection["encrypted."+field] = 1
+		}
+	}
+	return projection
+}
+
+// List - returns a page of the users matching the query, without passwords. Users are sorted by when
+// they were created if not set, when their names are encrypted.
+func (r *MongoRepository) List(ctx context.Context, query *ListQuery) (*ListPage, error) {
+	if query.SortBy == "" && r.envelope.Encrypts("name") {
+		query.SortBy = "created_at"
+	}
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	// encrypted fields are empty in the documents, and cannot sort them
+	if r.envelope.Encrypts(query.SortBy) {
+		return nil, fmt.Errorf("Cannot sort by %s, which is encrypted", query.SortBy)
+	}
+
+	filter, err := userScope(ctx, query.filter())
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := r.mongo.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err = query.cursorFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	order := 1
+	if query.Descending {
+		order = -1
+	}
+	// one user more than the page tells if there is a next page
+	opts := options.Find().
+		SetProjection(query.projection()).
+		SetSort(bson.D{{Key: query.SortBy, Value: order}, {Key: "id", Value: order}}).
+		SetLimit(query.Limit + 1)
+	cursor, err := r.mongo.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	page := &ListPage{Users: []*User{}, Total: total}
+	var last bson.Raw
+	for cursor.Next(ctx) {
+		if int64(len(page.Users)) == query.Limit {
+			if page.NextCursor, err = query.nextCursor(last); err != nil {
+				return nil, err
+			}
+			break
+		}
+		var tempUser User
+		if err := cursor.Decode(&tempUser); err != nil {
+			return nil, err
+		}
+		if err := r.decryptHelper(ctx, &tempUser); err != nil {
+			return nil, err
+		}
+		page.Users = append(page.Users, &tempUser)
+		last = append(bson.Raw{}, cursor.Current...)
+	}
+
+	return page, cursor.Err()
+}
@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	tenant "github.com/softcorp-io/hqs-user-service/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Organization - a customer company. Users only see the users of their own organization, and can
+// only be given the privileges of it.
+type Organization struct {
+	ID                 string    `bson:"id" json:"id"`
+	Name               string    `bson:"name" json:"name"`
+	PrivilegeIDs       []string  `bson:"privilege_ids" json:"privilege_ids"`
+	DefaultPrivilegeID string    `bson:"default_privilege_id" json:"default_privilege_id"`
+	CreatedAt          time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt          time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// OrganizationRepository - interface.
+type OrganizationRepository interface {
+	Create(ctx context.Context, organization *Organization) error
+	Get(ctx context.Context, organization *Organization) (*Organization, error)
+	GetAll(ctx context.Context) ([]*Organization, error)
+	Update(ctx context.Context, organization *Organization) error
+}
+
+// MongoOrganizationRepository - struct.
+type MongoOrganizationRepository struct {
+	mongo *mongo.Collection
+}
+
+// NewOrganizationRepository - returns MongoOrganizationRepository pointer.
+func NewOrganizationRepository(mongo *mongo.Collection) *MongoOrganizationRepository {
+	return &MongoOrganizationRepository{mongo}
+}
+
+// Validate - validates input. The default privilege is always one of the privileges of the organization.
+func (o *Organization) Validate() error {
+	o.Name = strings.TrimSpace(o.Name)
+	if o.Name == "" {
+		return errors.New("Required name")
+	}
+	if o.DefaultPrivilegeID == "" {
+		return errors.New("Invalid DefaultPrivilegeID")
+	}
+	if !o.HasPrivilege(o.DefaultPrivilegeID) {
+		o.PrivilegeIDs = append(o.PrivilegeIDs, o.DefaultPrivilegeID)
+	}
+	return nil
+}
+
+// HasPrivilege - returns whether users of the organization can be given the privilege
+func (o *Organization) HasPrivilege(privilegeID string) bool {
+	for _, id := range o.PrivilegeIDs {
+		if id == privilegeID {
+			return true
+		}
+	}
+	return false
+}
+
+// organizationScope - restricts filter to the organization in ctx, like scope does for users.
+func organizationScope(ctx context.Context, filter bson.M) (bson.M, error) {
+	organizationID, all, err := tenant.Organization(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !all {
+		filter["$and"] = bson.A{bson.M{"id": organizationID}}
+	}
+	return filter, nil
+}
+
+// Create - creates a new organization.
+func (r *MongoOrganizationRepository) Create(ctx context.Context, organization *Organization) error {
+	organization.ID = uuid.NewV4().String()
+	if err := organization.Validate(); err != nil {
+		return err
+	}
+
+	organization.CreatedAt = time.Now()
+	organization.UpdatedAt = time.Now()
+
+	_, err := r.mongo.InsertOne(ctx, organization)
+
+	return err
+}
+
+// Get - finds a single organization using its id.
+func (r *MongoOrganizationRepository) Get(ctx context.Context, organization *Organization) (*Organization, error) {
+	organizationReturn := Organization{}
+
+	filter, err := organizationScope(ctx, bson.M{"id": organization.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.mongo.FindOne(ctx, filter).Decode(&organizationReturn); err != nil {
+		return nil, err
+	}
+
+	return &organizationReturn, nil
+}
+
+// GetAll - returns every organization the context can see.
+func (r *MongoOrganizationRepository) GetAll(ctx context.Context) ([]*Organization, error) {
+	organizationsReturn := []*Organization{}
+
+	filter, err := organizationScope(ctx, bson.M{})
+	if err != nil {
+		return []*Organization{}, err
+	}
+
+	cursor, err := r.mongo.Find(ctx, filter)
+	if err != nil {
+		return []*Organization{}, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var tempOrganization Organization
+		if err := cursor.Decode(&tempOrganization); err != nil {
+			return []*Organization{}, err
+		}
+		organizationsReturn = append(organizationsReturn, &tempOrganization)
+	}
+
+	return organizationsReturn, cursor.Err()
+}
+
+// Update - updates the name and privileges of an organization.
+func (r *MongoOrganizationRepository) Update(ctx context.Context, organization *Organization) error {
+	if err := organization.Validate(); err != nil {
+		return err
+	}
+
+	filter, err := organizationScope(ctx, bson.M{"id": organization.ID})
+	if err != nil {
+		return err
+	}
+
+	result, err := r.mongo.UpdateOne(
+		ctx,
+		filter,
+		bson.M{
+			"$set": bson.M{
+				"name":                 organization.Name,
+				"privilege_ids":        organization.PrivilegeIDs,
+				"default_privilege_id": organization.DefaultPrivilegeID,
+				"updated_at":           time.Now(),
+			},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.New("Organization does not exist")
+	}
+
+	return nil
+}
@@ -9,10 +9,13 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"github.com/badoux/checkmail"
 	"github.com/golang/protobuf/ptypes"
 	uuid "github.com/satori/go.uuid"
+	crypto "github.com/softcorp-io/hqs-user-service/crypto"
+	tenant "github.com/softcorp-io/hqs-user-service/tenant"
 	userProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
 )
 
@@ -35,8 +38,66 @@ type User struct {
 	Admin       bool      `bson:"admin" json:"admin"`
 	CreatedAt   time.Time `bson:"created_at" json:"created_at"`
 	UpdatedAt   time.Time `bson:"updated_at" json:"updated_at"`
+	// service accounts are non-human users owned by a user. They authenticate with api keys.
+	ServiceAccount bool   `bson:"service_account" json:"service_account"`
+	OwnerID        string `bson:"owner_id,omitempty" json:"owner_id,omitempty"`
+	// the team of the user, used by the policy when users act on each other
+	Team string `bson:"team,omitempty" json:"team,omitempty"`
+	// the organization of the user. Users only see users of their own organization, except root.
+	OrgID string `bson:"org_id,omitempty" json:"org_id,omitempty"`
+	// the id of the user who last updated the profile, and of the user who last updated each profile field
+	UpdatedBy      string            `bson:"updated_by,omitempty" json:"updated_by,omitempty"`
+	FieldUpdatedBy map[string]string `bson:"field_updated_by,omitempty" json:"field_updated_by,omitempty"`
+	// the manager the user reports to. ManagerOrphaned is set while the manager is blocked or deleted.
+	ManagerID       string `bson:"manager_id,omitempty" json:"manager_id,omitempty"`
+	ManagerOrphaned bool   `bson:"manager_orphaned,omitempty" json:"manager_orphaned,omitempty"`
+	// deleted users are hidden from every query until they are restored or purged
+	DeletedAt *time.Time `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	DeletedBy string     `bson:"deleted_by,omitempty" json:"deleted_by,omitempty"`
+	// the lifecycle state of the user, and every change of it. Blocked is true while suspended or deactivated.
+	Status          Status         `bson:"status,omitempty" json:"status,omitempty"`
+	StatusUpdatedAt time.Time      `bson:"status_updated_at,omitempty" json:"status_updated_at,omitempty"`
+	StatusChanges   []StatusChange `bson:"status_changes,omitempty" json:"status_changes,omitempty"`
+	// the current suspension of the user, or the next if it has not started yet
+	Suspension *Suspension `bson:"suspension,omitempty" json:"suspension,omitempty"`
+	// incremented on every write. Users created before versions existed have version 0.
+	Version int64 `bson:"version" json:"version"`
+	// the version a write expects the user to have, if any. Not stored.
+	ExpectedVersion *int64 `bson:"-" json:"-"`
+	// the fields encrypted by the envelope, which are left empty in the document, and the blind indexes of
+	// the email, the phone and every word of the name. Users are returned decrypted.
+	Encrypted  map[string]string `bson:"encrypted,omitempty" json:"-"`
+	EmailIndex string            `bson:"email_index,omitempty" json:"-"`
+	PhoneIndex string            `bson:"phone_index,omitempty" json:"-"`
+	NameIndex  []string          `bson:"name_index,omitempty" json:"-"`
 }
 
+// profileFields - the profile fields which can be updated one by one, by their bson name
+var profileFields = []struct {
+	name string
+	get  func(u *User) interface{}
+	set  func(u *User, value interface{})
+}{
+	{"name", func(u *User) interface{} { return u.Name }, func(u *User, v interface{}) { u.Name = v.(string) }},
+	{"email", func(u *User) interface{} { return u.Email }, func(u *User, v interface{}) { u.Email = v.(string) }},
+	{"phone", func(u *User) interface{} { return u.Phone }, func(u *User, v interface{}) { u.Phone = v.(string) }},
+	{"country_code", func(u *User) interface{} { return u.CountryCode }, func(u *User, v interface{}) { u.CountryCode = v.(string) }},
+	{"dial_code", func(u *User) interface{} { return u.DialCode }, func(u *User, v interface{}) { u.DialCode = v.(string) }},
+	{"gender", func(u *User) interface{} { return u.Gender }, func(u *User, v interface{}) { u.Gender = v.(bool) }},
+	{"description", func(u *User) interface{} { return u.Description }, func(u *User, v interface{}) { u.Description = v.(string) }},
+	{"title", func(u *User) interface{} { return u.Title }, func(u *User, v interface{}) { u.Title = v.(string) }},
+	{"birthday", func(u *User) interface{} { return u.Birthday }, func(u *User, v interface{}) { u.Birthday = v.(time.Time) }},
+}
+
+// ProfileFields - the names of the profile fields which can be updated one by one
+var ProfileFields = func() []string {
+	names := []string{}
+	for _, field := range profileFields {
+		names = append(names, field.name)
+	}
+	return names
+}()
+
 // Upload -struct.
 type Upload struct {
 	Content []byte
@@ -46,27 +107,48 @@ type Upload struct {
 type Repository interface {
 	Create(ctx context.Context, user *User) error
 	CreateRoot(ctx context.Context, user *User) error
+	CreateServiceAccount(ctx context.Context, user *User) error
 	Signup(ctx context.Context, user *User) error
 	GetAll(ctx context.Context) ([]*User, error)
+	List(ctx context.Context, query *ListQuery) (*ListPage, error)
+	Search(ctx context.Context, query *SearchQuery) ([]*SearchResult, bool, error)
 	Get(ctx context.Context, user *User) (*User, error)
+	GetMany(ctx context.Context, ids []string) ([]*User, error)
 	GetRoot(ctx context.Context) error
 	GetByEmail(ctx context.Context, user *User) (*User, error)
+	GetServiceAccounts(ctx context.Context, owner *User) ([]*User, error)
 	UpdateProfile(ctx context.Context, user *User) error
+	UpdateProfileFields(ctx context.Context, user *User, fields []string) error
 	UpdatePrivileges(ctx context.Context, user *User) error
 	UpdateImage(ctx context.Context, user *User) error
 	UpdatePassword(ctx context.Context, user *User) error
-	UpdateBlockUser(ctx context.Context, user *User) error
+	UpdateStatus(ctx context.Context, user *User, change *StatusChange, suspension *Suspension) error
+	GetSuspensionChanges(ctx context.Context, now time.Time) ([]*User, error)
+	UpdateTeam(ctx context.Context, user *User) error
+	UpdateOrganization(ctx context.Context, user *User) error
+	UpdateManager(ctx context.Context, user *User) error
+	FlagReports(ctx context.Context, manager *User, orphaned bool) error
+	GetDirectReports(ctx context.Context, manager *User) ([]*User, error)
+	GetReports(ctx context.Context, manager *User) ([]*ChartUser, error)
+	GetManagementChain(ctx context.Context, user *User) ([]*ChartUser, error)
+	SoftDelete(ctx context.Context, user *User, deletedBy string) error
+	GetDeleted(ctx context.Context, user *User) (*User, error)
+	Restore(ctx context.Context, user *User, restoredBy string) error
+	GetPurgeable(ctx context.Context, before time.Time) ([]*User, error)
 	Delete(ctx context.Context, user *User) error
+	DestroyDataKey(ctx context.Context, user *User) (string, error)
+	MigrateEncryption(ctx context.Context) (int, error)
 }
 
 // MongoRepository - struct.
 type MongoRepository struct {
-	mongo *mongo.Collection
+	mongo    *mongo.Collection
+	envelope *crypto.Envelope
 }
 
-// NewRepository - returns MongoRepository pointer.
-func NewRepository(mongo *mongo.Collection) *MongoRepository {
-	return &MongoRepository{mongo}
+// NewRepository - returns MongoRepository pointer. A nil envelope stores every field in clear text.
+func NewRepository(mongo *mongo.Collection, envelope *crypto.Envelope) *MongoRepository {
+	return &MongoRepository{mongo, envelope}
 }
 
 // MarshalUserCollection - marshal collection from userProto.users to users.
@@ -197,6 +279,46 @@ func (u *User) Validate(action string) error {
 		if !passwordValidator(u.Password) {
 			return errors.New("Invalid password")
 		}
+	case "serviceaccount":
+		if strings.TrimSpace(u.Name) == "" {
+			return errors.New("Required name")
+		}
+		if u.ID == "" || len(u.ID) < 20 {
+			return errors.New("Invalid UUID")
+		}
+		if u.OwnerID == "" {
+			return errors.New("Invalid OwnerID")
+		}
+		if u.PrivilegeID == "" {
+			return errors.New("Invalid PrivilegeID")
+		}
+	}
+	return nil
+}
+
+// profileField - returns the value of a profile field by its bson name.
+func (u *User) profileField(field string) (interface{}, error) {
+	for _, profileField := range profileFields {
+		if profileField.name == field {
+			return profileField.get(u), nil
+		}
+	}
+	return nil, errors.New("Unknown profile field " + field)
+}
+
+// CopyProfileFields - copies the given profile fields from source to u.
+func (u *User) CopyProfileFields(source *User, fields []string) error {
+	for _, field := range fields {
+		copied := false
+		for _, profileField := range profileFields {
+			if profileField.name == field {
+				profileField.set(u, profileField.get(source))
+				copied = true
+			}
+		}
+		if !copied {
+			return errors.New("Unknown profile field " + field)
+		}
 	}
 	return nil
 }
@@ -219,6 +341,8 @@ func (u *User) prepare(action string) {
 		} else {
 			u.Image = "hqs/users/shared/profileImage/maleProfileImage.png"
 		}
+		u.initStatus()
+		u.Version = 1
 		break
 	case "update":
 		u.Name = strings.TrimSpace(u.Name)
@@ -228,6 +352,18 @@ func (u *User) prepare(action string) {
 		u.CountryCode = strings.TrimSpace(u.CountryCode)
 		u.DialCode = strings.TrimSpace(u.DialCode)
 		break
+	case "serviceaccount":
+		u.Name = strings.TrimSpace(u.Name)
+		u.Email = ""
+		u.Password = ""
+		u.Admin = false
+		u.ServiceAccount = true
+		u.CreatedAt = time.Now()
+		u.UpdatedAt = time.Now()
+		u.Image = "hqs/users/shared/profileImage/maleProfileImage.png"
+		u.initStatus()
+		u.Version = 1
+		break
 	case "root":
 		u.Name = strings.TrimSpace(u.Name)
 		u.Email = strings.TrimSpace(u.Email)
@@ -242,6 +378,8 @@ func (u *User) prepare(action string) {
 		} else {
 			u.Image = "hqs/users/shared/profileImage/maleProfileImage.png"
 		}
+		u.initStatus()
+		u.Version = 1
 		break
 	}
 }
@@ -255,13 +393,23 @@ func (r *MongoRepository) Create(ctx context.Context, user *User) error {
 
 	user.prepare("create")
 
+	organizationID, err := organizationOf(ctx, user.OrgID)
+	if err != nil {
+		return err
+	}
+	user.OrgID = organizationID
+
 	// check that a user don't exist with that email
-	checkUser, _ := r.GetByEmail(ctx, user)
-	if checkUser != nil {
+	if r.emailExistsHelper(ctx, user.Email) {
 		return errors.New("A user with that email already exists")
 	}
 
-	_, err := r.mongo.InsertOne(ctx, user)
+	stored, err := r.encryptHelper(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.mongo.InsertOne(ctx, stored)
 	if err != nil {
 		return err
 	}
@@ -278,13 +426,23 @@ func (r *MongoRepository) CreateRoot(ctx context.Context, user *User) error {
 
 	user.prepare("root")
 
+	organizationID, err := organizationOf(ctx, user.OrgID)
+	if err != nil {
+		return err
+	}
+	user.OrgID = organizationID
+
 	// check that a user don't exist with that email
-	checkUser, _ := r.GetByEmail(ctx, user)
-	if checkUser != nil {
+	if r.emailExistsHelper(ctx, user.Email) {
 		return errors.New("A user with that email already exists")
 	}
 
-	_, err := r.mongo.InsertOne(ctx, user)
+	stored, err := r.encryptHelper(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.mongo.InsertOne(ctx, stored)
 	if err != nil {
 		return err
 	}
@@ -292,6 +450,31 @@ func (r *MongoRepository) CreateRoot(ctx context.Context, user *User) error {
 	return err
 }
 
+// CreateServiceAccount - creates a new service account owned by user.OwnerID.
+func (r *MongoRepository) CreateServiceAccount(ctx context.Context, user *User) error {
+	user.ID = uuid.NewV4().String()
+	if err := user.Validate("serviceaccount"); err != nil {
+		return err
+	}
+
+	user.prepare("serviceaccount")
+
+	organizationID, err := organizationOf(ctx, user.OrgID)
+	if err != nil {
+		return err
+	}
+	user.OrgID = organizationID
+
+	stored, err := r.encryptHelper(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.mongo.InsertOne(ctx, stored)
+
+	return err
+}
+
 // Signup - same as create, but a uuid is given.
 func (r *MongoRepository) Signup(ctx context.Context, user *User) error {
 	if err := user.Validate("create"); err != nil {
@@ -300,13 +483,23 @@ func (r *MongoRepository) Signup(ctx context.Context, user *User) error {
 
 	user.prepare("create")
 
+	organizationID, err := organizationOf(ctx, user.OrgID)
+	if err != nil {
+		return err
+	}
+	user.OrgID = organizationID
+
 	// check that a user don't exist with that email
-	checkUser, _ := r.GetByEmail(ctx, user)
-	if checkUser != nil {
+	if r.emailExistsHelper(ctx, user.Email) {
 		return errors.New("A user with that email already exists")
 	}
 
-	_, err := r.mongo.InsertOne(ctx, user)
+	stored, err := r.encryptHelper(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.mongo.InsertOne(ctx, stored)
 
 	return err
 }
@@ -330,21 +523,54 @@ func (r *MongoRepository) UpdateProfile(ctx context.Context, user *User) error {
 			"description":  user.Description,
 			"title":        user.Title,
 			"birthday":     user.Birthday,
+			"updated_by":   user.UpdatedBy,
 			"updated_at":   time.Now(),
 		},
 	}
 
-	_, err := r.mongo.UpdateOne(
-		ctx,
-		bson.M{"id": user.ID},
-		updateUser,
-	)
+	filter, err := userScope(ctx, bson.M{"id": user.ID})
+	if err != nil {
+		return err
+	}
 
+	return r.updateHelper(ctx, user, filter, updateUser)
+}
+
+// UpdateProfileFields - updates only the given profile fields of user, and who updated them.
+func (r *MongoRepository) UpdateProfileFields(ctx context.Context, user *User, fields []string) error {
+	if len(fields) == 0 {
+		return errors.New("No fields to update")
+	}
+
+	if err := user.Validate("profile"); err != nil {
+		return err
+	}
+
+	user.prepare("update")
+
+	set := bson.M{
+		"updated_by": user.UpdatedBy,
+		"updated_at": time.Now(),
+	}
+	for _, field := range fields {
+		value, err := user.profileField(field)
+		if err != nil {
+			return err
+		}
+		set[field] = value
+		set["field_updated_by."+field] = user.UpdatedBy
+		if user.FieldUpdatedBy == nil {
+			user.FieldUpdatedBy = map[string]string{}
+		}
+		user.FieldUpdatedBy[field] = user.UpdatedBy
+	}
+
+	filter, err := userScope(ctx, bson.M{"id": user.ID})
 	if err != nil {
 		return err
 	}
 
-	return err
+	return r.updateHelper(ctx, user, filter, bson.M{"$set": set})
 }
 
 // UpdatePrivileges - updates users privileges be setting id to corresponding privilege.
@@ -356,17 +582,51 @@ func (r *MongoRepository) UpdatePrivileges(ctx context.Context, user *User) erro
 		},
 	}
 
-	_, err := r.mongo.UpdateOne(
-		ctx,
-		bson.M{"id": user.ID},
-		updateUser,
-	)
+	filter, err := userScope(ctx, bson.M{"id": user.ID})
+	if err != nil {
+		return err
+	}
+
+	return r.updateHelper(ctx, user, filter, updateUser)
+}
 
+// UpdateTeam - updates the team of a user. An empty team removes the user from his/her team.
+func (r *MongoRepository) UpdateTeam(ctx context.Context, user *User) error {
+	updateUser := bson.M{
+		"$set": bson.M{
+			"team":       strings.TrimSpace(user.Team),
+			"updated_at": time.Now(),
+		},
+	}
+
+	filter, err := userScope(ctx, bson.M{"id": user.ID})
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return r.updateHelper(ctx, user, filter, updateUser)
+}
+
+// UpdateOrganization - moves a user to another organization with a privilege of that organization.
+// The team and manager of the user belong to the old organization, so they are removed.
+func (r *MongoRepository) UpdateOrganization(ctx context.Context, user *User) error {
+	updateUser := bson.M{
+		"$set": bson.M{
+			"org_id":           user.OrgID,
+			"privilege_id":     user.PrivilegeID,
+			"team":             "",
+			"manager_id":       "",
+			"manager_orphaned": false,
+			"updated_at":       time.Now(),
+		},
+	}
+
+	filter, err := userScope(ctx, bson.M{"id": user.ID})
+	if err != nil {
+		return err
+	}
+
+	return r.updateHelper(ctx, user, filter, updateUser)
 }
 
 // UpdateImage - updates the path of the image.
@@ -380,17 +640,12 @@ func (r *MongoRepository) UpdateImage(ctx context.Context, user *User) error {
 		},
 	}
 
-	_, err := r.mongo.UpdateOne(
-		ctx,
-		bson.M{"id": user.ID},
-		updateUser,
-	)
-
+	filter, err := userScope(ctx, bson.M{"id": user.ID})
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return r.updateHelper(ctx, user, filter, updateUser)
 }
 
 // UpdatePassword - updates user password.
@@ -408,55 +663,146 @@ func (r *MongoRepository) UpdatePassword(ctx context.Context, user *User) error
 		},
 	}
 
-	_, err := r.mongo.UpdateOne(
-		ctx,
-		bson.M{"id": user.ID},
-		updateUser,
-	)
-
+	filter, err := userScope(ctx, bson.M{"id": user.ID})
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return r.updateHelper(ctx, user, filter, updateUser)
 }
 
-// UpdateBlockUser - update the block status on a user.
-func (r *MongoRepository) UpdateBlockUser(ctx context.Context, user *User) error {
-	updateUser := bson.M{
-		"$set": bson.M{
-			"blocked":    user.Blocked,
-			"updated_at": user.UpdatedAt,
-		},
+// scope - restricts filter to the organization in ctx. Fails if ctx has no organization, s.t. no query
+// can see the users of every organization by accident.
+func scope(ctx context.Context, filter bson.M) (bson.M, error) {
+	organizationID, all, err := tenant.Organization(ctx)
+	if err != nil {
+		return nil, err
 	}
-	_, err := r.mongo.UpdateOne(
-		ctx,
-		bson.M{"id": user.ID},
-		updateUser,
-	)
+	if all {
+		return filter, nil
+	}
+	if organizationID == "" {
+		// users created before organizations existed have no org_id
+		filter["org_id"] = bson.M{"$in": bson.A{"", nil}}
+	} else {
+		filter["org_id"] = organizationID
+	}
+	return filter, nil
+}
+
+// userScope - restricts filter to the users of the organization in ctx, which are not deleted.
+func userScope(ctx context.Context, filter bson.M) (bson.M, error) {
+	filter["deleted_at"] = nil
+	return scope(ctx, filter)
+}
+
+// organizationOf - returns the organization of a new document created in ctx. Only contexts that see
+// every organization can create documents in another organization than their own, given by current.
+func organizationOf(ctx context.Context, current string) (string, error) {
+	organizationID, all, err := tenant.Organization(ctx)
 	if err != nil {
-		return err
+		return "", err
+	}
+	if all {
+		return current, nil
 	}
+	return organizationID, nil
+}
 
-	return nil
+// emailExistsHelper - checks if any user has the email. Users log in with their email only, so
+// emails are unique across organizations.
+func (r *MongoRepository) emailExistsHelper(ctx context.Context, email string) bool {
+	err := r.mongo.FindOne(ctx, r.emailFilterHelper(email)).Err()
+	return err == nil
 }
 
 // Get - finds single user using the user's id.
 func (r *MongoRepository) Get(ctx context.Context, user *User) (*User, error) {
 	userReturn := User{}
 
-	if err := r.mongo.FindOne(ctx, bson.M{"id": user.ID}).Decode(&userReturn); err != nil {
+	filter, err := userScope(ctx, bson.M{"id": user.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.mongo.FindOne(ctx, filter).Decode(&userReturn); err != nil {
+		return nil, err
+	}
+	if err := r.decryptHelper(ctx, &userReturn); err != nil {
 		return nil, err
 	}
 
 	return &userReturn, nil
 }
 
+// GetMany - finds every user with one of the given ids. Users that do not exist are left out.
+func (r *MongoRepository) GetMany(ctx context.Context, ids []string) ([]*User, error) {
+	usersReturn := []*User{}
+
+	filter, err := userScope(ctx, bson.M{"id": bson.M{"$in": ids}})
+	if err != nil {
+		return []*User{}, err
+	}
+
+	cursor, err := r.mongo.Find(ctx, filter)
+	if err != nil {
+		return []*User{}, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var tempUser User
+		if err := cursor.Decode(&tempUser); err != nil {
+			return []*User{}, err
+		}
+		if err := r.decryptHelper(ctx, &tempUser); err != nil {
+			return []*User{}, err
+		}
+		usersReturn = append(usersReturn, &tempUser)
+	}
+
+	return usersReturn, cursor.Err()
+}
+
+// GetServiceAccounts - returns the service accounts owned by a user.
+func (r *MongoRepository) GetServiceAccounts(ctx context.Context, owner *User) ([]*User, error) {
+	usersReturn := []*User{}
+
+	filter, err := userScope(ctx, bson.M{"service_account": true, "owner_id": owner.ID})
+	if err != nil {
+		return []*User{}, err
+	}
+
+	cursor, err := r.mongo.Find(ctx, filter)
+	if err != nil {
+		return []*User{}, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var tempUser User
+		if err := cursor.Decode(&tempUser); err != nil {
+			return []*User{}, err
+		}
+		if err := r.decryptHelper(ctx, &tempUser); err != nil {
+			return []*User{}, err
+		}
+		usersReturn = append(usersReturn, &tempUser)
+	}
+
+	return usersReturn, cursor.Err()
+}
+
 // GetRoot - finds the single root user.
 func (r *MongoRepository) GetRoot(ctx context.Context) error {
 	userReturn := User{}
 
-	if err := r.mongo.FindOne(ctx, bson.M{"admin": true}).Decode(&userReturn); err != nil {
+	filter, err := userScope(ctx, bson.M{"admin": true})
+	if err != nil {
+		return err
+	}
+
+	if err := r.mongo.FindOne(ctx, filter).Decode(&userReturn); err != nil {
 		return err
 	}
 	return nil
@@ -466,42 +812,59 @@ func (r *MongoRepository) GetRoot(ctx context.Context) error {
 func (r *MongoRepository) GetByEmail(ctx context.Context, user *User) (*User, error) {
 	userReturn := User{}
 
-	if err := r.mongo.FindOne(ctx, bson.M{"email": user.Email}).Decode(&userReturn); err != nil {
+	filter, err := userScope(ctx, r.emailFilterHelper(user.Email))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.mongo.FindOne(ctx, filter).Decode(&userReturn); err != nil {
+		return nil, err
+	}
+	if err := r.decryptHelper(ctx, &userReturn); err != nil {
 		return nil, err
 	}
 
 	return &userReturn, nil
 }
 
-// GetAll - returns every user in the system. Also strips password of each user.
+// GetAll - returns every user in the system except root and service accounts, without passwords.
+// Use List to page through the users.
 func (r *MongoRepository) GetAll(ctx context.Context) ([]*User, error) {
 	usersReturn := []*User{}
 
-	cursor, err := r.mongo.Find(context.TODO(), bson.M{})
+	filter, err := userScope(ctx, (&ListQuery{}).filter())
+	if err != nil {
+		return []*User{}, err
+	}
 
+	cursor, err := r.mongo.Find(ctx, filter, options.Find().SetProjection(bson.M{"password": 0}))
 	if err != nil {
 		return []*User{}, err
 	}
+	defer cursor.Close(ctx)
 
 	for cursor.Next(ctx) {
 		var tempUser User
-		cursor.Decode(&tempUser)
-
-		// don't add root user
-		if tempUser.Admin {
-			continue
+		if err := cursor.Decode(&tempUser); err != nil {
+			return []*User{}, err
+		}
+		if err := r.decryptHelper(ctx, &tempUser); err != nil {
+			return []*User{}, err
 		}
-
 		usersReturn = append(usersReturn, &tempUser)
 	}
 
-	return usersReturn, nil
+	return usersReturn, cursor.Err()
 }
 
-// Delete - deletes a given user.
+// Delete - deletes a given user for good, also when the user is soft deleted.
 func (r *MongoRepository) Delete(ctx context.Context, user *User) error {
+	filter, err := scope(ctx, bson.M{"id": user.ID})
+	if err != nil {
+		return err
+	}
 
-	_, err := r.mongo.DeleteOne(ctx, bson.M{"id": user.ID})
+	_, err = r.mongo.DeleteOne(ctx, filter)
 	if err != nil {
 		return err
 	}
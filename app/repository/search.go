@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MaxSearchWindow - how far into the results a search can page, ie. the largest offset + limit
+const MaxSearchWindow = 1000
+
+// the scores added to the text score of a user, whose name or email starts with the search term, or whose
+// email or phone is the search term
+const (
+	namePrefixScore  = 2.0
+	emailPrefixScore = 1.5
+	exactMatchScore  = 3.0
+)
+
+// SearchQuery - searches users by Term. Blocked users are only found with IncludeBlocked.
+type SearchQuery struct {
+	Term           string
+	IncludeBlocked bool
+	Offset         int64
+	Limit          int64
+}
+
+// SearchResult - a user found by a search. Users with a higher score match the term better.
+type SearchResult struct {
+	User  `bson:",inline"`
+	Score float64 `bson:"score"`
+}
+
+// Validate - validates input and sets the default page size.
+func (q *SearchQuery) Validate() error {
+	q.Term = strings.TrimSpace(q.Term)
+	if q.Term == "" {
+		return errors.New("Required search term")
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultListLimit
+	}
+	if q.Offset+q.Limit > MaxSearchWindow {
+		return errors.New("Cannot page that far into the results, refine the search term")
+	}
+	return nil
+}
+
+// filter - the filter of the query besides the term. The root user and service accounts are never found.
+func (q *SearchQuery) filter() bson.M {
+	filter := bson.M{
+		"admin":           bson.M{"$ne": true},
+		"service_account": bson.M{"$ne": true},
+	}
+	if !q.IncludeBlocked {
+		filter["blocked"] = bson.M{"$ne": true}
+	}
+	return filter
+}
+
+// CreateIndexes - creates the indexes of the user collection, eg. the text index used by Search and the
+// blind indexes of the email, phone and name.
+func (r *MongoRepository) CreateIndexes(ctx context.Context) error {
+	textModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "name", Value: "text"}, {Key: "email", Value: "text"}, {Key: "phone", Value: "text"}},
+		Options: options.Index().
+			SetName("user_search").
+			SetWeights(bson.M{"name": 3, "email": 2, "phone": 1}).
+			SetDefaultLanguage("none"),
+	}
+	// users are found by the blind indexes of their email, phone and name, when they are encrypted
+	emailIndexModel := mongo.IndexModel{
+		Keys: bson.M{"email_index": 1},
+	}
+	phoneIndexModel := mongo.IndexModel{
+		Keys: bson.M{"phone_index": 1},
+	}
+	nameIndexModel := mongo.IndexModel{
+		Keys: bson.M{"name_index": 1},
+	}
+	_, err := r.mongo.Indexes().CreateMany(ctx, []mongo.IndexModel{textModel, emailIndexModel, phoneIndexModel, nameIndexModel})
+	return err
+}
+
+// Search - returns a page of the users matching the term, best match first and without passwords.
+// Users match when a word of their name, email or phone matches a word of the term, or when their
+// name or email starts with the term, ignoring case. Encrypted fields are left empty in the database, so
+// encrypted emails and phones only match the whole term, and encrypted names a whole word of the term, by
+// their blind indexes. more is true if there are more results.
+func (r *MongoRepository) Search(ctx context.Context, query *SearchQuery) (results []*SearchResult, more bool, err error) {
+	if err := query.Validate(); err != nil {
+		return nil, false, err
+	}
+
+	// every match up to the end of the page is needed to rank the page
+	window := query.Offset + query.Limit + 1
+	found := map[string]*SearchResult{}
+
+	textFilter := query.filter()
+	textFilter["$text"] = bson.M{"$search": query.Term}
+	textFilter, err = userScope(ctx, textFilter)
+	if err != nil {
+		return nil, false, err
+	}
+	textOpts := options.Find().
+		SetProjection(bson.M{"password": 0, "score": bson.M{"$meta": "textScore"}}).
+		SetSort(bson.M{"score": bson.M{"$meta": "textScore"}}).
+		SetLimit(window)
+	if err := r.searchHelper(ctx, textFilter, textOpts, found); err != nil {
+		return nil, false, err
+	}
+
+	prefix := primitive.Regex{Pattern: "^" + regexp.QuoteMeta(query.Term), Options: "i"}
+	prefixFields := bson.A{}
+	for _, field := range []string{"name", "email"} {
+		if !r.envelope.Encrypts(field) {
+			prefixFields = append(prefixFields, bson.M{field: prefix})
+		}
+	}
+	if len(prefixFields) > 0 {
+		prefixFilter := query.filter()
+		prefixFilter["$or"] = prefixFields
+		prefixFilter, err = userScope(ctx, prefixFilter)
+		if err != nil {
+			return nil, false, err
+		}
+		prefixOpts := options.Find().
+			SetProjection(bson.M{"password": 0}).
+			SetSort(bson.D{{Key: "name", Value: 1}, {Key: "id", Value: 1}}).
+			SetLimit(window)
+		if err := r.searchHelper(ctx, prefixFilter, prefixOpts, found); err != nil {
+			return nil, false, err
+		}
+	}
+
+	// encrypted emails and phones match the term, and encrypted names a word of the term, by their blind index
+	exactFields := bson.A{}
+	for field, index := range map[string]string{"email": "email_index", "phone": "phone_index"} {
+		if r.envelope.Encrypts(field) {
+			exactFields = append(exactFields, bson.M{index: r.envelope.BlindIndex(query.Term)})
+		}
+	}
+	if r.envelope.Encrypts("name") {
+		exactFields = append(exactFields, bson.M{"name_index": bson.M{"$in": r.nameIndexHelper(query.Term)}})
+	}
+	if len(exactFields) > 0 {
+		exactFilter := query.filter()
+		exactFilter["$or"] = exactFields
+		exactFilter, err = userScope(ctx, exactFilter)
+		if err != nil {
+			return nil, false, err
+		}
+		exactOpts := options.Find().
+			SetProjection(bson.M{"password": 0}).
+			SetSort(bson.D{{Key: "name", Value: 1}, {Key: "id", Value: 1}}).
+			SetLimit(window)
+		if err := r.searchHelper(ctx, exactFilter, exactOpts, found); err != nil {
+			return nil, false, err
+		}
+	}
+
+	// rank the matches
+	term := strings.ToLower(query.Term)
+	results = []*SearchResult{}
+	for _, result := range found {
+		if strings.HasPrefix(strings.ToLower(result.Name), term) {
+			result.Score += namePrefixScore
+		}
+		if strings.HasPrefix(strings.ToLower(result.Email), term) {
+			result.Score += emailPrefixScore
+		}
+		if result.Email == query.Term || result.Phone == query.Term {
+			result.Score += exactMatchScore
+		}
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if results[i].Name != results[j].Name {
+			return results[i].Name < results[j].Name
+		}
+		return results[i].ID < results[j].ID
+	})
+
+	if int64(len(results)) <= query.Offset {
+		return []*SearchResult{}, false, nil
+	}
+	results = results[query.Offset:]
+	if int64(len(results)) > query.Limit {
+		return results[:query.Limit], true, nil
+	}
+	return results, false, nil
+}
+
+// searchHelper - adds the users found by filter to found, keyed by id
+func (r *MongoRepository) searchHelper(ctx context.Context, filter bson.M, opts *options.FindOptions, found map[string]*SearchResult) error {
+	cursor, err := r.mongo.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var tempResult SearchResult
+		if err := cursor.Decode(&tempResult); err != nil {
+			return err
+		}
+		if err := r.decryptHelper(ctx, &tempResult.User); err != nil {
+			return err
+		}
+		if _, ok := found[tempResult.ID]; !ok {
+			found[tempResult.ID] = &tempResult
+		}
+	}
+
+	return cursor.Err()
+}
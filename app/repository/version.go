@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ErrVersionConflict - returned by a write, which expects a user to have another version than it has,
+// ie. the user was changed since the writer read it.
+var ErrVersionConflict = errors.New("The user was changed meanwhile, read it again and retry")
+
+// versionFilterHelper - matches users with version. Users created before versions existed have none,
+// and match version 0.
+func versionFilterHelper(version int64) interface{} {
+	if version == 0 {
+		return bson.M{"$in": bson.A{0, nil}}
+	}
+	return version
+}
+
+// expectVersionHelper - restricts filter to the version the user is expected to have, if any, and makes
+// update increment the version of the user.
+func expectVersionHelper(user *User, filter bson.M, update bson.M) {
+	if user.ExpectedVersion != nil {
+		filter["version"] = versionFilterHelper(*user.ExpectedVersion)
+	}
+	inc, ok := update["$inc"].(bson.M)
+	if !ok {
+		inc = bson.M{}
+		update["$inc"] = inc
+	}
+	inc["version"] = 1
+}
+
+// updateHelper - updates the user matching filter and increments the version of the user. If the user is
+// expected to have a version, ErrVersionConflict is returned when the user has another version.
+func (r *MongoRepository) updateHelper(ctx context.Context, user *User, filter bson.M, update bson.M) error {
+	expectVersionHelper(user, filter, update)
+	if err := r.encryptUpdateHelper(ctx, user.ID, update); err != nil {
+		return err
+	}
+
+	result, err := r.mongo.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if user.ExpectedVersion != nil {
+		if result.MatchedCount == 0 {
+			return ErrVersionConflict
+		}
+		user.Version = *user.ExpectedVersion + 1
+	}
+
+	return nil
+}
@@ -3,9 +3,11 @@ package server
 import (
 	"context"
 	"errors"
+	"expvar"
 	"fmt"
 	"math/rand"
 	"net"
+	"net/http"
 	"os"
 	"strings"
 	"sync"
@@ -15,21 +17,33 @@ import (
 	crypto "github.com/softcorp-io/hqs-user-service/crypto"
 	database "github.com/softcorp-io/hqs-user-service/database"
 	handler "github.com/softcorp-io/hqs-user-service/handler"
+	permission "github.com/softcorp-io/hqs-user-service/permission"
+	policy "github.com/softcorp-io/hqs-user-service/policy"
+	privilege "github.com/softcorp-io/hqs-user-service/privilege"
 	repository "github.com/softcorp-io/hqs-user-service/repository"
 	spaces "github.com/softcorp-io/hqs-user-service/spaces"
 	storage "github.com/softcorp-io/hqs-user-service/storage"
+	tenant "github.com/softcorp-io/hqs-user-service/tenant"
 	emailProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_email_service"
 	privilegeProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_privilege_service"
 	userProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
 )
 
 type collectionEnv struct {
-	userCollection  string
-	authCollection  string
-	tokenCollection string
+	userCollection          string
+	authCollection          string
+	tokenCollection         string
+	apiKeyCollection        string
+	personalTokenCollection string
+	organizationCollection  string
+	groupCollection         string
+	auditCollection         string
+	checkpointCollection    string
+	dataKeyCollection       string
 }
 
 // Init - initialize .env variables.
@@ -52,7 +66,35 @@ func loadCollections() (collectionEnv, error) {
 	if !ok {
 		return collectionEnv{}, errors.New("Required MONGO_DB_TOKEN_COLLECTION")
 	}
-	return collectionEnv{userCollection, authCollection, tokenCollection}, nil
+	apiKeyCollection, ok := os.LookupEnv("MONGO_DB_API_KEY_COLLECTION")
+	if !ok {
+		return collectionEnv{}, errors.New("Required MONGO_DB_API_KEY_COLLECTION")
+	}
+	personalTokenCollection, ok := os.LookupEnv("MONGO_DB_PERSONAL_TOKEN_COLLECTION")
+	if !ok {
+		return collectionEnv{}, errors.New("Required MONGO_DB_PERSONAL_TOKEN_COLLECTION")
+	}
+	organizationCollection, ok := os.LookupEnv("MONGO_DB_ORGANIZATION_COLLECTION")
+	if !ok {
+		return collectionEnv{}, errors.New("Required MONGO_DB_ORGANIZATION_COLLECTION")
+	}
+	groupCollection, ok := os.LookupEnv("MONGO_DB_GROUP_COLLECTION")
+	if !ok {
+		return collectionEnv{}, errors.New("Required MONGO_DB_GROUP_COLLECTION")
+	}
+	auditCollection, ok := os.LookupEnv("MONGO_DB_AUDIT_COLLECTION")
+	if !ok {
+		return collectionEnv{}, errors.New("Required MONGO_DB_AUDIT_COLLECTION")
+	}
+	checkpointCollection, ok := os.LookupEnv("MONGO_DB_AUDIT_CHECKPOINT_COLLECTION")
+	if !ok {
+		return collectionEnv{}, errors.New("Required MONGO_DB_AUDIT_CHECKPOINT_COLLECTION")
+	}
+	dataKeyCollection, ok := os.LookupEnv("MONGO_DB_DATA_KEY_COLLECTION")
+	if !ok {
+		return collectionEnv{}, errors.New("Required MONGO_DB_DATA_KEY_COLLECTION")
+	}
+	return collectionEnv{userCollection, authCollection, tokenCollection, apiKeyCollection, personalTokenCollection, organizationCollection, groupCollection, auditCollection, checkpointCollection, dataKeyCollection}, nil
 }
 
 // Run - runs a go microservice. Uses zap for logging and a waitGroup for async testing.
@@ -92,13 +134,30 @@ func Run(zapLog *zap.Logger, wg *sync.WaitGroup) {
 		zapLog.Fatal(fmt.Sprintf("Could not set up storage with err %v", err))
 	}
 
+	// setup the envelope encrypting personal data
+	envelope, err := crypto.NewEnvelope(database.Collection(collections.dataKeyCollection), zapLog)
+	if err != nil {
+		zapLog.Fatal(fmt.Sprintf("Could not setup encryption with err %v", err))
+	}
+
 	// setup repository
-	repo := repository.NewRepository(userCollection)
+	repo := repository.NewRepository(userCollection, envelope)
+	if err := repo.CreateIndexes(context.Background()); err != nil {
+		zapLog.Fatal(fmt.Sprintf("Could not create user indexes with err %v", err))
+	}
+	organizations := repository.NewOrganizationRepository(database.Collection(collections.organizationCollection))
+	groups := repository.NewGroupRepository(database.Collection(collections.groupCollection))
+	audit := repository.NewAuditRepository(database.Collection(collections.auditCollection), database.Collection(collections.checkpointCollection))
+	if err := audit.CreateIndexes(context.Background()); err != nil {
+		zapLog.Fatal(fmt.Sprintf("Could not create audit indexes with err %v", err))
+	}
 
 	// setup tokenservice
 	authCollection := database.Collection(collections.authCollection)
 	tokenCollection := database.Collection(collections.tokenCollection)
-	tokenService, err := crypto.NewTokenService(authCollection, tokenCollection, zapLog)
+	apiKeyCollection := database.Collection(collections.apiKeyCollection)
+	personalTokenCollection := database.Collection(collections.personalTokenCollection)
+	tokenService, err := crypto.NewTokenService(authCollection, tokenCollection, apiKeyCollection, personalTokenCollection, envelope, zapLog)
 	if err != nil {
 		zapLog.Fatal(fmt.Sprintf("Could not start token service with err %v", err))
 	}
@@ -135,19 +194,41 @@ func Run(zapLog *zap.Logger, wg *sync.WaitGroup) {
 	if !ok {
 		zapLog.Fatal("Could not get privilege service port")
 	}
-	privilegeConn, err := grpc.DialContext(context.Background(), privilegeServiceIP+":"+privilegeServicePort, grpc.WithInsecure())
+	privilegeConn, err := grpc.DialContext(context.Background(), privilegeServiceIP+":"+privilegeServicePort, grpc.WithInsecure(), grpc.WithConnectParams(grpc.ConnectParams{
+		Backoff:           backoff.DefaultConfig,
+		MinConnectTimeout: 5 * time.Second,
+	}))
 	if err != nil {
 		zapLog.Fatal(fmt.Sprintf("Could not dial privilege service with err %v", err))
 	}
 	defer privilegeConn.Close()
-	privilegeClient := privilegeProto.NewPrivilegeServiceClient(privilegeConn)
+
+	// calls to the privilege service are cached, retried and circuit broken
+	privilegeConfig, err := privilege.ConfigFromEnv()
+	if err != nil {
+		zapLog.Fatal(fmt.Sprintf("Could not configure privilege client with err %v", err))
+	}
+	privilegeClient := privilege.NewClient(privilegeProto.NewPrivilegeServiceClient(privilegeConn), privilegeConfig, zapLog)
+	expvar.Publish("privilege_client", privilegeClient.Metrics.Map())
 	_, err = privilegeClient.Ping(context.Background(), &privilegeProto.Request{})
 	if err != nil {
 		zapLog.Fatal(fmt.Sprintf("Could not ping email service with err %v", err))
 	}
 
+	// setup permission registry
+	permissions, err := permission.NewRegistry(repository.ProfileFields)
+	if err != nil {
+		zapLog.Fatal(fmt.Sprintf("Could not setup permission registry with err %v", err))
+	}
+
+	// setup policy
+	userPolicy, err := policy.NewPolicy()
+	if err != nil {
+		zapLog.Fatal(fmt.Sprintf("Could not load policy with err %v", err))
+	}
+
 	// use above to create handler
-	handle := handler.NewHandler(repo, stor, tokenService, emailClient, privilegeClient, zapLog)
+	handle := handler.NewHandler(repo, organizations, groups, audit, stor, tokenService, emailClient, privilegeClient, permissions, userPolicy, zapLog)
 
 	// create root
 	if err := createRoot(zapLog, repo, privilegeClient); err != nil {
@@ -155,6 +236,62 @@ func Run(zapLog *zap.Logger, wg *sync.WaitGroup) {
 
 	}
 
+	// serve token introspection over http, if a port is configured
+	if introspectionPort, ok := os.LookupEnv("INTROSPECTION_HTTP_PORT"); ok {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/introspect", handle.IntrospectHTTP)
+		go func() {
+			zapLog.Info(fmt.Sprintf("Introspection running on port: %s", introspectionPort))
+			if err := http.ListenAndServe(fmt.Sprintf(":%s", introspectionPort), mux); err != nil {
+				zapLog.Error(fmt.Sprintf("Introspection endpoint stopped with err %v", err))
+			}
+		}()
+	}
+
+	// serve metrics over http, if a port is configured
+	if metricsPort, ok := os.LookupEnv("METRICS_HTTP_PORT"); ok {
+		mux := http.NewServeMux()
+		mux.Handle("/debug/vars", expvar.Handler())
+		go func() {
+			zapLog.Info(fmt.Sprintf("Metrics running on port: %s", metricsPort))
+			if err := http.ListenAndServe(fmt.Sprintf(":%s", metricsPort), mux); err != nil {
+				zapLog.Error(fmt.Sprintf("Metrics endpoint stopped with err %v", err))
+			}
+		}()
+	}
+
+	// encrypt the fields of users, which were encrypted with a shared key or stored in clear text, with the
+	// keys of the users
+	go migrateEncryption(zapLog, handle)
+
+	// purge the users whose deletion grace period is over
+	purgeInterval := time.Hour
+	if interval, ok := os.LookupEnv("USER_PURGE_INTERVAL"); ok {
+		if purgeInterval, err = time.ParseDuration(interval); err != nil || purgeInterval <= 0 {
+			zapLog.Fatal(fmt.Sprintf("Invalid USER_PURGE_INTERVAL %s", interval))
+		}
+	}
+	go purgeDeletedUsers(zapLog, handle, purgeInterval)
+	go deleteExpiredExports(zapLog, handle, purgeInterval)
+
+	// start and lift time-boxed suspensions on time
+	suspensionInterval := time.Minute
+	if interval, ok := os.LookupEnv("SUSPENSION_SCHEDULER_INTERVAL"); ok {
+		if suspensionInterval, err = time.ParseDuration(interval); err != nil || suspensionInterval <= 0 {
+			zapLog.Fatal(fmt.Sprintf("Invalid SUSPENSION_SCHEDULER_INTERVAL %s", interval))
+		}
+	}
+	go applySuspensions(zapLog, handle, suspensionInterval)
+
+	// sign checkpoints of the audit log, s.t. it cannot be changed unnoticed
+	checkpointInterval := time.Hour
+	if interval, ok := os.LookupEnv("AUDIT_CHECKPOINT_INTERVAL"); ok {
+		if checkpointInterval, err = time.ParseDuration(interval); err != nil || checkpointInterval <= 0 {
+			zapLog.Fatal(fmt.Sprintf("Invalid AUDIT_CHECKPOINT_INTERVAL %s", interval))
+		}
+	}
+	go checkpointAuditLog(zapLog, handle, checkpointInterval)
+
 	// create the service and run the service
 	port, ok := os.LookupEnv("SERVICE_PORT")
 	if !ok {
@@ -174,6 +311,7 @@ func Run(zapLog *zap.Logger, wg *sync.WaitGroup) {
 
 	// register handler
 	userProto.RegisterUserServiceServer(grpcServer, handle)
+	grpcServer.RegisterService(&handler.ExtensionServiceDesc, handle)
 
 	// run the server
 	if err := grpcServer.Serve(lis); err != nil {
@@ -181,8 +319,89 @@ func Run(zapLog *zap.Logger, wg *sync.WaitGroup) {
 	}
 }
 
+// purgeDeletedUsers - purges deleted users every interval, until the service stops
+func purgeDeletedUsers(zapLog *zap.Logger, handle *handler.Handler, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		purged, err := handle.PurgeDeletedUsers(context.Background())
+		if err != nil {
+			zapLog.Error(fmt.Sprintf("Could not purge deleted users with err %v", err))
+			continue
+		}
+		if purged > 0 {
+			zapLog.Info(fmt.Sprintf("Purged %d deleted users", purged))
+		}
+	}
+}
+
+// deleteExpiredExports - deletes the exports, whose url expired, every interval, until the service stops
+func deleteExpiredExports(zapLog *zap.Logger, handle *handler.Handler, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		deleted, err := handle.DeleteExpiredExports(context.Background())
+		if err != nil {
+			zapLog.Error(fmt.Sprintf("Could not delete expired exports with err %v", err))
+			continue
+		}
+		if deleted > 0 {
+			zapLog.Info(fmt.Sprintf("Deleted %d expired exports", deleted))
+		}
+	}
+}
+
+// migrateEncryption - migrates the encryption of the users once, when the service starts
+func migrateEncryption(zapLog *zap.Logger, handle *handler.Handler) {
+	migrated, err := handle.MigrateEncryption(context.Background())
+	if err != nil {
+		zapLog.Error(fmt.Sprintf("Could not migrate the encryption of users with err %v", err))
+		return
+	}
+	if migrated > 0 {
+		zapLog.Info(fmt.Sprintf("Encrypted %d users with their own data keys", migrated))
+	}
+}
+
+// applySuspensions - starts and lifts suspensions every interval, until the service stops
+func applySuspensions(zapLog *zap.Logger, handle *handler.Handler, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		changed, err := handle.ApplySuspensions(context.Background())
+		if err != nil {
+			zapLog.Error(fmt.Sprintf("Could not apply suspensions with err %v", err))
+			continue
+		}
+		if changed > 0 {
+			zapLog.Info(fmt.Sprintf("Started or lifted %d suspensions", changed))
+		}
+	}
+}
+
+// checkpointAuditLog - signs a checkpoint of the audit log every interval, until the service stops
+func checkpointAuditLog(zapLog *zap.Logger, handle *handler.Handler, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		checkpoint, err := handle.CheckpointAuditLog(context.Background())
+		if err != nil {
+			zapLog.Error(fmt.Sprintf("Could not checkpoint the audit log with err %v", err))
+			continue
+		}
+		if checkpoint != nil {
+			zapLog.Info(fmt.Sprintf("Signed checkpoint of the audit log at entry %d", checkpoint.Sequence))
+		}
+	}
+}
+
 func createRoot(zapLog *zap.Logger, repo *repository.MongoRepository, privilegeClient privilegeProto.PrivilegeServiceClient) error {
-	ctx := context.Background()
+	// the root user is in no organization
+	ctx := tenant.WithAllOrganizations(context.Background())
 	if err := repo.GetRoot(ctx); err == nil {
 		zapLog.Info("A root user already exist")
 		return nil
@@ -2,8 +2,8 @@ package storage
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
-	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -18,7 +18,9 @@ import (
 type Storage interface {
 	Upload(data bytes.Buffer, path string, allowedTypes ...string) error
 	Get(path string, duration time.Duration) (string, error)
+	Download(path string) (bytes.Buffer, error)
 	Delete(path string) error
+	List(prefix string) (map[string]time.Time, error)
 }
 
 // SpaceStorage - the reference we need to act on.
@@ -31,20 +33,26 @@ func NewSpaceStorage(spc *s3.S3) *SpaceStorage {
 	return &SpaceStorage{spc}
 }
 
-// Upload - uploads a file to storage.
-func (s *SpaceStorage) Upload(data bytes.Buffer, filePath string, allowedTypes ...string) error {
-	contentType := http.DetectContentType(data.Bytes())
-	fmt.Println("recieved content type!", contentType)
+// contentTypeHelper - returns the allowed type of data, or an empty type if data has none of them. json is
+// detected as text, so it is allowed as application/json when it parses.
+func contentTypeHelper(data []byte, allowedTypes []string) string {
+	detected := http.DetectContentType(data)
 
-	isAllowed := false
 	for _, allowedType := range allowedTypes {
-		if strings.ToLower(allowedType) == strings.ToLower(contentType) {
-			isAllowed = true
-			break
+		if strings.ToLower(allowedType) == strings.ToLower(detected) {
+			return allowedType
+		}
+		if strings.ToLower(allowedType) == "application/json" && strings.HasPrefix(detected, "text/plain") && json.Valid(data) {
+			return allowedType
 		}
 	}
+	return ""
+}
 
-	if !isAllowed {
+// Upload - uploads a file to storage with the allowed type it has.
+func (s *SpaceStorage) Upload(data bytes.Buffer, filePath string, allowedTypes ...string) error {
+	contentType := contentTypeHelper(data.Bytes(), allowedTypes)
+	if contentType == "" {
 		return errors.New("illegal file type")
 	}
 
@@ -72,10 +80,11 @@ func (s *SpaceStorage) Upload(data bytes.Buffer, filePath string, allowedTypes .
 	defer uploadFile.Close()
 
 	object := s3.PutObjectInput{
-		Bucket: aws.String("hqs-spaces"),
-		Key:    aws.String(filePath),
-		Body:   uploadFile,
-		ACL:    aws.String("private"),
+		Bucket:      aws.String("hqs-spaces"),
+		Key:         aws.String(filePath),
+		Body:        uploadFile,
+		ACL:         aws.String("private"),
+		ContentType: aws.String(contentType),
 	}
 
 	_, err = s.spc.PutObject(&object)
@@ -99,6 +108,24 @@ func (s *SpaceStorage) Get(filePath string, time time.Duration) (string, error)
 	return uploadURL, nil
 }
 
+// Download - reads the content of a file.
+func (s *SpaceStorage) Download(filePath string) (bytes.Buffer, error) {
+	data := bytes.Buffer{}
+	object, err := s.spc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String("hqs-spaces"),
+		Key:    aws.String(filePath),
+	})
+	if err != nil {
+		return data, err
+	}
+	defer object.Body.Close()
+
+	if _, err := data.ReadFrom(object.Body); err != nil {
+		return data, err
+	}
+	return data, nil
+}
+
 // Delete - deletes upload by path.
 func (s *SpaceStorage) Delete(path string) error {
 	input := &s3.DeleteObjectInput{
@@ -111,3 +138,22 @@ func (s *SpaceStorage) Delete(path string) error {
 	}
 	return nil
 }
+
+// List - returns the files whose path starts with prefix, and when each was last modified.
+func (s *SpaceStorage) List(prefix string) (map[string]time.Time, error) {
+	files := map[string]time.Time{}
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String("hqs-spaces"),
+		Prefix: aws.String(prefix),
+	}
+	err := s.spc.ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			files[aws.StringValue(object.Key)] = aws.TimeValue(object.LastModified)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
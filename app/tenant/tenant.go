@@ -0,0 +1,43 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+)
+
+// contextKey - the type of the keys this package stores in a context
+type contextKey int
+
+const (
+	organizationKey contextKey = iota
+	allOrganizationsKey
+)
+
+// ErrMissing - returned when a context carries no organization, and is not allowed to see every organization.
+var ErrMissing = errors.New("No organization in context")
+
+// WithOrganization - returns a context, which only lets the repository see users of the organization.
+// An empty organization is the organization of users, which were created before organizations existed.
+func WithOrganization(ctx context.Context, organizationID string) context.Context {
+	ctx = context.WithValue(ctx, allOrganizationsKey, false)
+	return context.WithValue(ctx, organizationKey, organizationID)
+}
+
+// WithAllOrganizations - returns a context, which lets the repository see users of every organization.
+// Only used for the root user, and for lookups done before the caller is known, eg. when logging in.
+func WithAllOrganizations(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allOrganizationsKey, true)
+}
+
+// Organization - returns the organization of the context, or ErrMissing if the context has none.
+// all is true when the context may see every organization.
+func Organization(ctx context.Context) (organizationID string, all bool, err error) {
+	if all, ok := ctx.Value(allOrganizationsKey).(bool); ok && all {
+		return "", true, nil
+	}
+	organizationID, ok := ctx.Value(organizationKey).(string)
+	if !ok {
+		return "", false, ErrMissing
+	}
+	return organizationID, false, nil
+}
@@ -0,0 +1,326 @@
+package testing
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"log"
+	"net"
+	"os"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	handler "github.com/softcorp-io/hqs-user-service/handler"
+	mock "github.com/softcorp-io/hqs-user-service/testdev/mock"
+	proto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+	"github.com/stretchr/testify/assert"
+)
+
+var myHandler *handler.Handler
+
+func TestMain(m *testing.M) {
+	handler, err := mock.NewHandler()
+	if err != nil {
+		mock.TearDownMongoDocker()
+		log.Fatalf("Could not setup handler: %v", err)
+	}
+
+	myHandler = handler
+
+	code := m.Run()
+
+	mock.TearDownMongoDocker()
+	os.Exit(code)
+}
+
+func authContext(t *testing.T, email string, password string) context.Context {
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    email,
+		Password: password,
+	})
+	assert.Equal(t, nil, err)
+	assert.NotEmpty(t, tokenResponse)
+
+	md := metadata.New(map[string]string{"token": tokenResponse.Token})
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+func TestGetAuditLog(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	adminID := mock.Seed("Admin User", "admin@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	userID := mock.Seed("Blocked User", "blocked@softcorp.io", seedPhone, seedPassword, true, false, false, false, false, false, false, false)
+	auditorID := mock.Seed("Auditor", "auditor@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	mock.AssignPrivilege(auditorID, "auditor")
+
+	// the request id is taken from the metadata of the request
+	adminCtx := authContext(t, "admin@softcorp.io", seedPassword)
+	md, _ := metadata.FromIncomingContext(adminCtx)
+	adminCtx = metadata.NewIncomingContext(adminCtx, metadata.Join(md, metadata.Pairs("x-request-id", "request-1")))
+	_, err := myHandler.UpdateBlockUser(adminCtx, &proto.User{Id: userID, Blocked: true})
+	assert.NoError(t, err)
+
+	// act
+	res, err := myHandler.GetAuditLog(authContext(t, "auditor@softcorp.io", seedPassword), &handler.AuditLogRequest{TargetId: userID})
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), res.Total)
+	assert.Len(t, res.Entries, 1)
+	entry := res.Entries[0]
+	assert.Equal(t, "UpdateBlockUser", entry.Action)
+	assert.Equal(t, adminID, entry.ActorId)
+	assert.Equal(t, userID, entry.TargetId)
+	assert.Equal(t, "request-1", entry.RequestId)
+	assert.Contains(t, entry.Before, `"blocked":false`)
+	assert.Contains(t, entry.After, `"blocked":true`)
+	assert.Contains(t, entry.After, `"status":"deactivated"`)
+	assert.NotContains(t, entry.After, "password")
+	assert.NotNil(t, entry.CreatedAt)
+
+	// the filters narrow the log down
+	res, err = myHandler.GetAuditLog(authContext(t, "auditor@softcorp.io", seedPassword), &handler.AuditLogRequest{ActorId: userID})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), res.Total)
+}
+
+func TestGetAuditLogDenied(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	mock.Seed("Admin User", "admin@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+
+	// act
+	_, err := myHandler.GetAuditLog(authContext(t, "admin@softcorp.io", seedPassword), &handler.AuditLogRequest{})
+
+	// assert
+	assert.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestAuditCreateUser(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	mock.Seed("Admin User", "admin@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	auditorID := mock.Seed("Auditor", "auditor@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	mock.AssignPrivilege(auditorID, "auditor")
+
+	// act
+	createResponse, err := myHandler.Create(authContext(t, "admin@softcorp.io", seedPassword), &proto.User{
+		Name:        "Created User",
+		Email:       "created@softcorp.io",
+		Phone:       "+45 12 34 56 78",
+		Password:    seedPassword,
+		PrivilegeID: "someID",
+	})
+	assert.NoError(t, err)
+
+	// assert
+	// the entry names the personal fields of the user, but holds no personal data
+	res, err := myHandler.GetAuditLog(authContext(t, "auditor@softcorp.io", seedPassword), &handler.AuditLogRequest{TargetId: createResponse.User.Id, Action: "Create"})
+	assert.NoError(t, err)
+	if assert.Len(t, res.Entries, 1) {
+		after := res.Entries[0].After
+		assert.Contains(t, after, createResponse.User.Id)
+		assert.Contains(t, after, `"privilege_id":"someID"`)
+		assert.Contains(t, after, `"name":"[redacted]"`)
+		assert.Contains(t, after, `"email":"[redacted]"`)
+		assert.NotContains(t, after, "Created User")
+		assert.NotContains(t, after, "created@softcorp.io")
+		assert.NotContains(t, after, "+45 12 34 56 78")
+	}
+}
+
+func TestAuditTokenActions(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	userID := mock.Seed("Seed User", "seeduser@softcorp.io", seedPhone, seedPassword, true, false, false, false, false, false, false, false)
+	auditorID := mock.Seed("Auditor", "auditor@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	mock.AssignPrivilege(auditorID, "auditor")
+
+	userCtx := authContext(t, "seeduser@softcorp.io", seedPassword)
+	md, _ := metadata.FromIncomingContext(userCtx)
+
+	// act
+	_, err := myHandler.CreateScopedToken(userCtx, &handler.ScopedTokenRequest{Scopes: []string{"view_all_users"}})
+	assert.NoError(t, err)
+	// the reset and user keys are the same in the tests, so a login token works as reset token
+	_, err = myHandler.ResetPassword(context.Background(), &proto.ResetPasswordRequest{Token: md["token"][0], NewPassword: "NewPassword1234"})
+	assert.NoError(t, err)
+
+	// assert - the new password is stored hashed, so the user can login with it
+	authContext(t, "seeduser@softcorp.io", "NewPassword1234")
+
+	auditorCtx := authContext(t, "auditor@softcorp.io", seedPassword)
+	for _, action := range []string{"CreateScopedToken", "ResetPassword"} {
+		res, err := myHandler.GetAuditLog(auditorCtx, &handler.AuditLogRequest{TargetId: userID, Action: action})
+		assert.NoError(t, err)
+		assert.Len(t, res.Entries, 1)
+		assert.Equal(t, userID, res.Entries[0].ActorId)
+		assert.NotContains(t, res.Entries[0].After, "NewPassword1234")
+	}
+}
+
+func TestAuditForwardedIP(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	userID := mock.Seed("Seed User", "seeduser@softcorp.io", seedPhone, seedPassword, true, false, false, false, false, false, false, false)
+	auditorID := mock.Seed("Auditor", "auditor@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	mock.AssignPrivilege(auditorID, "auditor")
+
+	md, _ := metadata.FromIncomingContext(authContext(t, "seeduser@softcorp.io", seedPassword))
+	md = metadata.Join(md, metadata.New(map[string]string{"x-forwarded-for": "198.51.100.1, 198.51.100.2"}))
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 4321}})
+
+	// act
+	_, err := myHandler.CreateScopedToken(ctx, &handler.ScopedTokenRequest{Scopes: []string{"view_all_users"}})
+	assert.NoError(t, err)
+
+	previous := os.Getenv("AUDIT_TRUSTED_PROXIES")
+	os.Setenv("AUDIT_TRUSTED_PROXIES", "203.0.113.0/24,198.51.100.2")
+	defer os.Setenv("AUDIT_TRUSTED_PROXIES", previous)
+	_, err = myHandler.CreateScopedToken(ctx, &handler.ScopedTokenRequest{Scopes: []string{"view_all_users"}})
+	assert.NoError(t, err)
+
+	// assert - the header is only trusted from the proxies, and the proxies are skipped
+	res, err := myHandler.GetAuditLog(authContext(t, "auditor@softcorp.io", seedPassword), &handler.AuditLogRequest{TargetId: userID, Action: "CreateScopedToken"})
+	assert.NoError(t, err)
+	assert.Len(t, res.Entries, 2)
+	assert.Equal(t, "198.51.100.1", res.Entries[0].Ip)
+	assert.Equal(t, "203.0.113.7:4321", res.Entries[1].Ip)
+}
+
+func TestVerifyAuditLog(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	rootID := mock.Seed("Root User", "root@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	mock.MakeRoot(rootID)
+	userID := mock.Seed("Blocked User", "blocked@softcorp.io", seedPhone, seedPassword, true, false, false, false, false, false, false, false)
+
+	rootCtx := authContext(t, "root@softcorp.io", seedPassword)
+	_, err := myHandler.UpdateBlockUser(rootCtx, &proto.User{Id: userID, Blocked: true})
+	assert.NoError(t, err)
+	_, err = myHandler.UpdateBlockUser(rootCtx, &proto.User{Id: userID, Blocked: false})
+	assert.NoError(t, err)
+
+	// act
+	res, err := myHandler.VerifyAuditLog(rootCtx, &proto.Request{})
+
+	// assert
+	assert.NoError(t, err)
+	assert.True(t, res.Valid)
+	assert.Equal(t, int64(2), res.Entries)
+
+	// a checkpoint is signed at the last entry, and only once
+	checkpoint, err := myHandler.CheckpointAuditLog(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), checkpoint.Sequence)
+	checkpoint, err = myHandler.CheckpointAuditLog(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, checkpoint)
+
+	res, err = myHandler.VerifyAuditLog(rootCtx, &proto.Request{})
+	assert.NoError(t, err)
+	assert.True(t, res.Valid)
+	assert.Equal(t, int64(1), res.Checkpoints)
+
+	// a changed entry breaks the chain, which is then not checkpointed
+	_, err = myHandler.UpdateBlockUser(rootCtx, &proto.User{Id: userID, Blocked: true})
+	assert.NoError(t, err)
+	mock.TamperAuditEntry(3, "actor_id", userID)
+	res, err = myHandler.VerifyAuditLog(rootCtx, &proto.Request{})
+	assert.NoError(t, err)
+	assert.False(t, res.Valid)
+	assert.Equal(t, int64(3), res.BrokenSequence)
+	_, err = myHandler.CheckpointAuditLog(context.Background())
+	assert.Error(t, err)
+
+	// only root can verify the audit log
+	_, err = myHandler.VerifyAuditLog(authContext(t, "blocked@softcorp.io", seedPassword), &proto.Request{})
+	assert.Error(t, err)
+}
+
+func TestVerifyAuditLogRemoved(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	rootID := mock.Seed("Root User", "root@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	mock.MakeRoot(rootID)
+	userID := mock.Seed("Blocked User", "blocked@softcorp.io", seedPhone, seedPassword, true, false, false, false, false, false, false, false)
+
+	rootCtx := authContext(t, "root@softcorp.io", seedPassword)
+	_, err := myHandler.UpdateBlockUser(rootCtx, &proto.User{Id: userID, Blocked: true})
+	assert.NoError(t, err)
+	_, err = myHandler.UpdateBlockUser(rootCtx, &proto.User{Id: userID, Blocked: false})
+	assert.NoError(t, err)
+	_, err = myHandler.CheckpointAuditLog(context.Background())
+	assert.NoError(t, err)
+
+	// act
+	mock.RemoveAuditEntry(2)
+	res, err := myHandler.VerifyAuditLog(rootCtx, &proto.Request{})
+
+	// assert
+	assert.NoError(t, err)
+	assert.False(t, res.Valid)
+	assert.Equal(t, int64(2), res.BrokenSequence)
+}
+
+func TestVerifyAuditLogOtherPublicKey(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	rootID := mock.Seed("Root User", "root@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	mock.MakeRoot(rootID)
+	userID := mock.Seed("Blocked User", "blocked@softcorp.io", seedPhone, seedPassword, true, false, false, false, false, false, false, false)
+
+	rootCtx := authContext(t, "root@softcorp.io", seedPassword)
+	_, err := myHandler.UpdateBlockUser(rootCtx, &proto.User{Id: userID, Blocked: true})
+	assert.NoError(t, err)
+	_, err = myHandler.CheckpointAuditLog(context.Background())
+	assert.NoError(t, err)
+
+	// the checkpoint verifies with the public key of the signing key
+	res, err := myHandler.VerifyAuditLog(rootCtx, &proto.Request{})
+	assert.NoError(t, err)
+	assert.True(t, res.Valid)
+
+	otherKey, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	os.Setenv("AUDIT_CHECKPOINT_PUBLIC_KEY", base64.StdEncoding.EncodeToString(otherKey))
+	defer os.Unsetenv("AUDIT_CHECKPOINT_PUBLIC_KEY")
+
+	// act
+	res, err = myHandler.VerifyAuditLog(rootCtx, &proto.Request{})
+
+	// assert
+	assert.NoError(t, err)
+	assert.False(t, res.Valid)
+}
@@ -235,3 +235,84 @@ func TestDeleteIllegalToken(t *testing.T) {
 	assert.Equal(t, nil, err)
 	assert.NotEmpty(t, userResponse)
 }
+
+func authContext(t *testing.T, email string, password string) context.Context {
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    email,
+		Password: password,
+	})
+	assert.Equal(t, nil, err)
+	assert.NotEmpty(t, tokenResponse)
+
+	md := metadata.New(map[string]string{"token": tokenResponse.Token})
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+func TestRestoreUser(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	mock.Seed("Admin User", "admin@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	deletedID := mock.Seed("Deleted User", "deleted@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+
+	ctx := authContext(t, "admin@softcorp.io", seedPassword)
+
+	_, err := myHandler.Delete(ctx, &proto.User{Id: deletedID})
+	assert.Nil(t, err)
+
+	// the deleted user cannot log in, and the email is not free
+	_, err = myHandler.Auth(context.Background(), &proto.User{Email: "deleted@softcorp.io", Password: seedPassword})
+	assert.Error(t, err)
+	_, err = myHandler.Create(ctx, &proto.User{Name: "New User", Email: "deleted@softcorp.io", Phone: seedPhone, Password: seedPassword, PrivilegeID: "someID"})
+	assert.Error(t, err)
+
+	// act
+	_, err = myHandler.RestoreUser(ctx, &proto.User{Id: deletedID})
+
+	// assert
+	assert.Nil(t, err)
+	userResponse, err := myHandler.Get(ctx, &proto.User{Id: deletedID})
+	assert.Nil(t, err)
+	assert.Equal(t, deletedID, userResponse.User.Id)
+
+	// only deleted users can be restored
+	_, err = myHandler.RestoreUser(ctx, &proto.User{Id: deletedID})
+	assert.Error(t, err)
+}
+
+func TestPurgeDeletedUsers(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	mock.Seed("Admin User", "admin@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	deletedID := mock.Seed("Deleted User", "deleted@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+
+	ctx := authContext(t, "admin@softcorp.io", seedPassword)
+
+	_, err := myHandler.Delete(ctx, &proto.User{Id: deletedID})
+	assert.Nil(t, err)
+
+	// nothing is purged within the grace period
+	purged, err := myHandler.PurgeDeletedUsers(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, purged)
+
+	// act
+	os.Setenv("USER_DELETION_GRACE_PERIOD", "0s")
+	defer os.Setenv("USER_DELETION_GRACE_PERIOD", "1h")
+	purged, err = myHandler.PurgeDeletedUsers(context.Background())
+
+	// assert
+	assert.Nil(t, err)
+	assert.Equal(t, 1, purged)
+
+	// a purged user cannot be restored, and the email is free again
+	_, err = myHandler.RestoreUser(ctx, &proto.User{Id: deletedID})
+	assert.Error(t, err)
+	_, err = myHandler.Create(ctx, &proto.User{Name: "New User", Email: "deleted@softcorp.io", Phone: seedPhone, Password: seedPassword, PrivilegeID: "someID"})
+	assert.Nil(t, err)
+}
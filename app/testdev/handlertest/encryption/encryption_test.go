@@ -0,0 +1,217 @@
+package testing
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"google.golang.org/grpc/metadata"
+
+	handler "github.com/softcorp-io/hqs-user-service/handler"
+	mock "github.com/softcorp-io/hqs-user-service/testdev/mock"
+	proto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+	"github.com/stretchr/testify/assert"
+)
+
+var myHandler *handler.Handler
+
+func TestMain(m *testing.M) {
+	// the fields encrypted by default
+	os.Setenv("ENCRYPTED_FIELDS", "name,email,phone,birthday,description,geo")
+	handler, err := mock.NewHandler()
+	if err != nil {
+		mock.TearDownMongoDocker()
+		log.Fatalf("Could not setup handler: %v", err)
+	}
+
+	myHandler = handler
+
+	code := m.Run()
+
+	mock.TearDownMongoDocker()
+	os.Exit(code)
+}
+
+func authContext(t *testing.T, email string, password string, md metadata.MD) context.Context {
+	tokenResponse, err := myHandler.Auth(metadata.NewIncomingContext(context.Background(), md), &proto.User{
+		Email:    email,
+		Password: password,
+	})
+	assert.Equal(t, nil, err)
+	assert.NotEmpty(t, tokenResponse)
+
+	return metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"token": tokenResponse.Token}))
+}
+
+func TestEncryptedUserFields(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	mock.Seed("Admin User", "admin@softcorp.io", "+45 88 88 88 88", seedPassword, true, true, true, true, true, true, false, false)
+	auditorID := mock.Seed("Auditor", "auditor@softcorp.io", "+45 88 88 88 88", seedPassword, false, false, false, false, false, false, false, false)
+	mock.AssignPrivilege(auditorID, "auditor")
+	ctx := authContext(t, "admin@softcorp.io", seedPassword, metadata.MD{})
+
+	// act
+	createResponse, err := myHandler.Create(ctx, &proto.User{
+		Name:        "Test User",
+		Email:       "testuser@softcorp.io",
+		Phone:       "+45 12 34 56 78",
+		Description: "Likes long walks",
+		Password:    "TestPassword1234asda",
+		PrivilegeID: "someID",
+	})
+	assert.Nil(t, err)
+
+	// assert - the personal data is only stored encrypted
+	stored := mock.GetStoredUser(createResponse.User.Id)
+	assert.Equal(t, "", stored["name"])
+	assert.Equal(t, "", stored["email"])
+	assert.Equal(t, "", stored["phone"])
+	assert.Equal(t, "", stored["description"])
+	assert.NotEmpty(t, stored["email_index"])
+	assert.NotEmpty(t, stored["name_index"])
+	encrypted, ok := stored["encrypted"].(bson.M)
+	assert.True(t, ok)
+	assert.NotEmpty(t, encrypted["name"])
+	assert.NotEmpty(t, encrypted["email"])
+	assert.NotEmpty(t, encrypted["phone"])
+	assert.NotEmpty(t, encrypted["description"])
+	assert.NotEmpty(t, encrypted["birthday"])
+	assert.NotContains(t, encrypted["phone"], "+45 12 34 56 78")
+
+	// assert - users are returned decrypted and found by email
+	getResponse, err := myHandler.GetByEmail(ctx, &proto.User{Email: "testuser@softcorp.io"})
+	assert.Nil(t, err)
+	assert.Equal(t, createResponse.User.Id, getResponse.User.Id)
+	assert.Equal(t, "Test User", getResponse.User.Name)
+	assert.Equal(t, "testuser@softcorp.io", getResponse.User.Email)
+	assert.Equal(t, "+45 12 34 56 78", getResponse.User.Phone)
+	assert.Equal(t, "Likes long walks", getResponse.User.Description)
+
+	// act - the user logs in by email, and updates the phone
+	userCtx := authContext(t, "testuser@softcorp.io", "TestPassword1234asda", metadata.MD{})
+	getResponse.User.Phone = "+45 87 65 43 21"
+	_, err = myHandler.UpdateProfile(userCtx, getResponse.User)
+	assert.Nil(t, err)
+
+	// assert
+	getResponse, err = myHandler.Get(ctx, &proto.User{Id: createResponse.User.Id})
+	assert.Nil(t, err)
+	assert.Equal(t, "+45 87 65 43 21", getResponse.User.Phone)
+	assert.Equal(t, "", mock.GetStoredUser(createResponse.User.Id)["phone"])
+
+	// the audit log tells that the phone changed, but not to what
+	auditResponse, err := myHandler.GetAuditLog(authContext(t, "auditor@softcorp.io", seedPassword, metadata.MD{}), &handler.AuditLogRequest{TargetId: createResponse.User.Id, Action: "UpdateProfile"})
+	assert.Nil(t, err)
+	assert.Len(t, auditResponse.Entries, 1)
+	assert.Contains(t, auditResponse.Entries[0].After, `"phone":"[redacted]"`)
+	assert.NotContains(t, auditResponse.Entries[0].After, "+45 87 65 43 21")
+}
+
+func TestEncryptedNameSearchAndList(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	mock.Seed("Admin User", "admin@softcorp.io", "+45 88 88 88 88", seedPassword, true, true, true, true, true, true, false, false)
+	ctx := authContext(t, "admin@softcorp.io", seedPassword, metadata.MD{})
+
+	createResponse, err := myHandler.Create(ctx, &proto.User{
+		Name:        "Anna Jensen",
+		Email:       "anna@softcorp.io",
+		Phone:       "+45 12 34 56 78",
+		Password:    "TestPassword1234asda",
+		PrivilegeID: "someID",
+	})
+	assert.Nil(t, err)
+
+	// act
+	word, errWord := myHandler.SearchUsers(ctx, &handler.SearchUsersRequest{Term: "jensen"})
+	email, errEmail := myHandler.SearchUsers(ctx, &handler.SearchUsersRequest{Term: "anna@softcorp.io"})
+	partial, errPartial := myHandler.SearchUsers(ctx, &handler.SearchUsersRequest{Term: "jen"})
+	list, errList := myHandler.ListUsers(ctx, &handler.ListUsersRequest{})
+	_, errSort := myHandler.ListUsers(ctx, &handler.ListUsersRequest{SortBy: "name"})
+
+	// assert - encrypted names are found by a whole word, and emails as a whole
+	assert.Nil(t, errWord)
+	if assert.Len(t, word.Users, 1) {
+		assert.Equal(t, createResponse.User.Id, word.Users[0].Id)
+		assert.Equal(t, "Anna Jensen", word.Users[0].Name)
+	}
+	assert.Nil(t, errEmail)
+	if assert.Len(t, email.Users, 1) {
+		assert.Equal(t, createResponse.User.Id, email.Users[0].Id)
+	}
+	assert.Nil(t, errPartial)
+	assert.Empty(t, partial.Users)
+
+	// assert - users are listed by when they were created, and cannot be sorted by an encrypted name
+	assert.Nil(t, errList)
+	assert.Equal(t, int64(2), list.Total)
+	assert.Error(t, errSort)
+}
+
+func TestEncryptedFieldBoundToUser(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	mock.Seed("Admin User", "admin@softcorp.io", "+45 88 88 88 88", seedPassword, true, true, true, true, true, true, false, false)
+	ctx := authContext(t, "admin@softcorp.io", seedPassword, metadata.MD{})
+
+	firstResponse, err := myHandler.Create(ctx, &proto.User{
+		Name:        "First User",
+		Email:       "first@softcorp.io",
+		Phone:       "+45 12 34 56 78",
+		Password:    "TestPassword1234asda",
+		PrivilegeID: "someID",
+	})
+	assert.Nil(t, err)
+	secondResponse, err := myHandler.Create(ctx, &proto.User{
+		Name:        "Second User",
+		Email:       "second@softcorp.io",
+		Phone:       "+45 87 65 43 21",
+		Password:    "TestPassword1234asda",
+		PrivilegeID: "someID",
+	})
+	assert.Nil(t, err)
+
+	// act - the encrypted phone of the first user is copied to the second user
+	encrypted := mock.GetStoredUser(firstResponse.User.Id)["encrypted"].(bson.M)
+	mock.TamperStoredUser(secondResponse.User.Id, "encrypted.phone", encrypted["phone"])
+	getResponse, err := myHandler.Get(ctx, &proto.User{Id: secondResponse.User.Id})
+
+	// assert - the phone cannot be read as the phone of the second user
+	assert.Error(t, err)
+	assert.Empty(t, getResponse)
+}
+
+func TestEncryptedAuthLocation(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	id := mock.Seed("Seed User", "seeduser@softcorp.io", "+45 88 88 88 88", seedPassword, true, false, false, false, false, false, false, false)
+
+	// act
+	ctx := authContext(t, "seeduser@softcorp.io", seedPassword, metadata.New(map[string]string{"latitude": "55.6761", "longitude": "12.5683"}))
+
+	// assert - the location is only stored encrypted
+	stored := mock.GetStoredAuthHistory(id)
+	assert.Equal(t, 1, len(stored))
+	assert.Equal(t, 0.0, stored[0]["latitude"])
+	assert.Equal(t, 0.0, stored[0]["longitude"])
+	encrypted, ok := stored[0]["encrypted"].(bson.M)
+	assert.True(t, ok)
+	assert.NotEmpty(t, encrypted["geo"])
+
+	history, err := myHandler.GetAuthHistory(ctx, &proto.Request{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(history.AuthHistory))
+	assert.Equal(t, 55.6761, history.AuthHistory[0].Latitude)
+	assert.Equal(t, 12.5683, history.AuthHistory[0].Longitude)
+}
@@ -0,0 +1,197 @@
+package testing
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	handler "github.com/softcorp-io/hqs-user-service/handler"
+	mock "github.com/softcorp-io/hqs-user-service/testdev/mock"
+	proto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+	"github.com/stretchr/testify/assert"
+)
+
+var myHandler *handler.Handler
+
+func TestMain(m *testing.M) {
+	handler, err := mock.NewHandler()
+	if err != nil {
+		mock.TearDownMongoDocker()
+		log.Fatalf("Could not setup handler: %v", err)
+	}
+
+	myHandler = handler
+
+	code := m.Run()
+
+	mock.TearDownMongoDocker()
+	os.Exit(code)
+}
+
+func authContext(t *testing.T, email string, password string) context.Context {
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    email,
+		Password: password,
+	})
+	assert.Equal(t, nil, err)
+	assert.NotEmpty(t, tokenResponse)
+
+	return metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"token": tokenResponse.Token}))
+}
+
+func TestEraseUser(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	mock.Seed("Admin User", "admin@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	dpoID := mock.Seed("Data Protection Officer", "dpo@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	mock.AssignPrivilege(dpoID, "dpo")
+	auditorID := mock.Seed("Auditor", "auditor@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	mock.AssignPrivilege(auditorID, "auditor")
+	ctx := authContext(t, "admin@softcorp.io", seedPassword)
+
+	createResponse, err := myHandler.Create(ctx, &proto.User{
+		Name:        "Test User",
+		Email:       "testuser@softcorp.io",
+		Phone:       "+45 12 34 56 78",
+		Password:    "TestPassword1234asda",
+		PrivilegeID: "someID",
+	})
+	assert.Nil(t, err)
+	userID := createResponse.User.Id
+	assert.Equal(t, int64(1), mock.CountDataKeys(userID))
+	authContext(t, "testuser@softcorp.io", "TestPassword1234asda")
+
+	// act
+	res, err := myHandler.EraseUser(authContext(t, "dpo@softcorp.io", seedPassword), &handler.EraseUserRequest{Id: userID, Reason: "Right to erasure"})
+
+	// assert - the data key and the user are gone
+	assert.Nil(t, err)
+	assert.Equal(t, userID, res.UserId)
+	assert.NotEmpty(t, res.KeyId)
+	assert.Contains(t, res.Fields, "phone")
+	assert.Equal(t, int64(0), mock.CountDataKeys(userID))
+	assert.Equal(t, 0, len(mock.GetStoredAuthHistory(userID)))
+
+	_, err = myHandler.Get(ctx, &proto.User{Id: userID})
+	assert.Error(t, err)
+
+	// assert - the erasure certificate is in the audit log
+	auditResponse, err := myHandler.GetAuditLog(authContext(t, "auditor@softcorp.io", seedPassword), &handler.AuditLogRequest{TargetId: userID, Action: "EraseUser"})
+	assert.Nil(t, err)
+	assert.Len(t, auditResponse.Entries, 1)
+	assert.Equal(t, dpoID, auditResponse.Entries[0].ActorId)
+	assert.Contains(t, auditResponse.Entries[0].After, res.KeyId)
+	assert.Contains(t, auditResponse.Entries[0].After, "Right to erasure")
+	assert.NotContains(t, auditResponse.Entries[0].After, "+45 12 34 56 78")
+}
+
+func TestEraseUserFailingStorage(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	mock.Seed("Admin User", "admin@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	dpoID := mock.Seed("Data Protection Officer", "dpo@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	mock.AssignPrivilege(dpoID, "dpo")
+	userID := mock.Seed("Seed User", "seeduser@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+
+	mock.FailStorageDeletes(true)
+	defer mock.FailStorageDeletes(false)
+
+	// act
+	_, err := myHandler.EraseUser(authContext(t, "dpo@softcorp.io", seedPassword), &handler.EraseUserRequest{Id: userID})
+
+	// assert - the user is deleted although its image could not be
+	assert.Nil(t, err)
+	_, err = myHandler.Get(authContext(t, "admin@softcorp.io", seedPassword), &proto.User{Id: userID})
+	assert.Error(t, err)
+}
+
+func TestEraseUserFailingAudit(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	mock.Seed("Admin User", "admin@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	dpoID := mock.Seed("Data Protection Officer", "dpo@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	mock.AssignPrivilege(dpoID, "dpo")
+	userID := mock.Seed("Seed User", "seeduser@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	dpoCtx := authContext(t, "dpo@softcorp.io", seedPassword)
+
+	mock.FailAuditAppends(true)
+	defer mock.FailAuditAppends(false)
+
+	// act
+	res, err := myHandler.EraseUser(dpoCtx, &handler.EraseUserRequest{Id: userID})
+
+	// assert - the user is erased, but the missing certificate is reported
+	assert.Error(t, err)
+	assert.Empty(t, res.UserId)
+	assert.Equal(t, int64(0), mock.CountDataKeys(userID))
+}
+
+func TestEraseUserDenied(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	mock.Seed("Admin User", "admin@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	userID := mock.Seed("Seed User", "seeduser@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+
+	// act
+	_, err := myHandler.EraseUser(authContext(t, "admin@softcorp.io", seedPassword), &handler.EraseUserRequest{Id: userID})
+
+	// assert
+	assert.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestMigrateEncryption(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	mock.Seed("Admin User", "admin@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	userID := mock.Seed("Legacy User", "legacy@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	// the phone was encrypted with a shared key, and the description is stored in clear text
+	sharedKeyID := mock.SeedSharedKeyValue(userID, "phone", "+45 12 34 56 78")
+
+	// act
+	migrated, err := myHandler.MigrateEncryption(context.Background())
+	again, errAgain := myHandler.MigrateEncryption(context.Background())
+
+	// assert - every field is encrypted with the key of the user
+	assert.Nil(t, err)
+	assert.Equal(t, 2, migrated)
+	assert.Nil(t, errAgain)
+	assert.Equal(t, 0, again)
+
+	stored := mock.GetStoredUser(userID)
+	assert.Equal(t, "", stored["phone"])
+	assert.Equal(t, "", stored["description"])
+	encrypted, ok := stored["encrypted"].(bson.M)
+	if assert.True(t, ok) {
+		assert.NotContains(t, encrypted["phone"], sharedKeyID)
+		assert.NotEmpty(t, encrypted["description"])
+	}
+	assert.Equal(t, int64(1), mock.CountDataKeys(userID))
+
+	// assert - the user reads the same
+	getResponse, err := myHandler.Get(authContext(t, "admin@softcorp.io", seedPassword), &proto.User{Id: userID})
+	assert.Nil(t, err)
+	assert.Equal(t, "+45 12 34 56 78", getResponse.User.Phone)
+	assert.Equal(t, "some description", getResponse.User.Description)
+}
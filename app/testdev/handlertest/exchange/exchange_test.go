@@ -0,0 +1,218 @@
+package testing
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+
+	crypto "github.com/softcorp-io/hqs-user-service/crypto"
+	handler "github.com/softcorp-io/hqs-user-service/handler"
+	mock "github.com/softcorp-io/hqs-user-service/testdev/mock"
+	proto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+	"github.com/stretchr/testify/assert"
+)
+
+var myHandler *handler.Handler
+
+func TestMain(m *testing.M) {
+	handler, err := mock.NewHandler()
+	if err != nil {
+		mock.TearDownMongoDocker()
+		log.Fatalf("Could not setup handler: %v", err)
+	}
+
+	myHandler = handler
+
+	code := m.Run()
+
+	mock.TearDownMongoDocker()
+	os.Exit(code)
+}
+
+func clientContext(secret string) context.Context {
+	md := metadata.New(map[string]string{"client_id": "hqs.test.service", "client_secret": secret})
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+func tokenContext(token string) context.Context {
+	md := metadata.New(map[string]string{"token": token})
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+func login(t *testing.T, email string, password string) string {
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    email,
+		Password: password,
+	})
+	assert.Equal(t, nil, err)
+	assert.NotEmpty(t, tokenResponse)
+	return tokenResponse.Token
+}
+
+func exchangeRequest(token string, audience string, scope string) *handler.TokenExchangeRequest {
+	return &handler.TokenExchangeRequest{
+		GrantType:        "urn:ietf:params:oauth:grant-type:token-exchange",
+		SubjectToken:     token,
+		SubjectTokenType: crypto.TokenTypeJWT,
+		Audience:         audience,
+		Scope:            scope,
+	}
+}
+
+func TestExchangeToken(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedEmail := "seeduser1@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	id := mock.Seed("Seed User 1", seedEmail, "+45 88 88 88 88", seedPassword, true, true, true, true, true, true, false, false)
+
+	token := login(t, seedEmail, seedPassword)
+
+	// act
+	exchanged, err := myHandler.ExchangeToken(clientContext("someverysecuresecret"), exchangeRequest(token, "hqs.privilege.service", "view_all_users"))
+
+	// assert
+	assert.Nil(t, err)
+	assert.NotEmpty(t, exchanged.AccessToken)
+	assert.Equal(t, crypto.TokenTypeJWT, exchanged.IssuedTokenType)
+	assert.Equal(t, "view_all_users", exchanged.Scope)
+	assert.True(t, exchanged.ExpiresIn > 0)
+
+	introspection, err := myHandler.Introspect(clientContext("someverysecuresecret"), &handler.IntrospectRequest{Token: exchanged.AccessToken})
+	assert.Nil(t, err)
+	assert.True(t, introspection.Active)
+	assert.Equal(t, id, introspection.Sub)
+	assert.Equal(t, "hqs.privilege.service", introspection.Aud)
+	assert.Equal(t, "hqs.test.service", introspection.ClientID)
+	assert.Equal(t, "hqs.test.service", introspection.Act.Subject)
+
+	// the token is meant for another service
+	_, err = myHandler.GetByToken(tokenContext(exchanged.AccessToken), &proto.Request{})
+	assert.Error(t, err)
+}
+
+func TestExchangeTokenInvalidClient(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedEmail := "seeduser1@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	_ = mock.Seed("Seed User 1", seedEmail, "+45 88 88 88 88", seedPassword, true, true, true, true, true, true, false, false)
+
+	token := login(t, seedEmail, seedPassword)
+
+	// act
+	exchanged, err := myHandler.ExchangeToken(clientContext("wrongsecret"), exchangeRequest(token, "hqs.privilege.service", ""))
+
+	// assert
+	assert.Error(t, err)
+	assert.Empty(t, exchanged)
+}
+
+func TestExchangeTokenCannotWidenScopes(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedEmail := "seeduser1@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	_ = mock.Seed("Seed User 1", seedEmail, "+45 88 88 88 88", seedPassword, true, true, true, true, true, true, false, false)
+
+	scopedToken, err := myHandler.CreateScopedToken(tokenContext(login(t, seedEmail, seedPassword)), &handler.ScopedTokenRequest{
+		Scopes: []string{"view_all_users"},
+	})
+	assert.Nil(t, err)
+
+	// act
+	exchanged, err := myHandler.ExchangeToken(clientContext("someverysecuresecret"), exchangeRequest(scopedToken.Token, "hqs.privilege.service", "view_all_users delete_user"))
+
+	// assert
+	assert.Error(t, err)
+	assert.Empty(t, exchanged)
+}
+
+func TestExchangeTokenMeantForAnotherService(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedEmail := "seeduser1@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	_ = mock.Seed("Seed User 1", seedEmail, "+45 88 88 88 88", seedPassword, true, true, true, true, true, true, false, false)
+
+	emailToken, err := myHandler.CreateScopedToken(tokenContext(login(t, seedEmail, seedPassword)), &handler.ScopedTokenRequest{
+		Scopes:   []string{"view_all_users"},
+		Audience: "hqs.email.service",
+	})
+	assert.Nil(t, err)
+	testToken, err := myHandler.CreateScopedToken(tokenContext(login(t, seedEmail, seedPassword)), &handler.ScopedTokenRequest{
+		Scopes:   []string{"view_all_users"},
+		Audience: "hqs.test.service",
+	})
+	assert.Nil(t, err)
+
+	// act
+	exchanged, err := myHandler.ExchangeToken(clientContext("someverysecuresecret"), exchangeRequest(emailToken.Token, "hqs.privilege.service", ""))
+	ownExchanged, ownErr := myHandler.ExchangeToken(clientContext("someverysecuresecret"), exchangeRequest(testToken.Token, "hqs.privilege.service", ""))
+
+	// assert
+	assert.Error(t, err)
+	assert.Empty(t, exchanged.AccessToken)
+	assert.Nil(t, ownErr)
+	assert.NotEmpty(t, ownExchanged.AccessToken)
+}
+
+func TestExchangedTokenCannotCreateTokens(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedEmail := "seeduser1@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	_ = mock.Seed("Seed User 1", seedEmail, "+45 88 88 88 88", seedPassword, true, true, true, true, true, true, false, false)
+
+	exchanged, err := myHandler.ExchangeToken(clientContext("someverysecuresecret"), exchangeRequest(login(t, seedEmail, seedPassword), crypto.Issuer, ""))
+	assert.Nil(t, err)
+
+	ctx := tokenContext(exchanged.AccessToken)
+
+	// act
+	_, err = myHandler.GetByToken(ctx, &proto.Request{})
+	assert.Nil(t, err)
+
+	_, err = myHandler.CreateScopedToken(ctx, &handler.ScopedTokenRequest{Scopes: []string{"view_all_users"}})
+	assert.Error(t, err)
+
+	_, err = myHandler.CreatePersonalAccessToken(ctx, &handler.PersonalAccessTokenRequest{
+		Name:      "script",
+		Scopes:    []string{"view_all_users"},
+		ExpiresIn: 3600,
+	})
+	assert.Error(t, err)
+}
+
+func TestExchangeTokenBlockedUser(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedEmail := "seeduser1@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	_ = mock.Seed("Seed User 1", seedEmail, "+45 88 88 88 88", seedPassword, true, true, true, true, true, true, false, false)
+
+	seedEmail2 := "seeduser2@softcorp.io"
+	seedPassword2 := "RandomPassword1234"
+	id2 := mock.Seed("Seed User 2", seedEmail2, "+45 88 88 88 89", seedPassword2, false, false, false, false, false, false, false, false)
+
+	token := login(t, seedEmail2, seedPassword2)
+
+	_, err := myHandler.UpdateBlockUser(tokenContext(login(t, seedEmail, seedPassword)), &proto.User{Id: id2, Blocked: true})
+	assert.Nil(t, err)
+
+	// act
+	exchanged, err := myHandler.ExchangeToken(clientContext("someverysecuresecret"), exchangeRequest(token, "hqs.privilege.service", ""))
+
+	// assert
+	assert.Error(t, err)
+	assert.Empty(t, exchanged)
+}
@@ -0,0 +1,241 @@
+package testing
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	handler "github.com/softcorp-io/hqs-user-service/handler"
+	mock "github.com/softcorp-io/hqs-user-service/testdev/mock"
+	proto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+	"github.com/stretchr/testify/assert"
+)
+
+var myHandler *handler.Handler
+
+func TestMain(m *testing.M) {
+	handler, err := mock.NewHandler()
+	if err != nil {
+		mock.TearDownMongoDocker()
+		log.Fatalf("Could not setup handler: %v", err)
+	}
+
+	myHandler = handler
+
+	code := m.Run()
+
+	mock.TearDownMongoDocker()
+	os.Exit(code)
+}
+
+// exportStream - collects the messages of an export
+type exportStream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	responses []*handler.ExportDataResponse
+}
+
+func (s *exportStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *exportStream) Send(res *handler.ExportDataResponse) error {
+	s.responses = append(s.responses, res)
+	return nil
+}
+
+func (s *exportStream) data() []byte {
+	data := []byte{}
+	for _, res := range s.responses {
+		data = append(data, res.ChunkData...)
+	}
+	return data
+}
+
+func authContext(t *testing.T, email string, password string) context.Context {
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    email,
+		Password: password,
+	})
+	assert.Equal(t, nil, err)
+	assert.NotEmpty(t, tokenResponse)
+
+	return metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"token": tokenResponse.Token}))
+}
+
+func TestExportMyDataZip(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	id := mock.Seed("Seed User", "seeduser@softcorp.io", "+45 88 88 88 88", seedPassword, true, false, false, false, false, false, false, false)
+	stream := &exportStream{ctx: authContext(t, "seeduser@softcorp.io", seedPassword)}
+
+	// act
+	err := myHandler.ExportMyData(&handler.ExportDataRequest{}, stream)
+
+	// assert
+	assert.Nil(t, err)
+	assert.NotEmpty(t, stream.responses)
+	assert.Equal(t, "zip", stream.responses[0].Format)
+
+	archive, err := zip.NewReader(bytes.NewReader(stream.data()), int64(len(stream.data())))
+	assert.Nil(t, err)
+	files := map[string][]byte{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		assert.Nil(t, err)
+		files[file.Name], err = ioutil.ReadAll(reader)
+		assert.Nil(t, err)
+		reader.Close()
+	}
+	assert.Contains(t, files, "auth_history.json")
+	assert.Contains(t, files, "sessions.json")
+	assert.Contains(t, files, "personal_access_tokens.json")
+	assert.Contains(t, files, "audit_log.json")
+	assert.Equal(t, "some image", string(files["images/some image"]))
+
+	user := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(files["user.json"], &user))
+	assert.Equal(t, id, user["id"])
+	assert.Equal(t, "seeduser@softcorp.io", user["email"])
+	assert.NotContains(t, user, "password")
+
+	sessions := []map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(files["sessions.json"], &sessions))
+	assert.Equal(t, 1, len(sessions))
+}
+
+func TestExportMyDataURL(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	id := mock.Seed("Seed User", "seeduser@softcorp.io", "+45 88 88 88 88", seedPassword, true, false, false, false, false, false, false, false)
+	stream := &exportStream{ctx: authContext(t, "seeduser@softcorp.io", seedPassword)}
+
+	// act
+	err := myHandler.ExportMyData(&handler.ExportDataRequest{Format: "json", Delivery: "url"}, stream)
+
+	// assert
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(stream.responses))
+	assert.Equal(t, "json", stream.responses[0].Format)
+	assert.NotEmpty(t, stream.responses[0].Url)
+	assert.NotNil(t, stream.responses[0].ExpiresAt)
+	assert.Empty(t, stream.responses[0].ChunkData)
+
+	// the export is stored as json
+	stored := mock.GetStoredObjects("hqs/exports/" + id + "/")
+	assert.Equal(t, 1, len(stored))
+	for _, contentType := range stored {
+		assert.Equal(t, "application/json", contentType)
+	}
+}
+
+func TestExportURLExpires(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+	os.Setenv("DATA_EXPORT_URL_TTL", "1s")
+	defer os.Unsetenv("DATA_EXPORT_URL_TTL")
+
+	seedPassword := "RandomPassword1234"
+	id := mock.Seed("Seed User", "seeduser@softcorp.io", "+45 88 88 88 88", seedPassword, true, false, false, false, false, false, false, false)
+	stream := &exportStream{ctx: authContext(t, "seeduser@softcorp.io", seedPassword)}
+
+	// act
+	err := myHandler.ExportMyData(&handler.ExportDataRequest{Delivery: "url"}, stream)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(mock.GetStoredObjects("hqs/exports/"+id+"/")))
+	time.Sleep(2 * time.Second)
+
+	// assert - the export is deleted when its url expires
+	assert.Empty(t, mock.GetStoredObjects("hqs/exports/"+id+"/"))
+}
+
+func TestDeleteExpiredExports(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	id := mock.Seed("Seed User", "seeduser@softcorp.io", "+45 88 88 88 88", seedPassword, true, false, false, false, false, false, false, false)
+	ctx := authContext(t, "seeduser@softcorp.io", seedPassword)
+	err := myHandler.ExportMyData(&handler.ExportDataRequest{Delivery: "url"}, &exportStream{ctx: ctx})
+	assert.Nil(t, err)
+	err = myHandler.ExportMyData(&handler.ExportDataRequest{Delivery: "url"}, &exportStream{ctx: ctx})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(mock.GetStoredObjects("hqs/exports/"+id+"/")))
+
+	// the instance, which uploaded the exports, stopped before their urls expired
+	mock.AgeStoredObjects("hqs/exports/"+id+"/", 2*time.Hour)
+
+	// act
+	deleted, err := myHandler.DeleteExpiredExports(context.Background())
+
+	// assert
+	assert.Nil(t, err)
+	assert.Equal(t, 2, deleted)
+	assert.Empty(t, mock.GetStoredObjects("hqs/exports/"+id+"/"))
+}
+
+func TestExportUserData(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	dpoID := mock.Seed("Data Protection Officer", "dpo@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	mock.AssignPrivilege(dpoID, "dpo")
+	auditorID := mock.Seed("Auditor", "auditor@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	mock.AssignPrivilege(auditorID, "auditor")
+	id := mock.Seed("Seed User", "seeduser@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	stream := &exportStream{ctx: authContext(t, "dpo@softcorp.io", seedPassword)}
+
+	// act
+	err := myHandler.ExportUserData(&handler.ExportDataRequest{Id: id, Format: "json"}, stream)
+
+	// assert
+	assert.Nil(t, err)
+	bundle := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(stream.data(), &bundle))
+	user, ok := bundle["user"].(map[string]interface{})
+	assert.True(t, ok)
+	assert.Equal(t, id, user["id"])
+	assert.NotContains(t, user, "password")
+
+	// the export is in the audit log
+	auditResponse, err := myHandler.GetAuditLog(authContext(t, "auditor@softcorp.io", seedPassword), &handler.AuditLogRequest{TargetId: id, Action: "ExportUserData"})
+	assert.Nil(t, err)
+	assert.Len(t, auditResponse.Entries, 1)
+	assert.Equal(t, dpoID, auditResponse.Entries[0].ActorId)
+}
+
+func TestExportUserDataDenied(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	mock.Seed("Admin User", "admin@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	id := mock.Seed("Seed User", "seeduser@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	stream := &exportStream{ctx: authContext(t, "admin@softcorp.io", seedPassword)}
+
+	// act
+	err := myHandler.ExportUserData(&handler.ExportDataRequest{Id: id}, stream)
+
+	// assert
+	assert.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Empty(t, stream.responses)
+}
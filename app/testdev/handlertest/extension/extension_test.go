@@ -0,0 +1,147 @@
+package testing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	handler "github.com/softcorp-io/hqs-user-service/handler"
+	mock "github.com/softcorp-io/hqs-user-service/testdev/mock"
+	proto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+)
+
+var myClient proto.UserServiceClient
+var myConn *grpc.ClientConn
+
+func TestMain(m *testing.M) {
+	var wgServer sync.WaitGroup
+	wgServer.Add(1)
+	go mock.RunServerOnPort(&wgServer, "9092")
+	wgServer.Wait()
+
+	conn, err := grpc.Dial(":9092", grpc.WithInsecure())
+	if err != nil {
+		log.Fatalf("did not connect: %s", err)
+	}
+	defer conn.Close()
+	myClient = proto.NewUserServiceClient(conn)
+	myConn = conn
+
+	code := m.Run()
+
+	mock.TearDownMongoDocker()
+	os.Exit(code)
+}
+
+func authToken(t *testing.T, email string, password string) string {
+	tokenResponse, err := myClient.Auth(context.Background(), &proto.User{
+		Email:    email,
+		Password: password,
+	})
+	assert.Nil(t, err)
+
+	return tokenResponse.Token
+}
+
+func TestExtensionServiceIntrospect(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	id := mock.Seed("Seed User", "seeduser@softcorp.io", "+45 88 88 88 88", seedPassword, true, false, false, false, false, false, false, false)
+	token := authToken(t, "seeduser@softcorp.io", seedPassword)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "client_id", "hqs.test.service", "client_secret", "someverysecuresecret")
+
+	// act
+	res := &handler.IntrospectResponse{}
+	err := myConn.Invoke(ctx, "/"+handler.ExtensionServiceName+"/Introspect", &handler.IntrospectRequest{Token: token}, res)
+
+	// assert
+	assert.Nil(t, err)
+	assert.True(t, res.Active)
+	assert.Equal(t, id, res.Sub)
+	assert.Equal(t, "seeduser@softcorp.io", res.Username)
+}
+
+func TestExtensionServiceUnknownClient(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	_ = mock.Seed("Seed User", "seeduser@softcorp.io", "+45 88 88 88 88", seedPassword, true, false, false, false, false, false, false, false)
+	token := authToken(t, "seeduser@softcorp.io", seedPassword)
+
+	// act
+	res := &handler.IntrospectResponse{}
+	err := myConn.Invoke(context.Background(), "/"+handler.ExtensionServiceName+"/Introspect", &handler.IntrospectRequest{Token: token}, res)
+
+	// assert
+	assert.NotNil(t, err)
+	assert.False(t, res.Active)
+}
+
+func TestExtensionServiceListUsers(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	_ = mock.Seed("Seed User", "seeduser@softcorp.io", "+45 88 88 88 88", seedPassword, true, true, true, true, true, true, false, false)
+	_ = mock.Seed("Blocked User", "blocked@softcorp.io", "+45 99 99 99 99", seedPassword, false, false, false, false, false, false, true, false)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "token", authToken(t, "seeduser@softcorp.io", seedPassword))
+
+	// act
+	res := &handler.ListUsersResponse{}
+	err := myConn.Invoke(ctx, "/"+handler.ExtensionServiceName+"/ListUsers", &handler.ListUsersRequest{Blocked: &wrappers.BoolValue{Value: true}, Limit: 10}, res)
+
+	// assert
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res.Total)
+	assert.Equal(t, 1, len(res.Users))
+	assert.Equal(t, "blocked@softcorp.io", res.Users[0].Email)
+}
+
+func TestExtensionServiceExportMyData(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	_ = mock.Seed("Seed User", "seeduser@softcorp.io", "+45 88 88 88 88", seedPassword, true, false, false, false, false, false, false, false)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "token", authToken(t, "seeduser@softcorp.io", seedPassword))
+
+	// act
+	desc := &grpc.StreamDesc{StreamName: "ExportMyData", ServerStreams: true}
+	stream, err := myConn.NewStream(ctx, desc, "/"+handler.ExtensionServiceName+"/ExportMyData")
+	assert.Nil(t, err)
+	assert.Nil(t, stream.SendMsg(&handler.ExportDataRequest{Format: "json"}))
+	assert.Nil(t, stream.CloseSend())
+
+	var responses []*handler.ExportDataResponse
+	var data []byte
+	for {
+		res := &handler.ExportDataResponse{}
+		err := stream.RecvMsg(res)
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		if err != nil {
+			break
+		}
+		responses = append(responses, res)
+		data = append(data, res.ChunkData...)
+	}
+
+	// assert
+	assert.NotEmpty(t, responses)
+	assert.Equal(t, "json", responses[0].Format)
+	assert.True(t, json.Valid(data))
+}
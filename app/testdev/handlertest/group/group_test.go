@@ -0,0 +1,197 @@
+package testing
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+
+	handler "github.com/softcorp-io/hqs-user-service/handler"
+	policy "github.com/softcorp-io/hqs-user-service/policy"
+	mock "github.com/softcorp-io/hqs-user-service/testdev/mock"
+	proto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+	"github.com/stretchr/testify/assert"
+)
+
+var myHandler *handler.Handler
+
+func TestMain(m *testing.M) {
+	handler, err := mock.NewHandler()
+	if err != nil {
+		mock.TearDownMongoDocker()
+		log.Fatalf("Could not setup handler: %v", err)
+	}
+
+	myHandler = handler
+
+	code := m.Run()
+
+	mock.TearDownMongoDocker()
+	os.Exit(code)
+}
+
+func clientContext() context.Context {
+	md := metadata.New(map[string]string{"client_id": "hqs.test.service", "client_secret": "someverysecuresecret"})
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+func auth(t *testing.T, email string, password string) (string, context.Context) {
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    email,
+		Password: password,
+	})
+	assert.Equal(t, nil, err)
+	assert.NotEmpty(t, tokenResponse)
+
+	md := metadata.New(map[string]string{"token": tokenResponse.Token})
+	return tokenResponse.Token, metadata.NewIncomingContext(context.Background(), md)
+}
+
+func TestGroupMembership(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	managerID := mock.Seed("Group Manager", "manager@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	mock.AssignPrivilege(managerID, "groups")
+	adminID := mock.Seed("Admin User", "admin@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	memberID := mock.Seed("Member User", "member@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+
+	_, managerCtx := auth(t, "manager@softcorp.io", seedPassword)
+	_, adminCtx := auth(t, "admin@softcorp.io", seedPassword)
+
+	// act
+	group, err := myHandler.CreateGroup(managerCtx, &handler.GroupRequest{Name: "Backend"})
+	assert.Nil(t, err)
+	_, err = myHandler.CreateGroup(managerCtx, &handler.GroupRequest{Name: "Backend"})
+	assert.Error(t, err)
+
+	for _, id := range []string{memberID, adminID} {
+		_, err = myHandler.AddGroupMember(managerCtx, &handler.GroupRequest{Id: group.Group.Id, UserId: id})
+		assert.Nil(t, err)
+	}
+	_, err = myHandler.AddGroupMember(managerCtx, &handler.GroupRequest{Id: group.Group.Id, UserId: "unknown"})
+	assert.Error(t, err)
+
+	renamed, err := myHandler.RenameGroup(managerCtx, &handler.GroupRequest{Id: group.Group.Id, Name: "Platform"})
+	assert.Nil(t, err)
+	assert.Equal(t, "Platform", renamed.Group.Name)
+
+	// assert
+	members, err := myHandler.GetGroupMembers(adminCtx, &handler.GroupRequest{Id: group.Group.Id, Limit: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), members.Total)
+	assert.Equal(t, 1, len(members.Members))
+	assert.Equal(t, memberID, members.Members[0].Id)
+
+	members, err = myHandler.GetGroupMembers(adminCtx, &handler.GroupRequest{Id: group.Group.Id, Offset: 1, Limit: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, adminID, members.Members[0].Id)
+
+	// members cannot list other users groups, but can list their own
+	_, memberCtx := auth(t, "member@softcorp.io", seedPassword)
+	_, err = myHandler.GetUserGroups(memberCtx, &handler.GroupRequest{UserId: adminID})
+	assert.Error(t, err)
+
+	groups, err := myHandler.GetUserGroups(memberCtx, &handler.GroupRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), groups.Total)
+	assert.Equal(t, group.Group.Id, groups.Groups[0].Id)
+
+	// only group managers manage groups
+	_, err = myHandler.CreateGroup(adminCtx, &handler.GroupRequest{Name: "Other"})
+	assert.Error(t, err)
+
+	_, err = myHandler.RemoveGroupMember(managerCtx, &handler.GroupRequest{Id: group.Group.Id, UserId: memberID})
+	assert.Nil(t, err)
+
+	groups, err = myHandler.GetUserGroups(adminCtx, &handler.GroupRequest{UserId: memberID})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), groups.Total)
+}
+
+func TestAddGroupMemberSelf(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	managerID := mock.Seed("Group Manager", "manager@softcorp.io", "+45 88 88 88 88", seedPassword, false, false, false, false, false, false, false, false)
+	mock.AssignPrivilege(managerID, "groups")
+
+	_, managerCtx := auth(t, "manager@softcorp.io", seedPassword)
+	group, err := myHandler.CreateGroup(managerCtx, &handler.GroupRequest{Name: "Backend"})
+	assert.Nil(t, err)
+
+	// act
+	_, err = myHandler.AddGroupMember(managerCtx, &handler.GroupRequest{Id: group.Group.Id, UserId: managerID})
+
+	// assert
+	assert.Error(t, err)
+	groups, err := myHandler.GetUserGroups(managerCtx, &handler.GroupRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), groups.Total)
+}
+
+func TestAddGroupMemberOtherTeam(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	managerID := mock.Seed("Group Manager", "manager@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	mock.AssignPrivilege(managerID, "groups")
+	mock.TamperStoredUser(managerID, "team", "support")
+	memberID := mock.Seed("Member User", "member@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	mock.TamperStoredUser(memberID, "team", "sales")
+
+	_, managerCtx := auth(t, "manager@softcorp.io", seedPassword)
+	group, err := myHandler.CreateGroup(managerCtx, &handler.GroupRequest{Name: "Backend"})
+	assert.Nil(t, err)
+
+	// act
+	_, err = myHandler.AddGroupMember(managerCtx, &handler.GroupRequest{Id: group.Group.Id, UserId: memberID})
+
+	// assert
+	rule, ok := policy.RuleOf(err)
+	assert.True(t, ok)
+	assert.Equal(t, "own_team", rule)
+}
+
+func TestGroupClaims(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	managerID := mock.Seed("Group Manager", "manager@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	mock.AssignPrivilege(managerID, "groups")
+	memberID := mock.Seed("Member User", "member@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+
+	_, managerCtx := auth(t, "manager@softcorp.io", seedPassword)
+
+	group, err := myHandler.CreateGroup(managerCtx, &handler.GroupRequest{Name: "Backend"})
+	assert.Nil(t, err)
+	_, err = myHandler.AddGroupMember(managerCtx, &handler.GroupRequest{Id: group.Group.Id, UserId: memberID})
+	assert.Nil(t, err)
+
+	// act
+	token, _ := auth(t, "member@softcorp.io", seedPassword)
+	validations, err := myHandler.ValidateTokens(clientContext(), &handler.ValidateTokensRequest{Tokens: []string{token}})
+
+	// assert
+	assert.Nil(t, err)
+	assert.True(t, validations.Results[0].Valid)
+	assert.Equal(t, []string{group.Group.Id}, validations.Results[0].Groups)
+
+	// tokens created after the group is deleted no longer carry it
+	_, err = myHandler.DeleteGroup(managerCtx, &handler.GroupRequest{Id: group.Group.Id})
+	assert.Nil(t, err)
+
+	token, _ = auth(t, "member@softcorp.io", seedPassword)
+	validations, err = myHandler.ValidateTokens(clientContext(), &handler.ValidateTokensRequest{Tokens: []string{token}})
+	assert.Nil(t, err)
+	assert.Empty(t, validations.Results[0].Groups)
+}
@@ -0,0 +1,198 @@
+package testing
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+
+	handler "github.com/softcorp-io/hqs-user-service/handler"
+	mock "github.com/softcorp-io/hqs-user-service/testdev/mock"
+	proto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+	"github.com/stretchr/testify/assert"
+)
+
+var myHandler *handler.Handler
+
+func TestMain(m *testing.M) {
+	handler, err := mock.NewHandler()
+	if err != nil {
+		mock.TearDownMongoDocker()
+		log.Fatalf("Could not setup handler: %v", err)
+	}
+
+	myHandler = handler
+
+	code := m.Run()
+
+	mock.TearDownMongoDocker()
+	os.Exit(code)
+}
+
+func authContext(t *testing.T, email string, password string) context.Context {
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    email,
+		Password: password,
+	})
+	assert.Equal(t, nil, err)
+	assert.NotEmpty(t, tokenResponse)
+
+	md := metadata.New(map[string]string{"token": tokenResponse.Token})
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+func chartIDs(users []*handler.OrgChartUser) []string {
+	ids := []string{}
+	for _, user := range users {
+		ids = append(ids, user.User.Id)
+	}
+	return ids
+}
+
+func TestManagerHierarchy(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	ceoID := mock.Seed("CEO", "ceo@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	cfoID := mock.Seed("CFO", "cfo@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	accountantID := mock.Seed("Accountant", "accountant@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+
+	ceoCtx := authContext(t, "ceo@softcorp.io", seedPassword)
+
+	// act
+	_, err := myHandler.UpdateManager(ceoCtx, &handler.ManagerRequest{Id: cfoID, ManagerId: ceoID})
+	assert.Nil(t, err)
+	_, err = myHandler.UpdateManager(ceoCtx, &handler.ManagerRequest{Id: accountantID, ManagerId: cfoID})
+	assert.Nil(t, err)
+
+	// assert
+	direct, err := myHandler.GetDirectReports(ceoCtx, &handler.ManagerRequest{Id: ceoID})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{cfoID}, chartIDs(direct.Users))
+
+	reports, err := myHandler.GetReports(ceoCtx, &handler.ManagerRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{cfoID, accountantID}, chartIDs(reports.Users))
+	assert.Equal(t, int64(1), reports.Users[1].Depth)
+
+	// every user can see his/her own management chain, but not the chain of others
+	accountantCtx := authContext(t, "accountant@softcorp.io", seedPassword)
+	chain, err := myHandler.GetManagementChain(accountantCtx, &handler.ManagerRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{cfoID, ceoID}, chartIDs(chain.Users))
+
+	_, err = myHandler.GetReports(accountantCtx, &handler.ManagerRequest{Id: ceoID})
+	assert.Error(t, err)
+}
+
+func TestManagerCycle(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	rootID := mock.Seed("Root User", "root@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	mock.MakeRoot(rootID)
+	firstID := mock.Seed("First User", "first@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	secondID := mock.Seed("Second User", "second@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	thirdID := mock.Seed("Third User", "third@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+
+	rootCtx := authContext(t, "root@softcorp.io", seedPassword)
+
+	_, err := myHandler.UpdateManager(rootCtx, &handler.ManagerRequest{Id: secondID, ManagerId: firstID})
+	assert.Nil(t, err)
+	_, err = myHandler.UpdateManager(rootCtx, &handler.ManagerRequest{Id: thirdID, ManagerId: secondID})
+	assert.Nil(t, err)
+
+	// act
+	_, errSelf := myHandler.UpdateManager(rootCtx, &handler.ManagerRequest{Id: firstID, ManagerId: firstID})
+	_, errCycle := myHandler.UpdateManager(rootCtx, &handler.ManagerRequest{Id: firstID, ManagerId: thirdID})
+
+	// assert
+	assert.Error(t, errSelf)
+	assert.Error(t, errCycle)
+}
+
+func TestConcurrentManagerCycle(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	rootID := mock.Seed("Root User", "root@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	mock.MakeRoot(rootID)
+	firstID := mock.Seed("First User", "first@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	secondID := mock.Seed("Second User", "second@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+
+	rootCtx := authContext(t, "root@softcorp.io", seedPassword)
+
+	for round := 0; round < 10; round++ {
+		_, err := myHandler.UpdateManager(rootCtx, &handler.ManagerRequest{Id: firstID})
+		assert.Nil(t, err)
+		_, err = myHandler.UpdateManager(rootCtx, &handler.ManagerRequest{Id: secondID})
+		assert.Nil(t, err)
+
+		// act
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, errs[0] = myHandler.UpdateManager(rootCtx, &handler.ManagerRequest{Id: firstID, ManagerId: secondID})
+		}()
+		go func() {
+			defer wg.Done()
+			_, errs[1] = myHandler.UpdateManager(rootCtx, &handler.ManagerRequest{Id: secondID, ManagerId: firstID})
+		}()
+		wg.Wait()
+
+		// assert
+		assert.False(t, errs[0] == nil && errs[1] == nil)
+		chain, err := myHandler.GetManagementChain(rootCtx, &handler.ManagerRequest{Id: firstID})
+		assert.Nil(t, err)
+		assert.NotContains(t, chartIDs(chain.Users), firstID)
+	}
+}
+
+func TestOrphanedReports(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	rootID := mock.Seed("Root User", "root@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	mock.MakeRoot(rootID)
+	managerID := mock.Seed("Manager", "manager@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	reportID := mock.Seed("Report", "report@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+
+	rootCtx := authContext(t, "root@softcorp.io", seedPassword)
+
+	_, err := myHandler.UpdateManager(rootCtx, &handler.ManagerRequest{Id: reportID, ManagerId: managerID})
+	assert.Nil(t, err)
+
+	// act
+	_, err = myHandler.UpdateBlockUser(rootCtx, &proto.User{Id: managerID, Blocked: true})
+	assert.Nil(t, err)
+
+	// assert
+	reports, err := myHandler.GetDirectReports(rootCtx, &handler.ManagerRequest{Id: managerID})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(reports.Users))
+	assert.True(t, reports.Users[0].ManagerOrphaned)
+
+	// a blocked user cannot become a manager
+	_, err = myHandler.UpdateManager(rootCtx, &handler.ManagerRequest{Id: reportID, ManagerId: managerID})
+	assert.Error(t, err)
+
+	_, err = myHandler.UpdateBlockUser(rootCtx, &proto.User{Id: managerID, Blocked: false})
+	assert.Nil(t, err)
+
+	reports, err = myHandler.GetDirectReports(rootCtx, &handler.ManagerRequest{Id: managerID})
+	assert.Nil(t, err)
+	assert.False(t, reports.Users[0].ManagerOrphaned)
+}
@@ -0,0 +1,172 @@
+package testing
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+
+	handler "github.com/softcorp-io/hqs-user-service/handler"
+	mock "github.com/softcorp-io/hqs-user-service/testdev/mock"
+	proto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+	"github.com/stretchr/testify/assert"
+)
+
+var myHandler *handler.Handler
+
+func TestMain(m *testing.M) {
+	handler, err := mock.NewHandler()
+	if err != nil {
+		mock.TearDownMongoDocker()
+		log.Fatalf("Could not setup handler: %v", err)
+	}
+
+	myHandler = handler
+
+	code := m.Run()
+
+	mock.TearDownMongoDocker()
+	os.Exit(code)
+}
+
+func tokenContext(token string) context.Context {
+	md := metadata.New(map[string]string{"token": token})
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+func authContext(t *testing.T, email string, password string) context.Context {
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    email,
+		Password: password,
+	})
+	assert.Equal(t, nil, err)
+	assert.NotEmpty(t, tokenResponse)
+
+	return tokenContext(tokenResponse.Token)
+}
+
+func TestImpersonateAllowed(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	supportID := mock.Seed("Support User", "support@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	mock.AssignPrivilege(supportID, "support")
+	subjectID := mock.Seed("Seed User 1", "seeduser1@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+
+	ctx := authContext(t, "support@softcorp.io", seedPassword)
+
+	// act
+	impersonation, err := myHandler.Impersonate(ctx, &proto.User{Id: subjectID})
+
+	// assert
+	assert.Nil(t, err)
+	assert.NotEmpty(t, impersonation.Token)
+
+	impersonationCtx := tokenContext(impersonation.Token)
+
+	userResponse, err := myHandler.GetByToken(impersonationCtx, &proto.Request{})
+	assert.Nil(t, err)
+	assert.Equal(t, subjectID, userResponse.User.Id)
+
+	// sensitive actions are refused
+	_, err = myHandler.UpdatePassword(impersonationCtx, &proto.UpdatePasswordRequest{
+		OldPassword: seedPassword,
+		NewPassword: "AnotherPassword1234",
+	})
+	assert.Error(t, err)
+
+	_, err = myHandler.Delete(impersonationCtx, &proto.User{Id: supportID})
+	assert.Error(t, err)
+
+	_, err = myHandler.UpdatePrivileges(impersonationCtx, &proto.User{Id: supportID, PrivilegeID: "support"})
+	assert.Error(t, err)
+
+	_, err = myHandler.CreateScopedToken(impersonationCtx, &handler.ScopedTokenRequest{Scopes: []string{"view_all_users"}})
+	assert.Error(t, err)
+
+	_, err = myHandler.Impersonate(impersonationCtx, &proto.User{Id: supportID})
+	assert.Error(t, err)
+
+	_, err = myHandler.BlockUsersTokens(impersonationCtx, &proto.Request{})
+	assert.Error(t, err)
+
+	_, err = myHandler.BlockToken(impersonationCtx, &proto.Token{Token: impersonation.Token})
+	assert.Error(t, err)
+
+	_, err = myHandler.EmailResetPasswordToken(impersonationCtx, &proto.User{Id: subjectID})
+	assert.Error(t, err)
+
+	// the subject sees the impersonation
+	history, err := myHandler.GetAuthHistory(authContext(t, "seeduser1@softcorp.io", seedPassword), &proto.Request{})
+	assert.Nil(t, err)
+	found := false
+	for _, auth := range history.AuthHistory {
+		if auth.TokenID == impersonation.Id {
+			found = true
+			assert.Equal(t, "impersonation", auth.TypeOf)
+		}
+	}
+	assert.True(t, found)
+}
+
+func TestImpersonateNotAllowed(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	_ = mock.Seed("Seed User 1", "seeduser1@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	subjectID := mock.Seed("Seed User 2", "seeduser2@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+
+	ctx := authContext(t, "seeduser1@softcorp.io", seedPassword)
+
+	// act
+	impersonation, err := myHandler.Impersonate(ctx, &proto.User{Id: subjectID})
+
+	// assert
+	assert.Error(t, err)
+	assert.Empty(t, impersonation)
+}
+
+func TestImpersonateHigherPrivilege(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	supportID := mock.Seed("Support User", "support@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	mock.AssignPrivilege(supportID, "support")
+	subjectID := mock.Seed("Seed User 1", "seeduser1@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+
+	// act
+	impersonation, err := myHandler.Impersonate(authContext(t, "support@softcorp.io", seedPassword), &proto.User{Id: subjectID})
+
+	// assert
+	assert.Error(t, err)
+	assert.Empty(t, impersonation.Token)
+}
+
+func TestImpersonateRevokedImpersonator(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	supportID := mock.Seed("Support User", "support@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	mock.AssignPrivilege(supportID, "support")
+	subjectID := mock.Seed("Seed User 1", "seeduser1@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+
+	impersonation, err := myHandler.Impersonate(authContext(t, "support@softcorp.io", seedPassword), &proto.User{Id: subjectID})
+	assert.Nil(t, err)
+
+	// act
+	mock.AssignPrivilege(supportID, "default")
+
+	// assert
+	_, err = myHandler.GetByToken(tokenContext(impersonation.Token), &proto.Request{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,135 @@
+package testing
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+
+	handler "github.com/softcorp-io/hqs-user-service/handler"
+	mock "github.com/softcorp-io/hqs-user-service/testdev/mock"
+	proto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+	"github.com/stretchr/testify/assert"
+)
+
+var myHandler *handler.Handler
+
+func TestMain(m *testing.M) {
+	handler, err := mock.NewHandler()
+	if err != nil {
+		mock.TearDownMongoDocker()
+		log.Fatalf("Could not setup handler: %v", err)
+	}
+
+	myHandler = handler
+
+	code := m.Run()
+
+	mock.TearDownMongoDocker()
+	os.Exit(code)
+}
+
+func TestIntrospectActiveToken(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	// arrange
+	seedName := "Seed User"
+	seedEmail := "seeduser@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	seedAllowView := true
+	seedAllowCreate := false
+	seedAllowPermission := true
+	seedAllowDelete := false
+	seedAllowBlock := true
+	seedAllowReset := false
+	seedBlocked := false
+	seedGender := false
+	id := mock.Seed(seedName, seedEmail, seedPhone, seedPassword, seedAllowView, seedAllowCreate, seedAllowPermission, seedAllowDelete, seedAllowBlock, seedAllowReset, seedBlocked, seedGender)
+
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    seedEmail,
+		Password: seedPassword,
+	})
+	assert.Equal(t, nil, err)
+	assert.NotEmpty(t, tokenResponse)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	md := metadata.New(map[string]string{"client_id": "hqs.test.service", "client_secret": "someverysecuresecret"})
+	ctx = metadata.NewIncomingContext(ctx, md)
+
+	// act
+	res, err := myHandler.Introspect(ctx, &handler.IntrospectRequest{
+		Token: tokenResponse.Token,
+	})
+
+	// assert
+	assert.Nil(t, err)
+	assert.True(t, res.Active)
+	assert.Equal(t, id, res.Sub)
+	assert.Equal(t, seedEmail, res.Username)
+	assert.Equal(t, tokenResponse.Id, res.Jti)
+	assert.Equal(t, "view_all_users manage_privileges block_user", res.Scope)
+	assert.True(t, res.Exp > res.Iat)
+	assert.Equal(t, seedAllowView, res.Privilege.ViewAllUsers)
+	assert.Equal(t, seedAllowBlock, res.Privilege.BlockUser)
+	assert.Equal(t, seedAllowDelete, res.Privilege.DeleteUser)
+}
+
+func TestIntrospectInactiveToken(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	md := metadata.New(map[string]string{"client_id": "hqs.test.service", "client_secret": "someverysecuresecret"})
+	ctx = metadata.NewIncomingContext(ctx, md)
+
+	// act
+	res, err := myHandler.Introspect(ctx, &handler.IntrospectRequest{
+		Token: "some invalid token",
+	})
+
+	// assert
+	assert.Nil(t, err)
+	assert.False(t, res.Active)
+	assert.Empty(t, res.Sub)
+	assert.Nil(t, res.Privilege)
+}
+
+func TestIntrospectInvalidClient(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	// arrange
+	seedName := "Seed User"
+	seedEmail := "seeduser@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	_ = mock.Seed(seedName, seedEmail, seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    seedEmail,
+		Password: seedPassword,
+	})
+	assert.Equal(t, nil, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	md := metadata.New(map[string]string{"client_id": "hqs.test.service", "client_secret": "wrongsecret"})
+	ctx = metadata.NewIncomingContext(ctx, md)
+
+	// act
+	res, err := myHandler.Introspect(ctx, &handler.IntrospectRequest{
+		Token: tokenResponse.Token,
+	})
+
+	// assert
+	assert.Error(t, err)
+	assert.False(t, res.Active)
+}
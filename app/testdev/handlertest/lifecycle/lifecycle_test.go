@@ -0,0 +1,207 @@
+package testing
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	handler "github.com/softcorp-io/hqs-user-service/handler"
+	mock "github.com/softcorp-io/hqs-user-service/testdev/mock"
+	proto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+	"github.com/stretchr/testify/assert"
+)
+
+var myHandler *handler.Handler
+
+func TestMain(m *testing.M) {
+	handler, err := mock.NewHandler()
+	if err != nil {
+		mock.TearDownMongoDocker()
+		log.Fatalf("Could not setup handler: %v", err)
+	}
+
+	myHandler = handler
+
+	code := m.Run()
+
+	mock.TearDownMongoDocker()
+	os.Exit(code)
+}
+
+func authContext(t *testing.T, email string, password string) context.Context {
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    email,
+		Password: password,
+	})
+	assert.Equal(t, nil, err)
+	assert.NotEmpty(t, tokenResponse)
+
+	md := metadata.New(map[string]string{"token": tokenResponse.Token})
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+func statusReason(err error) string {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.Reason
+		}
+	}
+	return ""
+}
+
+func TestSuspendUser(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	mock.Seed("Admin User", "admin@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	userID := mock.Seed("Suspended User", "suspended@softcorp.io", seedPhone, seedPassword, true, false, false, false, false, false, false, false)
+
+	adminCtx := authContext(t, "admin@softcorp.io", seedPassword)
+	userCtx := authContext(t, "suspended@softcorp.io", seedPassword)
+	until, _ := ptypes.TimestampProto(time.Now().Add(time.Hour))
+
+	// a suspension requires a reason
+	_, err := myHandler.UpdateUserStatus(adminCtx, &handler.UserStatusRequest{Id: userID, Status: "suspended", SuspendedUntil: until})
+	assert.Error(t, err)
+
+	// act
+	res, err := myHandler.UpdateUserStatus(adminCtx, &handler.UserStatusRequest{Id: userID, Status: "suspended", Reason: "Investigation", SuspendedUntil: until})
+
+	// assert
+	assert.Nil(t, err)
+	assert.Equal(t, "suspended", res.Status)
+	assert.Equal(t, "Investigation", res.SuspendedReason)
+	assert.Equal(t, 1, len(res.Changes))
+	assert.Equal(t, "active", res.Changes[0].From)
+
+	// the user can neither log in nor use his/her token
+	_, err = myHandler.Auth(context.Background(), &proto.User{Email: "suspended@softcorp.io", Password: seedPassword})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Equal(t, "USER_SUSPENDED", statusReason(err))
+	_, err = myHandler.Get(userCtx, &proto.User{Id: userID})
+	assert.Equal(t, "USER_SUSPENDED", statusReason(err))
+
+	// the suspension is lifted
+	res, err = myHandler.UpdateUserStatus(adminCtx, &handler.UserStatusRequest{Id: userID, Status: "active"})
+	assert.Nil(t, err)
+	assert.Empty(t, res.SuspendedReason)
+	assert.Equal(t, 2, len(res.Changes))
+	_, err = myHandler.Get(userCtx, &proto.User{Id: userID})
+	assert.Nil(t, err)
+}
+
+func TestSuspendedUserWrongPassword(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	mock.Seed("Admin User", "admin@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	userID := mock.Seed("Suspended User", "suspended@softcorp.io", seedPhone, seedPassword, true, false, false, false, false, false, false, false)
+
+	adminCtx := authContext(t, "admin@softcorp.io", seedPassword)
+	until, _ := ptypes.TimestampProto(time.Now().Add(time.Hour))
+	_, err := myHandler.UpdateUserStatus(adminCtx, &handler.UserStatusRequest{Id: userID, Status: "suspended", Reason: "Investigation", SuspendedUntil: until})
+	assert.Nil(t, err)
+
+	// act
+	_, err = myHandler.Auth(context.Background(), &proto.User{Email: "suspended@softcorp.io", Password: "WrongPassword1234"})
+
+	// assert
+	assert.Error(t, err)
+	assert.NotEqual(t, codes.FailedPrecondition, status.Code(err))
+	assert.Empty(t, statusReason(err))
+	assert.NotContains(t, err.Error(), "suspended")
+}
+
+func TestStatusTransitions(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	mock.Seed("Admin User", "admin@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	blockedID := mock.Seed("Blocked User", "blocked@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, true, false)
+
+	adminCtx := authContext(t, "admin@softcorp.io", seedPassword)
+	until, _ := ptypes.TimestampProto(time.Now().Add(time.Hour))
+
+	// act
+	// users blocked before statuses existed are deactivated, and cannot be suspended or invited
+	statusRes, errGet := myHandler.GetUserStatus(adminCtx, &handler.UserStatusRequest{Id: blockedID})
+	_, errSuspend := myHandler.UpdateUserStatus(adminCtx, &handler.UserStatusRequest{Id: blockedID, Status: "suspended", Reason: "Investigation", SuspendedUntil: until})
+	_, errInvite := myHandler.UpdateUserStatus(adminCtx, &handler.UserStatusRequest{Id: blockedID, Status: "invited"})
+	_, errDelete := myHandler.UpdateUserStatus(adminCtx, &handler.UserStatusRequest{Id: blockedID, Status: "deleted"})
+	_, errUnblock := myHandler.UpdateBlockUser(adminCtx, &proto.User{Id: blockedID, Blocked: false})
+
+	// assert
+	assert.Nil(t, errGet)
+	assert.Equal(t, "deactivated", statusRes.Status)
+	assert.Error(t, errSuspend)
+	assert.Error(t, errInvite)
+	assert.Error(t, errDelete)
+	assert.Nil(t, errUnblock)
+
+	statusRes, err := myHandler.GetUserStatus(adminCtx, &handler.UserStatusRequest{Id: blockedID})
+	assert.Nil(t, err)
+	assert.Equal(t, "active", statusRes.Status)
+	assert.Equal(t, "deactivated", statusRes.Changes[0].From)
+}
+
+func TestScheduledSuspension(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	mock.Seed("Admin User", "admin@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	userID := mock.Seed("Suspended User", "suspended@softcorp.io", seedPhone, seedPassword, true, false, false, false, false, false, false, false)
+
+	adminCtx := authContext(t, "admin@softcorp.io", seedPassword)
+	from, _ := ptypes.TimestampProto(time.Now().Add(time.Second))
+	until, _ := ptypes.TimestampProto(time.Now().Add(2 * time.Second))
+
+	// act
+	res, err := myHandler.UpdateUserStatus(adminCtx, &handler.UserStatusRequest{Id: userID, Status: "suspended", Reason: "Vacation", SuspendedFrom: from, SuspendedUntil: until})
+
+	// assert
+	// the user is active until the suspension starts
+	assert.Nil(t, err)
+	assert.Equal(t, "active", res.Status)
+	assert.Equal(t, "Vacation", res.SuspendedReason)
+	authContext(t, "suspended@softcorp.io", seedPassword)
+
+	// the suspension starts on time and tells when access resumes
+	time.Sleep(1100 * time.Millisecond)
+	_, err = myHandler.Auth(context.Background(), &proto.User{Email: "suspended@softcorp.io", Password: seedPassword})
+	assert.Equal(t, "USER_SUSPENDED", statusReason(err))
+	assert.Contains(t, status.Convert(err).Message(), "suspended until")
+
+	changed, err := myHandler.ApplySuspensions(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, changed)
+
+	// the scheduler lifts the suspension when it ends, and records it
+	time.Sleep(time.Second)
+	changed, err = myHandler.ApplySuspensions(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, changed)
+
+	res, err = myHandler.GetUserStatus(adminCtx, &handler.UserStatusRequest{Id: userID})
+	assert.Nil(t, err)
+	assert.Equal(t, "active", res.Status)
+	assert.Empty(t, res.SuspendedReason)
+	assert.Equal(t, 2, len(res.Changes))
+	assert.Equal(t, "suspended", res.Changes[1].From)
+	authContext(t, "suspended@softcorp.io", seedPassword)
+}
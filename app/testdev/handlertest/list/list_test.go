@@ -0,0 +1,117 @@
+package testing
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc/metadata"
+
+	handler "github.com/softcorp-io/hqs-user-service/handler"
+	mock "github.com/softcorp-io/hqs-user-service/testdev/mock"
+	proto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+	"github.com/stretchr/testify/assert"
+)
+
+var myHandler *handler.Handler
+
+func TestMain(m *testing.M) {
+	handler, err := mock.NewHandler()
+	if err != nil {
+		mock.TearDownMongoDocker()
+		log.Fatalf("Could not setup handler: %v", err)
+	}
+
+	myHandler = handler
+
+	code := m.Run()
+
+	mock.TearDownMongoDocker()
+	os.Exit(code)
+}
+
+func authContext(t *testing.T, email string, password string) context.Context {
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    email,
+		Password: password,
+	})
+	assert.Equal(t, nil, err)
+	assert.NotEmpty(t, tokenResponse)
+
+	md := metadata.New(map[string]string{"token": tokenResponse.Token})
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+func TestListUsersPages(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	rootID := mock.Seed("Root User", "root@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	mock.MakeRoot(rootID)
+	mock.Seed("Admin User", "admin@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	for i := 0; i < 5; i++ {
+		mock.Seed(fmt.Sprintf("User %d", i), fmt.Sprintf("user%d@softcorp.io", i), seedPhone, seedPassword, false, false, false, false, false, false, i%2 == 0, false)
+	}
+
+	ctx := authContext(t, "admin@softcorp.io", seedPassword)
+
+	// act
+	ids := map[string]bool{}
+	names := []string{}
+	req := &handler.ListUsersRequest{Limit: 2, Fields: []string{"name"}}
+	for {
+		page, err := myHandler.ListUsers(ctx, req)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(6), page.Total)
+		for _, user := range page.Users {
+			assert.Empty(t, user.Password)
+			assert.Empty(t, user.Email)
+			ids[user.Id] = true
+			names = append(names, user.Name)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		req.Cursor = page.NextCursor
+	}
+
+	// assert
+	// every user except root is listed once, sorted by name
+	assert.Equal(t, 6, len(ids))
+	assert.False(t, ids[rootID])
+	assert.Equal(t, []string{"Admin User", "User 0", "User 1", "User 2", "User 3", "User 4"}, names)
+}
+
+func TestListUsersFilters(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	mock.Seed("Admin User", "admin@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	blockedID := mock.Seed("Blocked User", "blocked@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, true, false)
+	mock.Seed("Active User", "active@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+
+	ctx := authContext(t, "admin@softcorp.io", seedPassword)
+
+	// act
+	blockedPage, err := myHandler.ListUsers(ctx, &handler.ListUsersRequest{Blocked: &wrappers.BoolValue{Value: true}})
+	assert.Nil(t, err)
+	descendingPage, err := myHandler.ListUsers(ctx, &handler.ListUsersRequest{SortBy: "email", Descending: true})
+	assert.Nil(t, err)
+	_, errSort := myHandler.ListUsers(ctx, &handler.ListUsersRequest{SortBy: "password"})
+	_, errField := myHandler.ListUsers(ctx, &handler.ListUsersRequest{Fields: []string{"password"}})
+
+	// assert
+	assert.Equal(t, int64(1), blockedPage.Total)
+	assert.Equal(t, blockedID, blockedPage.Users[0].Id)
+	assert.Equal(t, "blocked@softcorp.io", descendingPage.Users[0].Email)
+	assert.Equal(t, "active@softcorp.io", descendingPage.Users[2].Email)
+	assert.Error(t, errSort)
+	assert.Error(t, errField)
+}
@@ -0,0 +1,179 @@
+package testing
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+
+	handler "github.com/softcorp-io/hqs-user-service/handler"
+	mock "github.com/softcorp-io/hqs-user-service/testdev/mock"
+	proto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+	"github.com/stretchr/testify/assert"
+)
+
+var myHandler *handler.Handler
+
+func TestMain(m *testing.M) {
+	handler, err := mock.NewHandler()
+	if err != nil {
+		mock.TearDownMongoDocker()
+		log.Fatalf("Could not setup handler: %v", err)
+	}
+
+	myHandler = handler
+
+	code := m.Run()
+
+	mock.TearDownMongoDocker()
+	os.Exit(code)
+}
+
+func tokenContext(token string) context.Context {
+	md := metadata.New(map[string]string{"token": token})
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+func authContext(t *testing.T, email string, password string) context.Context {
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    email,
+		Password: password,
+	})
+	assert.Equal(t, nil, err)
+	assert.NotEmpty(t, tokenResponse)
+
+	return tokenContext(tokenResponse.Token)
+}
+
+func userIDs(users []*proto.User) []string {
+	ids := []string{}
+	for _, user := range users {
+		ids = append(ids, user.Id)
+	}
+	return ids
+}
+
+func TestOrganizationIsolatesUsers(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	rootID := mock.Seed("Root User", "root@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	mock.MakeRoot(rootID)
+	acmeID := mock.Seed("Acme User", "acme@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	otherID := mock.Seed("Other User", "other@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+
+	rootCtx := authContext(t, "root@softcorp.io", seedPassword)
+	acmeCtx := authContext(t, "acme@softcorp.io", seedPassword)
+
+	acmeUser, err := myHandler.Get(rootCtx, &proto.User{Id: acmeID})
+	assert.Nil(t, err)
+
+	organization, err := myHandler.CreateOrganization(rootCtx, &handler.Organization{
+		Name:               "Acme",
+		DefaultPrivilegeId: acmeUser.User.PrivilegeID,
+	})
+	assert.Nil(t, err)
+
+	// act
+	_, err = myHandler.UpdateUserOrganization(rootCtx, &handler.UserOrganizationRequest{
+		Id:             acmeID,
+		OrganizationId: organization.Organization.Id,
+	})
+	assert.Nil(t, err)
+
+	// assert
+	// the token from before the move cannot be used
+	_, err = myHandler.GetByToken(acmeCtx, &proto.Request{})
+	assert.Error(t, err)
+
+	acmeCtx = authContext(t, "acme@softcorp.io", seedPassword)
+
+	usersResponse, err := myHandler.GetAll(acmeCtx, &proto.Request{})
+	assert.Nil(t, err)
+	assert.Contains(t, userIDs(usersResponse.Users), acmeID)
+	assert.NotContains(t, userIDs(usersResponse.Users), otherID)
+
+	_, err = myHandler.Get(acmeCtx, &proto.User{Id: otherID})
+	assert.Error(t, err)
+
+	_, err = myHandler.Delete(acmeCtx, &proto.User{Id: otherID})
+	assert.Error(t, err)
+
+	// users without an organization cannot see the organization either
+	otherCtx := authContext(t, "other@softcorp.io", seedPassword)
+	_, err = myHandler.Get(otherCtx, &proto.User{Id: acmeID})
+	assert.Error(t, err)
+
+	// root sees every organization
+	usersResponse, err = myHandler.GetAll(rootCtx, &proto.Request{})
+	assert.Nil(t, err)
+	assert.Contains(t, userIDs(usersResponse.Users), acmeID)
+	assert.Contains(t, userIDs(usersResponse.Users), otherID)
+}
+
+func TestOrganizationPrivileges(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	rootID := mock.Seed("Root User", "root@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	mock.MakeRoot(rootID)
+	adminID := mock.Seed("Acme Admin", "admin@acme.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	memberID := mock.Seed("Acme Member", "member@acme.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	otherID := mock.Seed("Other User", "other@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+
+	rootCtx := authContext(t, "root@softcorp.io", seedPassword)
+
+	admin, err := myHandler.Get(rootCtx, &proto.User{Id: adminID})
+	assert.Nil(t, err)
+	member, err := myHandler.Get(rootCtx, &proto.User{Id: memberID})
+	assert.Nil(t, err)
+	other, err := myHandler.Get(rootCtx, &proto.User{Id: otherID})
+	assert.Nil(t, err)
+
+	organization, err := myHandler.CreateOrganization(rootCtx, &handler.Organization{
+		Name:               "Acme",
+		PrivilegeIds:       []string{admin.User.PrivilegeID},
+		DefaultPrivilegeId: member.User.PrivilegeID,
+	})
+	assert.Nil(t, err)
+
+	for _, id := range []string{adminID, memberID} {
+		_, err = myHandler.UpdateUserOrganization(rootCtx, &handler.UserOrganizationRequest{
+			Id:             id,
+			OrganizationId: organization.Organization.Id,
+		})
+		assert.Nil(t, err)
+	}
+
+	// the admin got the default privilege of the organization, and is given the admin privilege back by root
+	_, err = myHandler.UpdatePrivileges(rootCtx, &proto.User{Id: adminID, PrivilegeID: admin.User.PrivilegeID})
+	assert.Nil(t, err)
+
+	adminCtx := authContext(t, "admin@acme.io", seedPassword)
+
+	// act
+	_, errOther := myHandler.UpdatePrivileges(adminCtx, &proto.User{Id: memberID, PrivilegeID: other.User.PrivilegeID})
+	_, errOwn := myHandler.UpdatePrivileges(adminCtx, &proto.User{Id: memberID, PrivilegeID: admin.User.PrivilegeID})
+
+	// assert
+	assert.Error(t, errOther)
+	assert.Nil(t, errOwn)
+
+	// only root manages organizations
+	_, err = myHandler.CreateOrganization(adminCtx, &handler.Organization{
+		Name:               "Evil",
+		DefaultPrivilegeId: admin.User.PrivilegeID,
+	})
+	assert.Error(t, err)
+
+	organizations, err := myHandler.GetOrganizations(adminCtx, &proto.Request{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(organizations.Organizations))
+	assert.Equal(t, organization.Organization.Id, organizations.Organizations[0].Id)
+}
@@ -0,0 +1,208 @@
+package testing
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	handler "github.com/softcorp-io/hqs-user-service/handler"
+	permission "github.com/softcorp-io/hqs-user-service/permission"
+	repository "github.com/softcorp-io/hqs-user-service/repository"
+	mock "github.com/softcorp-io/hqs-user-service/testdev/mock"
+	proto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+	"github.com/stretchr/testify/assert"
+)
+
+var myHandler *handler.Handler
+
+func TestMain(m *testing.M) {
+	handler, err := mock.NewHandler()
+	if err != nil {
+		mock.TearDownMongoDocker()
+		log.Fatalf("Could not setup handler: %v", err)
+	}
+
+	myHandler = handler
+
+	code := m.Run()
+
+	mock.TearDownMongoDocker()
+	os.Exit(code)
+}
+
+func authContext(t *testing.T, email string, password string) context.Context {
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    email,
+		Password: password,
+	})
+	assert.Equal(t, nil, err)
+	assert.NotEmpty(t, tokenResponse)
+
+	md := metadata.New(map[string]string{"token": tokenResponse.Token})
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+func TestPermissionDeniedNamesPermission(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedEmail := "seeduser1@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	_ = mock.Seed("Seed User 1", seedEmail, seedPhone, seedPassword, true, true, true, false, true, true, false, false)
+	id2 := mock.Seed("Seed User 2", "seeduser2@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+
+	ctx := authContext(t, seedEmail, seedPassword)
+
+	// act
+	_, err := myHandler.Delete(ctx, &proto.User{Id: id2})
+
+	// assert
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	missing, ok := permission.Missing(err)
+	assert.True(t, ok)
+	assert.Equal(t, permission.DeleteUser, missing)
+}
+
+func TestNamedPermissionGranted(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	auditorID := mock.Seed("Auditor", "auditor@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	mock.AssignPrivilege(auditorID, "auditor")
+	subjectID := mock.Seed("Seed User 1", "seeduser1@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+
+	// act
+	impersonation, err := myHandler.Impersonate(authContext(t, "auditor@softcorp.io", seedPassword), &proto.User{Id: subjectID})
+
+	// assert
+	assert.Nil(t, err)
+	assert.NotEmpty(t, impersonation.Token)
+}
+
+func TestNamedPermissionMissing(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedEmail := "seeduser1@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	_ = mock.Seed("Seed User 1", seedEmail, seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	id2 := mock.Seed("Seed User 2", "seeduser2@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+
+	// act
+	_, err := myHandler.Impersonate(authContext(t, seedEmail, seedPassword), &proto.User{Id: id2})
+
+	// assert
+	missing, ok := permission.Missing(err)
+	assert.True(t, ok)
+	assert.Equal(t, permission.Impersonate, missing)
+}
+
+func TestUnregisteredRPCDenied(t *testing.T) {
+	// configure
+	registry, err := permission.NewRegistry(repository.ProfileFields)
+	assert.Nil(t, err)
+
+	// act
+	err = registry.Authorize("SomeUnknownRPC", permission.Set{permission.ViewAllUsers: true})
+
+	// assert
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestRegisteredRPCWithoutPermissions(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedEmail := "seeduser1@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	id := mock.Seed("Seed User 1", seedEmail, seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+
+	ctx := authContext(t, seedEmail, seedPassword)
+
+	// act
+	_, reportsErr := myHandler.GetDirectReports(ctx, &handler.ManagerRequest{Id: id})
+	_, organizationsErr := myHandler.GetOrganizations(ctx, &proto.Request{})
+
+	// assert
+	assert.Nil(t, reportsErr)
+	assert.Nil(t, organizationsErr)
+}
+
+func TestUnknownPrivilegePermission(t *testing.T) {
+	// configure
+	previous := os.Getenv("PRIVILEGE_PERMISSIONS")
+	os.Setenv("PRIVILEGE_PERMISSIONS", "auditor:impersonate|view_everything")
+	defer os.Setenv("PRIVILEGE_PERMISSIONS", previous)
+
+	// act
+	registry, err := permission.NewRegistry(repository.ProfileFields)
+
+	// assert
+	assert.Error(t, err)
+	assert.Nil(t, registry)
+}
+
+func TestRootPermissionCannotBeGranted(t *testing.T) {
+	// configure
+	previous := os.Getenv("PRIVILEGE_PERMISSIONS")
+	os.Setenv("PRIVILEGE_PERMISSIONS", "auditor:root")
+	defer os.Setenv("PRIVILEGE_PERMISSIONS", previous)
+
+	// act
+	registry, err := permission.NewRegistry(repository.ProfileFields)
+
+	// assert
+	assert.Error(t, err)
+	assert.Nil(t, registry)
+}
+
+func TestRootPermissionMissing(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedEmail := "seeduser1@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	_ = mock.Seed("Seed User 1", seedEmail, seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+
+	// act
+	_, err := myHandler.CreateOrganization(authContext(t, seedEmail, seedPassword), &handler.Organization{Name: "Some Organization"})
+
+	// assert
+	missing, ok := permission.Missing(err)
+	assert.True(t, ok)
+	assert.Equal(t, permission.Root, missing)
+}
+
+func TestOtherUserPermissionMissing(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedEmail := "seeduser1@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	id := mock.Seed("Seed User 1", seedEmail, seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	id2 := mock.Seed("Seed User 2", "seeduser2@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+
+	ctx := authContext(t, seedEmail, seedPassword)
+
+	// act
+	_, ownErr := myHandler.GetUserGroups(ctx, &handler.GroupRequest{UserId: id})
+	_, otherErr := myHandler.GetUserGroups(ctx, &handler.GroupRequest{UserId: id2})
+
+	// assert
+	assert.Nil(t, ownErr)
+	missing, ok := permission.Missing(otherErr)
+	assert.True(t, ok)
+	assert.Equal(t, permission.ViewAllUsers, missing)
+}
@@ -0,0 +1,162 @@
+package testing
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+
+	handler "github.com/softcorp-io/hqs-user-service/handler"
+	mock "github.com/softcorp-io/hqs-user-service/testdev/mock"
+	proto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+	"github.com/stretchr/testify/assert"
+)
+
+var myHandler *handler.Handler
+
+func TestMain(m *testing.M) {
+	handler, err := mock.NewHandler()
+	if err != nil {
+		mock.TearDownMongoDocker()
+		log.Fatalf("Could not setup handler: %v", err)
+	}
+
+	myHandler = handler
+
+	code := m.Run()
+
+	mock.TearDownMongoDocker()
+	os.Exit(code)
+}
+
+func tokenContext(token string) context.Context {
+	md := metadata.New(map[string]string{"token": token})
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+func authContext(t *testing.T, email string, password string) context.Context {
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    email,
+		Password: password,
+	})
+	assert.Equal(t, nil, err)
+	assert.NotEmpty(t, tokenResponse)
+
+	return tokenContext(tokenResponse.Token)
+}
+
+func TestPersonalAccessTokenLifecycle(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedOneEmail := "seeduser1@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	_ = mock.Seed("Seed User 1", seedOneEmail, seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	id2 := mock.Seed("Seed User 2", "seeduser2@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+
+	ctx := authContext(t, seedOneEmail, seedPassword)
+
+	// act
+	created, err := myHandler.CreatePersonalAccessToken(ctx, &handler.PersonalAccessTokenRequest{
+		Name:      "deploy script",
+		Scopes:    []string{"view_all_users"},
+		ExpiresIn: 3600,
+	})
+
+	// assert
+	assert.Nil(t, err)
+	assert.NotEmpty(t, created.Token)
+	assert.Equal(t, "deploy script", created.PersonalAccessToken.Name)
+
+	patCtx := tokenContext(created.Token)
+
+	userResponse, err := myHandler.Get(patCtx, &proto.User{Id: id2})
+	assert.Nil(t, err)
+	assert.Equal(t, id2, userResponse.User.Id)
+
+	// scopes restrict the token
+	_, err = myHandler.Delete(patCtx, &proto.User{Id: id2})
+	assert.Error(t, err)
+
+	// a personal access token cannot create another one
+	_, err = myHandler.CreatePersonalAccessToken(patCtx, &handler.PersonalAccessTokenRequest{
+		Name:      "nested",
+		Scopes:    []string{"view_all_users"},
+		ExpiresIn: 3600,
+	})
+	assert.Error(t, err)
+
+	// nor a token, which would outlive revoking it
+	_, err = myHandler.CreateScopedToken(patCtx, &handler.ScopedTokenRequest{Scopes: []string{"view_all_users"}})
+	assert.Error(t, err)
+
+	// use shows up in the auth history
+	history, err := myHandler.GetAuthHistory(ctx, &proto.Request{})
+	assert.Nil(t, err)
+	found := false
+	for _, auth := range history.AuthHistory {
+		if auth.TokenID == created.PersonalAccessToken.Id {
+			found = true
+			assert.Equal(t, "personalaccesstoken", auth.TypeOf)
+		}
+	}
+	assert.True(t, found)
+
+	tokens, err := myHandler.GetPersonalAccessTokens(ctx, &proto.Request{})
+	assert.Nil(t, err)
+	assert.Len(t, tokens.PersonalAccessTokens, 1)
+
+	// revoke
+	_, err = myHandler.RevokePersonalAccessToken(ctx, &handler.PersonalAccessTokenRequest{Id: created.PersonalAccessToken.Id})
+	assert.Nil(t, err)
+
+	_, err = myHandler.Get(patCtx, &proto.User{Id: id2})
+	assert.Error(t, err)
+}
+
+func TestPersonalAccessTokenScopeEscalation(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedOneEmail := "seeduser1@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	_ = mock.Seed("Seed User 1", seedOneEmail, "+45 88 88 88 88", seedPassword, true, true, true, false, true, true, false, false)
+
+	ctx := authContext(t, seedOneEmail, seedPassword)
+
+	// act
+	created, err := myHandler.CreatePersonalAccessToken(ctx, &handler.PersonalAccessTokenRequest{
+		Name:      "cleanup script",
+		Scopes:    []string{"delete_user"},
+		ExpiresIn: 3600,
+	})
+
+	// assert
+	assert.Error(t, err)
+	assert.Empty(t, created)
+}
+
+func TestPersonalAccessTokenExpiryTooLong(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedOneEmail := "seeduser1@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	_ = mock.Seed("Seed User 1", seedOneEmail, "+45 88 88 88 88", seedPassword, true, true, true, true, true, true, false, false)
+
+	ctx := authContext(t, seedOneEmail, seedPassword)
+
+	// act
+	_, err := myHandler.CreatePersonalAccessToken(ctx, &handler.PersonalAccessTokenRequest{
+		Name:      "forever",
+		Scopes:    []string{"view_all_users"},
+		ExpiresIn: int64((10 * 8760 * time.Hour).Seconds()),
+	})
+
+	// assert
+	assert.Error(t, err)
+}
@@ -0,0 +1,187 @@
+package testing
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+
+	handler "github.com/softcorp-io/hqs-user-service/handler"
+	mock "github.com/softcorp-io/hqs-user-service/testdev/mock"
+	proto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+	"github.com/stretchr/testify/assert"
+)
+
+var myHandler *handler.Handler
+
+func TestMain(m *testing.M) {
+	handler, err := mock.NewHandler()
+	if err != nil {
+		mock.TearDownMongoDocker()
+		log.Fatalf("Could not setup handler: %v", err)
+	}
+
+	myHandler = handler
+
+	code := m.Run()
+
+	mock.TearDownMongoDocker()
+	os.Exit(code)
+}
+
+func clientContext() context.Context {
+	md := metadata.New(map[string]string{"client_id": "hqs.test.service", "client_secret": "someverysecuresecret"})
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+func emailClientContext() context.Context {
+	md := metadata.New(map[string]string{"client_id": "hqs.email.service", "client_secret": "someotherverysecuresecret"})
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+func authContext(t *testing.T, email string, password string) context.Context {
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    email,
+		Password: password,
+	})
+	assert.Equal(t, nil, err)
+	assert.NotEmpty(t, tokenResponse)
+
+	md := metadata.New(map[string]string{"token": tokenResponse.Token})
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+func TestScopedTokenRestrictsPrivileges(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedOneEmail := "seeduser1@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	_ = mock.Seed("Seed User 1", seedOneEmail, seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	id2 := mock.Seed("Seed User 2", "seeduser2@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+
+	ctx := authContext(t, seedOneEmail, seedPassword)
+
+	// act
+	scopedToken, err := myHandler.CreateScopedToken(ctx, &handler.ScopedTokenRequest{
+		Scopes: []string{"view_all_users"},
+	})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, scopedToken.Token)
+
+	scopedCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	md := metadata.New(map[string]string{"token": scopedToken.Token})
+	scopedCtx = metadata.NewIncomingContext(scopedCtx, md)
+
+	// assert
+	userResponse, err := myHandler.Get(scopedCtx, &proto.User{Id: id2})
+	assert.Nil(t, err)
+	assert.Equal(t, id2, userResponse.User.Id)
+
+	_, err = myHandler.Delete(scopedCtx, &proto.User{Id: id2})
+	assert.Error(t, err)
+
+	validation, err := myHandler.ValidateToken(context.Background(), &proto.Token{Token: scopedToken.Token})
+	assert.Nil(t, err)
+	assert.True(t, validation.Valid)
+	assert.False(t, validation.ManagePrivileges)
+}
+
+func TestScopedTokenCannotEscalate(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedEmail := "seeduser@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	_ = mock.Seed("Seed User", seedEmail, "+45 88 88 88 88", seedPassword, true, false, false, false, false, false, false, false)
+
+	ctx := authContext(t, seedEmail, seedPassword)
+
+	// act
+	scopedToken, err := myHandler.CreateScopedToken(ctx, &handler.ScopedTokenRequest{
+		Scopes: []string{"view_all_users", "delete_user"},
+	})
+
+	// assert
+	assert.Error(t, err)
+	assert.Empty(t, scopedToken.Token)
+
+	scopedToken, err = myHandler.CreateScopedToken(ctx, &handler.ScopedTokenRequest{
+		Scopes: []string{"not_a_scope"},
+	})
+	assert.Error(t, err)
+	assert.Empty(t, scopedToken.Token)
+}
+
+func TestScopedTokenAudience(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedEmail := "seeduser@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	id := mock.Seed("Seed User", seedEmail, "+45 88 88 88 88", seedPassword, true, true, true, true, true, true, false, false)
+
+	ctx := authContext(t, seedEmail, seedPassword)
+
+	scopedToken, err := myHandler.CreateScopedToken(ctx, &handler.ScopedTokenRequest{
+		Scopes:   []string{"view_all_users"},
+		Audience: "hqs.test.service",
+	})
+	assert.Nil(t, err)
+
+	scopedCtx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"token": scopedToken.Token}))
+
+	// act
+	_, err = myHandler.GetByToken(scopedCtx, &proto.Request{})
+
+	// assert
+	assert.Error(t, err)
+
+	res, err := myHandler.ValidateTokens(clientContext(), &handler.ValidateTokensRequest{
+		Tokens:   []string{scopedToken.Token},
+		Audience: "hqs.test.service",
+	})
+	assert.Nil(t, err)
+	assert.True(t, res.Results[0].Valid)
+	assert.Equal(t, id, res.Results[0].UserID)
+	assert.Equal(t, "hqs.test.service", res.Results[0].Audience)
+
+	res, err = myHandler.ValidateTokens(clientContext(), &handler.ValidateTokensRequest{
+		Tokens: []string{scopedToken.Token},
+	})
+	assert.Nil(t, err)
+	assert.True(t, res.Results[0].Valid)
+
+	// the audience is the authenticated client, not one the caller chooses
+	_, err = myHandler.ValidateTokens(clientContext(), &handler.ValidateTokensRequest{
+		Tokens:   []string{scopedToken.Token},
+		Audience: "hqs.email.service",
+	})
+	assert.Error(t, err)
+
+	res, err = myHandler.ValidateTokens(emailClientContext(), &handler.ValidateTokensRequest{
+		Tokens: []string{scopedToken.Token},
+	})
+	assert.Nil(t, err)
+	assert.False(t, res.Results[0].Valid)
+
+	// a service validating a single token authenticates with its client credentials
+	_, err = myHandler.ValidateToken(context.Background(), &proto.Token{Token: scopedToken.Token})
+	assert.Error(t, err)
+
+	audienceCtx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"audience": "hqs.test.service"}))
+	_, err = myHandler.ValidateToken(audienceCtx, &proto.Token{Token: scopedToken.Token})
+	assert.Error(t, err)
+
+	_, err = myHandler.ValidateToken(emailClientContext(), &proto.Token{Token: scopedToken.Token})
+	assert.Error(t, err)
+
+	validation, err := myHandler.ValidateToken(clientContext(), &proto.Token{Token: scopedToken.Token})
+	assert.Nil(t, err)
+	assert.True(t, validation.Valid)
+}
@@ -0,0 +1,159 @@
+package testing
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+
+	handler "github.com/softcorp-io/hqs-user-service/handler"
+	mock "github.com/softcorp-io/hqs-user-service/testdev/mock"
+	proto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+	"github.com/stretchr/testify/assert"
+)
+
+var myHandler *handler.Handler
+
+func TestMain(m *testing.M) {
+	handler, err := mock.NewHandler()
+	if err != nil {
+		mock.TearDownMongoDocker()
+		log.Fatalf("Could not setup handler: %v", err)
+	}
+
+	myHandler = handler
+
+	code := m.Run()
+
+	mock.TearDownMongoDocker()
+	os.Exit(code)
+}
+
+func authContext(t *testing.T, email string, password string) context.Context {
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    email,
+		Password: password,
+	})
+	assert.Equal(t, nil, err)
+	assert.NotEmpty(t, tokenResponse)
+
+	md := metadata.New(map[string]string{"token": tokenResponse.Token})
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+func userIDs(users []*proto.User) []string {
+	ids := []string{}
+	for _, user := range users {
+		ids = append(ids, user.Id)
+	}
+	return ids
+}
+
+func TestSearchUsers(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	adminID := mock.Seed("Admin User", "admin@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	annaID := mock.Seed("Anna Jensen", "anna@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	jensID := mock.Seed("Jens Hansen", "jens@softcorp.io", "+45 12 34 56 78", seedPassword, false, false, false, false, false, false, false, false)
+	blockedID := mock.Seed("Anders Blocked", "anders@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, true, false)
+
+	ctx := authContext(t, "admin@softcorp.io", seedPassword)
+
+	// act
+	prefix, errPrefix := myHandler.SearchUsers(ctx, &handler.SearchUsersRequest{Term: "an"})
+	text, errText := myHandler.SearchUsers(ctx, &handler.SearchUsersRequest{Term: "jensen"})
+	phone, errPhone := myHandler.SearchUsers(ctx, &handler.SearchUsersRequest{Term: "12"})
+	blocked, errBlocked := myHandler.SearchUsers(ctx, &handler.SearchUsersRequest{Term: "an", IncludeBlocked: true})
+
+	// assert
+	assert.Nil(t, errPrefix)
+	assert.Equal(t, []string{annaID}, userIDs(prefix.Users))
+
+	assert.Nil(t, errText)
+	assert.Equal(t, []string{annaID}, userIDs(text.Users))
+
+	assert.Nil(t, errPhone)
+	assert.Equal(t, []string{jensID}, userIDs(phone.Users))
+
+	assert.Nil(t, errBlocked)
+	assert.Contains(t, userIDs(blocked.Users), blockedID)
+	assert.NotContains(t, userIDs(blocked.Users), adminID)
+	for _, user := range blocked.Users {
+		assert.Empty(t, user.Password)
+	}
+}
+
+func TestSearchUsersRanksAndPages(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	mock.Seed("Admin User", "admin@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	mock.Seed("Peter Olsen", "peter@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	olsenID := mock.Seed("Olsen Peter", "op@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+
+	ctx := authContext(t, "admin@softcorp.io", seedPassword)
+
+	// act
+	first, err := myHandler.SearchUsers(ctx, &handler.SearchUsersRequest{Term: "olsen", Limit: 1})
+	assert.Nil(t, err)
+	second, err := myHandler.SearchUsers(ctx, &handler.SearchUsersRequest{Term: "olsen", Offset: 1, Limit: 1})
+	assert.Nil(t, err)
+
+	// assert
+	// a name starting with the term ranks above a name only containing it
+	assert.Equal(t, []string{olsenID}, userIDs(first.Users))
+	assert.True(t, first.More)
+	assert.Equal(t, 1, len(second.Users))
+	assert.False(t, second.More)
+
+	// the term is required
+	_, err = myHandler.SearchUsers(ctx, &handler.SearchUsersRequest{})
+	assert.Error(t, err)
+}
+
+func TestSearchEncryptedUsers(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	mock.Seed("Admin User", "admin@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+
+	ctx := authContext(t, "admin@softcorp.io", seedPassword)
+
+	// seeded users are stored in clear text, so the user is created to encrypt the phone
+	createResponse, err := myHandler.Create(ctx, &proto.User{
+		Name:        "Jens Hansen",
+		Email:       "jens@softcorp.io",
+		Phone:       "+45 12 34 56 78",
+		Password:    seedPassword,
+		PrivilegeID: "someID",
+	})
+	assert.Nil(t, err)
+	jensID := createResponse.User.Id
+
+	// act
+	exact, errExact := myHandler.SearchUsers(ctx, &handler.SearchUsersRequest{Term: "+45 12 34 56 78"})
+	partial, errPartial := myHandler.SearchUsers(ctx, &handler.SearchUsersRequest{Term: "12"})
+
+	// assert
+	// the phone is encrypted, so it is empty in the database and only found by its blind index
+	stored := mock.GetStoredUser(jensID)
+	assert.Empty(t, stored["phone"])
+	assert.NotEmpty(t, stored["phone_index"])
+
+	assert.Nil(t, errExact)
+	if assert.Equal(t, []string{jensID}, userIDs(exact.Users)) {
+		assert.Equal(t, "+45 12 34 56 78", exact.Users[0].Phone)
+	}
+
+	assert.Nil(t, errPartial)
+	assert.Empty(t, partial.Users)
+}
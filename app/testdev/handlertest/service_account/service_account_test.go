@@ -0,0 +1,172 @@
+package testing
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+
+	handler "github.com/softcorp-io/hqs-user-service/handler"
+	mock "github.com/softcorp-io/hqs-user-service/testdev/mock"
+	proto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+	"github.com/stretchr/testify/assert"
+)
+
+var myHandler *handler.Handler
+
+func TestMain(m *testing.M) {
+	handler, err := mock.NewHandler()
+	if err != nil {
+		mock.TearDownMongoDocker()
+		log.Fatalf("Could not setup handler: %v", err)
+	}
+
+	myHandler = handler
+
+	code := m.Run()
+
+	mock.TearDownMongoDocker()
+	os.Exit(code)
+}
+
+func authContext(t *testing.T, email string, password string) context.Context {
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    email,
+		Password: password,
+	})
+	assert.Equal(t, nil, err)
+	assert.NotEmpty(t, tokenResponse)
+
+	md := metadata.New(map[string]string{"token": tokenResponse.Token})
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+func TestServiceAccountAPIKey(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedEmail := "seeduser@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	ownerID := mock.Seed("Seed User", seedEmail, seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	otherID := mock.Seed("Seed User 2", "seeduser2@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+
+	ctx := authContext(t, seedEmail, seedPassword)
+
+	owner, err := myHandler.GetByToken(ctx, &proto.Request{})
+	assert.Nil(t, err)
+
+	// act
+	serviceAccount, err := myHandler.CreateServiceAccount(ctx, &handler.ServiceAccountRequest{
+		Name:        "CI",
+		PrivilegeID: owner.User.PrivilegeID,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, ownerID, serviceAccount.ServiceAccount.OwnerID)
+
+	apiKey, err := myHandler.CreateAPIKey(ctx, &handler.APIKeyRequest{
+		ServiceAccountID: serviceAccount.ServiceAccount.Id,
+		Name:             "nightly build",
+	})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, apiKey.Key)
+
+	keyCtx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"api-key": apiKey.Key}))
+
+	// assert
+	userResponse, err := myHandler.Get(keyCtx, &proto.User{Id: otherID})
+	assert.Nil(t, err)
+	assert.Equal(t, otherID, userResponse.User.Id)
+
+	usersResponse, err := myHandler.GetAll(keyCtx, &proto.Request{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(usersResponse.Users))
+
+	// service accounts cannot turn their api keys into tokens
+	_, err = myHandler.CreateScopedToken(keyCtx, &handler.ScopedTokenRequest{Scopes: []string{"view_all_users"}})
+	assert.Error(t, err)
+
+	// service accounts cannot manage service accounts
+	_, err = myHandler.CreateServiceAccount(keyCtx, &handler.ServiceAccountRequest{
+		Name:        "Nested",
+		PrivilegeID: owner.User.PrivilegeID,
+	})
+	assert.Error(t, err)
+
+	apiKeys, err := myHandler.GetAPIKeys(ctx, &handler.APIKeyRequest{
+		ServiceAccountID: serviceAccount.ServiceAccount.Id,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(apiKeys.APIKeys))
+	assert.Equal(t, apiKey.APIKey.Prefix, apiKeys.APIKeys[0].Prefix)
+}
+
+func TestServiceAccountRevokeAPIKey(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedEmail := "seeduser@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	_ = mock.Seed("Seed User", seedEmail, "+45 88 88 88 88", seedPassword, true, true, true, true, true, true, false, false)
+
+	ctx := authContext(t, seedEmail, seedPassword)
+
+	owner, err := myHandler.GetByToken(ctx, &proto.Request{})
+	assert.Nil(t, err)
+
+	serviceAccount, err := myHandler.CreateServiceAccount(ctx, &handler.ServiceAccountRequest{
+		Name:        "CI",
+		PrivilegeID: owner.User.PrivilegeID,
+	})
+	assert.Nil(t, err)
+
+	apiKey, err := myHandler.CreateAPIKey(ctx, &handler.APIKeyRequest{
+		ServiceAccountID: serviceAccount.ServiceAccount.Id,
+		Name:             "nightly build",
+	})
+	assert.Nil(t, err)
+
+	// act
+	_, err = myHandler.RevokeAPIKey(ctx, &handler.APIKeyRequest{
+		ServiceAccountID: serviceAccount.ServiceAccount.Id,
+		Id:               apiKey.APIKey.Id,
+	})
+	assert.Nil(t, err)
+
+	// assert
+	keyCtx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"api-key": apiKey.Key}))
+	_, err = myHandler.GetByToken(keyCtx, &proto.Request{})
+	assert.Error(t, err)
+}
+
+func TestServiceAccountCannotLogin(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedEmail := "seeduser@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	_ = mock.Seed("Seed User", seedEmail, "+45 88 88 88 88", seedPassword, true, true, true, true, true, true, false, false)
+
+	ctx := authContext(t, seedEmail, seedPassword)
+
+	owner, err := myHandler.GetByToken(ctx, &proto.Request{})
+	assert.Nil(t, err)
+
+	_, err = myHandler.CreateServiceAccount(ctx, &handler.ServiceAccountRequest{
+		Name:        "CI",
+		PrivilegeID: owner.User.PrivilegeID,
+	})
+	assert.Nil(t, err)
+
+	// act
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    "",
+		Password: "",
+	})
+
+	// assert
+	assert.Error(t, err)
+	assert.Empty(t, tokenResponse.Token)
+}
@@ -11,7 +11,10 @@ import (
 	mock "github.com/softcorp-io/hqs-user-service/testdev/mock"
 	proto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 var myHandler *handler.Handler
@@ -172,3 +175,139 @@ func TestUpdateBlockedNotAllowed(t *testing.T) {
 	assert.Equal(t, nil, err)
 	assert.Equal(t, seedTwoBlocked, userResponse.User.Blocked)
 }
+
+func TestUpdateBlockedSelf(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedOneEmail := "seeduser1@softcorp.io"
+	seedOnePassword := "RandomPassword1234"
+	id1 := mock.Seed("Seed User 1", seedOneEmail, "+45 88 88 88 88", seedOnePassword, true, true, true, true, true, true, false, false)
+
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    seedOneEmail,
+		Password: seedOnePassword,
+	})
+	assert.Equal(t, err, nil)
+
+	// arrange
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	md := metadata.New(map[string]string{"token": tokenResponse.Token})
+	ctx = metadata.NewIncomingContext(ctx, md)
+
+	// act
+	userResponse, err := myHandler.UpdateBlockUser(ctx, &proto.User{
+		Blocked: true,
+		Id:      id1,
+	})
+
+	// assert
+	assert.Error(t, err)
+	assert.Empty(t, userResponse)
+}
+
+func TestUpdateBlockedHigherPrivilege(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedOneEmail := "seeduser1@softcorp.io"
+	seedOnePassword := "RandomPassword1234"
+	_ = mock.Seed("Seed User 1", seedOneEmail, "+45 88 88 88 88", seedOnePassword, true, false, false, false, true, false, false, false)
+	id2 := mock.Seed("Seed User 2", "seeduser2@softcorp.io", "+45 88 88 88 88", seedOnePassword, true, true, true, true, true, true, false, false)
+
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    seedOneEmail,
+		Password: seedOnePassword,
+	})
+	assert.Equal(t, err, nil)
+
+	// arrange
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	md := metadata.New(map[string]string{"token": tokenResponse.Token})
+	ctx = metadata.NewIncomingContext(ctx, md)
+
+	// act
+	userResponse, err := myHandler.UpdateBlockUser(ctx, &proto.User{
+		Blocked: true,
+		Id:      id2,
+	})
+
+	// assert
+	assert.Error(t, err)
+	assert.Empty(t, userResponse)
+}
+
+func TestUpdateBlockedVersion(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedOneEmail := "seeduser1@softcorp.io"
+	seedOnePassword := "RandomPassword1234"
+	_ = mock.Seed("Seed User 1", seedOneEmail, "+45 88 88 88 88", seedOnePassword, true, true, true, true, true, true, false, false)
+	id2 := mock.Seed("Seed User 2", "seeduser2@softcorp.io", "+45 88 88 88 88", seedOnePassword, true, false, false, false, false, false, false, false)
+
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    seedOneEmail,
+		Password: seedOnePassword,
+	})
+	assert.Equal(t, err, nil)
+
+	versionContext := func(version string) (context.Context, context.CancelFunc) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		md := metadata.New(map[string]string{"token": tokenResponse.Token, "expected-version": version})
+		return metadata.NewIncomingContext(ctx, md), cancel
+	}
+
+	// act - the seeded user is at version 0
+	ctx, cancel := versionContext("0")
+	defer cancel()
+	_, err = myHandler.UpdateBlockUser(ctx, &proto.User{
+		Blocked: true,
+		Id:      id2,
+	})
+	assert.Nil(t, err)
+
+	// act - a second update with the same version is stale
+	ctx, cancel = versionContext("0")
+	defer cancel()
+	userResponse, err := myHandler.UpdateBlockUser(ctx, &proto.User{
+		Blocked: false,
+		Id:      id2,
+	})
+
+	// assert
+	assert.Error(t, err)
+	assert.Empty(t, userResponse)
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	reason := ""
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			reason = info.Reason
+		}
+	}
+	assert.Equal(t, "VERSION_CONFLICT", reason)
+
+	// act - the current version is accepted
+	ctx, cancel = versionContext("1")
+	defer cancel()
+	_, err = myHandler.UpdateBlockUser(ctx, &proto.User{
+		Blocked: false,
+		Id:      id2,
+	})
+	assert.Nil(t, err)
+
+	getResponse, err := myHandler.Get(ctx, &proto.User{Id: id2})
+	assert.Nil(t, err)
+	assert.False(t, getResponse.User.Blocked)
+
+	// act - an invalid version is rejected
+	ctx, cancel = versionContext("abc")
+	defer cancel()
+	_, err = myHandler.UpdateBlockUser(ctx, &proto.User{
+		Blocked: true,
+		Id:      id2,
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -11,7 +11,9 @@ import (
 	mock "github.com/softcorp-io/hqs-user-service/testdev/mock"
 	proto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 var myHandler *handler.Handler
@@ -166,3 +168,44 @@ func TestUpdateAllowanceNotAllowed(t *testing.T) {
 	assert.Equal(t, nil, err)
 	assert.NotEqual(t, userResponse.User.PrivilegeID, newPrivID)
 }
+
+func TestUpdatePrivilegesVersion(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedOneEmail := "seeduser1@softcorp.io"
+	seedOnePassword := "RandomPassword1234"
+	_ = mock.Seed("Seed User 1", seedOneEmail, "+45 88 88 88 88", seedOnePassword, true, true, true, true, true, true, false, false)
+	id2 := mock.Seed("Seed User 2", "seeduser2@softcorp.io", "+45 88 88 88 88", seedOnePassword, false, false, false, false, false, false, false, false)
+
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    seedOneEmail,
+		Password: seedOnePassword,
+	})
+	assert.Equal(t, err, nil)
+
+	versionContext := func(version string) (context.Context, context.CancelFunc) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		md := metadata.New(map[string]string{"token": tokenResponse.Token, "expected-version": version})
+		return metadata.NewIncomingContext(ctx, md), cancel
+	}
+
+	// act - the seeded user is at version 0
+	ctx, cancel := versionContext("0")
+	defer cancel()
+	_, err = myHandler.UpdatePrivileges(ctx, &proto.User{Id: id2, PrivilegeID: "new id"})
+	assert.Nil(t, err)
+
+	// act - a second update with the same version is stale
+	ctx, cancel = versionContext("0")
+	defer cancel()
+	userResponse, err := myHandler.UpdatePrivileges(ctx, &proto.User{Id: id2, PrivilegeID: "other id"})
+
+	// assert
+	assert.Empty(t, userResponse)
+	assert.Equal(t, codes.Aborted, status.Code(err))
+
+	getResponse, err := myHandler.Get(ctx, &proto.User{Id: id2})
+	assert.Nil(t, err)
+	assert.Equal(t, "new id", getResponse.User.PrivilegeID)
+}
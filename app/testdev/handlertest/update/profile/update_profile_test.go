@@ -11,7 +11,9 @@ import (
 	mock "github.com/softcorp-io/hqs-user-service/testdev/mock"
 	proto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 var myHandler *handler.Handler
@@ -258,3 +260,50 @@ func TestUpdateProfileIllegalToken(t *testing.T) {
 	assert.Error(t, err)
 	assert.Empty(t, userResponse)
 }
+
+func TestUpdateProfileVersion(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedEmail := "seeduser@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	_ = mock.Seed("Seed User", seedEmail, "+45 88 88 88 88", seedPassword, true, true, true, true, true, true, false, false)
+
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    seedEmail,
+		Password: seedPassword,
+	})
+	assert.Equal(t, err, nil)
+
+	versionContext := func(version string) (context.Context, context.CancelFunc) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		md := metadata.New(map[string]string{"token": tokenResponse.Token, "expected-version": version})
+		return metadata.NewIncomingContext(ctx, md), cancel
+	}
+	update := &proto.User{
+		Name:  "Updated User",
+		Email: seedEmail,
+		Phone: "+45 88 88 88 88",
+	}
+
+	// act - the seeded user is at version 0
+	ctx, cancel := versionContext("0")
+	defer cancel()
+	_, err = myHandler.UpdateProfile(ctx, update)
+	assert.Nil(t, err)
+
+	// act - a second update with the same version is stale
+	ctx, cancel = versionContext("0")
+	defer cancel()
+	userResponse, err := myHandler.UpdateProfile(ctx, update)
+
+	// assert
+	assert.Empty(t, userResponse)
+	assert.Equal(t, codes.Aborted, status.Code(err))
+
+	// act - the current version is accepted
+	ctx, cancel = versionContext("1")
+	defer cancel()
+	_, err = myHandler.UpdateProfile(ctx, update)
+	assert.Nil(t, err)
+}
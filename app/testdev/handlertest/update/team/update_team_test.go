@@ -0,0 +1,78 @@
+package testing
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+
+	handler "github.com/softcorp-io/hqs-user-service/handler"
+	mock "github.com/softcorp-io/hqs-user-service/testdev/mock"
+	proto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+)
+
+var myHandler *handler.Handler
+
+func TestMain(m *testing.M) {
+	handler, err := mock.NewHandler()
+	if err != nil {
+		mock.TearDownMongoDocker()
+		log.Fatalf("Could not setup handler: %v", err)
+	}
+
+	myHandler = handler
+
+	code := m.Run()
+
+	mock.TearDownMongoDocker()
+	os.Exit(code)
+}
+
+func authContext(t *testing.T, email string, password string) context.Context {
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    email,
+		Password: password,
+	})
+	assert.Equal(t, nil, err)
+	assert.NotEmpty(t, tokenResponse)
+
+	md := metadata.New(map[string]string{"token": tokenResponse.Token})
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+func TestUpdateTeam(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedEmail := "seeduser1@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	_ = mock.Seed("Seed User 1", seedEmail, seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	id2 := mock.Seed("Seed User 2", "seeduser2@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+
+	// act
+	_, err := myHandler.UpdateTeam(authContext(t, seedEmail, seedPassword), &handler.TeamRequest{Id: id2, Team: "support"})
+
+	// assert
+	assert.Nil(t, err)
+	assert.Equal(t, "support", mock.GetStoredUser(id2)["team"])
+}
+
+func TestUpdateTeamSelf(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedEmail := "seeduser1@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	id := mock.Seed("Seed User 1", seedEmail, "+45 88 88 88 88", seedPassword, true, true, true, true, true, true, false, false)
+
+	// act
+	userResponse, err := myHandler.UpdateTeam(authContext(t, seedEmail, seedPassword), &handler.TeamRequest{Id: id, Team: "support"})
+
+	// assert
+	assert.Error(t, err)
+	assert.Empty(t, userResponse)
+	assert.Nil(t, mock.GetStoredUser(id)["team"])
+}
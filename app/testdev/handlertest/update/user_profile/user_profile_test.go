@@ -0,0 +1,150 @@
+package testing
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"google.golang.org/grpc/metadata"
+
+	handler "github.com/softcorp-io/hqs-user-service/handler"
+	permission "github.com/softcorp-io/hqs-user-service/permission"
+	mock "github.com/softcorp-io/hqs-user-service/testdev/mock"
+	proto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+	"github.com/stretchr/testify/assert"
+)
+
+var myHandler *handler.Handler
+
+func TestMain(m *testing.M) {
+	handler, err := mock.NewHandler()
+	if err != nil {
+		mock.TearDownMongoDocker()
+		log.Fatalf("Could not setup handler: %v", err)
+	}
+
+	myHandler = handler
+
+	code := m.Run()
+
+	mock.TearDownMongoDocker()
+	os.Exit(code)
+}
+
+func authContext(t *testing.T, email string, password string) context.Context {
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    email,
+		Password: password,
+	})
+	assert.Equal(t, nil, err)
+	assert.NotEmpty(t, tokenResponse)
+
+	md := metadata.New(map[string]string{"token": tokenResponse.Token})
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+func TestUpdateUserProfileAllowedFields(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	hrID := mock.Seed("HR User", "hr@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	mock.AssignPrivilege(hrID, "hr")
+	userID := mock.Seed("Seed User", "seeduser@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+
+	ctx := authContext(t, "hr@softcorp.io", seedPassword)
+
+	// act
+	userResponse, err := myHandler.UpdateUserProfile(ctx, &handler.UserProfileRequest{
+		User: &proto.User{
+			Id:          userID,
+			Title:       "Engineer",
+			Description: "Builds things",
+			Name:        "Ignored Name",
+		},
+		Fields: []string{"title", "description"},
+	})
+
+	// assert
+	assert.Nil(t, err)
+	assert.Equal(t, "Engineer", userResponse.User.Title)
+
+	// only the given fields are updated
+	userCtx := authContext(t, "seeduser@softcorp.io", seedPassword)
+	userResponse, err = myHandler.GetByToken(userCtx, &proto.Request{})
+	assert.Nil(t, err)
+	assert.Equal(t, "Engineer", userResponse.User.Title)
+	assert.Equal(t, "Builds things", userResponse.User.Description)
+	assert.Equal(t, "Seed User", userResponse.User.Name)
+	assert.Equal(t, "seeduser@softcorp.io", userResponse.User.Email)
+
+	// every updated field records who updated it
+	fieldUpdatedBy, ok := mock.GetStoredUser(userID)["field_updated_by"].(bson.M)
+	assert.True(t, ok)
+	assert.Equal(t, hrID, fieldUpdatedBy["title"])
+	assert.Equal(t, hrID, fieldUpdatedBy["description"])
+	assert.Nil(t, fieldUpdatedBy["name"])
+}
+
+func TestUpdateUserProfileForbiddenField(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	hrID := mock.Seed("HR User", "hr@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	mock.AssignPrivilege(hrID, "hr")
+	userID := mock.Seed("Seed User", "seeduser@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+
+	ctx := authContext(t, "hr@softcorp.io", seedPassword)
+
+	// act
+	_, err := myHandler.UpdateUserProfile(ctx, &handler.UserProfileRequest{
+		User: &proto.User{
+			Id:    userID,
+			Title: "Engineer",
+			Email: "hacked@softcorp.io",
+		},
+		Fields: []string{"title", "email"},
+	})
+
+	// assert
+	assert.Error(t, err)
+	missing, ok := permission.Missing(err)
+	assert.True(t, ok)
+	assert.Equal(t, permission.ProfileField("email"), missing)
+
+	// nothing is updated
+	userCtx := authContext(t, "seeduser@softcorp.io", seedPassword)
+	userResponse, err := myHandler.GetByToken(userCtx, &proto.Request{})
+	assert.Nil(t, err)
+	assert.Equal(t, "", userResponse.User.Title)
+	assert.Equal(t, "seeduser@softcorp.io", userResponse.User.Email)
+}
+
+func TestUpdateUserProfileWithoutPermission(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	mock.Seed("Other User", "other@softcorp.io", seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	userID := mock.Seed("Seed User", "seeduser@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+
+	ctx := authContext(t, "other@softcorp.io", seedPassword)
+
+	// act
+	_, err := myHandler.UpdateUserProfile(ctx, &handler.UserProfileRequest{
+		User:   &proto.User{Id: userID, Title: "Engineer"},
+		Fields: []string{"title"},
+	})
+
+	// assert
+	assert.Error(t, err)
+	missing, ok := permission.Missing(err)
+	assert.True(t, ok)
+	assert.Equal(t, permission.UpdateUserProfile, missing)
+}
@@ -11,6 +11,9 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	mock "github.com/softcorp-io/hqs-user-service/testdev/mock"
 	proto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
@@ -111,3 +114,105 @@ func TestUploadImage(t *testing.T) {
 	assert.Nil(t, err)
 	assert.True(t, resp.Size > 0)
 }
+
+func uploadImage(t *testing.T, ctx context.Context, token string) (*proto.UploadImageResponse, metadata.MD, error) {
+	stream, err := myClient.UploadImage(ctx)
+	assert.Nil(t, err)
+
+	err = stream.Send(&proto.UploadImageRequest{
+		Data: &proto.UploadImageRequest_Token{
+			Token: token,
+		},
+	})
+	assert.Nil(t, err)
+
+	file, err := os.Open("invincible.jpg")
+	assert.Nil(t, err)
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	buffer := make([]byte, 1024)
+
+	for {
+		n, err := reader.Read(buffer)
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+
+		// the server might already have failed the stream, which is reported by CloseAndRecv
+		if err := stream.Send(&proto.UploadImageRequest{
+			Data: &proto.UploadImageRequest_ChunkData{
+				ChunkData: buffer[:n],
+			},
+		}); err != nil {
+			break
+		}
+	}
+
+	resp, err := stream.CloseAndRecv()
+	header, _ := stream.Header()
+	return resp, header, err
+}
+
+func TestUploadImageVersion(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedEmail := "seeduser@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	id := mock.Seed("Seed User", seedEmail, "+45 88 88 88 88", seedPassword, true, true, true, true, true, true, false, false)
+
+	tokenResponse, err := myClient.Auth(context.Background(), &proto.User{
+		Email:    seedEmail,
+		Password: seedPassword,
+	})
+	assert.Nil(t, err)
+
+	// act - the seeded user is at version 0, and the new version is sent in the header
+	resp, header, err := uploadImage(t, metadata.AppendToOutgoingContext(context.Background(), "expected-version", "0"), tokenResponse.Token)
+
+	// assert
+	assert.Nil(t, err)
+	assert.True(t, resp.Size > 0)
+	assert.Equal(t, []string{"1"}, header.Get("version"))
+
+	// act - a second upload with the same version is stale
+	_, _, err = uploadImage(t, metadata.AppendToOutgoingContext(context.Background(), "expected-version", "0"), tokenResponse.Token)
+
+	// assert - the stored image is still the first one, and the stale upload is not kept
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	stored := mock.GetStoredObjects("hqs/users/" + id)
+	assert.Len(t, stored, 1)
+	for path := range stored {
+		assert.Equal(t, path, mock.GetStoredUser(id)["image"])
+	}
+}
+
+func TestUpdateProfileVersionHeader(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedEmail := "seeduser@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	_ = mock.Seed("Seed User", seedEmail, "+45 88 88 88 88", seedPassword, true, true, true, true, true, true, false, false)
+
+	tokenResponse, err := myClient.Auth(context.Background(), &proto.User{
+		Email:    seedEmail,
+		Password: seedPassword,
+	})
+	assert.Nil(t, err)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "token", tokenResponse.Token, "expected-version", "0")
+
+	// act
+	var header metadata.MD
+	_, err = myClient.UpdateProfile(ctx, &proto.User{
+		Name:  "Updated User",
+		Email: seedEmail,
+		Phone: "+45 88 88 88 88",
+	}, grpc.Header(&header))
+
+	// assert
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1"}, header.Get("version"))
+}
@@ -0,0 +1,185 @@
+package testing
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+
+	handler "github.com/softcorp-io/hqs-user-service/handler"
+	mock "github.com/softcorp-io/hqs-user-service/testdev/mock"
+	proto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
+	"github.com/stretchr/testify/assert"
+)
+
+var myHandler *handler.Handler
+
+func TestMain(m *testing.M) {
+	handler, err := mock.NewHandler()
+	if err != nil {
+		mock.TearDownMongoDocker()
+		log.Fatalf("Could not setup handler: %v", err)
+	}
+
+	myHandler = handler
+
+	code := m.Run()
+
+	mock.TearDownMongoDocker()
+	os.Exit(code)
+}
+
+func clientContext(secret string) context.Context {
+	md := metadata.New(map[string]string{"client_id": "hqs.test.service", "client_secret": secret})
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+func TestValidateTokens(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedOneEmail := "seeduser1@softcorp.io"
+	seedTwoEmail := "seeduser2@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+
+	id1 := mock.Seed("Seed User 1", seedOneEmail, seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+	id2 := mock.Seed("Seed User 2", seedTwoEmail, seedPhone, seedPassword, true, true, false, true, true, true, false, false)
+
+	ctx := context.Background()
+
+	tokenOne, err := myHandler.Auth(ctx, &proto.User{
+		Email:    seedOneEmail,
+		Password: seedPassword,
+	})
+	assert.Equal(t, nil, err)
+
+	tokenTwo, err := myHandler.Auth(ctx, &proto.User{
+		Email:    seedTwoEmail,
+		Password: seedPassword,
+	})
+	assert.Equal(t, nil, err)
+
+	// block the second token
+	blockCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	md := metadata.New(map[string]string{"token": tokenTwo.Token})
+	blockCtx = metadata.NewIncomingContext(blockCtx, md)
+	tokenThree, err := myHandler.Auth(ctx, &proto.User{
+		Email:    seedTwoEmail,
+		Password: seedPassword,
+	})
+	assert.Equal(t, nil, err)
+	_, err = myHandler.BlockToken(blockCtx, &proto.Token{Token: tokenTwo.Token})
+	assert.Equal(t, nil, err)
+
+	// act
+	res, err := myHandler.ValidateTokens(clientContext("someverysecuresecret"), &handler.ValidateTokensRequest{
+		Tokens: []string{tokenOne.Token, tokenTwo.Token, "some invalid token", tokenThree.Token},
+	})
+
+	// assert
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(res.Results))
+
+	assert.True(t, res.Results[0].Valid)
+	assert.Equal(t, id1, res.Results[0].UserID)
+	assert.True(t, res.Results[0].ManagePrivileges)
+
+	assert.False(t, res.Results[1].Valid)
+	assert.NotEmpty(t, res.Results[1].Error)
+
+	assert.False(t, res.Results[2].Valid)
+	assert.NotEmpty(t, res.Results[2].Error)
+
+	assert.True(t, res.Results[3].Valid)
+	assert.Equal(t, id2, res.Results[3].UserID)
+	assert.False(t, res.Results[3].ManagePrivileges)
+}
+
+func TestValidateTokensDuplicateToken(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedEmail := "seeduser@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+
+	_ = mock.Seed("Seed User", seedEmail, seedPhone, seedPassword, true, true, true, true, true, true, false, false)
+
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    seedEmail,
+		Password: seedPassword,
+	})
+	assert.Equal(t, nil, err)
+
+	// act
+	res, err := myHandler.ValidateTokens(clientContext("someverysecuresecret"), &handler.ValidateTokensRequest{
+		Tokens: []string{tokenResponse.Token, tokenResponse.Token},
+	})
+
+	// assert
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(res.Results))
+	assert.True(t, res.Results[0].Valid)
+	assert.True(t, res.Results[1].Valid)
+}
+
+func TestValidateTokensUnknownClient(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedEmail := "seeduser@softcorp.io"
+	seedPassword := "RandomPassword1234"
+	_ = mock.Seed("Seed User", seedEmail, "+45 88 88 88 88", seedPassword, true, true, true, true, true, true, false, false)
+
+	tokenResponse, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    seedEmail,
+		Password: seedPassword,
+	})
+	assert.Equal(t, nil, err)
+
+	// act
+	res, err := myHandler.ValidateTokens(clientContext("wrongsecret"), &handler.ValidateTokensRequest{
+		Tokens: []string{tokenResponse.Token},
+	})
+
+	// assert
+	assert.Error(t, err)
+	assert.Empty(t, res.Results)
+}
+
+func TestValidateTokensRevokedImpersonator(t *testing.T) {
+	// configure
+	mock.TruncateUsers()
+
+	seedPassword := "RandomPassword1234"
+	seedPhone := "+45 88 88 88 88"
+	supportID := mock.Seed("Support User", "support@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+	mock.AssignPrivilege(supportID, "support")
+	subjectID := mock.Seed("Seed User", "seeduser@softcorp.io", seedPhone, seedPassword, false, false, false, false, false, false, false, false)
+
+	supportToken, err := myHandler.Auth(context.Background(), &proto.User{
+		Email:    "support@softcorp.io",
+		Password: seedPassword,
+	})
+	assert.Equal(t, nil, err)
+	md := metadata.New(map[string]string{"token": supportToken.Token})
+	impersonation, err := myHandler.Impersonate(metadata.NewIncomingContext(context.Background(), md), &proto.User{Id: subjectID})
+	assert.Nil(t, err)
+
+	// act
+	mock.AssignPrivilege(supportID, "default")
+	res, err := myHandler.ValidateTokens(clientContext("someverysecuresecret"), &handler.ValidateTokensRequest{
+		Tokens: []string{impersonation.Token},
+	})
+
+	// assert
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(res.Results))
+	assert.False(t, res.Results[0].Valid)
+	assert.Equal(t, "Invalid impersonator", res.Results[0].Error)
+}
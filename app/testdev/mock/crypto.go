@@ -23,10 +23,11 @@ func GetCrypto() (*crypto.TokenService, *mongo.Collection, *mongo.Collection, er
 	os.Setenv("SIGNUP_TOKEN_TTL", "5s")
 	os.Setenv("RESET_PASS_TTL", "5s")
 	os.Setenv("EMAIL_SIGNUP_LINK_BASE", "https://hqs.softcorp.io/signup/")
+	os.Setenv("SERVICE_CLIENTS", "hqs.test.service:someverysecuresecret")
 
 	zapLog, _ := zap.NewProduction()
 
-	tokenService, err := crypto.NewTokenService(mongoAuthCollection, mongoTokenCollection, zapLog)
+	tokenService, err := crypto.NewTokenService(mongoAuthCollection, mongoTokenCollection, mongoAPIKeyCollection, mongoPersonalTokenCollection, nil, zapLog)
 	if err != nil {
 		return nil, nil, nil, err
 	}
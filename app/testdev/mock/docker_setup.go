@@ -13,12 +13,20 @@ import (
 	"github.com/ory/dockertest"
 	"github.com/ory/dockertest/docker"
 	database "github.com/softcorp-io/hqs-user-service/database"
+	repository "github.com/softcorp-io/hqs-user-service/repository"
 )
 
 // stub database
 var mongoUserCollection *mongo.Collection
 var mongoTokenCollection *mongo.Collection
 var mongoAuthCollection *mongo.Collection
+var mongoAPIKeyCollection *mongo.Collection
+var mongoPersonalTokenCollection *mongo.Collection
+var mongoOrganizationCollection *mongo.Collection
+var mongoGroupCollection *mongo.Collection
+var mongoAuditCollection *mongo.Collection
+var mongoCheckpointCollection *mongo.Collection
+var mongoDataKeyCollection *mongo.Collection
 var mongoDatabase *mongo.Database
 
 // docker container info
@@ -93,6 +101,13 @@ func SetupDockerMongo() error {
 		mongoUserCollection = client.Database("hqs-user").Collection("users")
 		mongoTokenCollection = client.Database("hqs-user").Collection("auth_history")
 		mongoAuthCollection = client.Database("hqs-user").Collection("token_history")
+		mongoAPIKeyCollection = client.Database("hqs-user").Collection("api_keys")
+		mongoPersonalTokenCollection = client.Database("hqs-user").Collection("personal_tokens")
+		mongoOrganizationCollection = client.Database("hqs-user").Collection("organizations")
+		mongoGroupCollection = client.Database("hqs-user").Collection("groups")
+		mongoAuditCollection = client.Database("hqs-user").Collection("audit")
+		mongoCheckpointCollection = client.Database("hqs-user").Collection("audit_checkpoints")
+		mongoDataKeyCollection = client.Database("hqs-user").Collection("data_keys")
 		return err
 	}); err != nil {
 		_ = TearDownMongoDocker()
@@ -124,6 +139,32 @@ func TruncateUsers() {
 	if err := mongoAuthCollection.Drop(context.Background()); err != nil {
 		log.Fatal("Could not delete auth collection")
 	}
+	if err := mongoAPIKeyCollection.Drop(context.Background()); err != nil {
+		log.Fatal("Could not delete api key collection")
+	}
+	if err := mongoPersonalTokenCollection.Drop(context.Background()); err != nil {
+		log.Fatal("Could not delete personal tokens collection")
+	}
+	if err := mongoOrganizationCollection.Drop(context.Background()); err != nil {
+		log.Fatal("Could not delete organization collection")
+	}
+	if err := mongoGroupCollection.Drop(context.Background()); err != nil {
+		log.Fatal("Could not delete group collection")
+	}
+	if err := mongoAuditCollection.Drop(context.Background()); err != nil {
+		log.Fatal("Could not delete audit collection")
+	}
+	if err := mongoCheckpointCollection.Drop(context.Background()); err != nil {
+		log.Fatal("Could not delete audit checkpoint collection")
+	}
+
+	// the search index is dropped with the users. The data keys are kept, like the envelope caches them.
+	if err := repository.NewRepository(mongoUserCollection, nil).CreateIndexes(context.Background()); err != nil {
+		log.Fatal("Could not create user indexes")
+	}
+	if err := repository.NewAuditRepository(mongoAuditCollection, mongoCheckpointCollection).CreateIndexes(context.Background()); err != nil {
+		log.Fatal("Could not create audit indexes")
+	}
 }
 
 func getMongoUserCollection() *mongo.Collection {
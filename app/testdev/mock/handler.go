@@ -3,8 +3,13 @@ package mock
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"errors"
+	"io/ioutil"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	uuid "github.com/satori/go.uuid"
@@ -12,6 +17,8 @@ import (
 
 	crypto "github.com/softcorp-io/hqs-user-service/crypto"
 	handler "github.com/softcorp-io/hqs-user-service/handler"
+	permission "github.com/softcorp-io/hqs-user-service/permission"
+	policy "github.com/softcorp-io/hqs-user-service/policy"
 	repository "github.com/softcorp-io/hqs-user-service/repository"
 	emailProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_email_service"
 	privilegeProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_privilege_service"
@@ -37,7 +44,77 @@ type storageMock struct {
 	mock.Mock
 }
 
+// failStorageDeletes - makes the storage mock fail every delete
+var failStorageDeletes bool
+
+// FailStorageDeletes - makes the storage fail every delete, or work again
+func FailStorageDeletes(fail bool) {
+	failStorageDeletes = fail
+}
+
+// failingAudit - an audit log, which fails every append while failAuditAppends is set
+type failingAudit struct {
+	repository.AuditRepository
+}
+
+// failAuditAppends - makes the audit log mock fail every append
+var failAuditAppends bool
+
+// FailAuditAppends - makes the audit log fail every append, or work again
+func FailAuditAppends(fail bool) {
+	failAuditAppends = fail
+}
+
+// Append - appends the entry, unless appends fail
+func (a *failingAudit) Append(ctx context.Context, entry *repository.AuditEntry) error {
+	if failAuditAppends {
+		return errors.New("Audit log is down")
+	}
+	return a.AuditRepository.Append(ctx, entry)
+}
+
+// storedObject - a file uploaded to the storage mock
+type storedObject struct {
+	contentType string
+	uploadedAt  time.Time
+}
+
+// storedObjects - the files uploaded to the storage mock by path
+var storedObjects = map[string]*storedObject{}
+var storedObjectsMu sync.Mutex
+
+// GetStoredObjects - returns the content types of the files in the storage, whose path starts with prefix
+func GetStoredObjects(prefix string) map[string]string {
+	storedObjectsMu.Lock()
+	defer storedObjectsMu.Unlock()
+	objects := map[string]string{}
+	for path, object := range storedObjects {
+		if strings.HasPrefix(path, prefix) {
+			objects[path] = object.contentType
+		}
+	}
+	return objects
+}
+
+// AgeStoredObjects - makes the files in the storage, whose path starts with prefix, look uploaded age ago
+func AgeStoredObjects(prefix string, age time.Duration) {
+	storedObjectsMu.Lock()
+	defer storedObjectsMu.Unlock()
+	for path, object := range storedObjects {
+		if strings.HasPrefix(path, prefix) {
+			object.uploadedAt = time.Now().Add(-age)
+		}
+	}
+}
+
 func (m *storageMock) Upload(data bytes.Buffer, filepath string, allowedTypes ...string) error {
+	storedObjectsMu.Lock()
+	defer storedObjectsMu.Unlock()
+	contentType := ""
+	if len(allowedTypes) > 0 {
+		contentType = allowedTypes[0]
+	}
+	storedObjects[filepath] = &storedObject{contentType: contentType, uploadedAt: time.Now()}
 	return nil
 }
 
@@ -45,10 +122,32 @@ func (m *storageMock) Get(path string, duration time.Duration) (string, error) {
 	return "some image", nil
 }
 
+func (m *storageMock) Download(path string) (bytes.Buffer, error) {
+	return *bytes.NewBufferString("some image"), nil
+}
+
 func (m *storageMock) Delete(path string) error {
+	if failStorageDeletes {
+		return errors.New("storage is unavailable")
+	}
+	storedObjectsMu.Lock()
+	defer storedObjectsMu.Unlock()
+	delete(storedObjects, path)
 	return nil
 }
 
+func (m *storageMock) List(prefix string) (map[string]time.Time, error) {
+	storedObjectsMu.Lock()
+	defer storedObjectsMu.Unlock()
+	files := map[string]time.Time{}
+	for path, object := range storedObjects {
+		if strings.HasPrefix(path, prefix) {
+			files[path] = object.uploadedAt
+		}
+	}
+	return files, nil
+}
+
 // privilege client mock
 type privilegeClientMock struct {
 	privileges map[string]*privilegeProto.Privilege
@@ -126,6 +225,28 @@ func (pc *privilegeClientMock) Delete(ctx context.Context, req *privilegeProto.P
 	return nil, nil
 }
 
+// masterKey - the master key of the envelope, s.t. the tests can store values like older versions of the service
+var masterKey []byte
+
+// newEnvelope - returns an envelope, whose master key is written to a temporary file.
+func newEnvelope(zapLog *zap.Logger) (*crypto.Envelope, error) {
+	masterKey = make([]byte, 32)
+	if _, err := rand.Read(masterKey); err != nil {
+		return nil, err
+	}
+	masterKeyFile, err := ioutil.TempFile("", "hqs-master-key")
+	if err != nil {
+		return nil, err
+	}
+	defer masterKeyFile.Close()
+	if _, err := masterKeyFile.WriteString(base64.StdEncoding.EncodeToString(masterKey)); err != nil {
+		return nil, err
+	}
+	os.Setenv("ENCRYPTION_MASTER_KEY_FILE", masterKeyFile.Name())
+
+	return crypto.NewEnvelope(mongoDataKeyCollection, zapLog)
+}
+
 // NewHandler - Returns a new handler & uses docker conainer for postgres database.
 func NewHandler() (*handler.Handler, error) {
 	err := SetupDockerMongo()
@@ -139,6 +260,7 @@ func NewHandler() (*handler.Handler, error) {
 	storageMock.On("Upload", mock.Anything).Return(nil)
 	storageMock.On("Get", mock.Anything).Return("some image", nil)
 	storageMock.On("Delete", mock.Anything).Return(nil)
+	storageMock.On("Download", mock.Anything).Return(bytes.Buffer{}, nil)
 
 	emailClientMock := new(emailClientMock)
 	emailClientMock.On("SendResetPasswordEmail", mock.Anything).Return(nil, nil)
@@ -154,16 +276,46 @@ func NewHandler() (*handler.Handler, error) {
 	os.Setenv("SIGNUP_TOKEN_TTL", "20s")
 	os.Setenv("RESET_PASS_TTL", "20s")
 	os.Setenv("EMAIL_SIGNUP_LINK_BASE", "https://hqs.softcorp.io/signup/")
+	os.Setenv("SERVICE_CLIENTS", "hqs.test.service:someverysecuresecret,hqs.email.service:someotherverysecuresecret")
+	os.Setenv("IMPERSONATION_PRIVILEGE_IDS", "support")
+	os.Setenv("PRIVILEGE_PERMISSIONS", "auditor:impersonate|view_audit_log,hr:update_user_profile|profile_title|profile_description,groups:manage_groups,dpo:erase_user|export_user_data")
+	os.Setenv("TOKEN_GROUP_CLAIMS", "true")
+	os.Setenv("USER_DELETION_GRACE_PERIOD", "1h")
+	os.Setenv("AUDIT_CHECKPOINT_SIGNING_KEY", "c29tZXZlcnlzZWN1cmVrZXlzb21ldmVyeXNlY3VyZWs=")
 
 	zapLog, _ := zap.NewProduction()
 
-	repo := repository.NewRepository(mongoUserCollection)
-	tokenService, err := crypto.NewTokenService(mongoAuthCollection, mongoTokenCollection, zapLog)
+	envelope, err := newEnvelope(zapLog)
+	if err != nil {
+		return nil, err
+	}
+
+	repo := repository.NewRepository(mongoUserCollection, envelope)
+	if err := repo.CreateIndexes(context.Background()); err != nil {
+		return nil, err
+	}
+	organizations := repository.NewOrganizationRepository(mongoOrganizationCollection)
+	groups := repository.NewGroupRepository(mongoGroupCollection)
+	audit := repository.NewAuditRepository(mongoAuditCollection, mongoCheckpointCollection)
+	if err := audit.CreateIndexes(context.Background()); err != nil {
+		return nil, err
+	}
+	tokenService, err := crypto.NewTokenService(mongoAuthCollection, mongoTokenCollection, mongoAPIKeyCollection, mongoPersonalTokenCollection, envelope, zapLog)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := permission.NewRegistry(repository.ProfileFields)
+	if err != nil {
+		return nil, err
+	}
+
+	userPolicy, err := policy.NewPolicy()
 	if err != nil {
 		return nil, err
 	}
 
-	resultHandler := handler.NewHandler(repo, storageMock, tokenService, emailClientMock, pcMock, zapLog)
+	resultHandler := handler.NewHandler(repo, organizations, groups, &failingAudit{audit}, storageMock, tokenService, emailClientMock, pcMock, permissions, userPolicy, zapLog)
 
 	return resultHandler, nil
 }
@@ -2,12 +2,18 @@ package mock
 
 import (
 	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
 	"log"
 	"time"
 
+	crypto "github.com/softcorp-io/hqs-user-service/crypto"
 	repository "github.com/softcorp-io/hqs-user-service/repository"
 	privilegeProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_privilege_service"
 	"github.com/twinj/uuid"
+	"go.mongodb.org/mongo-driver/bson"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -61,3 +67,128 @@ func Seed(name string, email string, phone string, password string, viewAllUsers
 
 	return id
 }
+
+// AssignPrivilege - gives a seeded user another privilege id, eg. one from the env.
+func AssignPrivilege(userID string, privilegeID string) {
+	_, err := mongoUserCollection.UpdateOne(context.Background(), bson.M{"id": userID}, bson.M{"$set": bson.M{"privilege_id": privilegeID}})
+	if err != nil {
+		_ = TearDownMongoDocker()
+		log.Fatal("Could not assign privilege")
+	}
+}
+
+// MakeRoot - turns a seeded user into the root user, who is in no organization.
+func MakeRoot(userID string) {
+	_, err := mongoUserCollection.UpdateOne(context.Background(), bson.M{"id": userID}, bson.M{"$set": bson.M{"admin": true}})
+	if err != nil {
+		_ = TearDownMongoDocker()
+		log.Fatal("Could not make root")
+	}
+}
+
+// TamperAuditEntry - changes a field of the audit entry with sequence, like someone with access to the database.
+func TamperAuditEntry(sequence int64, field string, value interface{}) {
+	_, err := mongoAuditCollection.UpdateOne(context.Background(), bson.M{"sequence": sequence}, bson.M{"$set": bson.M{field: value}})
+	if err != nil {
+		_ = TearDownMongoDocker()
+		log.Fatal("Could not tamper with audit entry")
+	}
+}
+
+// TamperStoredUser - changes a field of the stored user with id, like someone with access to the database.
+func TamperStoredUser(id string, field string, value interface{}) {
+	_, err := mongoUserCollection.UpdateOne(context.Background(), bson.M{"id": id}, bson.M{"$set": bson.M{field: value}})
+	if err != nil {
+		_ = TearDownMongoDocker()
+		log.Fatal("Could not tamper with user")
+	}
+}
+
+// sealHelper - encrypts plaintext with key like the envelope, with the nonce in front of the ciphertext
+func sealHelper(key []byte, plaintext []byte, additionalData []byte) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		_ = TearDownMongoDocker()
+		log.Fatal("Could not create cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		_ = TearDownMongoDocker()
+		log.Fatal("Could not create cipher")
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		_ = TearDownMongoDocker()
+		log.Fatal("Could not create nonce")
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData)
+}
+
+// SeedSharedKeyValue - stores a field of the user with id encrypted with a new shared key, like the service
+// did before users had keys of their own. Returns the id of the shared key.
+func SeedSharedKeyValue(id string, field string, value string) string {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		_ = TearDownMongoDocker()
+		log.Fatal("Could not create shared key")
+	}
+	dataKey := &crypto.DataKey{
+		ID:        uuid.NewV4().String(),
+		CreatedAt: time.Now(),
+	}
+	// the id is authenticated with the key, like the envelope does
+	dataKey.WrappedKey = sealHelper(masterKey, key, []byte(dataKey.ID))
+	if _, err := mongoDataKeyCollection.InsertOne(context.Background(), dataKey); err != nil {
+		_ = TearDownMongoDocker()
+		log.Fatal("Could not store shared key")
+	}
+
+	ciphertext := dataKey.ID + ":" + base64.RawStdEncoding.EncodeToString(sealHelper(key, []byte(value), []byte(field)))
+	TamperStoredUser(id, "encrypted."+field, ciphertext)
+	TamperStoredUser(id, field, "")
+	return dataKey.ID
+}
+
+// RemoveAuditEntry - removes the audit entry with sequence, like someone with access to the database.
+func RemoveAuditEntry(sequence int64) {
+	_, err := mongoAuditCollection.DeleteOne(context.Background(), bson.M{"sequence": sequence})
+	if err != nil {
+		_ = TearDownMongoDocker()
+		log.Fatal("Could not remove audit entry")
+	}
+}
+
+// GetStoredUser - returns the user with id as it is stored in the database.
+func GetStoredUser(id string) bson.M {
+	stored := bson.M{}
+	if err := mongoUserCollection.FindOne(context.Background(), bson.M{"id": id}).Decode(&stored); err != nil {
+		_ = TearDownMongoDocker()
+		log.Fatal("Could not get stored user")
+	}
+	return stored
+}
+
+// GetStoredAuthHistory - returns the auth history of the user with id as it is stored in the database.
+func GetStoredAuthHistory(userID string) []bson.M {
+	stored := []bson.M{}
+	cursor, err := mongoAuthCollection.Find(context.Background(), bson.M{"user_id": userID})
+	if err != nil {
+		_ = TearDownMongoDocker()
+		log.Fatal("Could not get stored auth history")
+	}
+	if err := cursor.All(context.Background(), &stored); err != nil {
+		_ = TearDownMongoDocker()
+		log.Fatal("Could not get stored auth history")
+	}
+	return stored
+}
+
+// CountDataKeys - returns how many data keys the user with id has in the database.
+func CountDataKeys(userID string) int64 {
+	count, err := mongoDataKeyCollection.CountDocuments(context.Background(), bson.M{"user_id": userID})
+	if err != nil {
+		_ = TearDownMongoDocker()
+		log.Fatal("Could not count data keys")
+	}
+	return count
+}
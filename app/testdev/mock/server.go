@@ -6,6 +6,7 @@ import (
 	"net"
 	"sync"
 
+	handler "github.com/softcorp-io/hqs-user-service/handler"
 	proto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_user_service"
 
 	"google.golang.org/grpc"
@@ -13,26 +14,33 @@ import (
 
 // RunServer - runs the hqs-user microservice
 func RunServer(wg *sync.WaitGroup) {
+	RunServerOnPort(wg, "9091")
+}
+
+// RunServerOnPort - runs the hqs-user microservice on port, so test packages running at the same
+// time each get their own server
+func RunServerOnPort(wg *sync.WaitGroup, port string) {
 	// create the service and run the service
-	lis, err := net.Listen("tcp", ":9091")
+	lis, err := net.Listen("tcp", ":"+port)
 	if err != nil {
 		log.Fatal(fmt.Sprintf("Failed to listen with err %v", err))
 	}
 
-	log.Printf("Service running on port: %s", "9091")
+	log.Printf("Service running on port: %s", port)
 
 	// setup grpc
 
 	grpcServer := grpc.NewServer()
 
-	handler, err := NewHandler()
+	handle, err := NewHandler()
 	if err != nil {
 		TearDownMongoDocker()
 		log.Fatal(fmt.Sprintf("Failed to get handler with err %v", err))
 	}
 	wg.Done()
 	// register handler
-	proto.RegisterUserServiceServer(grpcServer, handler)
+	proto.RegisterUserServiceServer(grpcServer, handle)
+	grpcServer.RegisterService(&handler.ExtensionServiceDesc, handle)
 	// run the server
 	if err := grpcServer.Serve(lis); err != nil {
 		TearDownMongoDocker()
@@ -0,0 +1,154 @@
+package testing
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	policy "github.com/softcorp-io/hqs-user-service/policy"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var allPermissions = []string{"block_user", "create_user", "delete_user", "manage_privileges", "send_reset_password_email", "view_all_users"}
+
+func defaultPolicy(t *testing.T) *policy.Policy {
+	os.Unsetenv("POLICY_FILE")
+	p, err := policy.NewPolicy()
+	assert.Nil(t, err)
+	return p
+}
+
+func assertDeniedBy(t *testing.T, err error, rule string) {
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	name, ok := policy.RuleOf(err)
+	assert.True(t, ok)
+	assert.Equal(t, rule, name)
+}
+
+func TestNoHigherPrivilege(t *testing.T) {
+	p := defaultPolicy(t)
+
+	req := &policy.Request{
+		Action: "Delete",
+		Actor:  policy.Subject{ID: "actor", Permissions: []string{"delete_user"}},
+		Target: policy.Subject{ID: "target", Permissions: []string{"delete_user", "manage_privileges"}},
+	}
+	assertDeniedBy(t, p.Evaluate(req), "no_higher_privilege")
+
+	req.Target.Permissions = []string{"delete_user"}
+	assert.Nil(t, p.Evaluate(req))
+
+	// root is not bound by the rule
+	req.Target.Permissions = allPermissions
+	req.Actor.Admin = true
+	assert.Nil(t, p.Evaluate(req))
+}
+
+func TestNoPrivilegeEscalation(t *testing.T) {
+	p := defaultPolicy(t)
+
+	req := &policy.Request{
+		Action:      "UpdatePrivileges",
+		Actor:       policy.Subject{ID: "actor", Permissions: []string{"manage_privileges"}},
+		Target:      policy.Subject{ID: "target"},
+		Permissions: []string{"manage_privileges", "delete_user"},
+	}
+	assertDeniedBy(t, p.Evaluate(req), "no_privilege_escalation")
+
+	req.Permissions = []string{"manage_privileges"}
+	assert.Nil(t, p.Evaluate(req))
+}
+
+func TestOwnTeam(t *testing.T) {
+	p := defaultPolicy(t)
+
+	req := &policy.Request{
+		Action: "UpdateBlockUser",
+		Actor:  policy.Subject{ID: "actor", Team: "support", Permissions: allPermissions},
+		Target: policy.Subject{ID: "target", Team: "sales"},
+	}
+	assertDeniedBy(t, p.Evaluate(req), "own_team")
+
+	req.Target.Team = "support"
+	assert.Nil(t, p.Evaluate(req))
+}
+
+func TestOwnTeamWithoutTeam(t *testing.T) {
+	p := defaultPolicy(t)
+
+	// users without a team are in the same team
+	req := &policy.Request{
+		Action: "UpdateTeam",
+		Actor:  policy.Subject{ID: "actor", Permissions: allPermissions},
+		Target: policy.Subject{ID: "target"},
+	}
+	assert.Nil(t, p.Evaluate(req))
+
+	// but not in the team of anyone else
+	req.Target.Team = "sales"
+	assertDeniedBy(t, p.Evaluate(req), "own_team")
+
+	req.Target.Team = ""
+	req.Actor.Team = "sales"
+	assertDeniedBy(t, p.Evaluate(req), "own_team")
+}
+
+func TestNotSelf(t *testing.T) {
+	p := defaultPolicy(t)
+
+	req := &policy.Request{
+		Action: "UpdateBlockUser",
+		Actor:  policy.Subject{ID: "actor", Admin: true, Permissions: allPermissions},
+		Target: policy.Subject{ID: "actor", Permissions: allPermissions},
+	}
+	assertDeniedBy(t, p.Evaluate(req), "not_self")
+
+	req.Action = "UpdateTeam"
+	assertDeniedBy(t, p.Evaluate(req), "not_self")
+
+	// the rule is only about blocking, the status and the team
+	req.Action = "UpdateManager"
+	assert.Nil(t, p.Evaluate(req))
+}
+
+func TestPolicyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "policy.json")
+	err = ioutil.WriteFile(path, []byte(`{"rules": [{"name": "no_deletes", "actions": ["Delete"], "require": {"left": "actor.admin", "operator": "equals", "right": "true"}}]}`), 0600)
+	assert.Nil(t, err)
+
+	os.Setenv("POLICY_FILE", path)
+	defer os.Unsetenv("POLICY_FILE")
+
+	p, err := policy.NewPolicy()
+	assert.Nil(t, err)
+
+	req := &policy.Request{
+		Action: "Delete",
+		Actor:  policy.Subject{ID: "actor", Permissions: allPermissions},
+		Target: policy.Subject{ID: "target"},
+	}
+	assertDeniedBy(t, p.Evaluate(req), "no_deletes")
+
+	// the default rules are replaced by the file
+	req.Action = "UpdateBlockUser"
+	req.Target.ID = "actor"
+	assert.Nil(t, p.Evaluate(req))
+}
+
+func TestInvalidPolicy(t *testing.T) {
+	_, err := policy.Parse([]byte(`{"rules": [{"name": "bad", "actions": ["Delete"], "require": {"left": "actor.salary", "operator": "equals", "right": "1"}}]}`))
+	assert.Error(t, err)
+
+	_, err = policy.Parse([]byte(`{"rules": [{"name": "bad", "actions": ["Delete"], "require": {"left": "actor.id", "operator": "greater", "right": "1"}}]}`))
+	assert.Error(t, err)
+
+	_, err = policy.Parse([]byte(`{"rules": [{"name": "bad", "require": {"left": "actor.id", "operator": "equals", "right": "1"}}]}`))
+	assert.Error(t, err)
+}
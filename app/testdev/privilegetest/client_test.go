@@ -0,0 +1,220 @@
+package testing
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	privilege "github.com/softcorp-io/hqs-user-service/privilege"
+	privilegeProto "github.com/softcorp-io/hqs_proto/go_hqs/hqs_privilege_service"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeClient - a privilege service which fails the next failures calls
+type fakeClient struct {
+	mu       sync.Mutex
+	calls    int
+	failures int
+	err      error
+	delay    time.Duration
+}
+
+func (f *fakeClient) Get(ctx context.Context, in *privilegeProto.Privilege, opts ...grpc.CallOption) (*privilegeProto.Response, error) {
+	f.mu.Lock()
+	f.calls++
+	fail := f.failures > 0
+	if fail {
+		f.failures--
+	}
+	f.mu.Unlock()
+
+	if f.delay > 0 {
+		select {
+		case <-time.After(f.delay):
+		case <-ctx.Done():
+			return nil, status.Error(codes.DeadlineExceeded, ctx.Err().Error())
+		}
+	}
+	if fail {
+		return nil, f.err
+	}
+	return &privilegeProto.Response{Privilege: &privilegeProto.Privilege{Id: in.Id, ViewAllUsers: true}}, nil
+}
+
+func (f *fakeClient) fail(failures int, err error) {
+	f.mu.Lock()
+	f.failures = failures
+	f.err = err
+	f.mu.Unlock()
+}
+
+func (f *fakeClient) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func (f *fakeClient) Ping(ctx context.Context, in *privilegeProto.Request, opts ...grpc.CallOption) (*privilegeProto.Response, error) {
+	return &privilegeProto.Response{}, nil
+}
+
+func (f *fakeClient) Create(ctx context.Context, in *privilegeProto.Privilege, opts ...grpc.CallOption) (*privilegeProto.Response, error) {
+	return &privilegeProto.Response{Privilege: in}, nil
+}
+
+func (f *fakeClient) Update(ctx context.Context, in *privilegeProto.Privilege, opts ...grpc.CallOption) (*privilegeProto.Response, error) {
+	return &privilegeProto.Response{Privilege: in}, nil
+}
+
+func (f *fakeClient) GetDefault(ctx context.Context, in *privilegeProto.Request, opts ...grpc.CallOption) (*privilegeProto.Response, error) {
+	return &privilegeProto.Response{}, nil
+}
+
+func (f *fakeClient) GetRoot(ctx context.Context, in *privilegeProto.Request, opts ...grpc.CallOption) (*privilegeProto.Response, error) {
+	return &privilegeProto.Response{}, nil
+}
+
+func (f *fakeClient) GetAll(ctx context.Context, in *privilegeProto.Request, opts ...grpc.CallOption) (*privilegeProto.Response, error) {
+	return &privilegeProto.Response{}, nil
+}
+
+func (f *fakeClient) Delete(ctx context.Context, in *privilegeProto.Privilege, opts ...grpc.CallOption) (*privilegeProto.Response, error) {
+	return &privilegeProto.Response{}, nil
+}
+
+var unavailable = status.Error(codes.Unavailable, "connection refused")
+
+func testConfig() privilege.Config {
+	return privilege.Config{
+		CacheTTL:         50 * time.Millisecond,
+		CallTimeout:      20 * time.Millisecond,
+		MaxRetries:       2,
+		RetryBaseDelay:   time.Millisecond,
+		BreakerThreshold: 2,
+		BreakerCooldown:  100 * time.Millisecond,
+		ServeStale:       true,
+	}
+}
+
+func newClient(config privilege.Config) (*privilege.Client, *fakeClient) {
+	fake := &fakeClient{}
+	return privilege.NewClient(fake, config, zap.NewNop()), fake
+}
+
+func TestCache(t *testing.T) {
+	client, fake := newClient(testConfig())
+
+	for i := 0; i < 3; i++ {
+		res, err := client.Get(context.Background(), &privilegeProto.Privilege{Id: "privilege"})
+		assert.Nil(t, err)
+		assert.Equal(t, "privilege", res.Privilege.Id)
+	}
+	assert.Equal(t, 1, fake.callCount())
+	assert.Equal(t, int64(2), client.Metrics.CacheHits.Value())
+	assert.Equal(t, int64(1), client.Metrics.CacheMisses.Value())
+
+	// the cache expires
+	time.Sleep(60 * time.Millisecond)
+	_, err := client.Get(context.Background(), &privilegeProto.Privilege{Id: "privilege"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, fake.callCount())
+
+	// updates invalidate the cache
+	_, err = client.Update(context.Background(), &privilegeProto.Privilege{Id: "privilege"})
+	assert.Nil(t, err)
+	_, err = client.Get(context.Background(), &privilegeProto.Privilege{Id: "privilege"})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, fake.callCount())
+}
+
+func TestRetry(t *testing.T) {
+	client, fake := newClient(testConfig())
+	fake.fail(2, unavailable)
+
+	res, err := client.Get(context.Background(), &privilegeProto.Privilege{Id: "privilege"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "privilege", res.Privilege.Id)
+	assert.Equal(t, 3, fake.callCount())
+	assert.Equal(t, int64(2), client.Metrics.Retries.Value())
+}
+
+func TestNoRetryOnRequestErrors(t *testing.T) {
+	client, fake := newClient(testConfig())
+	fake.fail(1, errors.New("No id in privilege"))
+
+	_, err := client.Get(context.Background(), &privilegeProto.Privilege{Id: "privilege"})
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, fake.callCount())
+}
+
+func TestCallDeadline(t *testing.T) {
+	config := testConfig()
+	config.MaxRetries = 0
+	client, fake := newClient(config)
+	fake.delay = time.Second
+
+	start := time.Now()
+	_, err := client.Get(context.Background(), &privilegeProto.Privilege{Id: "privilege"})
+
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+}
+
+func TestBreakerServesStale(t *testing.T) {
+	client, fake := newClient(testConfig())
+
+	_, err := client.Get(context.Background(), &privilegeProto.Privilege{Id: "privilege"})
+	assert.Nil(t, err)
+	time.Sleep(60 * time.Millisecond)
+
+	// the privilege service goes down
+	fake.fail(100, unavailable)
+	for i := 0; i < 2; i++ {
+		res, err := client.Get(context.Background(), &privilegeProto.Privilege{Id: "privilege"})
+		assert.Nil(t, err)
+		assert.True(t, res.Privilege.ViewAllUsers)
+	}
+	assert.Equal(t, int64(1), client.Metrics.BreakerOpen.Value())
+
+	// the breaker is open, so the privilege service is not called
+	calls := fake.callCount()
+	res, err := client.Get(context.Background(), &privilegeProto.Privilege{Id: "privilege"})
+	assert.Nil(t, err)
+	assert.Equal(t, "privilege", res.Privilege.Id)
+	assert.Equal(t, calls, fake.callCount())
+	assert.Equal(t, int64(1), client.Metrics.Rejected.Value())
+	assert.Equal(t, int64(3), client.Metrics.StaleServed.Value())
+
+	// after the cooldown one call is let through, and closes the breaker again
+	fake.fail(0, nil)
+	time.Sleep(110 * time.Millisecond)
+	_, err = client.Get(context.Background(), &privilegeProto.Privilege{Id: "privilege"})
+	assert.Nil(t, err)
+	assert.Equal(t, calls+1, fake.callCount())
+}
+
+func TestBreakerFailsClosed(t *testing.T) {
+	config := testConfig()
+	config.ServeStale = false
+	client, fake := newClient(config)
+
+	_, err := client.Get(context.Background(), &privilegeProto.Privilege{Id: "privilege"})
+	assert.Nil(t, err)
+	time.Sleep(60 * time.Millisecond)
+
+	fake.fail(100, unavailable)
+	for i := 0; i < 3; i++ {
+		_, err := client.Get(context.Background(), &privilegeProto.Privilege{Id: "privilege"})
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+	}
+	assert.Equal(t, int64(0), client.Metrics.StaleServed.Value())
+	assert.Equal(t, int64(1), client.Metrics.Rejected.Value())
+}
@@ -427,3 +427,35 @@ func TestSetLatitudeLongitude(t *testing.T) {
 	err = myService.DeleteUserAuthHistory(context.Background(), &user)
 	assert.Nil(t, err)
 }
+
+func TestAddPersonalAccessTokenToHistory(t *testing.T) {
+	// arrange
+	user := proto.User{
+		Name:  "Test User",
+		Email: "testuser@softcorp.io",
+		Id:    "some-pat-user-id",
+	}
+	token, personalToken, err := myService.CreatePersonalAccessToken(context.Background(), user.Id, "script", []string{"view_all_users"}, time.Hour)
+	assert.Nil(t, err)
+
+	// act
+	errFirst := myService.AddAuthToHistory(context.Background(), &user, token, "personalaccesstoken", nil)
+	errSecond := myService.AddAuthToHistory(context.Background(), &user, token, "personalaccesstoken", nil)
+	errOtherUser := myService.AddAuthToHistory(context.Background(), &proto.User{Id: "some-other-user-id"}, token, "personalaccesstoken", nil)
+	tokenHistory, err := myService.GetAuthHistory(context.Background(), &user)
+
+	// assert
+	assert.Nil(t, errFirst)
+	assert.Nil(t, errSecond)
+	assert.Error(t, errOtherUser)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(tokenHistory))
+	assert.Equal(t, personalToken.ID, tokenHistory[0].TokenID)
+	assert.Equal(t, "personalaccesstoken", tokenHistory[0].TypeOf)
+
+	// clean up
+	assert.Nil(t, myService.BlockToken(context.Background(), personalToken.ID))
+	tokenHistory, err = myService.GetAuthHistory(context.Background(), &user)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(tokenHistory))
+}